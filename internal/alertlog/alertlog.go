@@ -0,0 +1,65 @@
+package alertlog
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// DefaultMaxSize is the size at which the alert log is rotated when Init is
+// given no limit.
+const DefaultMaxSize = 10 << 20
+
+var (
+	logPath string
+	maxSize int64
+	mu      sync.Mutex
+)
+
+// Entry is one alert as written to the log.
+type Entry struct {
+	ID         int64  `json:"id"`
+	Timestamp  int64  `json:"timestamp"`
+	Severity   string `json:"severity"`
+	SourceType string `json:"source_type"`
+	SourceID   string `json:"source_id"`
+	Subject    string `json:"subject"`
+	Message    string `json:"message"`
+}
+
+// Init sets the alert log path (alerts.log_file; empty disables it) and the
+// size in bytes past which it is rotated to <path>.1.
+func Init(path string, maxSizeBytes int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	logPath = path
+	maxSize = maxSizeBytes
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+}
+
+// Write appends an alert to the log as one NDJSON line if the log is enabled.
+func Write(e Entry) {
+	mu.Lock()
+	defer mu.Unlock()
+	if logPath == "" {
+		return
+	}
+
+	// Rotate by size, keeping a single previous file
+	if info, err := os.Stat(logPath); err == nil && info.Size() >= maxSize {
+		_ = os.Rename(logPath, logPath+".1")
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		// Silently fail - the alert is still stored and notified
+		return
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(e)
+}
@@ -1,25 +1,50 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/metabinary-ltd/storagesentinel/internal/collectors"
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/discovery"
+	"github.com/metabinary-ltd/storagesentinel/internal/events"
+	"github.com/metabinary-ltd/storagesentinel/internal/scheduler"
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
 
 func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("/health", s.handleHealth)
+	s.mux.HandleFunc("/livez", s.handleHealth)
+	s.mux.HandleFunc("/readyz", s.handleReady)
 	s.mux.HandleFunc("/api/v1/summary", s.wrapAuth(s.handleSummary))
 	s.mux.HandleFunc("/api/v1/disks", s.wrapAuth(s.handleDisks))
+	s.mux.HandleFunc("/api/v1/disks/", s.wrapAuth(s.handleDisks))
 	s.mux.HandleFunc("/api/v1/pools", s.wrapAuth(s.handlePools))
 	s.mux.HandleFunc("/api/v1/alerts", s.wrapAuth(s.handleAlerts))
+	s.mux.HandleFunc("/api/v1/alerts/", s.wrapAuth(s.handleAlerts))
+	s.mux.HandleFunc("/api/v1/events", s.wrapAuth(s.handleEvents))
 	s.mux.HandleFunc("/api/v1/collect/smart", s.wrapAuth(s.handleCollectSmart))
 	s.mux.HandleFunc("/api/v1/collect/nvme", s.wrapAuth(s.handleCollectNvme))
 	s.mux.HandleFunc("/api/v1/collect/zfs", s.wrapAuth(s.handleCollectZfs))
 	s.mux.HandleFunc("/api/v1/notifications/queue", s.wrapAuth(s.handleNotificationQueue))
 	s.mux.HandleFunc("/api/v1/pools/", s.wrapAuth(s.handlePoolRoutes))
+	s.mux.HandleFunc("/api/v1/schedules/refresh", s.wrapAuth(s.handleRefreshSchedules))
+	s.mux.HandleFunc("/api/v1/commands/history", s.wrapAuth(s.handleCommandHistory))
+	s.mux.HandleFunc("/api/v1/diagnostics", s.wrapAuth(s.handleDiagnostics))
+	s.mux.HandleFunc("/api/v1/diagnostics/breakers/reset", s.wrapAuth(s.handleResetBreaker))
 }
 
 func (s *Server) wrapAuth(next http.HandlerFunc) http.HandlerFunc {
@@ -27,7 +52,7 @@ func (s *Server) wrapAuth(next http.HandlerFunc) http.HandlerFunc {
 		if s.authToken != "" && !strings.HasPrefix(r.URL.Path, "/health") {
 			auth := r.Header.Get("Authorization")
 			if auth != "Bearer "+s.authToken {
-				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				writeError(w, http.StatusUnauthorized, "unauthorized")
 				return
 			}
 		}
@@ -39,72 +64,653 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// handleReady is the readiness probe: unlike /health and /livez, which only
+// show the process is up, it fails until the database answers and the first
+// discovery and collection passes have completed.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.Ping(r.Context()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, "database unavailable: "+err.Error())
+		return
+	}
+	if s.triggers.Ready != nil && !s.triggers.Ready() {
+		writeError(w, http.StatusServiceUnavailable, "initial collection not complete")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
 func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
 	report, err := s.health.Summary(r.Context())
 	if err != nil {
 		s.logger.Error("failed to build summary", "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
-	writeJSON(w, http.StatusOK, report)
+	for i := range report.Disks {
+		s.applyDisplayUnits(&report.Disks[i])
+	}
+	// Alerts are evaluated afresh for every request and stamped with the
+	// evaluation time. Leave the stamps out of the ETag so it only changes
+	// when the report does.
+	key := report
+	key.Alerts = slices.Clone(report.Alerts)
+	for i := range key.Alerts {
+		key.Alerts[i].Timestamp = 0
+	}
+	writeJSONWithETag(w, r, report, key)
+}
+
+// applyDisplayUnits adds the Fahrenheit reading when the API is configured
+// to display it. Celsius stays canonical in storage and rules.
+func (s *Server) applyDisplayUnits(h *types.DiskHealth) {
+	if s.cfg.DisplayUnits == "fahrenheit" && h.TemperatureC != 0 {
+		h.TemperatureF = math.Round(config.CelsiusToFahrenheit(h.TemperatureC)*10) / 10
+	}
 }
 
 func (s *Server) handleDisks(w http.ResponseWriter, r *http.Request) {
+	id, action := diskRouteFromRequest(r)
+	if action != "" {
+		if id == "" {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		switch action {
+		case "locate":
+			s.handleDiskLocate(w, r, id)
+		case "replay":
+			s.handleDiskReplay(w, r, id)
+		case "ack-hardware":
+			s.handleDiskAckHardware(w, r, id)
+		case "timeseries":
+			s.handleDiskTimeSeries(w, r, id)
+		}
+		return
+	}
+
+	if r.Method == http.MethodDelete && id != "" {
+		s.handleDiskDelete(w, r, id)
+		return
+	}
 	if r.Method != http.MethodGet {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	if r.URL.Path == "/api/v1/disks/unpooled" {
+		s.handleUnpooledDisks(w, r)
+		return
+	}
+	if r.URL.Path == "/api/v1/disks/latest" {
+		s.handleDisksLatest(w, r)
+		return
+	}
+	// detail route: /api/v1/disks/{id} or /api/v1/disks?id={id}
+	if id != "" {
+		s.handleDiskDetail(w, r, id)
+		return
+	}
+
+	disks, err := s.store.ListDisks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
 		return
 	}
-	// detail route: /api/v1/disks/{id}
-	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/disks"), "/")
-	if len(parts) > 1 && parts[1] != "" {
-		id := strings.TrimPrefix(r.URL.Path, "/api/v1/disks/")
-		disk, _ := s.store.GetDisk(r.Context(), id)
-		if disk == nil {
-			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	writeCacheableJSON(w, r, disks)
+}
+
+func (s *Server) handleDiskDetail(w http.ResponseWriter, r *http.Request, id string) {
+	disk, _ := s.lookupDisk(r.Context(), id)
+	if disk == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	historyLimit := defaultDiskHistory
+	if v := r.URL.Query().Get("history"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			historyLimit = min(n, maxDiskHistory)
+		}
+	}
+	// ?at=<unixts> reports the disk as of a past time: "latest" becomes the
+	// newest snapshot taken at or before then, and "health" is evaluated
+	// against it.
+	var at int64
+	if v := r.URL.Query().Get("at"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "at must be a positive unix timestamp")
 			return
 		}
-		resp := map[string]interface{}{
-			"disk": disk,
+		at = n
+	}
+	// ?history_cursor= continues the history from a previous response's
+	// history_next token.
+	historyAfter, ok := cursorParam(w, r, "history_cursor")
+	if !ok {
+		return
+	}
+	resp := map[string]interface{}{
+		"disk": disk,
+	}
+	if at > 0 {
+		resp["at"] = at
+	}
+	if disk.Type == "nvme" {
+		hist, _ := s.store.NvmeHistoryAfter(r.Context(), disk.ID, historyAfter, historyLimit)
+		resp["history"] = hist
+		if len(hist) == historyLimit {
+			last := hist[len(hist)-1]
+			resp["history_next"] = storage.Cursor{Timestamp: last.Timestamp, ID: last.ID}.Token()
+		}
+		var latest *storage.NvmeSnapshot
+		if at > 0 {
+			latest, _ = s.store.NvmeAt(r.Context(), disk.ID, at)
+		} else {
+			latest, _ = s.store.LatestNvme(r.Context(), disk.ID)
+		}
+		resp["latest"] = latest
+	} else {
+		hist, _ := s.store.SmartHistoryAfter(r.Context(), disk.ID, historyAfter, historyLimit)
+		resp["history"] = hist
+		if len(hist) == historyLimit {
+			last := hist[len(hist)-1]
+			resp["history_next"] = storage.Cursor{Timestamp: last.Timestamp, ID: last.ID}.Token()
 		}
-		if disk.Type == "nvme" {
-			hist, _ := s.store.NvmeHistory(r.Context(), id, 10)
-			resp["history"] = hist
+		var latest *storage.SmartSnapshot
+		if at > 0 {
+			latest, _ = s.store.SmartAt(r.Context(), disk.ID, at)
 		} else {
-			hist, _ := s.store.SmartHistory(r.Context(), id, 10)
-			resp["history"] = hist
+			latest, _ = s.store.LatestSmart(r.Context(), disk.ID)
 		}
-		writeJSON(w, http.StatusOK, resp)
-		return
+		resp["latest"] = latest
+	}
+
+	pools, err := s.store.GetDiskPoolMembership(r.Context(), disk.ID)
+	if err != nil {
+		s.logger.Warn("failed to load pool membership", "disk", disk.ID, "error", err)
+	}
+	if pools == nil {
+		pools = []storage.PoolMembership{}
+	}
+	resp["pools"] = pools
+	if role := diskRole(*disk, pools); role != "" {
+		resp["role"] = role
+	}
+
+	if eval, ok := s.health.(diskEvaluator); ok {
+		dh := eval.DiskHealthAt(r.Context(), *disk, at)
+		s.applyDisplayUnits(&dh)
+		resp["health"] = dh
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// diskRole is what a disk is used for: "system" for the disk holding /, as
+// in its health, otherwise its role in its pool (data, log, cache, spare...).
+func diskRole(d storage.Disk, pools []storage.PoolMembership) string {
+	if root := discovery.RootDisk(); root != "" && d.Name == root {
+		return "system"
+	}
+	if len(pools) > 0 {
+		return pools[0].Role
+	}
+	return ""
+}
+
+// handleUnpooledDisks lists disks that belong to no ZFS pool. On a ZFS host a
+// data drive outside every pool is usually a forgotten spare or a
+// misconfiguration. ?exclude_boot=true drops the disk holding /.
+func (s *Server) handleUnpooledDisks(w http.ResponseWriter, r *http.Request) {
+	excludeBoot := false
+	if v := r.URL.Query().Get("exclude_boot"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "exclude_boot must be true or false")
+			return
+		}
+		excludeBoot = b
+	}
+	boot := ""
+	if excludeBoot {
+		boot = discovery.RootDisk()
 	}
 
 	disks, err := s.store.ListDisks(r.Context())
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal"})
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	unpooled := []storage.Disk{}
+	for _, d := range disks {
+		if boot != "" && d.Name == boot {
+			continue
+		}
+		pools, err := s.store.GetDiskPoolMembership(r.Context(), d.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal")
+			return
+		}
+		if len(pools) == 0 {
+			unpooled = append(unpooled, d)
+		}
+	}
+	writeJSON(w, http.StatusOK, unpooled)
+}
+
+// diskLatest is one entry of /api/v1/disks/latest.
+type diskLatest struct {
+	Disk   storage.Disk      `json:"disk"`
+	Latest any               `json:"latest"` // *storage.SmartSnapshot or *storage.NvmeSnapshot
+	Health *types.DiskHealth `json:"health,omitempty"`
+}
+
+// handleDisksLatest returns every disk with its newest SMART/NVMe reading
+// and health, so a dashboard needs one call instead of one detail call per
+// disk. Readings come from two batched queries, and health is evaluated from
+// them (the newest two per disk) without persisting alerts.
+func (s *Server) handleDisksLatest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	disks, err := s.store.ListDisks(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	// The previous reading too: health compares it with the newest.
+	smart, err := s.store.LatestSmartByDisk(ctx, 2)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	nvme, err := s.store.LatestNvmeByDisk(ctx, 2)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	eval, _ := s.health.(diskEvaluator)
+
+	resp := make([]diskLatest, 0, len(disks))
+	for _, d := range disks {
+		entry := diskLatest{Disk: d}
+		if d.Type == "nvme" {
+			if hist := nvme[d.ID]; len(hist) > 0 {
+				entry.Latest = &hist[0]
+			}
+		} else if hist := smart[d.ID]; len(hist) > 0 {
+			entry.Latest = &hist[0]
+		}
+		if eval != nil {
+			h := eval.DiskHealthFrom(ctx, d, smart[d.ID], nvme[d.ID])
+			s.applyDisplayUnits(&h)
+			entry.Health = &h
+		}
+		resp = append(resp, entry)
+	}
+	writeCacheableJSON(w, r, resp)
+}
+
+// diskEvaluator is implemented by health providers that can evaluate a
+// single disk on demand, optionally as of a past Unix time (0 = now) or from
+// snapshots the caller already loaded.
+type diskEvaluator interface {
+	DiskHealthAt(ctx context.Context, d storage.Disk, at int64) types.DiskHealth
+	DiskHealthFrom(ctx context.Context, d storage.Disk, smart []storage.SmartSnapshot, nvme []storage.NvmeSnapshot) types.DiskHealth
+}
+
+// handleDiskAckHardware acknowledges a known-bad disk (e.g. awaiting RMA).
+// POST records the disk's current error counters as a baseline; its
+// hardware-error alerts are then held until a counter grows past it. DELETE
+// removes the acknowledgement.
+func (s *Server) handleDiskAckHardware(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	disk, _ := s.lookupDisk(r.Context(), id)
+	if disk == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.store.ClearHardwareAck(r.Context(), disk.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "cleared", "disk_id": disk.ID})
+		return
+	}
+
+	var baseline storage.HardwareBaseline
+	if disk.Type == "nvme" {
+		snap, _ := s.store.LatestNvme(r.Context(), disk.ID)
+		if snap == nil {
+			writeError(w, http.StatusConflict, "no readings to acknowledge yet")
+			return
+		}
+		baseline = storage.NvmeBaseline(*snap)
+	} else {
+		snap, _ := s.store.LatestSmart(r.Context(), disk.ID)
+		if snap == nil {
+			writeError(w, http.StatusConflict, "no readings to acknowledge yet")
+			return
+		}
+		baseline = storage.SmartBaseline(*snap)
+	}
+	if err := s.store.SetHardwareAck(r.Context(), baseline); err != nil {
+		s.logger.Error("failed to acknowledge disk hardware", "disk", disk.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	baseline.AckedAt = time.Now().Unix()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "acknowledged",
+		"baseline": baseline,
+	})
+}
+
+// handleDiskDelete forgets a permanently removed disk along with its history
+// (DELETE /api/v1/disks/{id}). A disk still seen by discovery is refused
+// unless ?force=true, as it would simply be re-added on the next pass.
+func (s *Server) handleDiskDelete(w http.ResponseWriter, r *http.Request, id string) {
+	disk, _ := s.lookupDisk(r.Context(), id)
+	if disk == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.URL.Query().Get("force") != "true" {
+		known, err := s.store.ListDisks(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal")
+			return
+		}
+		if discovery.Present(known)[disk.ID] {
+			writeError(w, http.StatusConflict, "disk is currently present; use ?force=true to delete it anyway")
+			return
+		}
+	}
+	if _, err := s.store.DeleteDisk(r.Context(), disk.ID); err != nil {
+		s.logger.Error("failed to delete disk", "disk", disk.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "deleted", "disk_id": disk.ID})
+}
+
+// diskReplayer is implemented by health providers that can re-evaluate a
+// disk's stored history without raising alerts.
+type diskReplayer interface {
+	ReplayDisk(ctx context.Context, d storage.Disk, limit int) ([]types.Alert, int, error)
+}
+
+const defaultReplaySnapshots = 100
+
+// handleDiskReplay reports the alerts the disk's last ?limit= snapshots
+// (default 100) would have raised under the current thresholds. Useful after
+// tuning alert settings; the alerts are not stored or sent.
+func (s *Server) handleDiskReplay(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	replayer, ok := s.health.(diskReplayer)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "replay not supported")
+		return
+	}
+	disk, _ := s.lookupDisk(r.Context(), id)
+	if disk == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	limit := defaultReplaySnapshots
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxDiskHistory)
+	}
+	alerts, evaluated, err := replayer.ReplayDisk(r.Context(), *disk, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
 		return
 	}
-	writeJSON(w, http.StatusOK, disks)
+	if alerts == nil {
+		alerts = []types.Alert{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"disk_id":   disk.ID,
+		"snapshots": evaluated,
+		"alerts":    alerts,
+	})
+}
+
+const (
+	defaultSeriesWindow = 7 * 24 * time.Hour
+	defaultSeriesStep   = time.Hour
+	maxSeriesBuckets    = 2000
+)
+
+// handleDiskTimeSeries returns bucketed averages of several snapshot metrics
+// on a shared time axis, e.g.
+// ?metrics=temperature,reallocated&window=7d&step=1h. Buckets are aligned to
+// multiples of step; empty buckets are null.
+func (s *Server) handleDiskTimeSeries(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	disk, _ := s.lookupDisk(r.Context(), id)
+	if disk == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	q := r.URL.Query()
+	window, err := parseSeriesDuration(q.Get("window"), defaultSeriesWindow)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid window")
+		return
+	}
+	step, err := parseSeriesDuration(q.Get("step"), defaultSeriesStep)
+	if err != nil || step < time.Second {
+		writeError(w, http.StatusBadRequest, "invalid step")
+		return
+	}
+	if window/step > maxSeriesBuckets {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("window/step exceeds %d buckets", maxSeriesBuckets))
+		return
+	}
+
+	nvme := disk.Type == "nvme"
+	known := storage.SmartSeriesMetrics
+	if nvme {
+		known = storage.NvmeSeriesMetrics
+	}
+	var metrics []string
+	for _, m := range strings.Split(q.Get("metrics"), ",") {
+		m = strings.TrimSpace(m)
+		if m == "" || slices.Contains(metrics, m) {
+			continue
+		}
+		if _, ok := known[m]; !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown metric %q for %s disk (valid: %s)",
+				m, disk.Type, strings.Join(slices.Sorted(maps.Keys(known)), ", ")))
+			return
+		}
+		metrics = append(metrics, m)
+	}
+	if len(metrics) == 0 {
+		metrics = []string{"temperature"}
+	}
+
+	end := time.Now().Unix()
+	stepSeconds := int64(step / time.Second)
+	series, err := s.store.DiskTimeSeries(r.Context(), disk.ID, nvme, metrics, end-int64(window/time.Second), end, stepSeconds)
+	if err != nil {
+		s.logger.Error("failed to build time series", "disk", disk.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"disk_id":    disk.ID,
+		"step":       stepSeconds,
+		"timestamps": series.Timestamps,
+		"series":     series.Series,
+	})
+}
+
+// parseSeriesDuration parses a window or step such as "90m", "1h" or "7d";
+// Go durations don't have a day unit. Empty yields def.
+func parseSeriesDuration(v string, def time.Duration) (time.Duration, error) {
+	if v == "" {
+		return def, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return d, nil
+}
+
+const (
+	defaultDiskHistory = 10
+	maxDiskHistory     = 1000
+)
+
+// nextTokenHeader carries the keyset token for the next page of a listing
+// whose body is a bare array (pass it back as ?cursor=).
+const nextTokenHeader = "X-Next-Token"
+
+// cursorParam parses an opaque pagination token from the named query
+// parameter, writing a 400 and returning false if it is malformed. An absent
+// parameter yields the zero cursor (first page).
+func cursorParam(w http.ResponseWriter, r *http.Request, name string) (storage.Cursor, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return storage.Cursor{}, true
+	}
+	c, err := storage.ParseCursor(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, name+" is not a valid pagination token")
+		return storage.Cursor{}, false
+	}
+	return c, true
+}
+
+// diskActions are the subroutes that may follow a disk ID, e.g.
+// /api/v1/disks/{id}/locate.
+var diskActions = []string{"locate", "replay", "ack-hardware", "timeseries"}
+
+// diskRouteFromRequest extracts the disk ID and optional action for detail
+// routes. Disk IDs are usually /dev/disk/by-id/... paths, so the ID may span
+// several path segments; clients should percent-encode it
+// (/api/v1/disks/%2Fdev%2Fdisk%2F...) or pass it as ?id= (with the action,
+// if any, as the path: /api/v1/disks/locate?id=...). The mux hands us the
+// decoded path.
+func diskRouteFromRequest(r *http.Request) (id, action string) {
+	rest := ""
+	if strings.HasPrefix(r.URL.Path, "/api/v1/disks/") {
+		rest = strings.TrimPrefix(r.URL.Path, "/api/v1/disks/")
+	}
+	for _, a := range diskActions {
+		if rest == a {
+			rest, action = "", a
+			break
+		}
+		if strings.HasSuffix(rest, "/"+a) {
+			rest, action = strings.TrimSuffix(rest, "/"+a), a
+			break
+		}
+	}
+	if q := r.URL.Query().Get("id"); q != "" {
+		return q, action
+	}
+	return rest, action
+}
+
+// handleDiskLocate blinks the disk's enclosure locate LED for ?duration=
+// (default 1m, capped at 30m).
+func (s *Server) handleDiskLocate(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	disk, _ := s.lookupDisk(r.Context(), id)
+	if disk == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if s.triggers.LocateDisk == nil {
+		writeError(w, http.StatusNotImplemented, "locate not configured")
+		return
+	}
+
+	duration := collectors.DefaultLocateDuration
+	if v := r.URL.Query().Get("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid duration")
+			return
+		}
+		duration = min(d, collectors.MaxLocateDuration)
+	}
+
+	if err := s.triggers.LocateDisk(r.Context(), disk.ID, duration); err != nil {
+		if errors.Is(err, collectors.ErrLocateUnsupported) {
+			writeError(w, http.StatusNotImplemented, err.Error())
+			return
+		}
+		s.logger.Error("failed to locate disk", "disk", disk.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to locate disk")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":           "locating",
+		"disk_id":          disk.ID,
+		"duration_seconds": int(duration.Seconds()),
+	})
+}
+
+// lookupDisk resolves a disk by ID. An unencoded ID gets its leading slash
+// stripped by the mux's path cleaning, so retry with it restored.
+func (s *Server) lookupDisk(ctx context.Context, id string) (*storage.Disk, error) {
+	disk, err := s.store.GetDisk(ctx, id)
+	if err != nil || disk != nil {
+		return disk, err
+	}
+	if !strings.HasPrefix(id, "/") {
+		return s.store.GetDisk(ctx, "/"+id)
+	}
+	return nil, nil
 }
 
 func (s *Server) handlePools(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
 		return
 	}
 
 	// Only handle listing - detail routes are handled by handlePoolRoutes
 	pools, err := s.store.ListPools(r.Context())
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal"})
+		writeError(w, http.StatusInternalServerError, "internal")
 		return
 	}
-	writeJSON(w, http.StatusOK, pools)
+	writeCacheableJSON(w, r, pools)
 }
 
 func (s *Server) handlePoolDetail(w http.ResponseWriter, r *http.Request, poolName string) {
 	// Get pool status
 	pools, err := s.store.ListPools(r.Context())
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal"})
+		writeError(w, http.StatusInternalServerError, "internal")
 		return
 	}
 
@@ -117,25 +723,49 @@ func (s *Server) handlePoolDetail(w http.ResponseWriter, r *http.Request, poolNa
 	}
 
 	if pool == nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "pool not found"})
+		writeError(w, http.StatusNotFound, "pool not found")
 		return
 	}
 
-	// Get device mappings
+	// Get device mappings; members adds each device's role and vdev type
 	devices, _ := s.store.GetPoolDevices(r.Context(), poolName)
+	members, _ := s.store.PoolDevices(r.Context(), poolName)
+	if members == nil {
+		members = []storage.PoolDevice{}
+	}
 
 	// Get scrub history
 	scrubHistory, _ := s.store.GetScrubHistory(r.Context(), poolName, 20)
 
+	permanentErrors, _ := s.store.PoolErrors(r.Context(), poolName)
+	if permanentErrors == nil {
+		permanentErrors = []string{}
+	}
+
+	// Compression/dedup properties (nil unless storage.zfs_properties is on)
+	properties, _ := s.store.GetPoolProperties(r.Context(), poolName)
+	// Allocation and fragmentation from the last zpool list
+	space, _ := s.store.GetPoolSpace(r.Context(), poolName)
+
 	resp := map[string]interface{}{
-		"pool":          pool,
-		"devices":       devices,
-		"scrub_history": scrubHistory,
+		"pool":             pool,
+		"devices":          devices,
+		"members":          members,
+		"scrub_history":    scrubHistory,
+		"permanent_errors": permanentErrors,
+		"properties":       properties,
+		"space":            space,
 	}
 
 	writeJSON(w, http.StatusOK, resp)
 }
 
+const (
+	// minAlertQueryLen rejects near-empty searches that would match everything.
+	minAlertQueryLen = 3
+	maxAlertLimit    = 1000
+)
+
 func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 	// Check if this is an acknowledge route: /api/v1/alerts/{id}/acknowledge
 	path := strings.TrimPrefix(r.URL.Path, "/api/v1/alerts/")
@@ -145,16 +775,30 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 		// Parse alert ID
 		alertID, err := strconv.ParseInt(parts[0], 10, 64)
 		if err != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid alert ID"})
+			writeError(w, http.StatusBadRequest, "invalid alert ID")
 			return
 		}
 		s.handleAcknowledgeAlert(w, r, alertID)
 		return
 	}
+	if len(parts) >= 2 && parts[1] == "snooze" {
+		alertID, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid alert ID")
+			return
+		}
+		s.handleSnoozeAlert(w, r, alertID)
+		return
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/api/v1/alerts" {
+		s.handleCreateAlert(w, r)
+		return
+	}
 
 	// Default: list alerts
 	if r.Method != http.MethodGet {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
 		return
 	}
 
@@ -164,27 +808,105 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 			limit = n
 		}
 	}
-	alerts, err := s.store.RecentAlerts(r.Context(), limit)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query != "" && len([]rune(query)) < minAlertQueryLen {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("q must be at least %d characters", minAlertQueryLen))
+		return
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > maxAlertLimit {
+		limit = maxAlertLimit
+	}
+	after, ok := cursorParam(w, r, "cursor")
+	if !ok {
+		return
+	}
+	alerts, err := s.store.ListAlerts(r.Context(), storage.AlertFilter{Query: query, Limit: limit, After: after})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	// The body stays a plain array; the next page's token travels in a
+	// header and is omitted on the last page.
+	if len(alerts) == limit {
+		last := alerts[len(alerts)-1]
+		w.Header().Set(nextTokenHeader, storage.Cursor{Timestamp: last.Timestamp, ID: last.ID}.Token())
+	}
+	writeCacheableJSON(w, r, alerts)
+}
+
+// maxAlertBody bounds the size of externally posted alerts.
+const maxAlertBody = 64 << 10
+
+var validSeverities = map[string]bool{"info": true, "warning": true, "critical": true, "emergency": true}
+
+// handleCreateAlert accepts alerts from external sources (e.g. RAID controller
+// scripts) and runs them through the notification pipeline.
+func (s *Server) handleCreateAlert(w http.ResponseWriter, r *http.Request) {
+	var alert types.Alert
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertBody)).Decode(&alert); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	alert.Severity = strings.ToLower(strings.TrimSpace(alert.Severity))
+	if !validSeverities[alert.Severity] {
+		writeError(w, http.StatusBadRequest, "severity must be one of info, warning, critical")
+		return
+	}
+	if strings.TrimSpace(alert.SourceID) == "" || strings.TrimSpace(alert.Subject) == "" {
+		writeError(w, http.StatusBadRequest, "source_id and subject are required")
+		return
+	}
+	alert.ID = 0
+	alert.Acknowledged = false
+	alert.Resolves = false
+	alert.SourceType = "external"
+	if alert.Timestamp <= 0 {
+		alert.Timestamp = time.Now().Unix()
+	}
+
+	var id int64
+	var queued bool
+	var err error
+	if s.notifier != nil {
+		id, queued, err = s.notifier.Submit(r.Context(), alert)
+	} else {
+		id, err = s.store.AddAlert(r.Context(), storage.Alert{
+			Timestamp:  alert.Timestamp,
+			Severity:   alert.Severity,
+			SourceType: alert.SourceType,
+			SourceID:   alert.SourceID,
+			Subject:    alert.Subject,
+			Message:    alert.Message,
+		})
+	}
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal"})
+		s.logger.Error("failed to store external alert", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to store alert")
 		return
 	}
-	writeJSON(w, http.StatusOK, alerts)
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":     id,
+		"queued": queued,
+	})
 }
 
 func (s *Server) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request, alertID int64) {
 	if r.Method != http.MethodPost {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
 		return
 	}
 
 	if err := s.store.AcknowledgeAlert(r.Context(), alertID); err != nil {
 		if err.Error() == "alert not found" {
-			writeJSON(w, http.StatusNotFound, map[string]string{"error": "alert not found"})
+			writeError(w, http.StatusNotFound, "alert not found")
 			return
 		}
 		s.logger.Error("failed to acknowledge alert", "alert_id", alertID, "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to acknowledge alert"})
+		writeError(w, http.StatusInternalServerError, "failed to acknowledge alert")
 		return
 	}
 
@@ -194,31 +916,246 @@ func (s *Server) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request,
 	})
 }
 
-func (s *Server) handleCollectSmart(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+// maxSnooze caps POST /api/v1/alerts/{id}/snooze; acknowledge is for good.
+const maxSnooze = 30 * 24 * time.Hour
+
+// handleSnoozeAlert holds notifications for an alert's condition (same
+// source and subject) for ?duration=, e.g. 4h. Occurrences are still
+// recorded. DELETE lifts the snooze.
+func (s *Server) handleSnoozeAlert(w http.ResponseWriter, r *http.Request, alertID int64) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	alert, err := s.store.GetAlert(r.Context(), alertID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
 		return
 	}
-	if s.triggers.CollectSmart != nil {
-		_ = s.triggers.CollectSmart(r.Context())
+	if alert == nil {
+		writeError(w, http.StatusNotFound, "alert not found")
+		return
 	}
-	writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+
+	if r.Method == http.MethodDelete {
+		found, err := s.store.UnsnoozeAlert(r.Context(), *alert)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal")
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "alert is not snoozed")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "unsnoozed", "alert_id": alertID})
+		return
+	}
+
+	d, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil || d <= 0 {
+		writeError(w, http.StatusBadRequest, "duration must be a positive duration, e.g. 4h")
+		return
+	}
+	if d > maxSnooze {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("duration must be at most %s; acknowledge the alert instead", maxSnooze))
+		return
+	}
+	until := time.Now().Add(d).Unix()
+	if err := s.store.SnoozeAlert(r.Context(), *alert, until); err != nil {
+		s.logger.Error("failed to snooze alert", "alert_id", alertID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to snooze alert")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":        "snoozed",
+		"alert_id":      alertID,
+		"snoozed_until": until,
+	})
+}
+
+const (
+	// eventKeepalive is how often a comment is sent on an idle event stream
+	// so proxies don't time the connection out.
+	eventKeepalive = 15 * time.Second
+	// eventReplayBatch bounds each read of missed alerts on reconnect.
+	eventReplayBatch = 200
+)
+
+// handleEvents streams alerts and status changes as Server-Sent Events.
+// Alert events carry the alert id, so a client reconnecting with
+// Last-Event-ID (or ?last_event_id=) first receives the alerts it missed.
+// A client too slow to keep up is disconnected and resumes the same way.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var after int64
+	if lastID != "" {
+		n, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid last event id")
+			return
+		}
+		after = n
+	}
+
+	// Subscribe before replaying so nothing stored in between is lost;
+	// alerts already replayed are skipped when they arrive live.
+	stream, unsubscribe := s.store.Events().Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if lastID != "" {
+		for {
+			missed, err := s.store.AlertsAfterID(r.Context(), after, eventReplayBatch)
+			if err != nil {
+				s.logger.Warn("event replay failed", "error", err)
+				return
+			}
+			for _, a := range missed {
+				if err := writeEvent(w, a.ID, events.TypeAlert, a); err != nil {
+					return
+				}
+				after = a.ID
+			}
+			flusher.Flush()
+			if len(missed) < eventReplayBatch {
+				break
+			}
+		}
+	}
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-stream:
+			if !ok {
+				// Dropped as a slow consumer.
+				return
+			}
+			if e.ID != 0 {
+				if e.ID <= after {
+					continue
+				}
+				after = e.ID
+			}
+			if err := writeEvent(w, e.ID, e.Type, e.Data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes one SSE frame; id 0 omits the id field so the client's
+// last event id still points at the last replayable event.
+func writeEvent(w http.ResponseWriter, id int64, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if id != 0 {
+		fmt.Fprintf(&buf, "id: %d\n", id)
+	}
+	fmt.Fprintf(&buf, "event: %s\ndata: %s\n\n", event, payload)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (s *Server) handleCollectSmart(w http.ResponseWriter, r *http.Request) {
+	s.handleCollectDisks(w, r, "SMART", s.triggers.CollectSmart)
 }
 
 func (s *Server) handleCollectNvme(w http.ResponseWriter, r *http.Request) {
+	s.handleCollectDisks(w, r, "NVMe", s.triggers.CollectNvme)
+}
+
+// collectWaitTimeout bounds a collection run with ?wait=true. Such requests
+// are exempt from api.handler_timeout, which a pass over many disks easily
+// exceeds, and the pass isn't cut short if the client disconnects.
+const collectWaitTimeout = 15 * time.Minute
+
+// handleCollectDisks starts a SMART or NVMe collection. By default it
+// returns 202 once the pass has started; ?wait=true runs it to completion,
+// for up to collectWaitTimeout, and returns the result (disks collected,
+// per-disk failures).
+func (s *Server) handleCollectDisks(w http.ResponseWriter, r *http.Request, kind string, trigger func(context.Context, bool) (*types.CollectionResult, error)) {
 	if r.Method != http.MethodPost {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
 		return
 	}
-	if s.triggers.CollectNvme != nil {
-		_ = s.triggers.CollectNvme(r.Context())
+	wait := false
+	if v := r.URL.Query().Get("wait"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "wait must be true or false")
+			return
+		}
+		wait = b
 	}
-	writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+	if trigger == nil {
+		if wait {
+			writeError(w, http.StatusNotImplemented, kind+" collection not configured")
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+		return
+	}
+
+	ctx := r.Context()
+	if wait {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), collectWaitTimeout)
+		defer cancel()
+	}
+	result, err := trigger(ctx, wait)
+	if errors.Is(err, collectors.ErrCollectionInProgress) {
+		writeError(w, http.StatusConflict, kind+" collection already in progress")
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, fmt.Sprintf("%s collection did not finish within %s", kind, collectWaitTimeout))
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to collect", "kind", kind, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to start "+kind+" collection")
+		return
+	}
+	if !wait || result == nil {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "completed", "result": result})
 }
 
 func (s *Server) handleCollectZfs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
 		return
 	}
 	if s.triggers.CollectZfs != nil {
@@ -227,6 +1164,58 @@ func (s *Server) handleCollectZfs(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
 }
 
+// handleRefreshSchedules re-polls cloud schedules instead of waiting for
+// the hourly poll, so a schedule changed in the cloud applies now.
+func (s *Server) handleRefreshSchedules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	if s.triggers.RefreshSchedules == nil {
+		writeError(w, http.StatusNotImplemented, "cloud schedules not enabled")
+		return
+	}
+	n, err := s.triggers.RefreshSchedules(r.Context())
+	if errors.Is(err, scheduler.ErrCloudDisabled) {
+		writeError(w, http.StatusConflict, "cloud connection not enabled; set cloud.enabled to poll schedules")
+		return
+	}
+	if err != nil {
+		s.logger.Warn("failed to refresh schedules", "error", err)
+		writeError(w, http.StatusBadGateway, "failed to refresh schedules: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"stored": n})
+}
+
+// handleCommandHistory lists the remote commands the agent received from
+// the cloud, newest first, with their outcome.
+func (s *Server) handleCommandHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, 500)
+	}
+	history, err := s.store.ListCommandHistory(r.Context(), limit)
+	if err != nil {
+		s.logger.Error("failed to list command history", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if history == nil {
+		history = []storage.CommandRecord{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"commands": history})
+}
+
 func (s *Server) handlePoolRoutes(w http.ResponseWriter, r *http.Request) {
 	// Handle routes like /api/v1/pools/{name} and /api/v1/pools/{name}/scrub
 	path := strings.TrimPrefix(r.URL.Path, "/api/v1/pools/")
@@ -252,25 +1241,25 @@ func (s *Server) handlePoolRoutes(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handlePoolScrub(w http.ResponseWriter, r *http.Request, poolName string) {
 	if r.Method != http.MethodPost {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
 		return
 	}
 
 	if s.triggers.TriggerScrub != nil {
 		if err := s.triggers.TriggerScrub(r.Context(), poolName); err != nil {
 			s.logger.Error("failed to trigger scrub", "pool", poolName, "error", err)
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to trigger scrub"})
+			writeError(w, http.StatusInternalServerError, "failed to trigger scrub")
 			return
 		}
 		writeJSON(w, http.StatusAccepted, map[string]string{"status": "scrub triggered", "pool": poolName})
 	} else {
-		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "scrub trigger not configured"})
+		writeError(w, http.StatusNotImplemented, "scrub trigger not configured")
 	}
 }
 
 func (s *Server) handleNotificationQueue(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		writeJSON(w, http.StatusMethodNotAllowed, nil)
+		writeError(w, http.StatusMethodNotAllowed, "")
 		return
 	}
 
@@ -284,12 +1273,29 @@ func (s *Server) handleNotificationQueue(w http.ResponseWriter, r *http.Request)
 	count, err := s.notifier.GetUnsentCount(r.Context())
 	if err != nil {
 		s.logger.Error("failed to get unsent notification count", "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, 500)
+	}
+	entries, err := s.notifier.PendingEntries(r.Context(), limit)
+	if err != nil {
+		s.logger.Error("failed to list pending notifications", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"unsent_count": count,
+		"pending":      entries,
 	})
 }
 
@@ -300,3 +1306,158 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 		_ = json.NewEncoder(w).Encode(v)
 	}
 }
+
+// writeCacheableJSON writes a 200 JSON response carrying an ETag (a hash of
+// the body), or an empty 304 when the request's If-None-Match already names
+// it, so pollers don't re-transfer unchanged listings.
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	writeJSONWithETag(w, r, v, nil)
+}
+
+// writeJSONWithETag is writeCacheableJSON with the ETag hashed from key
+// instead of the body, for responses carrying fields that change on every
+// request while the content doesn't. A nil key hashes the body.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, v, key interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal")
+		return
+	}
+	hashed := buf.Bytes()
+	if key != nil {
+		b, err := json.Marshal(key)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal")
+			return
+		}
+		hashed = b
+	}
+	sum := sha256.Sum256(hashed)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// problem is an RFC 7807 problem details body. Type is always "about:blank",
+// so Title is the HTTP status text and Detail says what went wrong.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeError writes an application/problem+json error response.
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// handleDiagnostics reports agent internals useful when troubleshooting.
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	dbBytes, walBytes := s.store.FileSizes()
+	resp := map[string]interface{}{
+		"database": map[string]interface{}{
+			"size_bytes":     dbBytes,
+			"wal_size_bytes": walBytes,
+			"read_only":      s.store.ReadOnly(),
+		},
+	}
+	// Only populated when scheduling.collection_metrics is on.
+	if stats, err := s.store.CollectionMetricStats(r.Context()); err == nil && len(stats) > 0 {
+		resp["collection_metrics"] = stats
+	}
+	// Only populated when storage.system_metrics is on.
+	if samples, err := s.store.RecentSystemMetrics(r.Context(), 1); err == nil && len(samples) > 0 {
+		resp["system"] = samples[0]
+	}
+	// Recorded by the scheduler from the Date header of cloud responses.
+	if skew, _ := s.store.GetMeta(r.Context(), "cloud_clock_skew_seconds"); skew != "" {
+		seconds, _ := strconv.ParseInt(skew, 10, 64)
+		checkedAt, _ := s.store.GetMeta(r.Context(), "cloud_clock_skew_checked_at")
+		at, _ := strconv.ParseInt(checkedAt, 10, 64)
+		resp["clock_skew"] = map[string]interface{}{
+			"seconds":    seconds,
+			"checked_at": at,
+		}
+	}
+	// Recorded by the scheduler after each run of a scheduled task.
+	if runs, err := s.store.ListTaskRuns(r.Context()); err == nil && len(runs) > 0 {
+		schedules := make([]map[string]interface{}, 0, len(runs))
+		for _, run := range runs {
+			entry := map[string]interface{}{
+				"task":           run.TaskType,
+				"source":         run.Source,
+				"schedule_type":  run.ScheduleType,
+				"schedule_value": run.ScheduleValue,
+				"next_run":       time.Unix(run.NextRun, 0).UTC().Format(time.RFC3339),
+			}
+			if run.LastRun > 0 {
+				entry["last_run"] = time.Unix(run.LastRun, 0).UTC().Format(time.RFC3339)
+			}
+			schedules = append(schedules, entry)
+		}
+		resp["schedules"] = schedules
+	}
+	// Scrubs and SMART tests suspended by the scheduler's circuit breaker.
+	if s.triggers.OpenBreakers != nil {
+		if open := s.triggers.OpenBreakers(); len(open) > 0 {
+			resp["open_breakers"] = open
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleResetBreaker re-enables a scheduled action suspended by its circuit
+// breaker, named by ?key= as listed under open_breakers in diagnostics.
+func (s *Server) handleResetBreaker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	if s.triggers.OpenBreakers == nil || s.triggers.ResetBreaker == nil {
+		writeError(w, http.StatusNotImplemented, "scheduler not available")
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "key is required")
+		return
+	}
+	if !slices.Contains(s.triggers.OpenBreakers(), key) {
+		writeError(w, http.StatusNotFound, "no open breaker for "+key)
+		return
+	}
+	s.triggers.ResetBreaker(key)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reset", "key": key})
+}
@@ -0,0 +1,1430 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/collectors"
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/discovery"
+	"github.com/metabinary-ltd/storagesentinel/internal/events"
+	"github.com/metabinary-ltd/storagesentinel/internal/health"
+	"github.com/metabinary-ltd/storagesentinel/internal/notifier"
+	"github.com/metabinary-ltd/storagesentinel/internal/scheduler"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+	"github.com/metabinary-ltd/storagesentinel/internal/uplink"
+)
+
+func newTestServer(t *testing.T) (*Server, *storage.Store) {
+	t.Helper()
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	provider := health.NewStorageBackedProvider(store, slog.Default())
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200}, store, provider, nil, Triggers{}, slog.Default())
+	return srv, store
+}
+
+func doRequest(srv *Server, method, target string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+	return rr
+}
+
+func TestDiskDetailSlashID(t *testing.T) {
+	srv, store := newTestServer(t)
+	id := "/dev/disk/by-id/ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000000"
+	if err := store.UpsertDisk(context.Background(), storage.Disk{ID: id, Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	for _, target := range []string{
+		"/api/v1/disks/" + url.PathEscape(id),
+		"/api/v1/disks?id=" + url.QueryEscape(id),
+		"/api/v1/disks" + id, // unencoded, as left by the mux's path cleaning
+	} {
+		rr := doRequest(srv, http.MethodGet, target)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", target, rr.Code)
+		}
+		var resp struct {
+			Disk storage.Disk `json:"disk"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", target, err)
+		}
+		if resp.Disk.ID != id {
+			t.Fatalf("%s: expected disk %s, got %s", target, id, resp.Disk.ID)
+		}
+	}
+
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+url.PathEscape("/dev/disk/by-id/missing")); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown disk, got %d", rr.Code)
+	}
+}
+
+func TestErrorsUseProblemJSON(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/disks/ata-MISSING")
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("expected problem+json content type, got %q", ct)
+	}
+	var p problem
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "not found"}
+	if p != want {
+		t.Fatalf("expected %+v, got %+v", want, p)
+	}
+
+	// Method mismatches carry the same shape, without a detail.
+	rr = doRequest(srv, http.MethodGet, "/api/v1/collect/smart")
+	p = problem{}
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil || p.Status != http.StatusMethodNotAllowed || p.Title != "Method Not Allowed" {
+		t.Fatalf("expected a 405 problem, got %d %+v (err %v)", rr.Code, p, err)
+	}
+}
+
+func TestDiskDetailHistoryParam(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "/dev/disk/by-id/ata-HIST"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	base := time.Now().Add(-48 * time.Hour).Unix()
+	for i := 0; i < maxDiskHistory+5; i++ {
+		if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: id, HealthStatus: "passed", Timestamp: base + int64(i)}); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", defaultDiskHistory},
+		{"?history=25", 25},
+		{"?history=abc", defaultDiskHistory},
+		{fmt.Sprintf("?history=%d", maxDiskHistory*10), maxDiskHistory},
+	} {
+		rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+url.PathEscape(id)+tc.query)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d", tc.query, rr.Code)
+		}
+		var resp struct {
+			History []storage.SmartSnapshot `json:"history"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("%q: decode: %v", tc.query, err)
+		}
+		if len(resp.History) != tc.want {
+			t.Fatalf("%q: expected %d history points, got %d", tc.query, tc.want, len(resp.History))
+		}
+	}
+}
+
+func TestAlertsSearch(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	now := time.Now().Unix()
+	for _, a := range []storage.Alert{
+		{Timestamp: now, Severity: "warning", SourceType: "disk", SourceID: "sda", Subject: "High temperature", Message: "Temperature 58C exceeds threshold"},
+		{Timestamp: now, Severity: "critical", SourceType: "pool", SourceID: "tank", Subject: "Pool not healthy", Message: "ZFS pool state: DEGRADED"},
+		{Timestamp: now, Severity: "info", SourceType: "disk", SourceID: "sdb", Subject: "Drive added", Message: "100% new drive"},
+	} {
+		if _, err := store.AddAlert(ctx, a); err != nil {
+			t.Fatalf("add alert: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"degraded", 1},
+		{"temperature", 1},
+		{"100%", 1},
+		{"zzz-no-match", 0},
+	} {
+		rr := doRequest(srv, http.MethodGet, "/api/v1/alerts?q="+url.QueryEscape(tc.query))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d", tc.query, rr.Code)
+		}
+		var alerts []storage.Alert
+		if err := json.NewDecoder(rr.Body).Decode(&alerts); err != nil {
+			t.Fatalf("%q: decode: %v", tc.query, err)
+		}
+		if len(alerts) != tc.want {
+			t.Fatalf("%q: expected %d alerts, got %+v", tc.query, tc.want, alerts)
+		}
+	}
+
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/alerts?q=%25"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for overly broad query, got %d", rr.Code)
+	}
+}
+
+func TestDiskDetailSections(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "/dev/disk/by-id/ata-POOLED"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{id}, "mirror"); err != nil {
+		t.Fatalf("upsert pool devices: %v", err)
+	}
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: id, HealthStatus: "passed", TemperatureC: 38, Timestamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+url.PathEscape(id))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp struct {
+		Disk    *storage.Disk            `json:"disk"`
+		History []storage.SmartSnapshot  `json:"history"`
+		Latest  *storage.SmartSnapshot   `json:"latest"`
+		Pools   []storage.PoolMembership `json:"pools"`
+		Health  *types.DiskHealth        `json:"health"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Disk == nil || len(resp.History) != 1 {
+		t.Fatalf("expected disk and history, got %+v", resp)
+	}
+	if resp.Latest == nil || resp.Latest.TemperatureC != 38 {
+		t.Fatalf("expected latest snapshot, got %+v", resp.Latest)
+	}
+	if len(resp.Pools) != 1 || resp.Pools[0].PoolName != "tank" || resp.Pools[0].VdevType != "mirror" {
+		t.Fatalf("expected tank membership, got %+v", resp.Pools)
+	}
+	if resp.Health == nil || resp.Health.ID != id || resp.Health.Status == "" {
+		t.Fatalf("expected health evaluation, got %+v", resp.Health)
+	}
+}
+
+func TestCreateExternalAlert(t *testing.T) {
+	_, store := newTestServer(t)
+	ctx := context.Background()
+	n := notifier.New(store, config.NotificationsConfig{
+		Webhooks: []config.WebhookConfig{{Name: "hook", URL: "http://127.0.0.1:1/"}},
+	}, time.Hour, "warning", slog.Default())
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200}, store, nil, n, Triggers{}, slog.Default())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/alerts", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := post(`{"severity":"critical","source_type":"disk","source_id":"megaraid0","subject":"Virtual drive degraded","message":"VD0 is degraded"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		ID     int64 `json:"id"`
+		Queued bool  `json:"queued"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.ID == 0 || !resp.Queued {
+		t.Fatalf("expected stored and queued alert, got %+v", resp)
+	}
+
+	stored, err := store.GetAlert(ctx, resp.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("get alert: %v", err)
+	}
+	if stored.SourceType != "external" || stored.Subject != "Virtual drive degraded" {
+		t.Fatalf("unexpected stored alert: %+v", stored)
+	}
+	if count, _ := store.GetUnsentNotificationCount(ctx); count != 1 {
+		t.Fatalf("expected 1 queued notification, got %d", count)
+	}
+
+	for _, body := range []string{
+		`{"severity":"bogus","source_id":"x","subject":"y"}`,
+		`{"severity":"warning","source_id":"","subject":"y"}`,
+		`not json`,
+	} {
+		if rr := post(body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestDiagnosticsWALSize(t *testing.T) {
+	srv, store := newTestServer(t)
+	if err := store.UpsertDisk(context.Background(), storage.Disk{ID: "disk-a", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/diagnostics")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp struct {
+		Database struct {
+			SizeBytes    int64 `json:"size_bytes"`
+			WALSizeBytes int64 `json:"wal_size_bytes"`
+		} `json:"database"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Database.WALSizeBytes == 0 {
+		t.Fatalf("expected nonzero WAL size after a write, got %+v", resp.Database)
+	}
+}
+
+func TestDiagnosticsSchedules(t *testing.T) {
+	srv, store := newTestServer(t)
+	next := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.SetTaskRun(context.Background(), storage.TaskRun{TaskType: "ZFS_SCRUB", Source: "config", ScheduleType: "INTERVAL", ScheduleValue: "720h0m0s", NextRun: next.Unix()}); err != nil {
+		t.Fatalf("set task run: %v", err)
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/diagnostics")
+	var resp struct {
+		Schedules []map[string]string `json:"schedules"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Schedules) != 1 || resp.Schedules[0]["next_run"] != "2026-03-01T12:00:00Z" || resp.Schedules[0]["last_run"] != "" {
+		t.Fatalf("unexpected schedules %+v", resp.Schedules)
+	}
+}
+
+func TestDiagnosticsBreakers(t *testing.T) {
+	srv, _ := newTestServer(t)
+	open := []string{"scrub:tank", "smart_long:ata-A"}
+	srv.triggers.OpenBreakers = func() []string { return open }
+	srv.triggers.ResetBreaker = func(key string) { open = slices.DeleteFunc(open, func(k string) bool { return k == key }) }
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/diagnostics")
+	var resp struct {
+		OpenBreakers []string `json:"open_breakers"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if fmt.Sprint(resp.OpenBreakers) != "[scrub:tank smart_long:ata-A]" {
+		t.Fatalf("unexpected open breakers %v", resp.OpenBreakers)
+	}
+
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/diagnostics/breakers/reset?key=scrub:tank"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if fmt.Sprint(open) != "[smart_long:ata-A]" {
+		t.Fatalf("expected the scrub breaker to be reset, still open: %v", open)
+	}
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/diagnostics/breakers/reset?key=scrub:tank"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a closed breaker, got %d", rr.Code)
+	}
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/diagnostics/breakers/reset"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a key, got %d", rr.Code)
+	}
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/diagnostics/breakers/reset?key=smart_long:ata-A"); rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rr.Code)
+	}
+}
+
+func TestDiskLocateRoute(t *testing.T) {
+	_, store := newTestServer(t)
+	id := "/dev/disk/by-id/ata-LOCATE"
+	if err := store.UpsertDisk(context.Background(), storage.Disk{ID: id, Name: "/dev/sdc", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	var gotID string
+	var gotDuration time.Duration
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200}, store, nil, nil, Triggers{
+		LocateDisk: func(_ context.Context, diskID string, d time.Duration) error {
+			gotID, gotDuration = diskID, d
+			if diskID != id {
+				return collectors.ErrLocateUnsupported
+			}
+			return nil
+		},
+	}, slog.Default())
+
+	rr := doRequest(srv, http.MethodPost, "/api/v1/disks/"+url.PathEscape(id)+"/locate?duration=2m")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if gotID != id || gotDuration != 2*time.Minute {
+		t.Fatalf("unexpected dispatch: %s %v", gotID, gotDuration)
+	}
+
+	rr = doRequest(srv, http.MethodPost, "/api/v1/disks/locate?id="+url.QueryEscape(id)+"&duration=10h")
+	if rr.Code != http.StatusAccepted || gotDuration != collectors.MaxLocateDuration {
+		t.Fatalf("expected capped duration via ?id=, got %d %v", rr.Code, gotDuration)
+	}
+
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+url.PathEscape(id)+"/locate"); rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rr.Code)
+	}
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/disks/"+url.PathEscape("/dev/disk/by-id/missing")+"/locate"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown disk, got %d", rr.Code)
+	}
+
+	other := "/dev/disk/by-id/ata-NOENCLOSURE"
+	_ = store.UpsertDisk(context.Background(), storage.Disk{ID: other, Name: "/dev/sdd", Type: "hdd"})
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/disks/"+url.PathEscape(other)+"/locate"); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 for unsupported enclosure, got %d", rr.Code)
+	}
+}
+
+func TestDiskDetailAt(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "/dev/disk/by-id/ata-HISTORY"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	base := time.Now().Add(-48 * time.Hour).Unix()
+	for i, status := range []string{"passed", "passed", "failed"} {
+		snap := storage.SmartSnapshot{DiskID: id, HealthStatus: status, TemperatureC: float64(30 + i), Timestamp: base + int64(i)*3600}
+		if err := store.AddSmartSnapshot(ctx, snap); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+
+	// Between the second and third snapshots: expect the second, and a
+	// health evaluation that predates the SMART failure.
+	rr := doRequest(srv, http.MethodGet, fmt.Sprintf("/api/v1/disks/%s?at=%d", url.PathEscape(id), base+3600+60))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Latest *storage.SmartSnapshot `json:"latest"`
+		Health *types.DiskHealth      `json:"health"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Latest == nil || resp.Latest.Timestamp != base+3600 || resp.Latest.TemperatureC != 31 {
+		t.Fatalf("expected second snapshot, got %+v", resp.Latest)
+	}
+	if resp.Health == nil || resp.Health.Status == "critical" {
+		t.Fatalf("expected pre-failure health, got %+v", resp.Health)
+	}
+
+	rr = doRequest(srv, http.MethodGet, fmt.Sprintf("/api/v1/disks/%s?at=%d", url.PathEscape(id), base-1))
+	resp.Latest, resp.Health = nil, nil
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Latest != nil {
+		t.Fatalf("expected no snapshot before the first one, got %+v", resp.Latest)
+	}
+
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+url.PathEscape(id)+"?at=yesterday"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad at, got %d", rr.Code)
+	}
+}
+
+func TestSummaryDisplayUnitsFahrenheit(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-TEMP", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "ata-TEMP", HealthStatus: "passed", TemperatureC: 40, Timestamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	for _, tc := range []struct {
+		units string
+		wantF float64
+	}{
+		{"celsius", 0},
+		{"fahrenheit", 104},
+	} {
+		provider := health.NewStorageBackedProvider(store, slog.Default())
+		srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200, DisplayUnits: tc.units}, store, provider, nil, Triggers{}, slog.Default())
+		rr := doRequest(srv, http.MethodGet, "/api/v1/summary")
+		var report types.HealthReport
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(report.Disks) != 1 {
+			t.Fatalf("expected one disk, got %+v", report.Disks)
+		}
+		if d := report.Disks[0]; d.TemperatureC != 40 || d.TemperatureF != tc.wantF {
+			t.Fatalf("%s: expected 40C / %gF, got %+v", tc.units, tc.wantF, d)
+		}
+	}
+}
+
+func TestAlertsAndHistoryCursorPagination(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+
+	// Pairs of alerts share a timestamp so the id tiebreak is exercised.
+	base := time.Now().Add(-time.Hour).Unix()
+	const total = 11
+	for i := 0; i < total; i++ {
+		if _, err := store.AddAlert(ctx, storage.Alert{
+			Timestamp: base + int64(i/2), Severity: "warning", SourceType: "disk", SourceID: "d",
+			Subject: fmt.Sprintf("alert %d", i), Message: "m",
+		}); err != nil {
+			t.Fatalf("add alert: %v", err)
+		}
+	}
+
+	seen := map[int64]bool{}
+	var order []storage.Alert
+	target := "/api/v1/alerts?limit=4"
+	for pages := 0; ; pages++ {
+		if pages > total {
+			t.Fatal("pagination did not terminate")
+		}
+		rr := doRequest(srv, http.MethodGet, target)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", target, rr.Code)
+		}
+		var page []storage.Alert
+		if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, a := range page {
+			if seen[a.ID] {
+				t.Fatalf("alert %d returned twice", a.ID)
+			}
+			seen[a.ID] = true
+		}
+		order = append(order, page...)
+		next := rr.Header().Get(nextTokenHeader)
+		if next == "" {
+			break
+		}
+		target = "/api/v1/alerts?limit=4&cursor=" + url.QueryEscape(next)
+	}
+	if len(order) != total {
+		t.Fatalf("expected %d alerts across pages, got %d", total, len(order))
+	}
+	for i := 1; i < len(order); i++ {
+		prev, cur := order[i-1], order[i]
+		if cur.Timestamp > prev.Timestamp || (cur.Timestamp == prev.Timestamp && cur.ID > prev.ID) {
+			t.Fatalf("alerts out of order at %d: %+v after %+v", i, cur, prev)
+		}
+	}
+
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/alerts?cursor=bogus"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed cursor, got %d", rr.Code)
+	}
+
+	// Snapshot history pages the same way via history_next.
+	id := "ata-PAGED"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sdp", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: id, HealthStatus: "passed", Timestamp: base + int64(i)}); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+	var timestamps []int64
+	target = "/api/v1/disks/" + id + "?history=2"
+	for target != "" {
+		rr := doRequest(srv, http.MethodGet, target)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", target, rr.Code)
+		}
+		var resp struct {
+			History     []storage.SmartSnapshot `json:"history"`
+			HistoryNext string                  `json:"history_next"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, snap := range resp.History {
+			timestamps = append(timestamps, snap.Timestamp)
+		}
+		target = ""
+		if resp.HistoryNext != "" {
+			target = "/api/v1/disks/" + id + "?history=2&history_cursor=" + url.QueryEscape(resp.HistoryNext)
+		}
+	}
+	want := []int64{base + 4, base + 3, base + 2, base + 1, base}
+	if fmt.Sprint(timestamps) != fmt.Sprint(want) {
+		t.Fatalf("history pages = %v, want %v", timestamps, want)
+	}
+}
+
+func TestDiskReplay(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "ata-REPLAY"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sdr", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	// High temperature at 60°C and 62°C (one episode), clears at 40°C, then
+	// returns at 58°C: two alerts, one per episode.
+	base := time.Now().Add(-24 * time.Hour).Unix()
+	for i, temp := range []float64{40, 60, 62, 40, 58} {
+		if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{
+			DiskID: id, HealthStatus: "passed", TemperatureC: temp, Timestamp: base + int64(i)*3600,
+		}); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+id+"/replay")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Snapshots int           `json:"snapshots"`
+		Alerts    []types.Alert `json:"alerts"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Snapshots != 5 {
+		t.Fatalf("expected 5 snapshots evaluated, got %d", resp.Snapshots)
+	}
+	var fired []int64
+	for _, a := range resp.Alerts {
+		if a.Subject == "High temperature" {
+			fired = append(fired, a.Timestamp)
+		}
+	}
+	if want := []int64{base + 3600, base + 4*3600}; fmt.Sprint(fired) != fmt.Sprint(want) {
+		t.Fatalf("high temperature fired at %v, want %v", fired, want)
+	}
+
+	// Replay is read-only: nothing lands in the alerts table.
+	if stored, _ := store.ListAlerts(ctx, storage.AlertFilter{}); len(stored) != 0 {
+		t.Fatalf("expected no persisted alerts, got %d", len(stored))
+	}
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+id+"/replay?limit=0"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for limit=0, got %d", rr.Code)
+	}
+}
+
+func TestUnpooledDisks(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	for _, d := range []storage.Disk{
+		{ID: "ata-BOOT", Name: "/dev/sda", Type: "sata_ssd"},
+		{ID: "ata-POOLED_1", Name: "/dev/sdb", Type: "hdd"},
+		{ID: "ata-POOLED_2", Name: "/dev/sdc", Type: "hdd"},
+		{ID: "ata-SPARE", Name: "/dev/sdd", Type: "hdd"},
+	} {
+		if err := store.UpsertDisk(ctx, d); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{"ata-POOLED_1", "ata-POOLED_2"}, "data"); err != nil {
+		t.Fatalf("upsert pool devices: %v", err)
+	}
+	prev := discovery.RootDisk
+	discovery.RootDisk = func() string { return "/dev/sda" }
+	defer func() { discovery.RootDisk = prev }()
+
+	ids := func(target string) []string {
+		t.Helper()
+		rr := doRequest(srv, http.MethodGet, target)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", target, rr.Code)
+		}
+		var disks []storage.Disk
+		if err := json.NewDecoder(rr.Body).Decode(&disks); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var res []string
+		for _, d := range disks {
+			res = append(res, d.ID)
+		}
+		return res
+	}
+	if got := ids("/api/v1/disks/unpooled"); fmt.Sprint(got) != "[ata-BOOT ata-SPARE]" {
+		t.Fatalf("unpooled = %v, want [ata-BOOT ata-SPARE]", got)
+	}
+	if got := ids("/api/v1/disks/unpooled?exclude_boot=true"); fmt.Sprint(got) != "[ata-SPARE]" {
+		t.Fatalf("unpooled excluding boot = %v, want [ata-SPARE]", got)
+	}
+}
+
+func TestDiskAckHardware(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "ata-RMA"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sdm", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	addSnapshot := func(pending int64, ts int64) {
+		t.Helper()
+		if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{
+			DiskID: id, HealthStatus: "passed", TemperatureC: 35, Pending: pending, Timestamp: ts,
+		}); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+	pendingAlert := func() bool {
+		t.Helper()
+		report, err := srv.health.Summary(ctx)
+		if err != nil {
+			t.Fatalf("summary: %v", err)
+		}
+		for _, a := range report.Alerts {
+			if a.SourceID == id && a.Subject == "Pending sectors" {
+				return true
+			}
+		}
+		return false
+	}
+
+	now := time.Now().Unix()
+	addSnapshot(8, now-60)
+	if !pendingAlert() {
+		t.Fatal("expected pending sectors alert before acknowledgement")
+	}
+
+	rr := doRequest(srv, http.MethodPost, "/api/v1/disks/"+id+"/ack-hardware")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if pendingAlert() {
+		t.Fatal("expected stable pending sectors to be silenced after acknowledgement")
+	}
+
+	// A new pending sector exceeds the baseline and re-alerts.
+	addSnapshot(9, now)
+	if !pendingAlert() {
+		t.Fatal("expected pending sectors alert once counts exceed the baseline")
+	}
+
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/disks/ata-MISSING/ack-hardware"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown disk, got %d", rr.Code)
+	}
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+id+"/ack-hardware"); rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rr.Code)
+	}
+}
+
+func TestNotificationQueueListsPendingEntries(t *testing.T) {
+	_, store := newTestServer(t)
+	ctx := context.Background()
+	n := notifier.New(store, config.NotificationsConfig{
+		Webhooks: []config.WebhookConfig{{Name: "slack", URL: "https://hooks.example.com/services/T000/SECRET"}},
+	}, time.Hour, "warning", slog.Default())
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200}, store, nil, n, Triggers{}, slog.Default())
+
+	alertID, err := store.AddAlert(ctx, storage.Alert{
+		Severity: "critical", SourceType: "disk", SourceID: "sda", Subject: "SMART FAILED", Message: "m", Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		t.Fatalf("add alert: %v", err)
+	}
+	if err := store.EnqueueNotification(ctx, alertID, "webhook:slack"); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	pending, _ := store.GetPendingNotifications(ctx, time.Now(), 10)
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 queued entry, got %d", len(pending))
+	}
+	nextRetry := time.Now().Add(5 * time.Minute)
+	sendErr := `send request: Post "https://hooks.example.com/services/T000/SECRET": dial tcp: i/o timeout`
+	if err := store.MarkNotificationFailed(ctx, pending[0].ID, sendErr, nextRetry); err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/notifications/queue")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		UnsentCount int                   `json:"unsent_count"`
+		Pending     []notifier.QueueEntry `json:"pending"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.UnsentCount != 1 || len(resp.Pending) != 1 {
+		t.Fatalf("expected one pending entry, got %+v", resp)
+	}
+	e := resp.Pending[0]
+	if e.Channel != "webhook:slack" || e.Subject != "SMART FAILED" || e.Severity != "critical" || e.Attempts != 1 {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e.NextRetry != nextRetry.Unix() {
+		t.Fatalf("expected next_retry %d, got %d", nextRetry.Unix(), e.NextRetry)
+	}
+	if strings.Contains(e.LastError, "SECRET") || !strings.Contains(e.LastError, "https://hooks.example.com/[redacted]") {
+		t.Fatalf("expected the webhook URL redacted in last_error, got %q", e.LastError)
+	}
+}
+
+func TestDiskDelete(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "ata-RETIRED"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sdr", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: id, HealthStatus: "passed", Timestamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	// Just discovered, so still present: refused without force.
+	if rr := doRequest(srv, http.MethodDelete, "/api/v1/disks/"+id); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a present disk, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doRequest(srv, http.MethodDelete, "/api/v1/disks/"+id+"?force=true"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 with force, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if d, _ := store.GetDisk(ctx, id); d != nil {
+		t.Fatalf("expected disk row removed, got %+v", d)
+	}
+	if snap, _ := store.LatestSmart(ctx, id); snap != nil {
+		t.Fatalf("expected snapshots removed, got %+v", snap)
+	}
+	if rr := doRequest(srv, http.MethodDelete, "/api/v1/disks/"+id+"?force=true"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 once deleted, got %d", rr.Code)
+	}
+}
+
+func TestListEndpointsHonourETag(t *testing.T) {
+	srv, store := newTestServer(t)
+	if err := store.UpsertDisk(context.Background(), storage.Disk{ID: "ata-A", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	for _, target := range []string{"/api/v1/summary", "/api/v1/disks"} {
+		first := doRequest(srv, http.MethodGet, target)
+		etag := first.Header().Get("ETag")
+		if first.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: expected 200 with an ETag, got %d %q", target, first.Code, etag)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("If-None-Match", etag)
+		rr := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Fatalf("%s: expected an empty 304 for a matching ETag, got %d %q", target, rr.Code, rr.Body.String())
+		}
+	}
+
+	// A change to the listing changes the ETag.
+	before := doRequest(srv, http.MethodGet, "/api/v1/disks").Header().Get("ETag")
+	if err := store.UpsertDisk(context.Background(), storage.Disk{ID: "ata-B", Name: "/dev/sdb", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/disks", nil)
+	req.Header.Set("If-None-Match", before)
+	rr := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == before {
+		t.Fatalf("expected 200 with a new ETag after a change, got %d", rr.Code)
+	}
+}
+
+func TestSummaryETagStableWithActiveAlert(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-A", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "ata-A", HealthStatus: "failed", TemperatureC: 35, Timestamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	first := doRequest(srv, http.MethodGet, "/api/v1/summary")
+	if !strings.Contains(first.Body.String(), `"alerts"`) {
+		t.Fatalf("expected an active alert in the summary, got %s", first.Body.String())
+	}
+	// Alerts are stamped when evaluated; a later evaluation of the same
+	// state must still match.
+	time.Sleep(1100 * time.Millisecond)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/summary", nil)
+	req.Header.Set("If-None-Match", first.Header().Get("ETag"))
+	rr := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for an unchanged summary, got %d", rr.Code)
+	}
+}
+
+func TestCollectSmartWaitReturnsResult(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	for _, name := range []string{"sda", "sdb"} {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-" + name, Name: "/dev/" + name, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	// sdb can't be opened: smartctl sets exit bit 1 and prints no report.
+	bin := filepath.Join(t.TempDir(), "smartctl")
+	script := "#!/bin/sh\nfor a; do last=$a; done\n" +
+		"[ \"$last\" = /dev/sdb ] && exit 2\n" +
+		"echo 'SMART overall-health self-assessment test result: PASSED'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	smart := collectors.NewSmartCollector(store, bin, slog.Default())
+	srv.triggers.CollectSmart = func(ctx context.Context, wait bool) (*types.CollectionResult, error) {
+		disks, err := store.ListDisks(ctx)
+		if err != nil || !wait {
+			return nil, err
+		}
+		result, err := smart.CollectWithResult(ctx, disks)
+		return &result, err
+	}
+
+	rr := doRequest(srv, http.MethodPost, "/api/v1/collect/smart?wait=true")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Status string                 `json:"status"`
+		Result types.CollectionResult `json:"result"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Status != "completed" || resp.Result.Collected != 1 || len(resp.Result.Failures) != 1 || resp.Result.Failures[0].DiskID != "ata-sdb" {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/collect/smart"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 without wait, got %d", rr.Code)
+	}
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/collect/smart?wait=maybe"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad wait value, got %d", rr.Code)
+	}
+}
+
+func TestCollectWaitOutlivesHandlerTimeout(t *testing.T) {
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200, HandlerTimeout: 50 * time.Millisecond}, nil, nil, nil, Triggers{}, slog.Default())
+	srv.triggers.CollectSmart = func(ctx context.Context, wait bool) (*types.CollectionResult, error) {
+		if _, ok := ctx.Deadline(); wait && !ok {
+			t.Error("expected the waited pass to run with its own deadline")
+		}
+		select {
+		case <-time.After(150 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &types.CollectionResult{Collected: 3}, nil
+	}
+
+	rr := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/collect/smart?wait=true", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"collected":3`) {
+		t.Fatalf("expected the pass to complete, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Without wait the handler returns at once and stays under the timeout.
+	srv.triggers.CollectSmart = func(ctx context.Context, wait bool) (*types.CollectionResult, error) {
+		return nil, nil
+	}
+	rr = httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/collect/smart", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rr.Code)
+	}
+}
+
+func TestSnoozeAlert(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id, err := store.AddAlert(ctx, storage.Alert{Severity: "warning", SourceType: "disk", SourceID: "ata-A", Subject: "High temperature", Timestamp: time.Now().Unix()})
+	if err != nil {
+		t.Fatalf("add alert: %v", err)
+	}
+	target := fmt.Sprintf("/api/v1/alerts/%d/snooze", id)
+
+	for _, bad := range []string{"", "?duration=-1h", "?duration=soon", "?duration=2000h"} {
+		if rr := doRequest(srv, http.MethodPost, target+bad); rr.Code != http.StatusBadRequest {
+			t.Errorf("duration %q: expected 400, got %d", bad, rr.Code)
+		}
+	}
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/alerts/999/snooze?duration=4h"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown alert, got %d", rr.Code)
+	}
+
+	rr := doRequest(srv, http.MethodPost, target+"?duration=4h")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	until, err := store.AlertSnoozedUntil(ctx, "disk", "ata-A", "High temperature")
+	if want := time.Now().Add(4 * time.Hour).Unix(); err != nil || until < want-5 || until > want {
+		t.Fatalf("snoozed until %d (%v), want about %d", until, err, want)
+	}
+
+	if rr := doRequest(srv, http.MethodDelete, target); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 lifting the snooze, got %d", rr.Code)
+	}
+	if rr := doRequest(srv, http.MethodDelete, target); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when not snoozed, got %d", rr.Code)
+	}
+}
+
+func TestReadyzAfterInitialCollection(t *testing.T) {
+	srv, store := newTestServer(t)
+	sched := scheduler.New(slog.Default(), config.SchedulingConfig{}, config.CloudConfig{}, store, nil, nil, nil, nil, srv.health, nil, nil)
+	srv.triggers.Ready = sched.Ready
+
+	if rr := doRequest(srv, http.MethodGet, "/livez"); rr.Code != http.StatusOK {
+		t.Fatalf("livez: expected 200, got %d", rr.Code)
+	}
+	if rr := doRequest(srv, http.MethodGet, "/readyz"); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz before collection: expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	sched.Start(context.Background(), true)
+	if rr := doRequest(srv, http.MethodGet, "/readyz"); rr.Code != http.StatusOK {
+		t.Fatalf("readyz after collection: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	_ = store.Close()
+	if rr := doRequest(srv, http.MethodGet, "/readyz"); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz with closed db: expected 503, got %d", rr.Code)
+	}
+}
+
+func TestRefreshSchedules(t *testing.T) {
+	srv, store := newTestServer(t)
+	if rr := doRequest(srv, http.MethodPost, "/api/v1/schedules/refresh"); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without a cloud connection, got %d", rr.Code)
+	}
+
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/agent/schedules" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"schedules":[
+			{"id":"s1","task_type":"ZFS_SCRUB","schedule_type":"CRON","schedule_value":"0 2 * * 0","enabled":true},
+			{"id":"s2","task_type":"SMART_SHORT_TEST","schedule_type":"INTERVAL","schedule_value":"12h","enabled":true}]}`))
+	}))
+	defer cloud.Close()
+
+	// Wired up but with the cloud connection off: a conflict, not a bad gateway.
+	srv.triggers.RefreshSchedules = scheduler.New(slog.Default(), config.SchedulingConfig{}, config.CloudConfig{}, store, nil, nil, nil, nil, srv.health, nil, nil).RefreshSchedules
+	rr := doRequest(srv, http.MethodPost, "/api/v1/schedules/refresh")
+	if rr.Code != http.StatusConflict || rr.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(rr.Body.String(), "cloud.enabled") {
+		t.Fatalf("expected a 409 problem with cloud disabled, got %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+
+	sched := scheduler.New(slog.Default(), config.SchedulingConfig{}, config.CloudConfig{Enabled: true}, store, nil, nil, nil, nil, srv.health, nil,
+		uplink.New(cloud.URL, "token", "host-1", "host"))
+	srv.triggers.RefreshSchedules = sched.RefreshSchedules
+
+	rr = doRequest(srv, http.MethodPost, "/api/v1/schedules/refresh")
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != `{"stored":2}` {
+		t.Fatalf("expected 2 schedules stored, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got, err := store.GetScheduleForTask(context.Background(), "ZFS_SCRUB"); err != nil || got == nil || got.ScheduleValue != "0 2 * * 0" {
+		t.Fatalf("expected the scrub schedule stored, got %+v (%v)", got, err)
+	}
+}
+
+func TestDiskDetailReturnsDecompressedRawOutput(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "nvme-Samsung_SSD_980_PRO_S000"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/nvme0n1", Type: "nvme"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	raw := "Smart Log for NVME device:nvme0n1 namespace-id:ffffffff\n" + strings.Repeat("media_errors : 0\n", 40)
+	if err := store.AddNvmeSnapshot(ctx, storage.NvmeSnapshot{DiskID: id, Timestamp: time.Now().Unix(), RawOutput: raw}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+id)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Latest  storage.NvmeSnapshot   `json:"latest"`
+		History []storage.NvmeSnapshot `json:"history"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Latest.RawOutput != raw || len(resp.History) != 1 || resp.History[0].RawOutput != raw {
+		t.Fatalf("raw output not round-tripped: latest %q", resp.Latest.RawOutput)
+	}
+}
+
+func TestPoolDetailIncludesDeviceRoles(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	devices := []storage.PoolDevice{
+		{DiskID: "ata-DATA_1", Role: "data", VdevType: "mirror"},
+		{DiskID: "ata-DATA_2", Role: "data", VdevType: "mirror"},
+		{DiskID: "nvme-SLOG", Role: "log", VdevType: "disk"},
+		{DiskID: "nvme-L2ARC", Role: "cache", VdevType: "disk"},
+	}
+	for _, d := range devices {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: d.DiskID, Name: "/dev/" + d.DiskID, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	if err := store.SetPoolDevices(ctx, "tank", devices); err != nil {
+		t.Fatalf("set pool devices: %v", err)
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/pools/tank")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var pool struct {
+		Members []storage.PoolDevice `json:"members"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &pool); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	roles := map[string]string{}
+	for _, m := range pool.Members {
+		roles[m.DiskID] = m.Role + "/" + m.VdevType
+	}
+	if len(pool.Members) != 4 || pool.Members[0].Role != "data" ||
+		roles["nvme-SLOG"] != "log/disk" || roles["nvme-L2ARC"] != "cache/disk" || roles["ata-DATA_1"] != "data/mirror" {
+		t.Fatalf("unexpected members %+v", pool.Members)
+	}
+
+	rr = doRequest(srv, http.MethodGet, "/api/v1/disks/nvme-SLOG")
+	var disk struct {
+		Role  string                   `json:"role"`
+		Pools []storage.PoolMembership `json:"pools"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &disk); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if disk.Role != "log" || len(disk.Pools) != 1 || disk.Pools[0].Role != "log" || disk.Pools[0].VdevType != "disk" {
+		t.Fatalf("unexpected disk detail role %q, pools %+v", disk.Role, disk.Pools)
+	}
+}
+
+func TestDisksLatest(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	now := time.Now().Unix()
+	for _, d := range []storage.Disk{
+		{ID: "ata-A", Name: "/dev/sda", Type: "hdd"},
+		{ID: "ata-B", Name: "/dev/sdb", Type: "hdd"},
+		{ID: "nvme-C", Name: "/dev/nvme0n1", Type: "nvme"},
+		{ID: "ata-NEW", Name: "/dev/sdc", Type: "hdd"}, // no readings yet
+	} {
+		if err := store.UpsertDisk(ctx, d); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	for i := int64(0); i < 3; i++ {
+		for id, status := range map[string]string{"ata-A": "passed", "ata-B": "failed"} {
+			if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: id, HealthStatus: status, TemperatureC: float64(30 + i), Timestamp: now - 100 + i}); err != nil {
+				t.Fatalf("add smart: %v", err)
+			}
+		}
+		if err := store.AddNvmeSnapshot(ctx, storage.NvmeSnapshot{DiskID: "nvme-C", PercentUsed: float64(i), Timestamp: now - 100 + i}); err != nil {
+			t.Fatalf("add nvme: %v", err)
+		}
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/disks/latest")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp []struct {
+		Disk   storage.Disk      `json:"disk"`
+		Latest json.RawMessage   `json:"latest"`
+		Health *types.DiskHealth `json:"health"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 4 {
+		t.Fatalf("expected 4 disks, got %d", len(resp))
+	}
+	for _, e := range resp {
+		if e.Health == nil || e.Health.ID != e.Disk.ID {
+			t.Errorf("%s: missing health %+v", e.Disk.ID, e.Health)
+		}
+		switch e.Disk.ID {
+		case "ata-A", "ata-B":
+			var snap storage.SmartSnapshot
+			if err := json.Unmarshal(e.Latest, &snap); err != nil || snap.TemperatureC != 32 {
+				t.Errorf("%s: latest = %s (%v)", e.Disk.ID, e.Latest, err)
+			}
+			if e.Disk.ID == "ata-B" && e.Health != nil && e.Health.Status != "critical" {
+				t.Errorf("ata-B: expected failed SMART to be critical, got %+v", e.Health)
+			}
+		case "nvme-C":
+			var snap storage.NvmeSnapshot
+			if err := json.Unmarshal(e.Latest, &snap); err != nil || snap.PercentUsed != 2 {
+				t.Errorf("%s: latest = %s (%v)", e.Disk.ID, e.Latest, err)
+			}
+		case "ata-NEW":
+			if string(e.Latest) != "null" {
+				t.Errorf("ata-NEW: expected no reading, got %s", e.Latest)
+			}
+		}
+	}
+	// A read must not store the alerts it evaluates.
+	if alerts, _ := store.ListAlerts(ctx, storage.AlertFilter{Limit: 10}); len(alerts) != 0 {
+		t.Fatalf("expected no alerts stored by the GET, got %d", len(alerts))
+	}
+}
+
+func TestEventsStreamsAlertsAndReplays(t *testing.T) {
+	srv, store := newTestServer(t)
+	ts := httptest.NewServer(srv.srv.Handler)
+	defer ts.Close()
+	ctx := context.Background()
+
+	// readEvent returns the id, type and data of the next frame.
+	readEvent := func(r *bufio.Reader) (id, event, data string) {
+		t.Helper()
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "" && event != "":
+				return id, event, data
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+	connect := func(lastID string) (*http.Response, *bufio.Reader) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/events", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	resp, body := connect("")
+	for store.Events().Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	first, err := store.AddAlert(ctx, storage.Alert{Severity: "critical", SourceType: "disk", SourceID: "sda", Subject: "SMART failure", Message: "failed", Timestamp: time.Now().Unix()})
+	if err != nil {
+		t.Fatalf("add alert: %v", err)
+	}
+	id, event, data := readEvent(body)
+	if id != strconv.FormatInt(first, 10) || event != "alert" || !strings.Contains(data, `"Subject":"SMART failure"`) {
+		t.Fatalf("unexpected event id=%q event=%q data=%s", id, event, data)
+	}
+	resp.Body.Close()
+	for store.Events().Subscribers() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// An alert stored while disconnected is replayed on reconnect.
+	second, err := store.AddAlert(ctx, storage.Alert{Severity: "warning", SourceType: "pool", SourceID: "tank", Subject: "Pool degraded", Message: "degraded", Timestamp: time.Now().Unix()})
+	if err != nil {
+		t.Fatalf("add alert: %v", err)
+	}
+	resp, body = connect(id)
+	defer resp.Body.Close()
+	id, _, data = readEvent(body)
+	if id != strconv.FormatInt(second, 10) || !strings.Contains(data, "Pool degraded") {
+		t.Fatalf("expected the missed alert to be replayed, got id=%q data=%s", id, data)
+	}
+}
+
+func TestSummaryPollingPublishesRaisedAlertOnce(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	if err := store.UpsertPool(ctx, "tank", "DEGRADED", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	stream, unsubscribe := store.Events().Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		if rr := doRequest(srv, http.MethodGet, "/api/v1/summary"); rr.Code != http.StatusOK {
+			t.Fatalf("summary: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	var published []events.Event
+	for len(stream) > 0 {
+		published = append(published, <-stream)
+	}
+	if len(published) != 1 || published[0].Data.(storage.Alert).SourceID != "tank" {
+		t.Fatalf("expected only the newly raised pool alert published, got %+v", published)
+	}
+	if alerts, _ := store.ListAlerts(ctx, storage.AlertFilter{Limit: 10}); len(alerts) != 1 {
+		t.Fatalf("expected one stored alert, got %d", len(alerts))
+	}
+}
+
+func TestEventsStreamWithoutAcceptHeader(t *testing.T) {
+	_, store := newTestServer(t)
+	provider := health.NewStorageBackedProvider(store, slog.Default())
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200, HandlerTimeout: 50 * time.Millisecond}, store, provider, nil, Triggers{}, slog.Default())
+	ts := httptest.NewServer(srv.srv.Handler)
+	defer ts.Close()
+
+	// Plain clients such as curl send no Accept header; the stream must
+	// still work and outlive the handler timeout.
+	resp, err := ts.Client().Get(ts.URL + "/api/v1/events")
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for store.Events().Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := store.AddAlert(context.Background(), storage.Alert{Severity: "critical", SourceType: "disk", SourceID: "sda", Subject: "SMART failure", Message: "failed", Timestamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("add alert: %v", err)
+	}
+	body := bufio.NewReader(resp.Body)
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if !strings.Contains(line, "SMART failure") {
+				t.Fatalf("unexpected event data %q", line)
+			}
+			return
+		}
+	}
+}
+
+func TestDiskTimeSeriesBucketsAndAligns(t *testing.T) {
+	srv, store := newTestServer(t)
+	ctx := context.Background()
+	id := "ata-TEST"
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	// Three snapshots in one hour bucket two hours ago, one in the previous
+	// hour's bucket, and one outside the window.
+	bucket := (time.Now().Unix()/3600 - 2) * 3600
+	snaps := []storage.SmartSnapshot{
+		{TemperatureC: 30, Reallocated: 0, Timestamp: bucket + 60},
+		{TemperatureC: 40, Reallocated: 2, Timestamp: bucket + 1800},
+		{TemperatureC: 50, Reallocated: 4, Timestamp: bucket + 3599},
+		{TemperatureC: 35, Reallocated: 0, Timestamp: bucket - 10},
+		{TemperatureC: 99, Reallocated: 9, Timestamp: bucket - 48*3600},
+	}
+	for _, snap := range snaps {
+		snap.DiskID, snap.HealthStatus = id, "passed"
+		if err := store.AddSmartSnapshot(ctx, snap); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+
+	rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+id+"/timeseries?metrics=temperature,reallocated&window=6h&step=1h")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Step       int64                 `json:"step"`
+		Timestamps []int64               `json:"timestamps"`
+		Series     map[string][]*float64 `json:"series"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Step != 3600 || len(resp.Timestamps) < 6 || len(resp.Timestamps) > 7 {
+		t.Fatalf("expected 6-7 hourly buckets, got step %d, %v", resp.Step, resp.Timestamps)
+	}
+	for i, ts := range resp.Timestamps {
+		if ts%3600 != 0 {
+			t.Fatalf("bucket %d at %d is not aligned to the step", i, ts)
+		}
+		if i > 0 && ts-resp.Timestamps[i-1] != 3600 {
+			t.Fatalf("buckets %d and %d are not one step apart", i-1, i)
+		}
+	}
+	for _, m := range []string{"temperature", "reallocated"} {
+		if len(resp.Series[m]) != len(resp.Timestamps) {
+			t.Fatalf("series %s has %d points for %d buckets", m, len(resp.Series[m]), len(resp.Timestamps))
+		}
+	}
+
+	values := map[int64][2]*float64{}
+	for i, ts := range resp.Timestamps {
+		values[ts] = [2]*float64{resp.Series["temperature"][i], resp.Series["reallocated"][i]}
+	}
+	if v := values[bucket]; v[0] == nil || *v[0] != 40 || v[1] == nil || *v[1] != 2 {
+		t.Fatalf("expected averages 40 and 2 in the downsampled bucket, got %v", v)
+	}
+	if v := values[bucket-3600]; v[0] == nil || *v[0] != 35 {
+		t.Fatalf("expected 35 in the previous bucket, got %v", v)
+	}
+	if v := values[bucket+3600]; v[0] != nil || v[1] != nil {
+		t.Fatalf("expected an empty bucket to be null, got %v", v)
+	}
+	for i := range resp.Timestamps {
+		if v := resp.Series["temperature"][i]; v != nil && *v == 99 {
+			t.Fatal("snapshot outside the window was included")
+		}
+	}
+
+	if rr := doRequest(srv, http.MethodGet, "/api/v1/disks/"+id+"/timeseries?metrics=percent_used"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an NVMe-only metric on a SATA disk, got %d", rr.Code)
+	}
+}
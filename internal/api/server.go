@@ -6,12 +6,16 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/config"
 	"github.com/metabinary-ltd/storagesentinel/internal/health"
 	"github.com/metabinary-ltd/storagesentinel/internal/notifier"
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
 
 type Server struct {
@@ -28,10 +32,27 @@ type Server struct {
 }
 
 type Triggers struct {
-	CollectSmart func(context.Context) error
-	CollectNvme  func(context.Context) error
+	// CollectSmart and CollectNvme start a collection pass. With wait they
+	// run it to completion and return its result; otherwise they return as
+	// soon as it has started, with a nil result.
+	CollectSmart func(ctx context.Context, wait bool) (*types.CollectionResult, error)
+	CollectNvme  func(ctx context.Context, wait bool) (*types.CollectionResult, error)
 	CollectZfs   func(context.Context) error
 	TriggerScrub func(context.Context, string) error
+	LocateDisk   func(ctx context.Context, diskID string, duration time.Duration) error
+
+	// RefreshSchedules polls cloud schedules now and returns how many were
+	// stored. Nil when the agent has no cloud connection.
+	RefreshSchedules func(context.Context) (int, error)
+
+	// OpenBreakers lists scheduled actions (e.g. "scrub:tank") suspended
+	// after repeated failures to start, and ResetBreaker re-enables one.
+	OpenBreakers func() []string
+	ResetBreaker func(key string)
+
+	// Ready reports whether initial discovery and collection have finished;
+	// /readyz returns 503 until it does. Nil means always ready.
+	Ready func() bool
 }
 
 func NewServer(cfg config.APIConfig, store *storage.Store, healthProvider health.Provider, notifier *notifier.Notifier, triggers Triggers, logger *slog.Logger) *Server {
@@ -48,8 +69,8 @@ func NewServer(cfg config.APIConfig, store *storage.Store, healthProvider health
 	}
 	s.registerRoutes()
 	s.srv = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.BindAddress, cfg.Port),
-		Handler: s.mux,
+		Addr:    cfg.Addr(),
+		Handler: withTimeout(s.mux, cfg.HandlerTimeout),
 		BaseContext: func(l net.Listener) context.Context {
 			return context.Background()
 		},
@@ -57,15 +78,107 @@ func NewServer(cfg config.APIConfig, store *storage.Store, healthProvider health
 	return s
 }
 
+// timeoutBody is returned with a 503 when a handler exceeds the deadline.
+const timeoutBody = `{"type":"about:blank","title":"Service Unavailable","status":503,"detail":"request timed out"}`
+
+// withTimeout bounds handler execution so a slow store query (e.g. during
+// VACUUM or lock contention) can't hang a request indefinitely. Routes that
+// are long-lived by design are exempt; see exemptFromTimeout.
+func withTimeout(h http.Handler, d time.Duration) http.Handler {
+	if d <= 0 {
+		return h
+	}
+	timed := http.TimeoutHandler(h, d, timeoutBody)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exemptFromTimeout(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		timed.ServeHTTP(problemTimeoutWriter{w}, r)
+	})
+}
+
+// problemTimeoutWriter labels the 503 that http.TimeoutHandler writes on
+// timeout, which carries timeoutBody but no Content-Type, as problem+json.
+// Responses that completed in time keep the headers their handler set.
+type problemTimeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (w problemTimeoutWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/problem+json")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// exemptFromTimeout reports whether r is served without the handler
+// timeout. The event stream stays open for as long as the client listens,
+// and a SMART/NVMe collection with ?wait=true runs under its own, longer
+// collectWaitTimeout. The decision is made by route, not by request
+// headers, so a client can't opt an arbitrary handler out of the deadline.
+func exemptFromTimeout(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/v1/events":
+		return true
+	case "/api/v1/collect/smart", "/api/v1/collect/nvme":
+		wait, _ := strconv.ParseBool(r.URL.Query().Get("wait"))
+		return wait
+	}
+	return false
+}
+
 func (s *Server) Start() error {
-	s.logger.Info("starting api server", "addr", s.srv.Addr)
+	listener, err := activationListener()
+	if err != nil {
+		return err
+	}
 	s.started = true
-	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if listener != nil {
+		s.logger.Info("starting api server (socket activated)", "addr", listener.Addr().String())
+		err = s.srv.Serve(listener)
+	} else {
+		s.logger.Info("starting api server", "addr", s.srv.Addr)
+		err = s.srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return err
 	}
 	return nil
 }
 
+// listenFDsStart is the first file descriptor passed by systemd (SD_LISTEN_FDS_START).
+var listenFDsStart uintptr = 3
+
+// activationListener returns the listener handed over by systemd socket
+// activation (LISTEN_PID/LISTEN_FDS), or nil when the process was not
+// socket-activated and should bind the configured address itself.
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds < 1 {
+		return nil, nil
+	}
+	// Don't leak the activation environment to child processes.
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(listenFDsStart, "systemd-socket")
+	if f == nil {
+		return nil, fmt.Errorf("socket activation: invalid fd %d", listenFDsStart)
+	}
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	return l, nil
+}
+
 func (s *Server) Stop(ctx context.Context) error {
 	if !s.started {
 		return nil
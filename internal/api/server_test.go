@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+)
+
+func TestStartSocketActivated(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("listener file: %v", err)
+	}
+	// activationListener takes ownership of the descriptor and closes it, as
+	// with the one systemd passes. Hand it a bare duplicate: if f still owned
+	// it, f's finalizer would close the number again later, by then possibly
+	// reused by another test's database file.
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("dup listener fd: %v", err)
+	}
+
+	prevStart := listenFDsStart
+	listenFDsStart = uintptr(fd)
+	defer func() { listenFDsStart = prevStart }()
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+
+	// Port 1 is never bound here; serving on it would fail the request below.
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 1}, nil, nil, nil, Triggers{}, slog.Default())
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Start() }()
+	defer srv.Stop(context.Background())
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = client.Get("http://" + l.Addr().String() + "/health")
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("request via activated socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatalf("expected activation env to be cleared")
+	}
+}
+
+func TestActivationListenerNotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	l, err := activationListener()
+	if err != nil || l != nil {
+		t.Fatalf("expected no listener for foreign LISTEN_PID, got %v, %v", l, err)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	srv := NewServer(config.APIConfig{BindAddress: "127.0.0.1", Port: 8200, HandlerTimeout: 50 * time.Millisecond}, nil, nil, nil, Triggers{}, slog.Default())
+	srv.mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		case <-r.Context().Done():
+		}
+	})
+
+	rr := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rr.Code)
+	}
+	if rr.Body.String() != timeoutBody {
+		t.Fatalf("unexpected body %q", rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("expected problem+json content type, got %q", ct)
+	}
+
+	// Asking for an event stream doesn't lift the deadline on other routes.
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	rr = httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 despite the Accept header, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected fast handler to succeed, got %d", rr.Code)
+	}
+}
@@ -3,12 +3,98 @@ package collectors
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os/exec"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+// DefaultMaxConcurrentCommands bounds subprocesses across all collectors and
+// on-demand triggers combined.
+const DefaultMaxConcurrentCommands = 8
+
+var (
+	cmdSemMu sync.RWMutex
+	cmdSem   = make(chan struct{}, DefaultMaxConcurrentCommands)
 )
 
+// SetMaxConcurrentCommands sets the global ceiling on concurrent runCommand
+// invocations. Commands already running keep their slot in the old pool.
+func SetMaxConcurrentCommands(n int) {
+	if n <= 0 {
+		n = DefaultMaxConcurrentCommands
+	}
+	cmdSemMu.Lock()
+	cmdSem = make(chan struct{}, n)
+	cmdSemMu.Unlock()
+}
+
+// ErrCollectionInProgress is returned by Collect when the previous collection
+// of the same kind is still running.
+var ErrCollectionInProgress = errors.New("collection already in progress")
+
+// runGuard lets only one collection of a kind run at a time. An overlapping
+// call fails fast instead of queueing, so a slow pass doesn't double up
+// subprocesses or race the running one on inserts.
+type runGuard struct {
+	mu sync.Mutex
+}
+
+// start claims the guard; the returned func releases it.
+func (g *runGuard) start() (func(), error) {
+	if !g.mu.TryLock() {
+		return nil, ErrCollectionInProgress
+	}
+	return g.mu.Unlock, nil
+}
+
+// recordMetrics gates per-collector and per-disk duration recording
+// (scheduling.collection_metrics).
+var recordMetrics atomic.Bool
+
+// SetRecordMetrics enables storing collection durations for diagnostics.
+func SetRecordMetrics(enabled bool) {
+	recordMetrics.Store(enabled)
+}
+
+// recordDuration stores how long a collection that began at start took.
+// diskID is empty for a whole collector pass.
+func recordDuration(ctx context.Context, store *storage.Store, logger *slog.Logger, collector, diskID string, start time.Time) {
+	if !recordMetrics.Load() || store == nil {
+		return
+	}
+	m := storage.CollectionMetric{Collector: collector, DiskID: diskID, Duration: time.Since(start)}
+	if err := store.RecordCollectionMetric(ctx, m); err != nil {
+		logger.Debug("failed to record collection metric", "collector", collector, "disk", diskID, "error", err)
+	}
+}
+
+// acquireCommandSlot blocks until a subprocess slot is free or ctx is done.
+// The returned func releases the slot.
+func acquireCommandSlot(ctx context.Context) (func(), error) {
+	cmdSemMu.RLock()
+	sem := cmdSem
+	cmdSemMu.RUnlock()
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func runCommand(ctx context.Context, cmd string, args ...string) (string, error) {
+	release, err := acquireCommandSlot(ctx)
+	if err != nil {
+		return "", fmt.Errorf("waiting for command slot: %w", err)
+	}
+	defer release()
+
 	c := exec.CommandContext(ctx, cmd, args...)
 	var buf bytes.Buffer
 	c.Stdout = &buf
@@ -0,0 +1,59 @@
+package collectors
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCommandSemaphoreCapsConcurrency(t *testing.T) {
+	SetMaxConcurrentCommands(2)
+	defer SetMaxConcurrentCommands(DefaultMaxConcurrentCommands)
+
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := acquireCommandSlot(context.Background())
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			defer release()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent commands, saw %d", peak)
+	}
+}
+
+func TestRunCommandHonorsContextWhileWaiting(t *testing.T) {
+	SetMaxConcurrentCommands(1)
+	defer SetMaxConcurrentCommands(DefaultMaxConcurrentCommands)
+
+	release, err := acquireCommandSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := runCommand(ctx, "true"); err == nil {
+		t.Fatalf("expected runCommand to give up waiting for a slot")
+	}
+}
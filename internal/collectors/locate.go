@@ -0,0 +1,133 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+// ErrLocateUnsupported is returned when the disk's enclosure (or the
+// configured tool) can't drive a locate LED for it.
+var ErrLocateUnsupported = errors.New("locate LED not supported for this disk")
+
+const (
+	DefaultLocateDuration = time.Minute
+	MaxLocateDuration     = 30 * time.Minute
+)
+
+// Locator blinks enclosure locate LEDs via ledctl (ledmon) or sg_ses
+// (sg3_utils), switching them off again after a bounded duration.
+type Locator struct {
+	logger  *slog.Logger
+	binPath string
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func NewLocator(binPath string, logger *slog.Logger) *Locator {
+	return &Locator{binPath: binPath, logger: logger, timers: make(map[string]*time.Timer)}
+}
+
+// Locate turns the disk's locate LED on for duration. Calling it again while
+// the LED is lit extends the window.
+func (l *Locator) Locate(ctx context.Context, disk storage.Disk, duration time.Duration) error {
+	if duration <= 0 {
+		duration = DefaultLocateDuration
+	}
+	if duration > MaxLocateDuration {
+		duration = MaxLocateDuration
+	}
+
+	on, err := locateArgs(l.binPath, disk.Name, true)
+	if err != nil {
+		return err
+	}
+	off, _ := locateArgs(l.binPath, disk.Name, false)
+
+	ctx, cancel := ctxWithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := runCommand(ctx, l.binPath, on...); err != nil {
+		l.logger.Warn("locate LED failed", "disk", disk.Name, "error", err)
+		return fmt.Errorf("%w: %v", ErrLocateUnsupported, err)
+	}
+
+	l.mu.Lock()
+	if t, ok := l.timers[disk.ID]; ok {
+		t.Stop()
+	}
+	l.timers[disk.ID] = time.AfterFunc(duration, func() {
+		l.mu.Lock()
+		delete(l.timers, disk.ID)
+		l.mu.Unlock()
+		ctx, cancel := ctxWithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := runCommand(ctx, l.binPath, off...); err != nil {
+			l.logger.Warn("failed to switch off locate LED", "disk", disk.Name, "error", err)
+		}
+	})
+	l.mu.Unlock()
+
+	l.logger.Info("locate LED on", "disk", disk.Name, "duration", duration)
+	return nil
+}
+
+// locateArgs builds the tool arguments to switch a disk's locate LED on or
+// off. The tool flavor is chosen by the binary's base name.
+func locateArgs(binPath, devName string, on bool) ([]string, error) {
+	switch filepath.Base(binPath) {
+	case "ledctl":
+		if on {
+			return []string{"locate=" + devName}, nil
+		}
+		return []string{"locate_off=" + devName}, nil
+	case "sg_ses":
+		enclosure, slot, err := sesSlot(devName)
+		if err != nil {
+			return nil, err
+		}
+		action := "--clear=locate"
+		if on {
+			action = "--set=locate"
+		}
+		return []string{"--dev-slot-num=" + slot, action, enclosure}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown locate tool %q (expected ledctl or sg_ses)", ErrLocateUnsupported, binPath)
+	}
+}
+
+// sysfsRoot is swapped out in tests.
+var sysfsRoot = "/sys"
+
+// sesSlot finds the SES enclosure sg device and slot number for a block
+// device through the kernel's enclosure links:
+// /sys/block/sdX/device/enclosure_device:<slot> -> /sys/class/enclosure/<enc>/<slot>
+func sesSlot(devName string) (string, string, error) {
+	name := filepath.Base(devName)
+	matches, _ := filepath.Glob(filepath.Join(sysfsRoot, "block", name, "device", "enclosure_device:*"))
+	if len(matches) == 0 {
+		return "", "", fmt.Errorf("%w: %s is not in an SES enclosure", ErrLocateUnsupported, name)
+	}
+	link := matches[0]
+	slotDir, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrLocateUnsupported, err)
+	}
+	slotData, err := os.ReadFile(filepath.Join(slotDir, "slot"))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: no slot number for %s", ErrLocateUnsupported, name)
+	}
+	sgs, _ := filepath.Glob(filepath.Join(filepath.Dir(slotDir), "device", "scsi_generic", "sg*"))
+	if len(sgs) == 0 {
+		return "", "", fmt.Errorf("%w: no sg device for the enclosure of %s", ErrLocateUnsupported, name)
+	}
+	return "/dev/" + filepath.Base(sgs[0]), strings.TrimSpace(string(slotData)), nil
+}
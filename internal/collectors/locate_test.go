@@ -0,0 +1,61 @@
+package collectors
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLocateArgsLedctl(t *testing.T) {
+	on, err := locateArgs("/usr/sbin/ledctl", "/dev/sdc", true)
+	if err != nil {
+		t.Fatalf("on: %v", err)
+	}
+	off, _ := locateArgs("ledctl", "/dev/sdc", false)
+	if !reflect.DeepEqual(on, []string{"locate=/dev/sdc"}) || !reflect.DeepEqual(off, []string{"locate_off=/dev/sdc"}) {
+		t.Fatalf("unexpected args: on %v off %v", on, off)
+	}
+}
+
+func TestLocateArgsSgSes(t *testing.T) {
+	root := t.TempDir()
+	slotDir := filepath.Join(root, "class", "enclosure", "0:0:8:0", "Slot 04")
+	mustMkdir(t, slotDir)
+	mustMkdir(t, filepath.Join(root, "class", "enclosure", "0:0:8:0", "device", "scsi_generic", "sg9"))
+	if err := os.WriteFile(filepath.Join(slotDir, "slot"), []byte("4\n"), 0o644); err != nil {
+		t.Fatalf("write slot: %v", err)
+	}
+	devDir := filepath.Join(root, "block", "sdc", "device")
+	mustMkdir(t, devDir)
+	if err := os.Symlink(slotDir, filepath.Join(devDir, "enclosure_device:Slot 04")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	prev := sysfsRoot
+	sysfsRoot = root
+	defer func() { sysfsRoot = prev }()
+
+	on, err := locateArgs("/usr/bin/sg_ses", "/dev/sdc", true)
+	if err != nil {
+		t.Fatalf("on: %v", err)
+	}
+	if want := []string{"--dev-slot-num=4", "--set=locate", "/dev/sg9"}; !reflect.DeepEqual(on, want) {
+		t.Fatalf("expected %v, got %v", want, on)
+	}
+
+	if _, err := locateArgs("sg_ses", "/dev/sdd", true); !errors.Is(err, ErrLocateUnsupported) {
+		t.Fatalf("expected unsupported for disk outside an enclosure, got %v", err)
+	}
+	if _, err := locateArgs("blinkenlights", "/dev/sdc", true); !errors.Is(err, ErrLocateUnsupported) {
+		t.Fatalf("expected unsupported for unknown tool, got %v", err)
+	}
+}
+
+func mustMkdir(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir %s: %v", dir, err)
+	}
+}
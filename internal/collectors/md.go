@@ -0,0 +1,146 @@
+package collectors
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+// procMdstat is read for the list of md arrays; a variable so tests can
+// point it at a fixture.
+var procMdstat = "/proc/mdstat"
+
+// MdCollector records Linux software RAID (mdadm) array state
+// (storage.md_enable).
+type MdCollector struct {
+	store  *storage.Store
+	logger *slog.Logger
+	mdadm  string
+}
+
+func NewMdCollector(store *storage.Store, mdadmPath string, logger *slog.Logger) *MdCollector {
+	return &MdCollector{store: store, mdadm: mdadmPath, logger: logger}
+}
+
+func (c *MdCollector) Collect(ctx context.Context) error {
+	defer recordDuration(ctx, c.store, c.logger, "md", "", time.Now())
+
+	b, err := os.ReadFile(procMdstat)
+	if err != nil {
+		c.logger.Warn("reading mdstat failed", "path", procMdstat, "error", err)
+		return nil
+	}
+	arrays := parseMdstat(string(b))
+
+	// mdadm --detail has the authoritative state string ("clean, degraded,
+	// recovering"); mdstat alone only says active or inactive.
+	for i := range arrays {
+		detailCtx, cancel := ctxWithTimeout(ctx, 10*time.Second)
+		out, err := runCommand(detailCtx, c.mdadm, "--detail", "/dev/"+arrays[i].Name)
+		cancel()
+		if err != nil {
+			c.logger.Debug("mdadm --detail failed", "array", arrays[i].Name, "error", err)
+			continue
+		}
+		if state := parseMdadmDetailState(out); state != "" {
+			arrays[i].State = state
+		}
+	}
+
+	if err := c.store.SetMDArrays(ctx, arrays); err != nil {
+		c.logger.Warn("failed to store md arrays", "error", err)
+	}
+	return nil
+}
+
+var (
+	// mdMemberRe matches a member in an mdstat array line, e.g. sda1[0] or
+	// sde1[2](F).
+	mdMemberRe = regexp.MustCompile(`^([^\[\s]+)\[\d+\](?:\(([A-Z])\))?$`)
+	// mdStatusRe matches the [total/active] device counts, e.g. [3/2].
+	mdStatusRe = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	// mdSyncRe matches a running sync line, e.g. "recovery = 12.6% (...)".
+	mdSyncRe = regexp.MustCompile(`(recovery|resync|reshape|check)\s*=\s*([\d.]+)%`)
+)
+
+// mdMemberStates maps mdstat member flags to states.
+var mdMemberStates = map[string]string{"": "active", "F": "faulty", "S": "spare", "R": "replacement", "W": "active"}
+
+// parseMdstat reads /proc/mdstat. Each array starts with a line such as
+//
+//	md1 : active raid5 sdd1[3] sdc1[1] sde1[0](F)
+//
+// followed by indented lines carrying the [total/active] counts and, while
+// running, a recovery/resync/reshape/check progress line.
+func parseMdstat(out string) []storage.MDArray {
+	var arrays []storage.MDArray
+	var cur *storage.MDArray
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			cur = nil
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			cur = nil
+			name, rest, ok := strings.Cut(line, " : ")
+			if !ok || !strings.HasPrefix(name, "md") {
+				continue // Personalities, unused devices
+			}
+			arrays = append(arrays, parseMdstatArrayLine(strings.TrimSpace(name), rest))
+			cur = &arrays[len(arrays)-1]
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if m := mdStatusRe.FindStringSubmatch(line); m != nil && cur.RaidDisks == 0 {
+			cur.RaidDisks, _ = strconv.Atoi(m[1])
+			cur.ActiveDisks, _ = strconv.Atoi(m[2])
+		}
+		if m := mdSyncRe.FindStringSubmatch(line); m != nil {
+			cur.SyncAction = m[1]
+			cur.SyncProgress, _ = strconv.ParseFloat(m[2], 64)
+		}
+	}
+	return arrays
+}
+
+func parseMdstatArrayLine(name, rest string) storage.MDArray {
+	a := storage.MDArray{Name: name}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return a
+	}
+	a.State = fields[0]
+	for _, f := range fields[1:] {
+		if m := mdMemberRe.FindStringSubmatch(f); m != nil {
+			a.Members = append(a.Members, storage.MDMember{Device: m[1], State: mdMemberStates[m[2]]})
+			continue
+		}
+		if strings.HasPrefix(f, "(") { // (auto-read-only), (read-only)
+			continue
+		}
+		if a.Level == "" {
+			a.Level = f
+		}
+	}
+	return a
+}
+
+// parseMdadmDetailState returns the "State :" value from `mdadm --detail`,
+// e.g. "clean, degraded, recovering".
+func parseMdadmDetailState(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, " : ")
+		if ok && strings.TrimSpace(key) == "State" {
+			return strings.TrimSpace(val)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package collectors
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+const mdstatOutput = `Personalities : [raid1] [raid6] [raid5] [raid4] [linear]
+md0 : active raid1 sdb1[1] sda1[0]
+      1953382464 blocks super 1.2 [2/2] [UU]
+      bitmap: 0/15 pages [0KB], 65536KB chunk
+
+md1 : active raid5 sdd1[3] sdc1[1] sde1[0](F)
+      3906764800 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [_UU]
+      [==>..................]  recovery = 12.6% (246183424/1953382400) finish=151.6min speed=187628K/sec
+
+md2 : active (auto-read-only) raid1 sdg1[1] sdf1[0] sdh1[2](S)
+      976630464 blocks super 1.2 [2/2] [UU]
+      [=========>...........]  check = 47.1% (460323904/976630464) finish=48.2min speed=178421K/sec
+
+md3 : inactive sdi1[0](S)
+      976630471 blocks super 1.2
+
+unused devices: <none>
+`
+
+func TestParseMdstat(t *testing.T) {
+	got := parseMdstat(mdstatOutput)
+	want := []storage.MDArray{
+		{Name: "md0", Level: "raid1", State: "active", RaidDisks: 2, ActiveDisks: 2,
+			Members: []storage.MDMember{{Device: "sdb1", State: "active"}, {Device: "sda1", State: "active"}}},
+		{Name: "md1", Level: "raid5", State: "active", RaidDisks: 3, ActiveDisks: 2,
+			SyncAction: "recovery", SyncProgress: 12.6,
+			Members: []storage.MDMember{{Device: "sdd1", State: "active"}, {Device: "sdc1", State: "active"}, {Device: "sde1", State: "faulty"}}},
+		{Name: "md2", Level: "raid1", State: "active", RaidDisks: 2, ActiveDisks: 2,
+			SyncAction: "check", SyncProgress: 47.1,
+			Members: []storage.MDMember{{Device: "sdg1", State: "active"}, {Device: "sdf1", State: "active"}, {Device: "sdh1", State: "spare"}}},
+		{Name: "md3", State: "inactive",
+			Members: []storage.MDMember{{Device: "sdi1", State: "spare"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseMdstat =\n%+v\nwant\n%+v", got, want)
+	}
+	if got[0].Degraded() || !got[1].Degraded() {
+		t.Fatalf("expected only md1 degraded")
+	}
+}
+
+func TestParseMdadmDetailState(t *testing.T) {
+	out := "/dev/md1:\n" +
+		"           Version : 1.2\n" +
+		"        Raid Level : raid5\n" +
+		"             State : clean, degraded, recovering \n" +
+		"    Active Devices : 2\n"
+	if got := parseMdadmDetailState(out); got != "clean, degraded, recovering" {
+		t.Fatalf("parseMdadmDetailState = %q", got)
+	}
+	if got := parseMdadmDetailState("mdadm: cannot open /dev/md9: No such file or directory\n"); got != "" {
+		t.Fatalf("expected no state, got %q", got)
+	}
+}
@@ -3,18 +3,21 @@ package collectors
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
 
 type NvmeCollector struct {
 	store   *storage.Store
 	logger  *slog.Logger
 	binPath string
+	running runGuard
 }
 
 func NewNvmeCollector(store *storage.Store, binPath string, logger *slog.Logger) *NvmeCollector {
@@ -22,29 +25,102 @@ func NewNvmeCollector(store *storage.Store, binPath string, logger *slog.Logger)
 }
 
 func (c *NvmeCollector) Collect(ctx context.Context, disks []storage.Disk) error {
+	_, err := c.CollectWithResult(ctx, disks)
+	return err
+}
+
+// CollectWithResult is Collect, also reporting which disks were collected
+// and which failed.
+func (c *NvmeCollector) CollectWithResult(ctx context.Context, disks []storage.Disk) (types.CollectionResult, error) {
+	var result types.CollectionResult
+	done, err := c.running.start()
+	if err != nil {
+		return result, err
+	}
+	defer done()
+
+	start := time.Now()
 	for _, d := range disks {
 		if d.Type != "nvme" {
 			continue
 		}
-		c.collectDisk(ctx, d)
+		diskStart := time.Now()
+		if err := c.collectDisk(ctx, d); err != nil {
+			result.Failures = append(result.Failures, types.CollectionFailure{DiskID: d.ID, Name: d.Name, Error: err.Error()})
+		} else {
+			result.Collected++
+		}
+		recordDuration(ctx, c.store, c.logger, "nvme", d.ID, diskStart)
 	}
-	return nil
+	recordDuration(ctx, c.store, c.logger, "nvme", "", start)
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
 }
 
-func (c *NvmeCollector) collectDisk(ctx context.Context, disk storage.Disk) {
+func (c *NvmeCollector) collectDisk(ctx context.Context, disk storage.Disk) error {
 	ctx, cancel := ctxWithTimeout(ctx, 20*time.Second)
 	defer cancel()
 
-	out, err := runCommand(ctx, c.binPath, "smart-log", disk.Name)
-	if err != nil {
-		c.logger.Warn("nvme collect failed", "disk", disk.Name, "error", err)
-		return
+	// Prefer the structured JSON output; older nvme-cli builds lack -o json
+	var snap storage.NvmeSnapshot
+	if out, err := runCommand(ctx, c.binPath, "smart-log", "-o", "json", disk.Name); err == nil {
+		if parsed, perr := parseSmartLogJSON(out); perr == nil {
+			snap = parsed
+		} else {
+			c.logger.Debug("nvme json smart-log unparseable, falling back to text", "disk", disk.Name, "error", perr)
+		}
 	}
 
-	snap := storage.NvmeSnapshot{
-		DiskID:    disk.ID,
-		Timestamp: time.Now().Unix(),
+	if snap.RawOutput == "" {
+		out, err := runCommand(ctx, c.binPath, "smart-log", disk.Name)
+		if err != nil {
+			c.logger.Warn("nvme collect failed", "disk", disk.Name, "error", err)
+			return err
+		}
+		snap = parseSmartLogText(out)
+	}
+	snap.DiskID = disk.ID
+	snap.Timestamp = time.Now().Unix()
+
+	if out, err := runCommand(ctx, c.binPath, "id-ns", disk.Name); err == nil {
+		if ns, ok := parseIDNS(out); ok {
+			snap.NamespaceCapacityBytes = ns.capacityBytes
+			snap.NamespaceUsedBytes = ns.usedBytes
+			snap.NamespaceThin = ns.thin
+		}
+	} else {
+		c.logger.Debug("nvme id-ns failed", "disk", disk.Name, "error", err)
+	}
+
+	if out, err := runCommand(ctx, c.binPath, "fw-log", disk.Name); err == nil {
+		if fw, ok := parseFWLog(out); ok {
+			snap.FirmwareActiveSlot = fw.activeSlot
+			snap.FirmwareSlots = fw.slots
+		}
+	} else {
+		c.logger.Debug("nvme fw-log failed", "disk", disk.Name, "error", err)
+	}
+
+	// Drives without the Sanitize feature fail the log read; that's normal
+	if out, err := runCommand(ctx, c.binPath, "sanitize-log", disk.Name); err == nil {
+		if san, ok := parseSanitizeLog(out); ok {
+			snap.SanitizeStatus = san.status
+			snap.SanitizeProgress = san.progress
+		}
+	} else {
+		c.logger.Debug("nvme sanitize-log failed", "disk", disk.Name, "error", err)
 	}
+
+	if err := c.store.AddNvmeSnapshot(ctx, snap); err != nil {
+		c.logger.Warn("failed to store nvme snapshot", "disk", disk.Name, "error", err)
+		return fmt.Errorf("store snapshot: %w", err)
+	}
+	return nil
+}
+
+// parseSmartLogText parses the human-readable `nvme smart-log` output.
+func parseSmartLogText(out string) storage.NvmeSnapshot {
+	var snap storage.NvmeSnapshot
 	for _, line := range strings.Split(out, "\n") {
 		l := strings.ToLower(line)
 		parseIntLine := func(prefix string, target *int64) {
@@ -134,6 +210,20 @@ func (c *NvmeCollector) collectDisk(ctx context.Context, disk storage.Disk) {
 		parseIntLine("power on hours", &snap.PowerOnHours)
 		parseIntLine("data units written", &snap.DataWrittenBytes)
 		parseIntLine("data units read", &snap.DataReadBytes)
+		parseIntLine("warning temperature time", &snap.WarningTempMinutes)
+		parseIntLine("critical composite temperature time", &snap.CriticalTempMinutes)
+		if strings.Contains(l, "warning temperature time") {
+			snap.TempTimeRead = true
+		}
+		// "available_spare_threshold" shares the prefix; skip it.
+		if (strings.Contains(l, "available_spare") || strings.Contains(l, "available spare")) && !strings.Contains(l, "threshold") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 {
+				if v, err := strconv.ParseFloat(strings.TrimSuffix(fields[len(fields)-1], "%"), 64); err == nil {
+					snap.AvailableSpare, snap.AvailableSpareRead = v, true
+				}
+			}
+		}
 		if strings.Contains(l, "percentage used") {
 			fields := strings.Fields(line)
 			if len(fields) > 0 {
@@ -151,10 +241,267 @@ func (c *NvmeCollector) collectDisk(ctx context.Context, disk storage.Disk) {
 
 	// Store raw output
 	snap.RawOutput = out
+	return snap
+}
 
-	if err := c.store.AddNvmeSnapshot(ctx, snap); err != nil {
-		c.logger.Warn("failed to store nvme snapshot", "disk", disk.Name, "error", err)
+// namespaceInfo is the subset of `nvme id-ns` we keep.
+type namespaceInfo struct {
+	capacityBytes int64
+	usedBytes     int64
+	thin          bool
+}
+
+// parseIDNS parses the text output of `nvme id-ns`. NCAP and NUSE are counted
+// in logical blocks whose size is 2^lbads of the LBA format marked "in use".
+func parseIDNS(out string) (namespaceInfo, bool) {
+	var ncap, nuse, nsfeat int64 = -1, -1, 0
+	lbads := int64(-1)
+	for _, line := range strings.Split(out, "\n") {
+		key, val, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+		switch {
+		case key == "ncap":
+			ncap = parseNumber(val)
+		case key == "nuse":
+			nuse = parseNumber(val)
+		case key == "nsfeat":
+			nsfeat = parseNumber(val)
+		case strings.HasPrefix(key, "lbaf") && strings.Contains(val, "in use"):
+			for _, f := range strings.Fields(val) {
+				if v, ok := strings.CutPrefix(f, "lbads:"); ok {
+					lbads = parseNumber(v)
+				}
+			}
+		}
+	}
+	if ncap < 0 || nuse < 0 || lbads < 0 || lbads > 31 {
+		return namespaceInfo{}, false
 	}
+	blockSize := int64(1) << lbads
+	return namespaceInfo{
+		capacityBytes: ncap * blockSize,
+		usedBytes:     nuse * blockSize,
+		thin:          nsfeat&0x1 != 0,
+	}, true
+}
+
+// firmwareLog is the subset of `nvme fw-log` we keep.
+type firmwareLog struct {
+	activeSlot int64
+	slots      string // "1:REV,2:REV" for each populated slot
+}
+
+// parseFWLog parses the text output of `nvme fw-log`. The active slot is
+// bits 2:0 of AFI; each populated frsN line carries the revision as hex and,
+// in most nvme-cli versions, decoded in parentheses.
+func parseFWLog(out string) (firmwareLog, bool) {
+	var fw firmwareLog
+	var slots []string
+	for _, line := range strings.Split(out, "\n") {
+		key, val, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+		switch {
+		case key == "afi":
+			if afi := parseNumber(val); afi >= 0 {
+				fw.activeSlot = afi & 0x7
+			}
+		case strings.HasPrefix(key, "frs"):
+			slot := parseNumber(strings.TrimPrefix(key, "frs"))
+			rev := firmwareRevision(val)
+			if slot > 0 && rev != "" {
+				slots = append(slots, fmt.Sprintf("%d:%s", slot, rev))
+			}
+		}
+	}
+	if fw.activeSlot == 0 {
+		return firmwareLog{}, false
+	}
+	fw.slots = strings.Join(slots, ",")
+	return fw, true
+}
+
+// sanitizeLog is the subset of `nvme sanitize-log` we keep.
+type sanitizeLog struct {
+	status   string  // never, completed, in_progress or failed
+	progress float64 // percent complete while in progress
+}
+
+// sanitizeStatuses maps SSTAT bits 2:0 to a status. 4 is a success where the
+// drive was told not to deallocate afterwards.
+var sanitizeStatuses = map[int64]string{0: "never", 1: "completed", 2: "in_progress", 3: "failed", 4: "completed"}
+
+// parseSanitizeLog parses the text output of `nvme sanitize-log`: SSTAT holds
+// the status of the most recent sanitize and SPROG its progress in 1/65536
+// units, e.g. "Sanitize Status (SSTAT) :  0x2".
+func parseSanitizeLog(out string) (sanitizeLog, bool) {
+	var san sanitizeLog
+	sprog := int64(-1)
+	for _, line := range strings.Split(out, "\n") {
+		key, val, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(key)
+		val = strings.Fields(val + " ")[0]
+		switch {
+		case strings.Contains(key, "(sstat)"):
+			if sstat := parseNumber(val); sstat >= 0 {
+				san.status = sanitizeStatuses[sstat&0x7]
+			}
+		case strings.Contains(key, "(sprog)"):
+			sprog = parseNumber(val)
+		}
+	}
+	if san.status == "" {
+		return sanitizeLog{}, false
+	}
+	if san.status == "in_progress" && sprog >= 0 {
+		san.progress = float64(sprog) * 100 / 65536
+	}
+	return san, true
+}
+
+// firmwareRevision extracts the revision from an frsN value such as
+// "0x3130354133344147 (GA43A501)". Without the parenthesized form the hex is
+// decoded directly: the revision is 8 ASCII bytes, first character in the
+// low byte. An all-zero value means the slot is empty.
+func firmwareRevision(val string) string {
+	if _, rev, ok := strings.Cut(val, "("); ok {
+		return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rev), ")"))
+	}
+	hex, ok := strings.CutPrefix(strings.ToLower(strings.Fields(val + " ")[0]), "0x")
+	if !ok {
+		return ""
+	}
+	v, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil || v == 0 {
+		return ""
+	}
+	var b []byte
+	for ; v != 0; v >>= 8 {
+		b = append(b, byte(v))
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// parseNumber parses a decimal or 0x-prefixed hex value, returning -1 on error.
+func parseNumber(s string) int64 {
+	s = strings.ToLower(strings.TrimSpace(s))
+	base := 10
+	if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	}
+	v, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// nvmeDataUnitBytes is the size of an NVMe "data unit" (1000 * 512 bytes).
+const nvmeDataUnitBytes = 512000
+
+// smartLogJSON mirrors the fields of `nvme smart-log -o json` we consume.
+type smartLogJSON struct {
+	CriticalWarning  json.RawMessage `json:"critical_warning"`
+	Temperature      flexInt         `json:"temperature"` // Kelvin
+	AvailSpare       *flexInt        `json:"avail_spare"`
+	PercentUsed      flexInt         `json:"percent_used"`
+	DataUnitsRead    flexInt         `json:"data_units_read"`
+	DataUnitsWritten flexInt         `json:"data_units_written"`
+	PowerOnHours     flexInt         `json:"power_on_hours"`
+	UnsafeShutdowns  flexInt         `json:"unsafe_shutdowns"`
+	MediaErrors      flexInt         `json:"media_errors"`
+	NumErrLogEntries flexInt         `json:"num_err_log_entries"`
+	WarningTempTime  *flexInt        `json:"warning_temp_time"`  // minutes
+	CriticalCompTime *flexInt        `json:"critical_comp_time"` // minutes
+}
+
+// parseSmartLogJSON parses `nvme smart-log -o json` output.
+func parseSmartLogJSON(out string) (storage.NvmeSnapshot, error) {
+	var raw smartLogJSON
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &raw); err != nil {
+		return storage.NvmeSnapshot{}, err
+	}
+	if raw.CriticalWarning == nil {
+		return storage.NvmeSnapshot{}, fmt.Errorf("missing critical_warning field")
+	}
+
+	snap := storage.NvmeSnapshot{
+		PercentUsed:      float64(raw.PercentUsed),
+		MediaErrors:      int64(raw.MediaErrors),
+		ErrorLogEntries:  int64(raw.NumErrLogEntries),
+		PowerOnHours:     int64(raw.PowerOnHours),
+		UnsafeShutdowns:  int64(raw.UnsafeShutdowns),
+		DataWrittenBytes: int64(raw.DataUnitsWritten) * nvmeDataUnitBytes,
+		DataReadBytes:    int64(raw.DataUnitsRead) * nvmeDataUnitBytes,
+		RawOutput:        out,
+	}
+	if raw.WarningTempTime != nil && raw.CriticalCompTime != nil {
+		snap.WarningTempMinutes = int64(*raw.WarningTempTime)
+		snap.CriticalTempMinutes = int64(*raw.CriticalCompTime)
+		snap.TempTimeRead = true
+	}
+	if raw.AvailSpare != nil {
+		snap.AvailableSpare, snap.AvailableSpareRead = float64(*raw.AvailSpare), true
+	}
+	if raw.Temperature > 0 {
+		snap.TemperatureC = float64(raw.Temperature) - 273.15
+	}
+
+	// nvme-cli prints critical_warning as a plain number, or as an object with
+	// a "value" member when human-readable decoding is requested.
+	var warning flexInt
+	if err := json.Unmarshal(raw.CriticalWarning, &warning); err != nil {
+		var obj struct {
+			Value flexInt `json:"value"`
+		}
+		if err := json.Unmarshal(raw.CriticalWarning, &obj); err != nil {
+			return storage.NvmeSnapshot{}, fmt.Errorf("parse critical_warning: %w", err)
+		}
+		warning = obj.Value
+	}
+	flags := CriticalWarningFlags{
+		AvailableSpareLow:            warning&0x01 != 0,
+		TemperatureThresholdExceeded: warning&0x02 != 0,
+		ReliabilityDegraded:          warning&0x04 != 0,
+		ReadOnly:                     warning&0x08 != 0,
+	}
+	if b, err := json.Marshal(flags); err == nil {
+		snap.CriticalWarningFlags = string(b)
+	}
+	return snap, nil
+}
+
+// flexInt decodes integers that nvme-cli may emit either as JSON numbers or,
+// for 128-bit counters on some versions, as (comma-grouped) strings.
+type flexInt int64
+
+func (f *flexInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(b)), `"`)
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*f = flexInt(v)
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*f = flexInt(v)
+	return nil
 }
 
 // CriticalWarningFlags represents the structured critical warning flags
@@ -0,0 +1,199 @@
+package collectors
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// Captured from `nvme smart-log -o json /dev/nvme0` (nvme-cli 2.4).
+const nvmeSmartLogJSON = `{
+  "critical_warning":4,
+  "temperature":318,
+  "avail_spare":100,
+  "spare_thresh":10,
+  "percent_used":3,
+  "endurance_grp_critical_warning_summary":0,
+  "data_units_read":24387311,
+  "data_units_written":31276590,
+  "host_read_commands":402765187,
+  "host_write_commands":719931114,
+  "controller_busy_time":1733,
+  "power_cycles":148,
+  "power_on_hours":12345,
+  "unsafe_shutdowns":17,
+  "media_errors":2,
+  "num_err_log_entries":41,
+  "warning_temp_time":0,
+  "critical_comp_time":0,
+  "temperature_sensor_1":318,
+  "temperature_sensor_2":325,
+  "thm_temp1_trans_count":0,
+  "thm_temp2_trans_count":0,
+  "thm_temp1_total_time":0,
+  "thm_temp2_total_time":0
+}`
+
+func TestParseSmartLogJSON(t *testing.T) {
+	snap, err := parseSmartLogJSON(nvmeSmartLogJSON)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if math.Abs(snap.TemperatureC-44.85) > 0.01 {
+		t.Fatalf("expected 44.85C, got %v", snap.TemperatureC)
+	}
+	if snap.PercentUsed != 3 || snap.MediaErrors != 2 || snap.ErrorLogEntries != 41 {
+		t.Fatalf("unexpected counters: %+v", snap)
+	}
+	if !snap.TempTimeRead {
+		t.Fatal("expected the temperature times to be marked as read")
+	}
+	if !snap.AvailableSpareRead || snap.AvailableSpare != 100 {
+		t.Fatalf("expected 100%% available spare, got %v (read %v)", snap.AvailableSpare, snap.AvailableSpareRead)
+	}
+	if snap.PowerOnHours != 12345 || snap.UnsafeShutdowns != 17 {
+		t.Fatalf("unexpected hours/shutdowns: %+v", snap)
+	}
+	if snap.DataWrittenBytes != 31276590*nvmeDataUnitBytes {
+		t.Fatalf("unexpected data written: %d", snap.DataWrittenBytes)
+	}
+
+	var flags CriticalWarningFlags
+	if err := json.Unmarshal([]byte(snap.CriticalWarningFlags), &flags); err != nil {
+		t.Fatalf("decode flags: %v", err)
+	}
+	if !flags.ReliabilityDegraded || flags.AvailableSpareLow || flags.ReadOnly {
+		t.Fatalf("unexpected flags: %+v", flags)
+	}
+}
+
+func TestParseSmartLogJSONObjectWarning(t *testing.T) {
+	out := `{"critical_warning":{"value":8},"temperature":"300","percent_used":"1","data_units_written":"1,000"}`
+	snap, err := parseSmartLogJSON(out)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if snap.DataWrittenBytes != 1000*nvmeDataUnitBytes {
+		t.Fatalf("unexpected data written: %d", snap.DataWrittenBytes)
+	}
+	if snap.AvailableSpareRead || snap.TempTimeRead {
+		t.Fatal("expected fields the log doesn't report to stay unknown")
+	}
+	var flags CriticalWarningFlags
+	_ = json.Unmarshal([]byte(snap.CriticalWarningFlags), &flags)
+	if !flags.ReadOnly {
+		t.Fatalf("expected read-only flag, got %+v", flags)
+	}
+}
+
+func TestParseSmartLogTextOverTempTime(t *testing.T) {
+	out := `Smart Log for NVME device:nvme0 namespace-id:ffffffff
+critical_warning                        : 0
+temperature                             : 41°C (314 Kelvin)
+Warning Temperature Time                : 128
+Critical Composite Temperature Time     : 3
+`
+	snap := parseSmartLogText(out)
+	if snap.WarningTempMinutes != 128 || snap.CriticalTempMinutes != 3 {
+		t.Fatalf("unexpected over-temperature minutes: warning %d, critical %d", snap.WarningTempMinutes, snap.CriticalTempMinutes)
+	}
+	if !snap.TempTimeRead {
+		t.Fatal("expected the temperature times to be marked as read")
+	}
+	if snap.TemperatureC != 41 {
+		t.Fatalf("expected 41C, got %v", snap.TemperatureC)
+	}
+}
+
+func TestParseSmartLogJSONRejectsText(t *testing.T) {
+	if _, err := parseSmartLogJSON("Smart Log for NVME device:nvme0 namespace-id:ffffffff\ncritical_warning : 0\n"); err == nil {
+		t.Fatalf("expected text output to be rejected so the caller falls back")
+	}
+}
+
+// Captured from `nvme id-ns /dev/nvme0n1` (nvme-cli 2.4) on a thin-provisioned
+// namespace, trimmed.
+const nvmeIDNSOutput = `NVME Identify Namespace 1:
+nsze    : 0x3a386030
+ncap    : 0x3a386030
+nuse    : 0x2e938000
+nsfeat  : 0x1
+nlbaf   : 1
+flbas   : 0
+mc      : 0
+dpc     : 0
+nguid   : 00000000000000000000000000000000
+eui64   : 0025388b91b0e5a1
+lbaf  0 : ms:0   lbads:9  rp:0x1 (in use)
+lbaf  1 : ms:0   lbads:12 rp:0
+`
+
+func TestParseIDNS(t *testing.T) {
+	ns, ok := parseIDNS(nvmeIDNSOutput)
+	if !ok {
+		t.Fatal("expected id-ns output to parse")
+	}
+	if ns.capacityBytes != 0x3a386030*512 || ns.usedBytes != 0x2e938000*512 {
+		t.Fatalf("unexpected sizes: %+v", ns)
+	}
+	if !ns.thin {
+		t.Fatal("expected thin provisioning from nsfeat bit 0")
+	}
+
+	if _, ok := parseIDNS("NVME Identify Namespace 1:\nnsze : 0x10\n"); ok {
+		t.Fatal("expected output without ncap/nuse/lbaf to be rejected")
+	}
+}
+
+// Captured from `nvme fw-log /dev/nvme0` (nvme-cli 1.16); slot 2 was
+// populated by a staged update.
+const nvmeFWLogOutput = `Firmware Log for device:nvme0
+afi  : 0x1
+frs1 : 0x3130354133344147 (GA43A501)
+frs2 : 0x3230354133344147 (GA43A502)
+`
+
+func TestParseFWLog(t *testing.T) {
+	fw, ok := parseFWLog(nvmeFWLogOutput)
+	if !ok {
+		t.Fatal("expected fw-log output to parse")
+	}
+	if fw.activeSlot != 1 || fw.slots != "1:GA43A501,2:GA43A502" {
+		t.Fatalf("unexpected firmware log: %+v", fw)
+	}
+
+	// Next-reset slot in AFI bits 6:4; revision only as hex; empty slot 3.
+	fw, ok = parseFWLog("afi : 0x12\nfrs1 : 0x3130354133344147\nfrs2 : 0x3230354133344147\nfrs3 : 0x0\n")
+	if !ok || fw.activeSlot != 2 || fw.slots != "1:GA43A501,2:GA43A502" {
+		t.Fatalf("unexpected firmware log from hex-only output: %+v (ok=%v)", fw, ok)
+	}
+
+	if _, ok := parseFWLog("Firmware Log for device:nvme0\n"); ok {
+		t.Fatal("expected output without afi to be rejected")
+	}
+}
+
+func TestParseSanitizeLog(t *testing.T) {
+	out := `Sanitize Progress                      (SPROG) :  16384
+Sanitize Status                        (SSTAT) :  0x102
+	[2:0]	Sanitize in Progress.
+Sanitize Command Dword 10 Information (SCDW10) :  0x2
+Estimated Time For Overwrite                   :  4294967295 (No time period reported)
+Estimated Time For Block Erase                 :  120
+`
+	san, ok := parseSanitizeLog(out)
+	if !ok || san.status != "in_progress" || san.progress != 25 {
+		t.Fatalf("unexpected sanitize log: %+v (ok=%v)", san, ok)
+	}
+
+	for sstat, want := range map[string]string{"0": "never", "0x1": "completed", "0x3": "failed", "0x104": "completed"} {
+		san, ok := parseSanitizeLog("Sanitize Progress (SPROG) :  65535\nSanitize Status (SSTAT) :  " + sstat + "\n")
+		if !ok || san.status != want || san.progress != 0 {
+			t.Errorf("SSTAT %s: got %+v (ok=%v), want %s", sstat, san, ok, want)
+		}
+	}
+
+	if _, ok := parseSanitizeLog("NVMe status: INVALID_OPCODE: The associated command opcode field is not valid(0x2001)\n"); ok {
+		t.Fatal("expected output without SSTAT to be rejected")
+	}
+}
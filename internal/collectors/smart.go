@@ -3,32 +3,65 @@ package collectors
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
 
 type SmartCollector struct {
 	store   *storage.Store
 	logger  *slog.Logger
 	binPath string
+	running runGuard
+	noSCT   map[string]bool // disks whose scttempsts read found no SCT support
 }
 
 func NewSmartCollector(store *storage.Store, binPath string, logger *slog.Logger) *SmartCollector {
-	return &SmartCollector{store: store, binPath: binPath, logger: logger}
+	return &SmartCollector{store: store, binPath: binPath, logger: logger, noSCT: make(map[string]bool)}
 }
 
 func (c *SmartCollector) Collect(ctx context.Context, disks []storage.Disk) error {
+	_, err := c.CollectWithResult(ctx, disks)
+	return err
+}
+
+// CollectWithResult is Collect, also reporting which disks were collected
+// and which failed.
+func (c *SmartCollector) CollectWithResult(ctx context.Context, disks []storage.Disk) (types.CollectionResult, error) {
+	var result types.CollectionResult
+	done, err := c.running.start()
+	if err != nil {
+		return result, err
+	}
+	defer done()
+
+	start := time.Now()
 	for _, d := range disks {
 		if d.Type == "nvme" {
 			continue
 		}
-		c.collectDisk(ctx, d)
+		diskStart := time.Now()
+		ok, err := c.collectDisk(ctx, d)
+		switch {
+		case err != nil:
+			result.Failures = append(result.Failures, types.CollectionFailure{DiskID: d.ID, Name: d.Name, Error: err.Error()})
+		case ok:
+			result.Collected++
+		default:
+			result.Unsupported++
+		}
+		recordDuration(ctx, c.store, c.logger, "smart", d.ID, diskStart)
 	}
-	return nil
+	recordDuration(ctx, c.store, c.logger, "smart", "", start)
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
 }
 
 // RunTest triggers a SMART self-test on a disk
@@ -48,26 +81,61 @@ func (c *SmartCollector) RunTest(ctx context.Context, disk storage.Disk, testTyp
 	return nil
 }
 
-func (c *SmartCollector) collectDisk(ctx context.Context, disk storage.Disk) {
+// collectDisk stores a snapshot of one disk, reporting false for a disk
+// without usable SMART.
+func (c *SmartCollector) collectDisk(ctx context.Context, disk storage.Disk) (bool, error) {
 	ctx, cancel := ctxWithTimeout(ctx, 20*time.Second)
 	defer cancel()
 
-	out, err := runCommand(ctx, c.binPath, "-H", "-A", disk.Name)
-	if err != nil {
+	out, err := runCommand(ctx, c.binPath, "-H", "-i", "-A", "-g", "wcache", disk.Name)
+	if smartUnsupported(out) {
+		if !disk.SmartUnsupported {
+			c.logger.Info("disk does not support SMART", "disk", disk.Name)
+			if err := c.store.SetSmartUnsupported(ctx, disk.ID, true); err != nil {
+				c.logger.Warn("failed to flag disk as smart unsupported", "disk", disk.Name, "error", err)
+			}
+		}
+		return false, nil
+	}
+	// smartctl gives up before reading anything (exit bit 2, which is
+	// otherwise non-fatal); on a drive with SMART this usually means it is
+	// failing, so report it rather than storing an empty snapshot. Earlier
+	// builds flagged such disks unsupported, which hid them; undo that.
+	if strings.Contains(out, smartMandatoryFailed) {
+		if disk.SmartUnsupported {
+			if err := c.store.SetSmartUnsupported(ctx, disk.ID, false); err != nil {
+				c.logger.Warn("failed to clear smart unsupported flag", "disk", disk.Name, "error", err)
+			}
+		}
+		err := fmt.Errorf("smartctl: %s", smartMandatoryFailed)
 		c.logger.Warn("smart collect failed", "disk", disk.Name, "error", err)
-		return
+		return false, err
+	}
+	status := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode()&smartctlFatalBits != 0 {
+			c.logger.Warn("smart collect failed", "disk", disk.Name, "error", err)
+			return false, err
+		}
+		// Only informational bits set: the report is complete and the
+		// bits describe what smartctl found in it.
+		status = exitErr.ExitCode()
+		c.logger.Debug("smartctl exited nonzero with usable output", "disk", disk.Name, "status", status)
+	}
+	if disk.SmartUnsupported {
+		if err := c.store.SetSmartUnsupported(ctx, disk.ID, false); err != nil {
+			c.logger.Warn("failed to clear smart unsupported flag", "disk", disk.Name, "error", err)
+		}
 	}
 
 	snap := storage.SmartSnapshot{
 		DiskID:    disk.ID,
 		Timestamp: time.Now().Unix(),
 	}
-	if strings.Contains(out, "PASSED") {
-		snap.HealthStatus = "passed"
-	} else if strings.Contains(strings.ToUpper(out), "FAILED") {
+	snap.HealthStatus = parseHealthStatus(out)
+	if status&smartctlDiskFailing != 0 {
 		snap.HealthStatus = "failed"
-	} else {
-		snap.HealthStatus = "unknown"
 	}
 
 	parseTable(out, map[string]*int64{
@@ -78,10 +146,39 @@ func (c *SmartCollector) collectDisk(ctx context.Context, disk storage.Disk) {
 		"Power_On_Hours":         &snap.PowerOnHours,
 		"Spin_Retry_Count":       &snap.SpinRetryCount,
 		"Load_Cycle_Count":       &snap.LoadCycleCount,
+		"Reported_Uncorrect":     &snap.ReportedUncorrect,
+		"Command_Timeout":        &snap.CommandTimeout,
+		"Power_Cycle_Count":      &snap.PowerCycleCount,
+		"Start_Stop_Count":       &snap.StartStopCount,
 	})
 	if temp := parseTemperature(out); temp != nil {
 		snap.TemperatureC = *temp
 	}
+	if defects := parseGrownDefects(out); defects != nil {
+		snap.GrownDefects = *defects
+	}
+	if sasTransport(out) {
+		// A failed phy log read leaves SASPhyRead unset, so the counters
+		// are stored as unknown rather than as zero, which the next good
+		// read would otherwise look like growth from.
+		phyOut, err := runCommand(ctx, c.binPath, "-l", "sasphy", disk.Name)
+		if err != nil {
+			c.logger.Debug("smartctl sasphy failed", "disk", disk.Name, "error", err)
+		} else {
+			parseSASPhy(phyOut, &snap)
+		}
+	} else if !c.noSCT[disk.ID] {
+		// ATA drives keep their own temperature record; ask once per
+		// disk per run of the agent whether they support it.
+		sctOut, err := runCommand(ctx, c.binPath, "-l", "scttempsts", disk.Name)
+		if !parseSCTTemp(sctOut, &snap) {
+			if err != nil {
+				c.logger.Debug("smartctl scttempsts failed", "disk", disk.Name, "error", err)
+			} else {
+				c.noSCT[disk.ID] = true
+			}
+		}
+	}
 
 	// Store full SMART output as JSON
 	if rawJSON, err := json.Marshal(out); err == nil {
@@ -90,7 +187,254 @@ func (c *SmartCollector) collectDisk(ctx context.Context, disk storage.Disk) {
 
 	if err := c.store.AddSmartSnapshot(ctx, snap); err != nil {
 		c.logger.Warn("failed to store smart snapshot", "disk", disk.Name, "error", err)
+		return false, fmt.Errorf("store snapshot: %w", err)
+	}
+	if disk.Type == "hdd" && solidState(out) {
+		c.logger.Info("reclassifying disk as SSD from SMART identity", "disk", disk.Name)
+		if err := c.store.MarkSolidState(ctx, disk.ID); err != nil {
+			c.logger.Warn("failed to reclassify disk", "disk", disk.Name, "error", err)
+		}
+	}
+	if wc := parseWriteCache(out); wc != disk.WriteCache {
+		if err := c.store.SetWriteCache(ctx, disk.ID, wc); err != nil {
+			c.logger.Warn("failed to store write cache state", "disk", disk.Name, "error", err)
+		}
+	}
+	if info := parseDeviceInfo(out); info != disk.DiskInfo {
+		if err := c.store.SetDiskInfo(ctx, disk.ID, info); err != nil {
+			c.logger.Warn("failed to store disk identity", "disk", disk.Name, "error", err)
+		}
+	}
+	return true, nil
+}
+
+// smartctl exit status bits (see smartctl(8) "RETURN VALUES"). Bits 0-1 mean
+// the command line was bad or the device couldn't be opened, so there is no
+// report to parse. Bit 2 flags a SMART command or checksum failure on part of
+// the output; the rest is still usable. Bits 3-7 are informational: they
+// summarise what the (complete) report says about the disk.
+const (
+	smartctlFatalBits   = 0x03
+	smartctlDiskFailing = 0x08
+)
+
+// solidState reports whether the smartctl -i section identifies a
+// non-rotating device: "Rotation Rate: Solid State Device" (or a rate of 0),
+// or NVMe identity fields from a drive behind a USB/SATA bridge.
+func solidState(out string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "NVMe Version:") {
+			return true
+		}
+		rate, ok := strings.CutPrefix(line, "Rotation Rate:")
+		if !ok {
+			continue
+		}
+		rate = strings.TrimSpace(rate)
+		return rate == "0" || strings.HasPrefix(rate, "Solid State")
+	}
+	return false
+}
+
+// parseDeviceInfo reads the identity fields of the smartctl -i section:
+// "Rotation Rate: 7200 rpm" (or "Solid State Device"), "Form Factor:",
+// "ATA Version is:", "SATA Version is:" and "TRIM Command:".
+func parseDeviceInfo(out string) storage.DiskInfo {
+	var info storage.DiskInfo
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Rotation Rate":
+			if rpm, ok := strings.CutSuffix(value, " rpm"); ok {
+				info.RotationRate, _ = strconv.ParseInt(rpm, 10, 64)
+			}
+		case "Form Factor":
+			info.FormFactor = value
+		case "ATA Version is":
+			info.ATAVersion = value
+		case "SATA Version is":
+			info.SATAVersion = value
+		case "TRIM Command":
+			info.TRIM = value
+		}
+	}
+	return info
+}
+
+// parseWriteCache reads the "Write cache is:" line printed by
+// `smartctl -g wcache` (ATA and SCSI alike) and returns "enabled",
+// "disabled", or "" when the drive doesn't report it ("Unavailable").
+func parseWriteCache(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "Write cache is:")
+		if !ok {
+			continue
+		}
+		state := strings.ToLower(strings.TrimSpace(rest))
+		switch {
+		case strings.HasPrefix(state, "enabled"):
+			return "enabled"
+		case strings.HasPrefix(state, "disabled"):
+			return "disabled"
+		}
+		return ""
+	}
+	return ""
+}
+
+// smartUnsupportedMarkers are smartctl messages for devices that have no
+// SMART capability or sit behind a bridge smartctl can't pass commands through.
+// smartMandatoryFailed is deliberately absent: smartctl prints it for failing
+// drives too, and those must surface as collection failures.
+var smartUnsupportedMarkers = []string{
+	"SMART support is: Unavailable",
+	"Device does not support SMART",
+	"Unknown USB bridge",
+}
+
+// smartMandatoryFailed is smartctl's message when a required SMART command
+// (e.g. reading the identify data) fails and it stops without a report.
+const smartMandatoryFailed = "A mandatory SMART command failed"
+
+// smartUnsupported reports whether smartctl output says SMART is unavailable.
+func smartUnsupported(out string) bool {
+	for _, m := range smartUnsupportedMarkers {
+		if strings.Contains(out, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHealthStatus maps smartctl's overall-health line to passed/failed/unknown.
+// ATA drives report "SMART overall-health self-assessment test result: PASSED",
+// while SCSI/SAS drives report "SMART Health Status: OK" or a failure reason
+// such as "FAILURE PREDICTION THRESHOLD EXCEEDED".
+func parseHealthStatus(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		idx := strings.Index(line, "SMART Health Status:")
+		if idx < 0 {
+			continue
+		}
+		status := strings.ToUpper(strings.TrimSpace(line[idx+len("SMART Health Status:"):]))
+		if status == "OK" {
+			return "passed"
+		}
+		if status != "" {
+			return "failed"
+		}
+	}
+
+	if strings.Contains(out, "PASSED") {
+		return "passed"
+	}
+	if strings.Contains(strings.ToUpper(out), "FAILED") {
+		return "failed"
+	}
+	return "unknown"
+}
+
+// parseGrownDefects extracts the SCSI grown defect list size, the SAS
+// counterpart of the ATA reallocated sector count.
+func parseGrownDefects(out string) *int64 {
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, "Elements in grown defect list") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseInt(fields[len(fields)-1], 10, 64); err == nil {
+			return &v
+		}
+	}
+	return nil
+}
+
+// sasTransport reports whether smartctl -i identifies a SAS device
+// ("Transport protocol: SAS (SPL-4)").
+func sasTransport(out string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if key, val, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "Transport protocol" {
+			return strings.HasPrefix(strings.TrimSpace(val), "SAS")
+		}
+	}
+	return false
+}
+
+// parseSASPhy sums the per-phy error counters from smartctl -l sasphy over
+// every port and phy. Only the "name = value" summary lines are read; the
+// phy event descriptors repeat the same counts as "name: value".
+func parseSASPhy(out string, snap *storage.SmartSnapshot) {
+	fields := map[string]*int64{
+		"Invalid DWORD count":           &snap.SASInvalidDwords,
+		"Running disparity error count": &snap.SASDisparityErrors,
+		"Loss of DWORD synchronization": &snap.SASLossOfSync,
+		"Phy reset problem":             &snap.SASPhyResets,
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		ref, known := fields[strings.TrimSpace(key)]
+		if !known {
+			continue
+		}
+		if v, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64); err == nil {
+			*ref += v
+			snap.SASPhyRead = true
+		}
+	}
+}
+
+// parseSCTTemp reads smartctl -l scttempsts, e.g.
+//
+//	Lifetime    Min/Max Temperature:     17/52 Celsius
+//	Under/Over Temperature Limit Count:   0/3
+//
+// and reports whether the drive returned SCT temperature status at all.
+// Fields the drive leaves as "?" stay zero; SCTLimitCountsRead is only set
+// when the limit counts were actually given.
+func parseSCTTemp(out string, snap *storage.SmartSnapshot) bool {
+	found := false
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		var lo, hi *int64
+		switch strings.Join(strings.Fields(key), " ") {
+		case "Lifetime Min/Max Temperature":
+			lo, hi = &snap.SCTLifetimeMinC, &snap.SCTLifetimeMaxC
+		case "Under/Over Temperature Limit Count":
+			lo, hi = &snap.SCTUnderTempCount, &snap.SCTOverTempCount
+		default:
+			continue
+		}
+		found = true
+		fields := strings.Fields(val)
+		if len(fields) == 0 {
+			continue
+		}
+		a, b, _ := strings.Cut(fields[0], "/")
+		if v, err := strconv.ParseInt(a, 10, 64); err == nil {
+			*lo = v
+		}
+		if v, err := strconv.ParseInt(b, 10, 64); err == nil {
+			*hi = v
+			if hi == &snap.SCTOverTempCount {
+				snap.SCTLimitCountsRead = true
+			}
+		}
 	}
+	return found
 }
 
 func parseTable(out string, fields map[string]*int64) {
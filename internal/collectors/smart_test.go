@@ -0,0 +1,508 @@
+package collectors
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+const sasSmartctlOutput = `smartctl 7.3 2022-02-28 r5338 [x86_64-linux-6.1.0] (local build)
+Copyright (C) 2002-22, Bruce Allen, Christian Franke, www.smartmontools.org
+
+=== START OF READ SMART DATA SECTION ===
+SMART Health Status: OK
+
+Current Drive Temperature:     34 C
+Drive Trip Temperature:        65 C
+
+Manufactured in week 12 of year 2017
+Specified cycle count over device lifetime:  50000
+Accumulated start-stop cycles:  112
+Specified load-unload count over device lifetime:  600000
+Accumulated load-unload cycles:  1320
+Elements in grown defect list: 7
+`
+
+func TestParseSASHealth(t *testing.T) {
+	if got := parseHealthStatus(sasSmartctlOutput); got != "passed" {
+		t.Fatalf("expected passed, got %s", got)
+	}
+
+	defects := parseGrownDefects(sasSmartctlOutput)
+	if defects == nil || *defects != 7 {
+		t.Fatalf("expected 7 grown defects, got %v", defects)
+	}
+
+	temp := parseTemperature(sasSmartctlOutput)
+	if temp == nil || *temp != 34 {
+		t.Fatalf("expected 34C, got %v", temp)
+	}
+
+	failed := "=== START OF READ SMART DATA SECTION ===\nSMART Health Status: FAILURE PREDICTION THRESHOLD EXCEEDED [asc=5d, ascq=10]\n"
+	if got := parseHealthStatus(failed); got != "failed" {
+		t.Fatalf("expected failed, got %s", got)
+	}
+}
+
+const sasPhyOutput = `smartctl 7.3 2022-02-28 r5338 [x86_64-linux-6.1.0] (local build)
+Copyright (C) 2002-22, Bruce Allen, Christian Franke, www.smartmontools.org
+
+=== START OF READ SMART DATA SECTION ===
+Protocol Specific port log page for SAS SSP
+relative target port id = 1
+  generation code = 0
+  number of phys = 1
+  phy identifier = 0
+    attached device type: expander device
+    attached reason: unknown
+    reason: power on
+    negotiated logical link rate: phy enabled; 12 Gbps
+    attached initiator port: ssp=0 stp=0 smp=1
+    attached target port: ssp=0 stp=0 smp=1
+    SAS address = 0x5000c500a1b2c3d5
+    attached SAS address = 0x500605b00ab12340
+    attached phy identifier = 3
+    Invalid DWORD count = 12
+    Running disparity error count = 9
+    Loss of DWORD synchronization = 2
+    Phy reset problem = 0
+    Phy event descriptors:
+     Invalid word count: 12
+     Running disparity error count: 9
+     Loss of dword synchronization count: 2
+     Phy reset problem count: 0
+relative target port id = 2
+  generation code = 0
+  number of phys = 1
+  phy identifier = 1
+    attached device type: no device attached
+    attached reason: unknown
+    reason: unknown
+    negotiated logical link rate: phy enabled; unknown
+    attached initiator port: ssp=0 stp=0 smp=0
+    attached target port: ssp=0 stp=0 smp=0
+    SAS address = 0x5000c500a1b2c3d6
+    attached SAS address = 0x0
+    attached phy identifier = 0
+    Invalid DWORD count = 3
+    Running disparity error count = 1
+    Loss of DWORD synchronization = 0
+    Phy reset problem = 1
+`
+
+func TestParseSASPhy(t *testing.T) {
+	if !sasTransport("Vendor:               SEAGATE\nTransport protocol:   SAS (SPL-4)\n") {
+		t.Fatal("expected SAS transport to be detected")
+	}
+	if sasTransport(sasSmartctlOutput) || sasTransport("Transport protocol:   Fibre channel (FCP-2)\n") {
+		t.Fatal("expected non-SAS output to be ignored")
+	}
+
+	var snap storage.SmartSnapshot
+	parseSASPhy(sasPhyOutput, &snap)
+	if snap.SASInvalidDwords != 15 || snap.SASDisparityErrors != 10 || snap.SASLossOfSync != 2 || snap.SASPhyResets != 1 {
+		t.Fatalf("expected counters summed over both ports, got %+v", snap)
+	}
+	if !snap.SASPhyRead {
+		t.Fatal("expected the phy log to be marked as read")
+	}
+
+	var failed storage.SmartSnapshot
+	parseSASPhy("Read SAS phy log failed\n", &failed)
+	if failed.SASPhyRead {
+		t.Fatal("expected an unreadable phy log to stay unknown")
+	}
+}
+
+const sctTempStsOutput = `smartctl 7.3 2022-02-28 r5338 [x86_64-linux-6.1.0] (local build)
+Copyright (C) 2002-22, Bruce Allen, Christian Franke, www.smartmontools.org
+
+=== START OF READ SMART DATA SECTION ===
+SCT Status Version:                  3
+SCT Version (vendor specific):       258 (0x0102)
+Device State:                        Active (0)
+Current Temperature:                    34 Celsius
+Power Cycle Min/Max Temperature:     25/38 Celsius
+Lifetime    Min/Max Temperature:     17/61 Celsius
+Under/Over Temperature Limit Count:   0/3
+Vendor specific:
+00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+`
+
+func TestParseSCTTemp(t *testing.T) {
+	var snap storage.SmartSnapshot
+	if !parseSCTTemp(sctTempStsOutput, &snap) {
+		t.Fatal("expected SCT status to be found")
+	}
+	if snap.SCTLifetimeMinC != 17 || snap.SCTLifetimeMaxC != 61 || snap.SCTUnderTempCount != 0 || snap.SCTOverTempCount != 3 {
+		t.Fatalf("unexpected SCT fields %+v", snap)
+	}
+	if !snap.SCTLimitCountsRead {
+		t.Fatal("expected the limit counts to be marked as read")
+	}
+
+	// Drives without SCT, or that leave the counters unset.
+	if parseSCTTemp("SCT Commands not supported\n", &storage.SmartSnapshot{}) {
+		t.Fatal("expected no SCT status")
+	}
+	snap = storage.SmartSnapshot{}
+	if !parseSCTTemp("Lifetime    Min/Max Temperature:     ?/? Celsius\n", &snap) || snap.SCTLifetimeMaxC != 0 {
+		t.Fatalf("expected unknown values left at zero, got %+v", snap)
+	}
+	if snap.SCTLimitCountsRead {
+		t.Fatal("expected missing limit counts to stay unknown")
+	}
+}
+
+func TestParseATAHealth(t *testing.T) {
+	out := "SMART overall-health self-assessment test result: PASSED\n"
+	if got := parseHealthStatus(out); got != "passed" {
+		t.Fatalf("expected passed, got %s", got)
+	}
+	if parseGrownDefects(out) != nil {
+		t.Fatalf("expected no grown defect count for ATA output")
+	}
+}
+
+const ataAttributeTable = `ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+  1 Raw_Read_Error_Rate     0x002f   200   200   051    Pre-fail  Always       -       0
+  4 Start_Stop_Count        0x0032   096   096   000    Old_age   Always       -       4127
+  5 Reallocated_Sector_Ct   0x0033   200   200   140    Pre-fail  Always       -       3
+  9 Power_On_Hours          0x0032   051   051   000    Old_age   Always       -       35870
+ 12 Power_Cycle_Count       0x0032   100   100   000    Old_age   Always       -       212
+187 Reported_Uncorrect      0x0032   100   100   000    Old_age   Always       -       1
+188 Command_Timeout         0x0032   100   100   000    Old_age   Always       -       0 0 2
+193 Load_Cycle_Count        0x0032   188   188   000    Old_age   Always       -       37512
+`
+
+func TestParseAttributeTableCycleCounts(t *testing.T) {
+	var startStop, powerCycles, reallocated, poh, reported, timeouts int64
+	parseTable(ataAttributeTable, map[string]*int64{
+		"Start_Stop_Count":      &startStop,
+		"Power_Cycle_Count":     &powerCycles,
+		"Reallocated_Sector_Ct": &reallocated,
+		"Power_On_Hours":        &poh,
+		"Reported_Uncorrect":    &reported,
+		"Command_Timeout":       &timeouts,
+	})
+	if startStop != 4127 || powerCycles != 212 {
+		t.Fatalf("expected start/stop 4127 and power cycles 212, got %d and %d", startStop, powerCycles)
+	}
+	if reallocated != 3 || poh != 35870 || reported != 1 || timeouts != 0 {
+		t.Fatalf("unexpected attribute values: realloc %d poh %d 187 %d 188 %d", reallocated, poh, reported, timeouts)
+	}
+}
+
+func TestCollectFlagsSmartUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\n" +
+		"echo 'smartctl 7.3 2022-02-28 r5338 [x86_64-linux-6.1.0] (local build)'\n" +
+		"echo '/dev/sdz: Unknown USB bridge [0x090c:0x1000 (0x1100)]'\n" +
+		"echo 'Please specify device type with the -d option.'\n" +
+		"exit 1\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store, err := storage.Open(filepath.Join(dir, "state.db"), slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	disk := storage.Disk{ID: "usb-Generic_Flash_Disk", Name: "/dev/sdz", Type: "hdd"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := NewSmartCollector(store, bin, slog.Default()).Collect(ctx, []storage.Disk{disk}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	got, err := store.GetDisk(ctx, disk.ID)
+	if err != nil || got == nil {
+		t.Fatalf("get disk: %v", err)
+	}
+	if !got.SmartUnsupported {
+		t.Fatal("expected disk to be flagged smart_unsupported")
+	}
+	if snap, _ := store.LatestSmart(ctx, disk.ID); snap != nil {
+		t.Fatalf("expected no snapshot for unsupported disk, got %+v", snap)
+	}
+	// Rediscovery must not clear the flag.
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("re-upsert disk: %v", err)
+	}
+	if got, _ := store.GetDisk(ctx, disk.ID); got == nil || !got.SmartUnsupported {
+		t.Fatal("expected flag to survive UpsertDisk")
+	}
+}
+
+func TestParseWriteCache(t *testing.T) {
+	cases := []struct {
+		name, out, want string
+	}{
+		{"ata enabled", "=== START OF READ SMART DATA SECTION ===\nWrite cache is:   Enabled\n", "enabled"},
+		{"sas disabled", sasSmartctlOutput + "Write cache is:   Disabled\n", "disabled"},
+		{"unavailable", "Write cache is:   Unavailable\n", ""},
+		{"not reported", ataAttributeTable, ""},
+	}
+	for _, tc := range cases {
+		if got := parseWriteCache(tc.out); got != tc.want {
+			t.Errorf("%s: parseWriteCache = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+const hddInfoOutput = `=== START OF INFORMATION SECTION ===
+Model Family:     Western Digital Red
+Device Model:     WDC WD40EFRX-68N32N0
+Serial Number:    WD-WCC7K0000000
+Firmware Version: 82.00A82
+User Capacity:    4,000,787,030,016 bytes [4.00 TB]
+Sector Sizes:     512 bytes logical, 4096 bytes physical
+Rotation Rate:    5400 rpm
+Form Factor:      3.5 inches
+Device is:        In smartctl database [for details use: -P show]
+ATA Version is:   ACS-3 T13/2161-D revision 3b
+SATA Version is:  SATA 3.1, 6.0 Gb/s (current: 6.0 Gb/s)
+Local Time is:    Sun Mar  2 10:15:01 2025 UTC
+SMART support is: Available - device has SMART capability.
+SMART support is: Enabled
+`
+
+const ssdInfoOutput = `=== START OF INFORMATION SECTION ===
+Model Family:     Samsung based SSDs
+Device Model:     Samsung SSD 860 EVO 500GB
+Serial Number:    S3Z2NB0K000000A
+Firmware Version: RVT04B6Q
+User Capacity:    500,107,862,016 bytes [500 GB]
+Sector Size:      512 bytes logical/physical
+Rotation Rate:    Solid State Device
+Form Factor:      2.5 inches
+TRIM Command:     Available, deterministic, zeroed
+Device is:        In smartctl database [for details use: -P show]
+ATA Version is:   ACS-4 T13/BSR INCITS 529 revision 5
+SATA Version is:  SATA 3.2, 6.0 Gb/s (current: 6.0 Gb/s)
+SMART support is: Available - device has SMART capability.
+SMART support is: Enabled
+`
+
+func TestParseDeviceInfo(t *testing.T) {
+	cases := []struct {
+		name, out string
+		want      storage.DiskInfo
+	}{
+		{"hdd", hddInfoOutput, storage.DiskInfo{
+			RotationRate: 5400,
+			FormFactor:   "3.5 inches",
+			ATAVersion:   "ACS-3 T13/2161-D revision 3b",
+			SATAVersion:  "SATA 3.1, 6.0 Gb/s (current: 6.0 Gb/s)",
+		}},
+		{"ssd", ssdInfoOutput, storage.DiskInfo{
+			FormFactor:  "2.5 inches",
+			ATAVersion:  "ACS-4 T13/BSR INCITS 529 revision 5",
+			SATAVersion: "SATA 3.2, 6.0 Gb/s (current: 6.0 Gb/s)",
+			TRIM:        "Available, deterministic, zeroed",
+		}},
+		{"not reported", ataAttributeTable, storage.DiskInfo{}},
+	}
+	for _, tc := range cases {
+		if got := parseDeviceInfo(tc.out); got != tc.want {
+			t.Errorf("%s: parseDeviceInfo = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+	if !solidState(ssdInfoOutput) || solidState(hddInfoOutput) {
+		t.Errorf("expected only the SSD output classified as solid state")
+	}
+}
+
+func TestCollectReclassifiesSolidStateDisk(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\ncat <<'EOF'\n" +
+		"=== START OF INFORMATION SECTION ===\n" +
+		"Device Model:     QEMU HARDDISK\n" +
+		"Rotation Rate:    Solid State Device\n" +
+		"\n" +
+		"=== START OF READ SMART DATA SECTION ===\n" +
+		"SMART overall-health self-assessment test result: PASSED\n" +
+		"EOF\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store, err := storage.Open(filepath.Join(dir, "state.db"), slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	// sysfs said rotational=1
+	disk := storage.Disk{ID: "ata-QEMU_HARDDISK_QM00001", Name: "/dev/sda", Type: "hdd"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := NewSmartCollector(store, bin, slog.Default()).Collect(ctx, []storage.Disk{disk}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if got, _ := store.GetDisk(ctx, disk.ID); got == nil || got.Type != "sata_ssd" {
+		t.Fatalf("expected disk reclassified as sata_ssd, got %+v", got)
+	}
+	// The next discovery pass still reads rotational=1.
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("re-upsert disk: %v", err)
+	}
+	if got, _ := store.GetDisk(ctx, disk.ID); got == nil || got.Type != "sata_ssd" {
+		t.Fatalf("expected reclassification to survive rediscovery, got %+v", got)
+	}
+
+	if solidState("Rotation Rate:    7200 rpm\n") {
+		t.Fatal("expected a 7200 rpm drive to stay rotational")
+	}
+}
+
+func TestCollectParsesInformationalExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "smartctl")
+	// Exit 0x48: bit 3 (disk failing) and bit 6 (error log has entries).
+	script := "#!/bin/sh\ncat <<'EOF'\n" +
+		"=== START OF READ SMART DATA SECTION ===\n" +
+		"SMART overall-health self-assessment test result: FAILED!\n" +
+		"Drive failure expected in less than 24 hours. SAVE ALL DATA.\n" +
+		ataAttributeTable +
+		"EOF\nexit 72\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store, err := storage.Open(filepath.Join(dir, "state.db"), slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	disk := storage.Disk{ID: "ata-FAILING", Name: "/dev/sdf", Type: "hdd"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := NewSmartCollector(store, bin, slog.Default()).Collect(ctx, []storage.Disk{disk}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	snap, err := store.LatestSmart(ctx, disk.ID)
+	if err != nil || snap == nil {
+		t.Fatalf("expected a snapshot despite nonzero exit, got %v (err %v)", snap, err)
+	}
+	if snap.HealthStatus != "failed" {
+		t.Fatalf("expected health failed, got %q", snap.HealthStatus)
+	}
+	if snap.PowerOnHours == 0 {
+		t.Fatal("expected attribute table to be parsed")
+	}
+
+	// Bit 1 (device open failed) is a real collection failure.
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho 'Smartctl open device: /dev/sdf failed: No such device'\nexit 2\n"), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-GONE", Name: "/dev/sdg", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := NewSmartCollector(store, bin, slog.Default()).Collect(ctx, []storage.Disk{{ID: "ata-GONE", Name: "/dev/sdg", Type: "hdd"}}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if snap, _ := store.LatestSmart(ctx, "ata-GONE"); snap != nil {
+		t.Fatalf("expected no snapshot when the device can't be opened, got %+v", snap)
+	}
+}
+
+func TestCollectRecordsDurations(t *testing.T) {
+	SetRecordMetrics(true)
+	t.Cleanup(func() { SetRecordMetrics(false) })
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\nsleep 0.05\necho 'SMART overall-health self-assessment test result: PASSED'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store, err := storage.Open(filepath.Join(dir, "state.db"), slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	disk := storage.Disk{ID: "ata-TIMED", Name: "/dev/sdt", Type: "hdd"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := NewSmartCollector(store, bin, slog.Default()).Collect(ctx, []storage.Disk{disk}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	stats, err := store.CollectionMetricStats(ctx)
+	if err != nil {
+		t.Fatalf("collection metric stats: %v", err)
+	}
+	got := map[string]storage.CollectionMetricStats{}
+	for _, st := range stats {
+		got[st.Collector+"/"+st.DiskID] = st
+	}
+	for _, key := range []string{"smart/", "smart/" + disk.ID} {
+		st, ok := got[key]
+		if !ok {
+			t.Fatalf("expected a duration for %s, got %+v", key, stats)
+		}
+		if st.Count != 1 || st.LastMs < 50 || st.MaxMs != st.LastMs {
+			t.Fatalf("unexpected stats for %s: %+v", key, st)
+		}
+	}
+}
+
+func TestMandatoryCommandFailureIsNotUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "smartctl")
+	// What smartctl prints for a dying drive that stops answering identify.
+	script := "#!/bin/sh\ncat <<'EOF'\n" +
+		"Read Device Identity failed: Input/output error\n\n" +
+		"A mandatory SMART command failed: exiting. To continue, add one or more '-T permissive' options.\n" +
+		"EOF\nexit 4\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store, err := storage.Open(filepath.Join(dir, "state.db"), slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	disk := storage.Disk{ID: "ata-DYING", Name: "/dev/sdh", Type: "hdd"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	// Flagged by an earlier build that treated this message as "no SMART".
+	if err := store.SetSmartUnsupported(ctx, disk.ID, true); err != nil {
+		t.Fatalf("flag disk: %v", err)
+	}
+	disk.SmartUnsupported = true
+	result, _ := NewSmartCollector(store, bin, slog.Default()).CollectWithResult(ctx, []storage.Disk{disk})
+	if result.Unsupported != 0 || len(result.Failures) != 1 {
+		t.Fatalf("expected a collection failure, got %+v", result)
+	}
+	stored, err := store.GetDisk(ctx, disk.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("get disk: %v", err)
+	}
+	if stored.SmartUnsupported {
+		t.Fatal("a failing drive must not be flagged as SMART unsupported")
+	}
+
+	if !smartUnsupported("SMART support is: Unavailable - device lacks SMART capability.\n") {
+		t.Fatal("expected a drive without SMART to be unsupported")
+	}
+}
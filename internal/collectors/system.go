@@ -0,0 +1,122 @@
+package collectors
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+// Host files read by the system collector; variables so tests can point
+// them at fixtures.
+var (
+	procLoadavg  = "/proc/loadavg"
+	procMeminfo  = "/proc/meminfo"
+	procArcstats = "/proc/spl/kstat/zfs/arcstats"
+)
+
+// SystemCollector records host load, memory and ZFS ARC state
+// (storage.system_metrics). Storage trouble often follows the host's: memory
+// pressure shrinks the ARC and throttles ZFS writes.
+type SystemCollector struct {
+	store  *storage.Store
+	logger *slog.Logger
+}
+
+func NewSystemCollector(store *storage.Store, logger *slog.Logger) *SystemCollector {
+	return &SystemCollector{store: store, logger: logger}
+}
+
+func (c *SystemCollector) Collect(ctx context.Context) error {
+	defer recordDuration(ctx, c.store, c.logger, "system", "", time.Now())
+
+	m := storage.SystemMetrics{Timestamp: time.Now().Unix()}
+	if b, err := os.ReadFile(procLoadavg); err == nil {
+		m.Load1, m.Load5, m.Load15 = parseLoadavg(string(b))
+	} else {
+		c.logger.Debug("reading loadavg failed", "error", err)
+	}
+	if b, err := os.ReadFile(procMeminfo); err == nil {
+		m.MemTotalBytes, m.MemAvailableBytes = parseMeminfo(string(b))
+	} else {
+		c.logger.Debug("reading meminfo failed", "error", err)
+	}
+	// Absent unless the zfs module is loaded
+	if b, err := os.ReadFile(procArcstats); err == nil {
+		arc := parseArcstats(string(b))
+		m.ARCSizeBytes = arc["size"]
+		m.ARCTargetBytes = arc["c"]
+		m.ARCMinBytes = arc["c_min"]
+		m.ARCMaxBytes = arc["c_max"]
+		m.ARCHits = arc["hits"]
+		m.ARCMisses = arc["misses"]
+		m.ARCThrottles = arc["memory_throttle_count"]
+	}
+
+	if err := c.store.AddSystemMetrics(ctx, m); err != nil {
+		c.logger.Warn("failed to store system metrics", "error", err)
+	}
+	return nil
+}
+
+// parseLoadavg reads the 1, 5 and 15 minute load averages from
+// /proc/loadavg, e.g. "0.52 0.58 0.59 1/467 12345".
+func parseLoadavg(out string) (load1, load5, load15 float64) {
+	fields := strings.Fields(out)
+	if len(fields) < 3 {
+		return 0, 0, 0
+	}
+	load1, _ = strconv.ParseFloat(fields[0], 64)
+	load5, _ = strconv.ParseFloat(fields[1], 64)
+	load15, _ = strconv.ParseFloat(fields[2], 64)
+	return load1, load5, load15
+}
+
+// parseMeminfo returns MemTotal and MemAvailable from /proc/meminfo in
+// bytes (the file reports kB).
+func parseMeminfo(out string) (total, available int64) {
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(val)
+		if len(fields) == 0 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "MemTotal":
+			total = kb * 1024
+		case "MemAvailable":
+			available = kb * 1024
+		}
+	}
+	return total, available
+}
+
+// parseArcstats parses the kstat table in /proc/spl/kstat/zfs/arcstats: a
+// kstat header line, a "name type data" line, then one "name type value"
+// row per statistic.
+func parseArcstats(out string) map[string]int64 {
+	stats := make(map[string]int64)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		stats[fields[0]] = v
+	}
+	return stats
+}
@@ -0,0 +1,49 @@
+package collectors
+
+import "testing"
+
+const arcstatsOutput = `13 1 0x01 123 33456 14255233385 1109935626316606
+name                            type data
+hits                            4    98765432
+misses                          4    1234567
+size                            4    4294967296
+c                               4    1073741824
+c_min                           4    1073741824
+c_max                           4    16777216000
+memory_throttle_count           4    3
+arc_no_grow                     4    1
+`
+
+func TestParseArcstats(t *testing.T) {
+	got := parseArcstats(arcstatsOutput)
+	want := map[string]int64{
+		"hits":                  98765432,
+		"misses":                1234567,
+		"size":                  4294967296,
+		"c":                     1073741824,
+		"c_min":                 1073741824,
+		"c_max":                 16777216000,
+		"memory_throttle_count": 3,
+		"arc_no_grow":           1,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d stats, want %d: %v", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %d, want %d", k, got[k], v)
+		}
+	}
+}
+
+func TestParseLoadavgAndMeminfo(t *testing.T) {
+	l1, l5, l15 := parseLoadavg("0.52 0.58 0.59 1/467 12345\n")
+	if l1 != 0.52 || l5 != 0.58 || l15 != 0.59 {
+		t.Errorf("load = %v %v %v", l1, l5, l15)
+	}
+
+	total, avail := parseMeminfo("MemTotal:       16318480 kB\nMemFree:         1021340 kB\nMemAvailable:    8159240 kB\n")
+	if total != 16318480*1024 || avail != 8159240*1024 {
+		t.Errorf("meminfo = %d/%d", avail, total)
+	}
+}
@@ -14,16 +14,24 @@ import (
 )
 
 type ZfsCollector struct {
-	store  *storage.Store
-	logger *slog.Logger
-	zpool  string
-	zfs    string
+	store      *storage.Store
+	logger     *slog.Logger
+	zpool      string
+	zfs        string
+	properties bool
+	running    runGuard
 }
 
 func NewZfsCollector(store *storage.Store, zpoolPath, zfsPath string, logger *slog.Logger) *ZfsCollector {
 	return &ZfsCollector{store: store, zpool: zpoolPath, zfs: zfsPath, logger: logger}
 }
 
+// SetCollectProperties enables collection of compression, space and dedup
+// properties for each pool (storage.zfs_properties).
+func (c *ZfsCollector) SetCollectProperties(enabled bool) {
+	c.properties = enabled
+}
+
 // TriggerScrub starts a ZFS scrub on the specified pool
 func (c *ZfsCollector) TriggerScrub(ctx context.Context, poolName string) error {
 	ctx, cancel := ctxWithTimeout(ctx, 5*time.Second)
@@ -40,16 +48,23 @@ func (c *ZfsCollector) TriggerScrub(ctx context.Context, poolName string) error
 }
 
 func (c *ZfsCollector) Collect(ctx context.Context) error {
+	done, err := c.running.start()
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	// #region agent log
 	debug.Log("internal/collectors/zfs.go:40", "ZfsCollector.Collect called", map[string]interface{}{
 		"zpoolPath": c.zpool,
 	})
 	// #endregion
+	defer recordDuration(ctx, c.store, c.logger, "zfs", "", time.Now())
 	ctx, cancel := ctxWithTimeout(ctx, 20*time.Second)
 	defer cancel()
 
-	// First get list of pools
-	listOut, err := runCommand(ctx, c.zpool, "list", "-H", "-o", "name")
+	// First get list of pools, with their allocation
+	listOut, err := runCommand(ctx, c.zpool, "list", "-Hp", "-o", "name,size,free,capacity,fragmentation")
 	// #region agent log
 	debug.Log("internal/collectors/zfs.go:48", "zpool list result", map[string]interface{}{
 		"output": strings.TrimSpace(listOut),
@@ -57,8 +72,7 @@ func (c *ZfsCollector) Collect(ctx context.Context) error {
 	})
 	// #endregion
 	if err != nil {
-		c.logger.Warn("zfs list failed", "error", err)
-		return nil
+		return fmt.Errorf("zpool list: %w", err)
 	}
 
 	poolNames := []string{}
@@ -79,8 +93,14 @@ func (c *ZfsCollector) Collect(ctx context.Context) error {
 	// #endregion
 
 	// Get detailed status for each pool
+	space := parsePoolList(listOut)
 	for _, poolName := range poolNames {
 		c.collectPoolStatus(ctx, poolName)
+		if sp, ok := space[poolName]; ok {
+			if err := c.store.UpsertPoolSpace(ctx, sp); err != nil {
+				c.logger.Warn("failed to store pool space", "pool", poolName, "error", err)
+			}
+		}
 	}
 
 	return nil
@@ -90,7 +110,7 @@ func (c *ZfsCollector) collectPoolStatus(ctx context.Context, poolName string) {
 	ctx, cancel := ctxWithTimeout(ctx, 20*time.Second)
 	defer cancel()
 
-	out, err := runCommand(ctx, c.zpool, "status", poolName)
+	out, err := runCommand(ctx, c.zpool, "status", "-v", poolName)
 	if err != nil {
 		c.logger.Warn("zpool status failed", "pool", poolName, "error", err)
 		return
@@ -105,12 +125,173 @@ func (c *ZfsCollector) collectPoolStatus(ctx context.Context, poolName string) {
 	// Check for active scrub
 	if isScrubActive(out) {
 		c.logger.Info("scrub in progress", "pool", poolName)
-		// We could track active scrub progress here if needed
 	}
+	c.trackScrub(ctx, poolName, out, lastScrubTime, lastScrubErrors)
 
 	if err := c.store.UpsertPool(ctx, poolName, state, lastScrubTime, lastScrubErrors); err != nil {
 		c.logger.Warn("failed to upsert pool", "pool", poolName, "error", err)
 	}
+	if err := c.store.SetPoolErrors(ctx, poolName, parsePermanentErrors(out)); err != nil {
+		c.logger.Warn("failed to store pool errors", "pool", poolName, "error", err)
+	}
+	if c.properties {
+		c.collectPoolProperties(ctx, poolName)
+	}
+}
+
+// trackScrub keeps the scrub history's open entry in step with the pool: a
+// running scrub nobody recorded (started by cron or by hand) gets a start
+// entry, and once no scrub is running open entries get their end time, so a
+// scrub that never completes stands out.
+func (c *ZfsCollector) trackScrub(ctx context.Context, poolName, out string, lastScrubTime, lastScrubErrors int64) {
+	if start, running := parseScrubStart(out); running {
+		open, err := c.store.OpenScrub(ctx, poolName)
+		if err != nil || open != nil {
+			return
+		}
+		if start == 0 {
+			start = time.Now().Unix()
+		}
+		if err := c.store.AddScrubHistory(ctx, storage.ScrubHistoryEntry{PoolName: poolName, StartTime: start, Notes: "Scrub in progress"}); err != nil {
+			c.logger.Warn("failed to record scrub start", "pool", poolName, "error", err)
+		}
+		return
+	}
+	if err := c.store.FinishScrubs(ctx, poolName, lastScrubTime, lastScrubErrors, time.Now().Unix()); err != nil {
+		c.logger.Warn("failed to record scrub completion", "pool", poolName, "error", err)
+	}
+}
+
+var scrubSinceRegex = regexp.MustCompile(`scan:\s+scrub in progress since\s+(.+)$`)
+
+// parseScrubStart reports whether a scrub is running and, when zpool status
+// says, since when: "scan: scrub in progress since Sun Mar  2 00:24:01 2025".
+func parseScrubStart(output string) (int64, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "scrub in progress") {
+			continue
+		}
+		if m := scrubSinceRegex.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			return parseScrubDate(regexp.MustCompile(`\s+`).ReplaceAllString(m[1], " ")), true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// collectPoolProperties records the root dataset's space and compression
+// properties plus the pool-wide dedup ratio.
+func (c *ZfsCollector) collectPoolProperties(ctx context.Context, poolName string) {
+	out, err := runCommand(ctx, c.zfs, "get", "-Hp", "-o", "name,property,value",
+		"used,logicalused,compressratio,dedup", poolName)
+	if err != nil {
+		c.logger.Warn("zfs get failed", "pool", poolName, "error", err)
+		return
+	}
+	values := parseZfsGet(out)
+	if ratioOut, err := runCommand(ctx, c.zpool, "get", "-Hp", "-o", "name,property,value", "dedupratio", poolName); err == nil {
+		for k, v := range parseZfsGet(ratioOut) {
+			values[k] = v
+		}
+	} else {
+		c.logger.Warn("zpool get dedupratio failed", "pool", poolName, "error", err)
+	}
+
+	props := storage.PoolProperties{
+		PoolName:      poolName,
+		CompressRatio: parseRatio(values["compressratio"]),
+		Dedup:         values["dedup"],
+		DedupRatio:    parseRatio(values["dedupratio"]),
+	}
+	props.UsedBytes, _ = strconv.ParseInt(values["used"], 10, 64)
+	props.LogicalUsedBytes, _ = strconv.ParseInt(values["logicalused"], 10, 64)
+	if err := c.store.UpsertPoolProperties(ctx, props); err != nil {
+		c.logger.Warn("failed to store pool properties", "pool", poolName, "error", err)
+	}
+}
+
+// parsePoolList reads `zpool list -Hp -o name,size,free,capacity,fragmentation`
+// output. Older releases append "%" to the percentages even with -p, and
+// fragmentation is "-" when the pool can't report it.
+func parsePoolList(output string) map[string]storage.PoolSpace {
+	pools := map[string]storage.PoolSpace{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		percent := func(v string) int64 {
+			n, _ := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			return int64(n)
+		}
+		sp := storage.PoolSpace{
+			PoolName:      fields[0],
+			Capacity:      percent(fields[3]),
+			Fragmentation: percent(fields[4]),
+		}
+		sp.SizeBytes, _ = strconv.ParseInt(fields[1], 10, 64)
+		sp.FreeBytes, _ = strconv.ParseInt(fields[2], 10, 64)
+		pools[sp.PoolName] = sp
+	}
+	return pools
+}
+
+// parseZfsGet maps property to value from `zfs get -H` / `zpool get -H`
+// output. Lines are tab-separated name, property, value[, source]; "-"
+// (not applicable) values are dropped.
+func parseZfsGet(output string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) < 3 || fields[2] == "-" {
+			continue
+		}
+		values[fields[1]] = fields[2]
+	}
+	return values
+}
+
+// parseRatio parses a compressratio/dedupratio value. With -p ZFS prints
+// a bare number, but older releases still append an "x" suffix.
+func parseRatio(value string) float64 {
+	ratio, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil {
+		return 0
+	}
+	return ratio
+}
+
+// parsePermanentErrors extracts the objects listed under "Permanent errors
+// have been detected in the following files:" in `zpool status -v` output.
+// Entries are file paths, dataset@snapshot:path pairs, or <0xN>:<0xN>
+// object IDs when the file can no longer be named.
+func parsePermanentErrors(output string) []string {
+	lines := strings.Split(output, "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.Contains(line, "Permanent errors have been detected") {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	var objects []string
+	for _, line := range lines[start:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			if len(objects) > 0 {
+				break
+			}
+			continue
+		}
+		if line == trimmed {
+			break // unindented: a new section
+		}
+		objects = append(objects, trimmed)
+	}
+	return objects
 }
 
 func parsePoolState(output string) string {
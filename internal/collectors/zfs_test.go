@@ -0,0 +1,108 @@
+package collectors
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+const zpoolStatusPermanentErrors = `  pool: tank
+ state: ONLINE
+status: One or more devices has experienced an error resulting in data
+	corruption.  Applications may be affected.
+action: Restore the file in question if possible.  Otherwise restore the
+	entire pool from backup.
+   see: https://openzfs.github.io/openzfs-docs/msg/ZFS-8000-8A
+  scan: scrub repaired 0B in 02:11:09 with 3 errors on Sun Mar 10 02:35:10 2024
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  mirror-0  ONLINE       0     0     0
+	    sda     ONLINE       0     0     6
+	    sdb     ONLINE       0     0     6
+
+errors: Permanent errors have been detected in the following files:
+
+        /tank/media/photos/2019/IMG_0042.jpg
+        tank/vm@daily-2024-03-09:/disk0.raw
+        <metadata>:<0x1b>
+`
+
+func TestParsePermanentErrors(t *testing.T) {
+	got := parsePermanentErrors(zpoolStatusPermanentErrors)
+	want := []string{
+		"/tank/media/photos/2019/IMG_0042.jpg",
+		"tank/vm@daily-2024-03-09:/disk0.raw",
+		"<metadata>:<0x1b>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsePermanentErrors = %q, want %q", got, want)
+	}
+
+	if got := parsePermanentErrors("  pool: tank\n state: ONLINE\nerrors: No known data errors\n"); got != nil {
+		t.Fatalf("expected no errors for a clean pool, got %q", got)
+	}
+}
+
+// Default `zfs get -Hp` columns: name, property, value, source.
+const zfsGetOutput = "tank\tused\t1319413953331\t-\n" +
+	"tank\tlogicalused\t2156044578816\t-\n" +
+	"tank\tcompressratio\t1.63x\t-\n" +
+	"tank\tdedup\ton\tlocal\n" +
+	"tank\tdedupratio\t1.04\t-\n" +
+	"tank\tquota\t-\t-\n"
+
+func TestParseZfsGet(t *testing.T) {
+	got := parseZfsGet(zfsGetOutput)
+	want := map[string]string{
+		"used":          "1319413953331",
+		"logicalused":   "2156044578816",
+		"compressratio": "1.63x",
+		"dedup":         "on",
+		"dedupratio":    "1.04",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseZfsGet = %v, want %v", got, want)
+	}
+
+	if r := parseRatio(got["compressratio"]); r != 1.63 {
+		t.Fatalf("expected compressratio 1.63, got %v", r)
+	}
+	if r := parseRatio(got["dedupratio"]); r != 1.04 {
+		t.Fatalf("expected dedupratio 1.04, got %v", r)
+	}
+	if r := parseRatio("-"); r != 0 {
+		t.Fatalf("expected 0 for an unparsable ratio, got %v", r)
+	}
+}
+
+func TestParsePoolList(t *testing.T) {
+	out := "tank\t16000900661248\t1120063046287\t93\t71\nboot\t254476812288\t231928233984\t8%\t-\n"
+	got := parsePoolList(out)
+	want := map[string]storage.PoolSpace{
+		"tank": {PoolName: "tank", SizeBytes: 16000900661248, FreeBytes: 1120063046287, Capacity: 93, Fragmentation: 71},
+		"boot": {PoolName: "boot", SizeBytes: 254476812288, FreeBytes: 231928233984, Capacity: 8},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsePoolList = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseScrubStart(t *testing.T) {
+	running := `  pool: tank
+ state: ONLINE
+  scan: scrub in progress since Sun Mar  2 00:24:01 2025
+	1.23T / 4.56T scanned at 512M/s, 0.98T / 4.56T issued at 410M/s
+	0B repaired, 21.49% done, 02:32:10 to go
+`
+	start, ok := parseScrubStart(running)
+	if want := time.Date(2025, 3, 2, 0, 24, 1, 0, time.UTC).Unix(); !ok || start != want {
+		t.Fatalf("parseScrubStart = %d, %v; want %d, true", start, ok, want)
+	}
+	if _, ok := parseScrubStart(zpoolStatusPermanentErrors); ok {
+		t.Fatal("completed scrub reported as running")
+	}
+}
@@ -1,9 +1,18 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,17 +24,68 @@ const (
 )
 
 type StorageConfig struct {
-	IncludeDevices []string `yaml:"include_devices"`
-	ExcludeDevices []string `yaml:"exclude_devices"`
-	ZFSEnable      bool     `yaml:"zfs_enable"`
+	IncludeDevices    []string `yaml:"include_devices"`
+	ExcludeDevices    []string `yaml:"exclude_devices"`
+	ZFSEnable         bool     `yaml:"zfs_enable"`
+	IncludePartitions bool     `yaml:"include_partitions"` // Also monitor partitions and md arrays, not just whole disks
+	ZFSProperties     bool     `yaml:"zfs_properties"`     // Collect compressratio/used/logicalused/dedup per pool
+	MDEnable          bool     `yaml:"md_enable"`          // Monitor mdadm software RAID arrays from /proc/mdstat
+	DiskIDStrategy    string   `yaml:"disk_id_strategy"`   // How disk IDs are derived: by-id (default), wwn or serial-hash
+	SystemMetrics     bool     `yaml:"system_metrics"`     // Collect load average, memory and ZFS ARC stats from /proc
 }
 
 type SchedulingConfig struct {
-	SmartCollectInterval time.Duration `yaml:"smart_collect_interval"`
-	ZFSStatusInterval    time.Duration `yaml:"zfs_status_interval"`
-	SmartShortInterval   time.Duration `yaml:"smart_short_interval"`
-	SmartLongInterval    time.Duration `yaml:"smart_long_interval"`
-	ZFSScrubInterval     time.Duration `yaml:"zfs_scrub_interval"`
+	SmartCollectInterval  time.Duration     `yaml:"smart_collect_interval"`
+	ZFSStatusInterval     time.Duration     `yaml:"zfs_status_interval"`
+	SmartShortInterval    time.Duration     `yaml:"smart_short_interval"`
+	SmartLongInterval     time.Duration     `yaml:"smart_long_interval"`
+	SmartTestMaxPerRun    int               `yaml:"smart_test_max_per_run"` // SMART tests started per pass (0 = no limit)
+	SmartTestStagger      time.Duration     `yaml:"smart_test_stagger"`     // Wait before starting the next batch of deferred tests
+	ExcludeRootDisk       bool              `yaml:"exclude_root_disk"`      // Skip the disk holding / for SMART self-tests and its nuisance alerts
+	ZFSScrubInterval      time.Duration     `yaml:"zfs_scrub_interval"`
+	SnapshotMaxRows       int               `yaml:"snapshot_max_rows"`       // Max snapshots kept per disk (0 = no limit)
+	MaxConcurrentCommands int               `yaml:"max_concurrent_commands"` // Global cap on concurrent collector subprocesses
+	WALCheckpointInterval time.Duration     `yaml:"wal_checkpoint_interval"` // How often to truncate the SQLite WAL (0 = never)
+	CollectionMetrics     bool              `yaml:"collection_metrics"`      // Record collection durations for /api/v1/diagnostics
+	PoolScrubSchedules    map[string]string `yaml:"pool_scrub_schedules"`    // Per-pool scrub interval ("7d") or 5-field cron, overriding zfs_scrub_interval
+	BreakerThreshold      int               `yaml:"breaker_threshold"`       // Consecutive failures to start a scrub/SMART test before suspending it (0 = never)
+	BreakerCooldown       time.Duration     `yaml:"breaker_cooldown"`        // How long a suspended scrub/SMART test waits before one retry (0 = until reset)
+	Adaptive              AdaptiveConfig    `yaml:"adaptive"`
+	PollPriority          PollPriority      `yaml:"poll_priority"`
+}
+
+// PollPriority orders disks before each SMART/NVMe collection pass so that
+// on large arrays the drives that matter most are read, and alert, first.
+// Without it disks are collected in ID order.
+type PollPriority struct {
+	PoolMembersFirst bool           `yaml:"pool_members_first"` // Collect ZFS pool members before other disks
+	Rules            []PriorityRule `yaml:"rules"`              // Higher priority first; outranks pool_members_first
+}
+
+// PriorityRule gives the disks matching Match (a glob on disk ID, device name
+// or model, as in alerts.disk_overrides) a collection priority. Unmatched
+// disks have priority 0; the first matching rule wins.
+type PriorityRule struct {
+	Match    string `yaml:"match"`
+	Priority int    `yaml:"priority"`
+}
+
+// PriorityFor returns the poll_priority rule priority for a disk.
+func (p PollPriority) PriorityFor(id, name, model string) int {
+	for _, r := range p.Rules {
+		if matchDisk(r.Match, id, name, model) {
+			return r.Priority
+		}
+	}
+	return 0
+}
+
+// AdaptiveConfig stretches collection intervals while everything is healthy.
+type AdaptiveConfig struct {
+	Enabled       bool    `yaml:"enabled"`
+	HealthyCycles int     `yaml:"healthy_cycles"` // Consecutive "ok" reports before backing off
+	Factor        float64 `yaml:"factor"`         // Multiplier applied per backoff step
+	MaxFactor     float64 `yaml:"max_factor"`     // Cap on the total multiplier
 }
 
 type TemperatureThresholds struct {
@@ -35,20 +95,169 @@ type TemperatureThresholds struct {
 	NvmeCritical float64 `yaml:"nvme_critical"` // Critical threshold for NVMe (default: 85°C)
 }
 
+// UnmarshalYAML accepts thresholds in either unit via an optional
+// "units: fahrenheit" key, converting them to Celsius, which is what the
+// collectors store and the rules compare against. Thresholds left out keep
+// their (Celsius) defaults.
+func (t *TemperatureThresholds) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Units        string   `yaml:"units"`
+		HDDWarning   *float64 `yaml:"hdd_warning"`
+		HDDCritical  *float64 `yaml:"hdd_critical"`
+		NvmeWarning  *float64 `yaml:"nvme_warning"`
+		NvmeCritical *float64 `yaml:"nvme_critical"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	convert := func(v float64) float64 { return v }
+	switch strings.ToLower(raw.Units) {
+	case "", "c", "celsius":
+	case "f", "fahrenheit":
+		convert = FahrenheitToCelsius
+	default:
+		return fmt.Errorf("alerts.temperature_thresholds.units must be celsius or fahrenheit (got %q)", raw.Units)
+	}
+	for _, f := range []struct {
+		dst *float64
+		src *float64
+	}{
+		{&t.HDDWarning, raw.HDDWarning},
+		{&t.HDDCritical, raw.HDDCritical},
+		{&t.NvmeWarning, raw.NvmeWarning},
+		{&t.NvmeCritical, raw.NvmeCritical},
+	} {
+		if f.src != nil {
+			*f.dst = convert(*f.src)
+		}
+	}
+	return nil
+}
+
+// DiskOverride replaces temperature thresholds for the disks whose ID, device
+// name or model matches the Match glob (e.g. "SAMSUNG MZQL2*"). Thresholds left
+// out, and "units", behave as in temperature_thresholds.
+type DiskOverride struct {
+	Match      string
+	Thresholds TemperatureThresholds
+}
+
+func (o *DiskOverride) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Match string `yaml:"match"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	o.Match = raw.Match
+	return value.Decode(&o.Thresholds)
+}
+
+// matches reports whether the override applies to a disk. The glob is tried
+// against the full ID and name and their last path element, so both
+// "nvme-SAMSUNG*" and "/dev/nvme0n1" work.
+func (o DiskOverride) matches(id, name, model string) bool {
+	return matchDisk(o.Match, id, name, model)
+}
+
+func matchDisk(pattern, id, name, model string) bool {
+	for _, s := range []string{id, filepath.Base(id), name, filepath.Base(name), model} {
+		if s == "" || s == "." {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ThresholdsFor returns the temperature thresholds for a disk: each threshold
+// comes from the first matching alerts.disk_overrides entry that sets it,
+// else from temperature_thresholds.
+func (a AlertsConfig) ThresholdsFor(id, name, model string) TemperatureThresholds {
+	t := a.TemperatureThresholds
+	set := map[*float64]bool{}
+	for _, o := range a.DiskOverrides {
+		if !o.matches(id, name, model) {
+			continue
+		}
+		for _, f := range []struct {
+			dst *float64
+			src float64
+		}{
+			{&t.HDDWarning, o.Thresholds.HDDWarning},
+			{&t.HDDCritical, o.Thresholds.HDDCritical},
+			{&t.NvmeWarning, o.Thresholds.NvmeWarning},
+			{&t.NvmeCritical, o.Thresholds.NvmeCritical},
+		} {
+			if f.src != 0 && !set[f.dst] {
+				*f.dst = f.src
+				set[f.dst] = true
+			}
+		}
+	}
+	return t
+}
+
+// FahrenheitToCelsius converts a temperature from °F to °C.
+func FahrenheitToCelsius(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+// CelsiusToFahrenheit converts a temperature from °C to °F.
+func CelsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
+
 type AlertsConfig struct {
-	MinSeverity          string                 `yaml:"min_severity"`
-	DebounceWindow       time.Duration          `yaml:"debounce_window"`
-	TemperatureThresholds TemperatureThresholds `yaml:"temperature_thresholds,omitempty"`
+	MinSeverity           string                  `yaml:"min_severity"`
+	DebounceWindow        time.Duration           `yaml:"debounce_window"`
+	TemperatureThresholds TemperatureThresholds   `yaml:"temperature_thresholds,omitempty"`
+	PredictiveFailure     PredictiveFailureConfig `yaml:"predictive_failure"`
+	SmartUnsupported      string                  `yaml:"smart_unsupported"`             // Disks without SMART: info, warning or ignore
+	NamespaceUtilization  float64                 `yaml:"namespace_utilization_warning"` // Percent of a thin-provisioned NVMe namespace in use before warning
+	MinDedupRatio         float64                 `yaml:"min_dedup_ratio"`               // Dedup ratio below which enabled dedup is reported as wasting RAM
+	PoolCapacityWarning   float64                 `yaml:"pool_capacity_warning"`         // Percent of a ZFS pool allocated before warning (lowered by fragmentation)
+	PoolCapacityCritical  float64                 `yaml:"pool_capacity_critical"`        // Percent of a ZFS pool allocated before critical (lowered by fragmentation)
+	WriteCacheProtected   bool                    `yaml:"write_cache_power_protected"`   // Drive caches are UPS/BBU-backed; don't flag enabled write caches
+	StartupGrace          time.Duration           `yaml:"startup_grace"`                 // After start, hold back overdue/staleness alerts for this long
+	MaxReadingAge         time.Duration           `yaml:"max_reading_age"`               // Latest SMART/NVMe reading older than this is stale (0 = 2x smart_collect_interval)
+	MaxScrubDuration      time.Duration           `yaml:"max_scrub_duration"`            // Warn when a scrub has been running longer than this (0 = disabled)
+	DiskOverrides         []DiskOverride          `yaml:"disk_overrides"`                // Per-disk/per-model temperature thresholds
+	Rules                 []AlertRule             `yaml:"rules"`                         // Custom thresholds on snapshot metrics, alongside the built-in checks
+	LogFile               string                  `yaml:"log_file"`                      // Append every alert as NDJSON to this file (empty = disabled)
+	LogFileMaxMB          int                     `yaml:"log_file_max_mb"`               // Rotate log_file to <log_file>.1 past this size
+}
+
+// AlertRule raises an alert with Severity when a metric of a disk's latest
+// SMART or NVMe snapshot compares to Value with Op, e.g. reallocated > 50.
+// Subject defaults to "<metric> <op> <value>".
+type AlertRule struct {
+	Metric   string  `yaml:"metric"`   // One of RuleMetrics
+	Op       string  `yaml:"op"`       // One of RuleOps
+	Value    float64 `yaml:"value"`
+	Severity string  `yaml:"severity"` // One of Severities
+	Subject  string  `yaml:"subject"`
+}
+
+// PredictiveFailureConfig controls the Backblaze-style rule over SMART
+// attributes 5, 187, 188, 197 and 198. Each nonzero attribute scores 1 and
+// each one that grew since the previous snapshot scores another 1.
+type PredictiveFailureConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	MinScore int  `yaml:"min_score"` // Score at which a critical alert is raised
 }
 
 type EmailConfig struct {
-	Enabled    bool     `yaml:"enabled"`
-	SMTPServer string   `yaml:"smtp_server"`
-	SMTPPort   int      `yaml:"smtp_port"`
-	Username   string   `yaml:"username"`
-	Password   string   `yaml:"password"`
-	From       string   `yaml:"from"`
-	To         []string `yaml:"to"`
+	Enabled     bool     `yaml:"enabled"`
+	SMTPServer  string   `yaml:"smtp_server"`
+	SMTPPort    int      `yaml:"smtp_port"`
+	Username    string   `yaml:"username"`
+	Password    string   `yaml:"password"`
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+	MinSeverity string   `yaml:"min_severity,omitempty"` // Only alerts at or above this severity (default: all)
 }
 
 type TelegramConfig struct {
@@ -57,31 +266,187 @@ type TelegramConfig struct {
 	ChatID   string `yaml:"chat_id"`
 }
 
+// SyslogConfig forwards alerts to a syslog collector or SIEM.
+type SyslogConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Network     string `yaml:"network"`  // udp or tcp
+	Address     string `yaml:"address"`  // host:port
+	Facility    string `yaml:"facility"` // e.g. daemon, local0..local7
+	Format      string `yaml:"format"`   // rfc5424 or cef
+	AppName     string `yaml:"app_name"`
+	MinSeverity string `yaml:"min_severity,omitempty"` // Only alerts at or above this severity (default: all)
+}
+
+// PagerDutyConfig sends alerts as PagerDuty Events API v2 events: one
+// incident per alerting disk/pool, resolved when its conditions clear.
+type PagerDutyConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	RoutingKey  string `yaml:"routing_key"`            // Integration key of an Events API v2 integration
+	URL         string `yaml:"url,omitempty"`          // Events endpoint (default: https://events.pagerduty.com/v2/enqueue)
+	MinSeverity string `yaml:"min_severity,omitempty"` // Only alerts at or above this severity (default: all)
+}
+
+// OpsGenieConfig sends alerts to the OpsGenie Alert API: one alert per
+// alerting disk/pool, closed when its conditions clear.
+type OpsGenieConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	APIKey      string `yaml:"api_key"`                // API key of an OpsGenie API integration
+	URL         string `yaml:"url,omitempty"`          // API base URL (default: https://api.opsgenie.com; EU: https://api.eu.opsgenie.com)
+	MinSeverity string `yaml:"min_severity,omitempty"` // Only alerts at or above this severity (default: all)
+}
+
 type WebhookConfig struct {
-	Name string `yaml:"name"`
-	URL  string `yaml:"url"`
+	Name        string            `yaml:"name"`
+	URL         string            `yaml:"url"`
+	Method      string            `yaml:"method,omitempty"`       // POST (default) or PUT
+	Headers     map[string]string `yaml:"headers,omitempty"`      // Extra request headers, e.g. auth or routing keys
+	MinSeverity string            `yaml:"min_severity,omitempty"` // Only alerts at or above this severity (default: all)
+	Envelope    bool              `yaml:"envelope,omitempty"`     // Wrap the alert as {event, host, agent_version, timestamp, alert} instead of the flat alert
 }
 
 type NotificationsConfig struct {
-	Email    EmailConfig     `yaml:"email"`
-	Telegram TelegramConfig  `yaml:"telegram"`
-	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Email                    EmailConfig      `yaml:"email"`
+	Telegram                 TelegramConfig   `yaml:"telegram"`
+	Webhooks                 []WebhookConfig  `yaml:"webhooks"`
+	Syslog                   SyslogConfig     `yaml:"syslog"`
+	PagerDuty                PagerDutyConfig  `yaml:"pagerduty"`
+	OpsGenie                 OpsGenieConfig   `yaml:"opsgenie"`
+	RecoveryNotifications    bool             `yaml:"recovery_notifications"` // Notify when a warning/critical condition clears
+	Redaction                RedactionConfig  `yaml:"redaction"`
+	QueueBatchSize           int              `yaml:"queue_batch_size"`           // Queue entries fetched per processing pass
+	QueueConcurrency         int              `yaml:"queue_concurrency"`          // Notifications sent in parallel
+	BatchWindow              time.Duration    `yaml:"batch_window"`               // Coalesce alerts per channel within this window (0 = off)
+	BatchCriticalImmediately bool             `yaml:"batch_critical_immediately"` // Critical alerts skip the batch window
+	TestOnFirstBoot          bool             `yaml:"test_on_first_boot"`         // Send a test notification during the first-boot self-check
+	TransitionWebhook        WebhookConfig    `yaml:"transition_webhook"`         // Called only when the overall health status changes
+	QuietHours               QuietHoursConfig `yaml:"quiet_hours"`                // Hold back non-critical notifications overnight
+	RetrySchedule            []string         `yaml:"retry_schedule"`             // Delay before each queue retry, e.g. ["1m", "5m"]; the last entry repeats (unset = built-in schedule)
+
+	// Routes lists the channels (as named in the queue: email, syslog,
+	// webhook:<name>, pagerduty, opsgenie) that alerts of each source type go
+	// to, e.g. {pool: ["webhook:storage"]}. Unlisted types go to every channel.
+	Routes map[string][]string `yaml:"routes"`
+
+	// HTTP configures the client used by webhooks, Telegram, PagerDuty and
+	// OpsGenie.
+	HTTP HTTPClientConfig `yaml:"http"`
+}
+
+// NotificationChannel is an enabled notification destination as named in the
+// queue and in Routes: email, syslog, webhook:<name>, pagerduty or opsgenie.
+type NotificationChannel struct {
+	Name        string
+	MinSeverity string
+	Incident    bool // PagerDuty/OpsGenie: opens incidents that recoveries resolve
+}
+
+// Channels lists the enabled notification channels. Email needs a server and
+// recipients to count as enabled.
+func (n NotificationsConfig) Channels() []NotificationChannel {
+	var channels []NotificationChannel
+	if n.Email.Enabled && n.Email.SMTPServer != "" && len(n.Email.To) > 0 {
+		channels = append(channels, NotificationChannel{Name: "email", MinSeverity: n.Email.MinSeverity})
+	}
+	if n.Syslog.Enabled {
+		channels = append(channels, NotificationChannel{Name: "syslog", MinSeverity: n.Syslog.MinSeverity})
+	}
+	for _, webhook := range n.Webhooks {
+		if webhook.URL != "" {
+			channels = append(channels, NotificationChannel{Name: "webhook:" + webhook.Name, MinSeverity: webhook.MinSeverity})
+		}
+	}
+	if n.PagerDuty.Enabled {
+		channels = append(channels, NotificationChannel{Name: "pagerduty", MinSeverity: n.PagerDuty.MinSeverity, Incident: true})
+	}
+	if n.OpsGenie.Enabled {
+		channels = append(channels, NotificationChannel{Name: "opsgenie", MinSeverity: n.OpsGenie.MinSeverity, Incident: true})
+	}
+	return channels
+}
+
+// QuietHoursConfig defers notifications of the muted severities queued
+// between Start and End (wall-clock "HH:MM" in Timezone; the window may wrap
+// past midnight) until the window ends. Alerts are still recorded at once,
+// and critical alerts are never held.
+type QuietHoursConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Start      string   `yaml:"start"`      // e.g. "22:00"
+	End        string   `yaml:"end"`        // e.g. "07:00"
+	Timezone   string   `yaml:"timezone"`   // IANA name, e.g. "Europe/London" (empty = local time)
+	Severities []string `yaml:"severities"` // Severities held back: info and/or warning
+}
+
+// RedactionConfig controls scrubbing of drive identifiers from outbound
+// notifications. The local database and API always keep the real values.
+type RedactionConfig struct {
+	Serials   string `yaml:"serials"`     // "", "hash" or "truncate"
+	ByIDPaths bool   `yaml:"by_id_paths"` // Also redact /dev/disk/by-id/ names
 }
 
 type CloudConfig struct {
-	Enabled            bool          `yaml:"enabled"`
-	Endpoint           string        `yaml:"endpoint"`
-	APIToken           string        `yaml:"api_token"`
-	HostID             string        `yaml:"host_id,omitempty"` // Auto-generated on registration
-	UploadInterval     time.Duration `yaml:"upload_interval"`
+	Enabled             bool          `yaml:"enabled"`
+	Endpoint            string        `yaml:"endpoint"`
+	APIToken            string        `yaml:"api_token"`
+	SigningSecret       string        `yaml:"signing_secret,omitempty"` // Shared secret for HMAC request signing (empty = unsigned)
+	HostID              string        `yaml:"host_id,omitempty"`        // Auto-generated on registration
+	UploadInterval      time.Duration `yaml:"upload_interval"`
 	CommandPollInterval time.Duration `yaml:"command_poll_interval"`
-	Hostname           string        `yaml:"hostname,omitempty"` // Override hostname
+	Hostname            string        `yaml:"hostname,omitempty"` // Override hostname
+	AllowedCommands     []string      `yaml:"allowed_commands"`   // Remote command types to execute (unset = all, [] = none)
+	UploadHistory       bool          `yaml:"upload_history"`     // Upload every snapshot not yet sent, not just the latest
+	UploadBatchSize     int           `yaml:"upload_batch_size"`  // Max snapshots per upload in upload_history mode
+	MaxClockSkew        time.Duration `yaml:"max_clock_skew"`     // Warn when the host clock differs from the cloud's by more than this (0 = never)
+
+	HTTP HTTPClientConfig `yaml:"http"` // Client for uplink requests
+}
+
+// HTTPClientConfig configures an outbound HTTP client. Without Proxy, the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+type HTTPClientConfig struct {
+	Timeout time.Duration `yaml:"timeout"` // Whole-request timeout, including reading the response
+	Proxy   string        `yaml:"proxy"`   // Proxy URL (http, https or socks5) for every request
 }
 
+// Severities lists alert severities from least to most severe. "emergency"
+// sits above "critical" for events such as a suspended pool.
+var Severities = []string{"info", "warning", "critical", "emergency"}
+
+// SeverityRank returns sev's position in Severities, counting from 1, or 0
+// for an empty or unknown severity. Case is ignored.
+func SeverityRank(sev string) int {
+	return slices.Index(Severities, strings.ToLower(sev)) + 1
+}
+
+// RuleMetrics lists the snapshot metrics alerts.rules can test. A rule
+// applies to the disks whose snapshots carry the metric: SMART, NVMe or both.
+var RuleMetrics = []string{
+	// Both
+	"temperature_c", "power_on_hours",
+	// SMART
+	"reallocated", "pending", "offline_uncorrectable", "crc_errors", "spin_retry_count",
+	"load_cycle_count", "grown_defects", "reported_uncorrect", "command_timeout",
+	"power_cycle_count", "start_stop_count",
+	// NVMe
+	"percent_used", "media_errors", "error_log_entries", "unsafe_shutdowns",
+	"data_written_bytes", "data_read_bytes",
+}
+
+// RuleOps lists the comparisons alerts.rules accept.
+var RuleOps = []string{">", ">=", "<", "<=", "==", "!="}
+
+// AlertSourceTypes lists the alert source types notifications.routes can
+// key on.
+var AlertSourceTypes = []string{"disk", "pool", "md", "system", "agent", "external"}
+
+// RemoteCommands lists the command types the cloud can send to an agent.
+var RemoteCommands = []string{"trigger_scrub", "collect_smart", "collect_nvme", "collect_zfs", "locate_disk", "refresh_schedules"}
+
 type APIConfig struct {
-	BindAddress string `yaml:"bind_address"`
-	Port        int    `yaml:"port"`
-	AuthToken   string `yaml:"auth_token"`
+	BindAddress    string        `yaml:"bind_address"`
+	Port           int           `yaml:"port"`
+	AuthToken      string        `yaml:"auth_token"`
+	HandlerTimeout time.Duration `yaml:"handler_timeout"` // Per-request deadline (0 = none)
+	DisplayUnits   string        `yaml:"display_units"`   // celsius or fahrenheit; fahrenheit adds temperature_f to responses
 }
 
 type LoggingConfig struct {
@@ -100,6 +465,8 @@ type ToolsConfig struct {
 	Nvme     string `yaml:"nvme"`
 	Zpool    string `yaml:"zpool"`
 	Zfs      string `yaml:"zfs"`
+	Locate   string `yaml:"locate"` // ledctl or sg_ses, for enclosure locate LEDs
+	Mdadm    string `yaml:"mdadm"`
 }
 
 type Config struct {
@@ -122,11 +489,23 @@ func defaultConfig() Config {
 			ZFSEnable:      true,
 		},
 		Scheduling: SchedulingConfig{
-			SmartCollectInterval: 6 * time.Hour,
-			ZFSStatusInterval:    15 * time.Minute,
-			SmartShortInterval:   168 * time.Hour,
-			SmartLongInterval:    720 * time.Hour,
-			ZFSScrubInterval:     720 * time.Hour,
+			SmartCollectInterval:  6 * time.Hour,
+			ZFSStatusInterval:     15 * time.Minute,
+			SmartShortInterval:    168 * time.Hour,
+			SmartLongInterval:     720 * time.Hour,
+			SmartTestStagger:      time.Hour,
+			ZFSScrubInterval:      720 * time.Hour,
+			SnapshotMaxRows:       10000,
+			MaxConcurrentCommands: 8,
+			WALCheckpointInterval: time.Hour,
+			BreakerThreshold:      3,
+			BreakerCooldown:       24 * time.Hour,
+			Adaptive: AdaptiveConfig{
+				Enabled:       false,
+				HealthyCycles: 3,
+				Factor:        2,
+				MaxFactor:     8,
+			},
 		},
 		Alerts: AlertsConfig{
 			MinSeverity:    "warning",
@@ -137,6 +516,17 @@ func defaultConfig() Config {
 				NvmeWarning:  70.0, // Default: 70°C warning for NVMe
 				NvmeCritical: 85.0, // Default: 85°C critical for NVMe
 			},
+			PredictiveFailure: PredictiveFailureConfig{
+				Enabled:  true,
+				MinScore: 1,
+			},
+			SmartUnsupported:     "info",
+			NamespaceUtilization: 90,
+			MinDedupRatio:        1.5,
+			PoolCapacityWarning:  80,
+			PoolCapacityCritical: 95,
+			StartupGrace:         30 * time.Minute,
+			LogFileMaxMB:         10,
 		},
 		Notifications: NotificationsConfig{
 			Email: EmailConfig{
@@ -154,6 +544,23 @@ func defaultConfig() Config {
 				ChatID:   "",
 			},
 			Webhooks: []WebhookConfig{},
+			Syslog: SyslogConfig{
+				Enabled:  false,
+				Network:  "udp",
+				Address:  "127.0.0.1:514",
+				Facility: "daemon",
+				Format:   "rfc5424",
+				AppName:  "storagesentinel",
+			},
+			QueueBatchSize:           50,
+			QueueConcurrency:         4,
+			BatchCriticalImmediately: true,
+			QuietHours: QuietHoursConfig{
+				Start:      "22:00",
+				End:        "07:00",
+				Severities: []string{"info", "warning"},
+			},
+			HTTP: HTTPClientConfig{Timeout: 10 * time.Second},
 		},
 		Cloud: CloudConfig{
 			Enabled:            false,
@@ -161,13 +568,18 @@ func defaultConfig() Config {
 			APIToken:           "",
 			HostID:             "",
 			UploadInterval:     15 * time.Minute,
+			UploadBatchSize:    200,
+			MaxClockSkew:       2 * time.Minute,
 			CommandPollInterval: 5 * time.Minute,
 			Hostname:           "",
+			HTTP:               HTTPClientConfig{Timeout: 30 * time.Second},
 		},
 		API: APIConfig{
-			BindAddress: "127.0.0.1",
-			Port:        8200,
-		AuthToken:   "",
+			BindAddress:    "127.0.0.1",
+			Port:           8200,
+			AuthToken:      "",
+			HandlerTimeout: 30 * time.Second,
+			DisplayUnits:   "celsius",
 		},
 		Logging: LoggingConfig{
 			Level:       "info",
@@ -183,6 +595,8 @@ func defaultConfig() Config {
 		Nvme:     "nvme",
 		Zpool:    "zpool",
 		Zfs:      "zfs",
+		Locate:   "ledctl",
+		Mdadm:    "mdadm",
 	},
 	}
 }
@@ -230,6 +644,78 @@ func applyEnvOverrides(cfg *Config) {
 	if v, ok := os.LookupEnv("STORAGESENTINEL_API_TOKEN"); ok && v != "" {
 		cfg.API.AuthToken = v
 	}
+	if v, ok := os.LookupEnv("STORAGESENTINEL_CLOUD_SIGNING_SECRET"); ok && v != "" {
+		cfg.Cloud.SigningSecret = v
+	}
+}
+
+// SyslogFacilities maps facility names to their RFC 5424 codes.
+var SyslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Addr returns the listen address, bracketing IPv6 literals as needed.
+func (c APIConfig) Addr() string {
+	return net.JoinHostPort(bindHost(c.BindAddress), strconv.Itoa(c.Port))
+}
+
+// bindHost strips optional brackets from an IPv6 bind address.
+func bindHost(addr string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// scheduleIntervalRe matches the interval form accepted for schedules:
+// a number and one of s, m, h or d.
+var scheduleIntervalRe = regexp.MustCompile(`^[1-9]\d*[smhd]$`)
+
+// knownChannel reports whether name is a notification channel as named in
+// the queue: email, syslog, pagerduty, opsgenie or webhook:<name> for a
+// configured webhook.
+func knownChannel(n NotificationsConfig, name string) bool {
+	switch name {
+	case "email", "syslog", "pagerduty", "opsgenie":
+		return true
+	}
+	hook, ok := strings.CutPrefix(name, "webhook:")
+	return ok && slices.ContainsFunc(n.Webhooks, func(wh WebhookConfig) bool { return wh.Name == hook })
+}
+
+// validateMinSeverity checks an optional per-channel severity floor.
+func validateMinSeverity(field, sev string) error {
+	if sev == "" || slices.Contains(Severities, strings.ToLower(sev)) {
+		return nil
+	}
+	return fmt.Errorf("%s.min_severity must be one of %s (got %q)", field, strings.Join(Severities, ", "), sev)
+}
+
+// hostnameLabel matches a single DNS label of a hostname.
+var hostnameLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// validateBindAddress accepts IPv4/IPv6 literals (IPv6 with or without
+// brackets, optionally zoned) and hostnames that resolve. A port belongs in
+// api.port.
+func validateBindAddress(addr string) error {
+	host := bindHost(addr)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	if strings.Contains(host, ":") {
+		return fmt.Errorf("api.bind_address %q is not a valid IP address (set the port via api.port)", addr)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if !hostnameLabel.MatchString(label) {
+			return fmt.Errorf("api.bind_address %q is not a valid IP address or hostname", addr)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return fmt.Errorf("api.bind_address %q does not resolve: %w", addr, err)
+	}
+	return nil
 }
 
 func validate(cfg Config) error {
@@ -239,6 +725,226 @@ func validate(cfg Config) error {
 	if cfg.API.BindAddress == "" {
 		return errors.New("api.bind_address must be set")
 	}
+	if err := validateBindAddress(cfg.API.BindAddress); err != nil {
+		return err
+	}
+	switch cfg.Storage.DiskIDStrategy {
+	case "", "by-id", "wwn", "serial-hash":
+	default:
+		return fmt.Errorf("storage.disk_id_strategy must be by-id, wwn or serial-hash (got %q)", cfg.Storage.DiskIDStrategy)
+	}
+	switch cfg.Alerts.SmartUnsupported {
+	case "", "info", "warning", "ignore":
+	default:
+		return fmt.Errorf("alerts.smart_unsupported must be info, warning or ignore (got %q)", cfg.Alerts.SmartUnsupported)
+	}
+	if u := cfg.Alerts.NamespaceUtilization; u < 0 || u > 100 {
+		return fmt.Errorf("alerts.namespace_utilization_warning must be between 0 and 100 (got %g)", u)
+	}
+	if cfg.Alerts.StartupGrace < 0 {
+		return errors.New("alerts.startup_grace must not be negative")
+	}
+	if cfg.Alerts.MaxReadingAge < 0 {
+		return errors.New("alerts.max_reading_age must not be negative")
+	}
+	if cfg.Alerts.MaxScrubDuration < 0 {
+		return errors.New("alerts.max_scrub_duration must not be negative")
+	}
+	if cfg.Alerts.LogFileMaxMB < 0 {
+		return fmt.Errorf("alerts.log_file_max_mb must not be negative (got %d)", cfg.Alerts.LogFileMaxMB)
+	}
+	if err := validateHTTPClient("cloud.http", cfg.Cloud.HTTP); err != nil {
+		return err
+	}
+	if err := validateHTTPClient("notifications.http", cfg.Notifications.HTTP); err != nil {
+		return err
+	}
+	if cfg.Cloud.MaxClockSkew < 0 {
+		return errors.New("cloud.max_clock_skew must not be negative")
+	}
+	if cfg.Cloud.UploadBatchSize < 0 {
+		return fmt.Errorf("cloud.upload_batch_size must not be negative (got %d)", cfg.Cloud.UploadBatchSize)
+	}
+	for i, r := range cfg.Scheduling.PollPriority.Rules {
+		if r.Match == "" {
+			return fmt.Errorf("scheduling.poll_priority.rules[%d].match must not be empty", i)
+		}
+		if _, err := filepath.Match(r.Match, ""); err != nil {
+			return fmt.Errorf("scheduling.poll_priority.rules[%d].match %q: %w", i, r.Match, err)
+		}
+	}
+	for i, o := range cfg.Alerts.DiskOverrides {
+		if o.Match == "" {
+			return fmt.Errorf("alerts.disk_overrides[%d].match must not be empty", i)
+		}
+		if _, err := filepath.Match(o.Match, ""); err != nil {
+			return fmt.Errorf("alerts.disk_overrides[%d].match %q: %w", i, o.Match, err)
+		}
+	}
+	for i, r := range cfg.Alerts.Rules {
+		if !slices.Contains(RuleMetrics, r.Metric) {
+			return fmt.Errorf("alerts.rules[%d].metric: unknown metric %q (known: %s)", i, r.Metric, strings.Join(RuleMetrics, ", "))
+		}
+		if !slices.Contains(RuleOps, r.Op) {
+			return fmt.Errorf("alerts.rules[%d].op must be one of %s (got %q)", i, strings.Join(RuleOps, " "), r.Op)
+		}
+		if !slices.Contains(Severities, r.Severity) {
+			return fmt.Errorf("alerts.rules[%d].severity must be one of %s (got %q)", i, strings.Join(Severities, ", "), r.Severity)
+		}
+	}
+	if cfg.Alerts.MinDedupRatio < 0 {
+		return fmt.Errorf("alerts.min_dedup_ratio must not be negative (got %g)", cfg.Alerts.MinDedupRatio)
+	}
+	for name, pct := range map[string]float64{
+		"alerts.pool_capacity_warning":  cfg.Alerts.PoolCapacityWarning,
+		"alerts.pool_capacity_critical": cfg.Alerts.PoolCapacityCritical,
+	} {
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("%s must be between 0 and 100 (got %g)", name, pct)
+		}
+	}
+	if w, c := cfg.Alerts.PoolCapacityWarning, cfg.Alerts.PoolCapacityCritical; w > 0 && c > 0 && w >= c {
+		return fmt.Errorf("alerts.pool_capacity_warning (%g) must be below alerts.pool_capacity_critical (%g)", w, c)
+	}
+	if sev := cfg.Alerts.MinSeverity; sev != "" && !slices.Contains(Severities, strings.ToLower(sev)) {
+		return fmt.Errorf("alerts.min_severity must be one of %s (got %q)", strings.Join(Severities, ", "), sev)
+	}
+	if err := validateMinSeverity("notifications.email", cfg.Notifications.Email.MinSeverity); err != nil {
+		return err
+	}
+	if err := validateMinSeverity("notifications.syslog", cfg.Notifications.Syslog.MinSeverity); err != nil {
+		return err
+	}
+	if pd := cfg.Notifications.PagerDuty; pd.Enabled && pd.RoutingKey == "" {
+		return errors.New("notifications.pagerduty.routing_key must be set when pagerduty is enabled")
+	}
+	if err := validateMinSeverity("notifications.pagerduty", cfg.Notifications.PagerDuty.MinSeverity); err != nil {
+		return err
+	}
+	if og := cfg.Notifications.OpsGenie; og.Enabled && og.APIKey == "" {
+		return errors.New("notifications.opsgenie.api_key must be set when opsgenie is enabled")
+	}
+	if err := validateMinSeverity("notifications.opsgenie", cfg.Notifications.OpsGenie.MinSeverity); err != nil {
+		return err
+	}
+	for _, wh := range cfg.Notifications.Webhooks {
+		switch strings.ToUpper(wh.Method) {
+		case "", http.MethodPost, http.MethodPut:
+		default:
+			return fmt.Errorf("notifications.webhooks[%s].method must be POST or PUT (got %q)", wh.Name, wh.Method)
+		}
+		if err := validateMinSeverity("notifications.webhooks["+wh.Name+"]", wh.MinSeverity); err != nil {
+			return err
+		}
+	}
+	switch strings.ToUpper(cfg.Notifications.TransitionWebhook.Method) {
+	case "", http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("notifications.transition_webhook.method must be POST or PUT (got %q)", cfg.Notifications.TransitionWebhook.Method)
+	}
+	for _, c := range cfg.Cloud.AllowedCommands {
+		if !slices.Contains(RemoteCommands, c) {
+			return fmt.Errorf("cloud.allowed_commands: unknown command %q (known: %s)", c, strings.Join(RemoteCommands, ", "))
+		}
+	}
+	if qh := cfg.Notifications.QuietHours; qh.Enabled {
+		start, err1 := time.Parse("15:04", qh.Start)
+		end, err2 := time.Parse("15:04", qh.End)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("notifications.quiet_hours start and end must be HH:MM (got %q, %q)", qh.Start, qh.End)
+		}
+		if start.Equal(end) {
+			return errors.New("notifications.quiet_hours start and end must differ")
+		}
+		if _, err := time.LoadLocation(qh.Timezone); err != nil {
+			return fmt.Errorf("notifications.quiet_hours.timezone: %w", err)
+		}
+		for _, sev := range qh.Severities {
+			if sev != "info" && sev != "warning" {
+				return fmt.Errorf("notifications.quiet_hours.severities may only list info and warning (got %q)", sev)
+			}
+		}
+	}
+	if sl := cfg.Notifications.Syslog; sl.Enabled {
+		if sl.Network != "udp" && sl.Network != "tcp" {
+			return fmt.Errorf("notifications.syslog.network must be udp or tcp (got %q)", sl.Network)
+		}
+		if sl.Format != "rfc5424" && sl.Format != "cef" {
+			return fmt.Errorf("notifications.syslog.format must be rfc5424 or cef (got %q)", sl.Format)
+		}
+		if _, ok := SyslogFacilities[sl.Facility]; !ok {
+			return fmt.Errorf("notifications.syslog.facility %q is not a valid syslog facility", sl.Facility)
+		}
+		if _, _, err := net.SplitHostPort(sl.Address); err != nil {
+			return fmt.Errorf("notifications.syslog.address: %w", err)
+		}
+	}
+	for _, step := range cfg.Notifications.RetrySchedule {
+		d, err := time.ParseDuration(step)
+		if err != nil {
+			return fmt.Errorf("notifications.retry_schedule: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("notifications.retry_schedule entries must be positive (got %q)", step)
+		}
+	}
+	for sourceType, channels := range cfg.Notifications.Routes {
+		if !slices.Contains(AlertSourceTypes, sourceType) {
+			return fmt.Errorf("notifications.routes: unknown source type %q (known: %s)", sourceType, strings.Join(AlertSourceTypes, ", "))
+		}
+		for _, ch := range channels {
+			if !knownChannel(cfg.Notifications, ch) {
+				return fmt.Errorf("notifications.routes.%s: unknown channel %q (use email, syslog, pagerduty, opsgenie or webhook:<name>)", sourceType, ch)
+			}
+		}
+	}
+	if cfg.Notifications.BatchWindow < 0 {
+		return errors.New("notifications.batch_window must not be negative")
+	}
+	if cfg.Notifications.QueueBatchSize < 0 || cfg.Notifications.QueueConcurrency < 0 {
+		return errors.New("notifications.queue_batch_size and queue_concurrency must not be negative")
+	}
+	switch cfg.Notifications.Redaction.Serials {
+	case "", "hash", "truncate":
+	default:
+		return fmt.Errorf("notifications.redaction.serials must be one of hash, truncate (got %q)", cfg.Notifications.Redaction.Serials)
+	}
+	switch cfg.API.DisplayUnits {
+	case "", "celsius", "fahrenheit":
+	default:
+		return fmt.Errorf("api.display_units must be celsius or fahrenheit (got %q)", cfg.API.DisplayUnits)
+	}
+	if cfg.API.HandlerTimeout < 0 {
+		return errors.New("api.handler_timeout must not be negative")
+	}
+	if a := cfg.Scheduling.Adaptive; a.Enabled {
+		if a.HealthyCycles < 1 {
+			return errors.New("scheduling.adaptive.healthy_cycles must be at least 1")
+		}
+		if a.Factor < 1 || a.MaxFactor < 1 {
+			return errors.New("scheduling.adaptive.factor and max_factor must be at least 1")
+		}
+	}
+	for pool, sched := range cfg.Scheduling.PoolScrubSchedules {
+		if len(strings.Fields(sched)) != 5 && !scheduleIntervalRe.MatchString(sched) {
+			return fmt.Errorf("scheduling.pool_scrub_schedules[%s] must be an interval like 7d or 168h, or a 5-field cron expression (got %q)", pool, sched)
+		}
+	}
+	if cfg.Scheduling.BreakerThreshold < 0 || cfg.Scheduling.BreakerCooldown < 0 {
+		return errors.New("scheduling.breaker_threshold and breaker_cooldown must not be negative")
+	}
+	if cfg.Scheduling.WALCheckpointInterval < 0 {
+		return errors.New("scheduling.wal_checkpoint_interval must not be negative")
+	}
+	if cfg.Scheduling.MaxConcurrentCommands < 0 {
+		return errors.New("scheduling.max_concurrent_commands must not be negative")
+	}
+	if cfg.Scheduling.SmartTestMaxPerRun < 0 || cfg.Scheduling.SmartTestStagger < 0 {
+		return errors.New("scheduling.smart_test_max_per_run and smart_test_stagger must not be negative")
+	}
+	if cfg.Scheduling.SnapshotMaxRows < 0 {
+		return errors.New("scheduling.snapshot_max_rows must not be negative")
+	}
 	return nil
 }
 
@@ -255,3 +961,25 @@ func parseInt(v string) (int, error) {
 	_, err := fmt.Sscanf(v, "%d", &n)
 	return n, err
 }
+
+func validateHTTPClient(field string, c HTTPClientConfig) error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("%s.timeout must not be negative", field)
+	}
+	if c.Proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Proxy)
+	if err != nil {
+		return fmt.Errorf("%s.proxy: %w", field, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("%s.proxy must be an http, https or socks5 URL (got %q)", field, c.Proxy)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s.proxy has no host (got %q)", field, c.Proxy)
+	}
+	return nil
+}
@@ -1,6 +1,11 @@
 package config
 
-import "testing"
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestDefaultLoad(t *testing.T) {
 	cfg, err := Load("")
@@ -14,3 +19,128 @@ func TestDefaultLoad(t *testing.T) {
 		t.Fatalf("db path empty")
 	}
 }
+
+func TestValidateBindAddress(t *testing.T) {
+	for _, tc := range []struct {
+		addr     string
+		wantErr  bool
+		wantAddr string
+	}{
+		{"127.0.0.1", false, "127.0.0.1:8200"},
+		{"0.0.0.0", false, "0.0.0.0:8200"},
+		{"::1", false, "[::1]:8200"},
+		{"[::]", false, "[::]:8200"},
+		{"fe80::1%eth0", false, "[fe80::1%eth0]:8200"},
+		{"localhost", false, "localhost:8200"},
+		{"127.0.0.1:8200", true, ""},
+		{"::1:::zz", true, ""},
+		{"not a host", true, ""},
+		{"bad_host!", true, ""},
+	} {
+		cfg := defaultConfig()
+		cfg.API.BindAddress = tc.addr
+		err := validate(cfg)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("%q: expected validation error", tc.addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.addr, err)
+		}
+		if got := cfg.API.Addr(); got != tc.wantAddr {
+			t.Fatalf("%q: expected addr %s, got %s", tc.addr, tc.wantAddr, got)
+		}
+	}
+}
+
+func TestTemperatureThresholdsFahrenheit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `alerts:
+  temperature_thresholds:
+    units: fahrenheit
+    hdd_warning: 131
+    nvme_critical: 185
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	th := cfg.Alerts.TemperatureThresholds
+	if math.Abs(th.HDDWarning-55) > 1e-9 || math.Abs(th.NvmeCritical-85) > 1e-9 {
+		t.Fatalf("expected Fahrenheit thresholds converted to Celsius, got %+v", th)
+	}
+	// Unset thresholds keep their Celsius defaults rather than being converted.
+	if th.HDDCritical != 70 || th.NvmeWarning != 70 {
+		t.Fatalf("expected defaults for unset thresholds, got %+v", th)
+	}
+
+	if err := os.WriteFile(path, []byte("alerts:\n  temperature_thresholds:\n    units: kelvin\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected unknown units to be rejected")
+	}
+}
+
+func TestDiskOverrideThresholds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `alerts:
+  disk_overrides:
+    - match: "SAMSUNG MZQL2*"
+      nvme_warning: 78
+    - match: "nvme0n1"
+      units: fahrenheit
+      nvme_warning: 140
+      nvme_critical: 203
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// The first override setting a threshold wins; unset ones fall through to
+	// later overrides and then the global thresholds.
+	th := cfg.Alerts.ThresholdsFor("/dev/disk/by-id/nvme-X", "/dev/nvme0n1", "SAMSUNG MZQL23T8HCLS-00A07")
+	if th.NvmeWarning != 78 || math.Abs(th.NvmeCritical-95) > 1e-9 || th.HDDWarning != 55 {
+		t.Fatalf("unexpected merged thresholds %+v", th)
+	}
+	if th := cfg.Alerts.ThresholdsFor("/dev/disk/by-id/nvme-Y", "/dev/nvme1n1", "WD_BLACK SN850X"); th != cfg.Alerts.TemperatureThresholds {
+		t.Fatalf("expected global thresholds for an unmatched disk, got %+v", th)
+	}
+
+	if err := os.WriteFile(path, []byte("alerts:\n  disk_overrides:\n    - match: \"[\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected a malformed glob to be rejected")
+	}
+}
+
+func TestAlertRulesValidated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	for _, tc := range []struct {
+		rule    string
+		wantErr bool
+	}{
+		{`{metric: reallocated, op: ">", value: 50, severity: critical, subject: "Worn disk"}`, false},
+		{`{metric: reallocated_sectors, op: ">", value: 50, severity: critical}`, true},
+		{`{metric: reallocated, op: "=>", value: 50, severity: critical}`, true},
+		{`{metric: reallocated, op: ">", value: 50, severity: severe}`, true},
+	} {
+		if err := os.WriteFile(path, []byte("alerts:\n  rules:\n    - "+tc.rule+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: got error %v, want error %v", tc.rule, err, tc.wantErr)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package discovery
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,10 +12,12 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/config"
 	"github.com/metabinary-ltd/storagesentinel/internal/debug"
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
 
 type Service struct {
@@ -21,6 +25,9 @@ type Service struct {
 	logger    *slog.Logger
 	cfg       config.StorageConfig
 	zpoolPath string
+	onAlerts  func(context.Context, []types.Alert)
+	present   map[string]bool // disk IDs seen in the previous pass
+	dupSerial map[string]bool // serial+device sets already reported as duplicates
 }
 
 func New(store *storage.Store, logger *slog.Logger) *Service {
@@ -41,9 +48,43 @@ func NewWithConfig(store *storage.Store, cfg config.StorageConfig, zpoolPath str
 	}
 }
 
+// sizeChange compares a discovered disk's size with the stored one. A resized
+// virtual disk is informational; for a pool member it's a warning, since a
+// device that shrinks under a pool (or a different device now answering to
+// the same ID) can cost the pool its vdev.
+func (s *Service) sizeChange(ctx context.Context, d storage.Disk, now int64) (types.Alert, bool) {
+	prev, err := s.store.GetDisk(ctx, d.ID)
+	if err != nil || prev == nil || prev.SizeBytes == 0 || d.SizeBytes == 0 || prev.SizeBytes == d.SizeBytes {
+		return types.Alert{}, false
+	}
+	severity := "info"
+	if pools, _ := s.store.GetDiskPoolMembership(ctx, d.ID); len(pools) > 0 {
+		severity = "warning"
+	}
+	change := "grew"
+	if d.SizeBytes < prev.SizeBytes {
+		change = "shrank"
+	}
+	return types.Alert{
+		Timestamp:  now,
+		Severity:   severity,
+		SourceType: "disk",
+		SourceID:   d.ID,
+		Subject:    "Drive size changed",
+		Message: fmt.Sprintf("%s %s from %d to %d bytes (%+d)",
+			d.Name, change, prev.SizeBytes, d.SizeBytes, d.SizeBytes-prev.SizeBytes),
+	}, true
+}
+
+// SetAlertHandler registers a callback that receives alerts raised during
+// discovery (e.g. drives appearing or disappearing), typically Notifier.Send.
+func (s *Service) SetAlertHandler(fn func(context.Context, []types.Alert)) {
+	s.onAlerts = fn
+}
+
 // RunOnce performs a single discovery pass.
 func (s *Service) RunOnce(ctx context.Context) error {
-	disks, err := scanSysBlock()
+	disks, err := scanSysBlock(s.cfg.IncludePartitions, s.cfg.DiskIDStrategy)
 	if err != nil {
 		return err
 	}
@@ -51,11 +92,7 @@ func (s *Service) RunOnce(ctx context.Context) error {
 	// Apply device filtering
 	disks = s.filterDevices(disks)
 
-	for _, d := range disks {
-		if err := s.store.UpsertDisk(ctx, d); err != nil {
-			s.logger.Warn("failed to upsert disk", "disk", d.ID, "error", err)
-		}
-	}
+	s.applyDisks(ctx, disks)
 
 	// Discover ZFS pools and their device mappings if enabled
 	if s.cfg.ZFSEnable {
@@ -67,8 +104,247 @@ func (s *Service) RunOnce(ctx context.Context) error {
 	return nil
 }
 
-func scanSysBlock() ([]storage.Disk, error) {
-	entries, err := os.ReadDir("/sys/block")
+// applyDisks upserts the discovered disks and raises presence-change alerts
+// against the set of disks seen in the previous pass, plus size-change alerts
+// for known disks whose capacity differs from the stored one.
+func (s *Service) applyDisks(ctx context.Context, disks []storage.Disk) []types.Alert {
+	previous := s.present
+	if previous == nil {
+		previous = s.loadPresent(ctx)
+	}
+
+	s.migrateIDs(ctx, disks, previous)
+
+	current := make(map[string]bool, len(disks))
+	var alerts []types.Alert
+	now := time.Now().Unix()
+	for _, d := range disks {
+		if a, ok := s.sizeChange(ctx, d, now); ok {
+			alerts = append(alerts, a)
+		}
+		if err := s.store.UpsertDisk(ctx, d); err != nil {
+			s.logger.Warn("failed to upsert disk", "disk", d.ID, "error", err)
+		}
+		current[d.ID] = true
+		// Skip "added" alerts for the initial inventory on a fresh install
+		if len(previous) > 0 && !previous[d.ID] {
+			alerts = append(alerts, types.Alert{
+				Timestamp:  now,
+				Severity:   "info",
+				SourceType: "disk",
+				SourceID:   d.ID,
+				Subject:    "Drive added",
+				Message:    fmt.Sprintf("New drive detected: %s (%s %s)", d.Name, d.Model, d.Serial),
+			})
+		}
+	}
+	for id := range previous {
+		if current[id] {
+			continue
+		}
+		alerts = append(alerts, types.Alert{
+			Timestamp:  now,
+			Severity:   "warning",
+			SourceType: "disk",
+			SourceID:   id,
+			Subject:    "Drive removed",
+			Message:    fmt.Sprintf("Previously seen drive %s is no longer present", id),
+		})
+	}
+	s.present = current
+	alerts = append(alerts, s.duplicateSerialAlerts(disks, now)...)
+
+	for _, a := range alerts {
+		s.logger.Info("disk inventory changed", "disk", a.SourceID, "change", a.Subject)
+		if _, err := s.store.AddAlert(ctx, storage.Alert{
+			Severity:   a.Severity,
+			SourceType: a.SourceType,
+			SourceID:   a.SourceID,
+			Subject:    a.Subject,
+			Message:    a.Message,
+			Timestamp:  a.Timestamp,
+		}); err != nil {
+			s.logger.Warn("failed to store discovery alert", "disk", a.SourceID, "error", err)
+		}
+	}
+	if len(alerts) > 0 && s.onAlerts != nil {
+		s.onAlerts(ctx, alerts)
+	}
+	return alerts
+}
+
+// duplicateSerialAlerts warns when distinct whole disks report the same
+// serial. Counterfeit and cloned drives often share one, and it breaks the
+// assumption that a serial (and IDs derived from it) names a single drive.
+// Paths to one multipathed drive share a device-mapper holder and are not
+// duplicates. Each set of devices is reported once.
+func (s *Service) duplicateSerialAlerts(disks []storage.Disk, now int64) []types.Alert {
+	bySerial := make(map[string][]storage.Disk)
+	var serials []string
+	for _, d := range disks {
+		name := strings.TrimPrefix(d.Name, "/dev/")
+		dir := filepath.Join(sysBlockDir, name)
+		if d.Serial == "" {
+			continue
+		}
+		if _, err := os.Stat(dir); err != nil || !isWholeDisk(name, dir) {
+			continue // partitions carry their disk's serial
+		}
+		if len(bySerial[d.Serial]) == 0 {
+			serials = append(serials, d.Serial)
+		}
+		bySerial[d.Serial] = append(bySerial[d.Serial], d)
+	}
+
+	reported := make(map[string]bool)
+	var alerts []types.Alert
+	for _, serial := range serials {
+		group := bySerial[serial]
+		if len(group) < 2 || sameMultipathDevice(group) {
+			continue
+		}
+		names := make([]string, len(group))
+		for i, d := range group {
+			names[i] = d.Name
+		}
+		key := serial + "\x00" + strings.Join(names, ",")
+		reported[key] = true
+		if s.dupSerial[key] {
+			continue
+		}
+		s.logger.Warn("devices report the same serial", "serial", serial, "devices", names)
+		for _, d := range group {
+			alerts = append(alerts, types.Alert{
+				Timestamp:  now,
+				Severity:   "warning",
+				SourceType: "disk",
+				SourceID:   d.ID,
+				Subject:    "Duplicate serial",
+				Message: fmt.Sprintf("Serial %s is reported by %s (%s); the drives may be counterfeit or cloned, and their identities can't be told apart",
+					serial, strings.Join(names, ", "), d.Model),
+			})
+		}
+	}
+	s.dupSerial = reported
+	return alerts
+}
+
+// sameMultipathDevice reports whether every disk in group is held by the same
+// device-mapper device, i.e. they are paths to one multipathed drive.
+func sameMultipathDevice(group []storage.Disk) bool {
+	common := ""
+	for _, d := range group {
+		holders, err := os.ReadDir(filepath.Join(sysBlockDir, strings.TrimPrefix(d.Name, "/dev/"), "holders"))
+		if err != nil {
+			return false
+		}
+		holder := ""
+		for _, h := range holders {
+			if strings.HasPrefix(h.Name(), "dm-") {
+				holder = h.Name()
+				break
+			}
+		}
+		if holder == "" || (common != "" && holder != common) {
+			return false
+		}
+		common = holder
+	}
+	return true
+}
+
+// migrateIDs carries history over when a disk turns up under a new ID, as
+// after a storage.disk_id_strategy change or a distro naming its by-id links
+// differently: a stored disk no longer discovered, with the same model and
+// serial, is renamed to the new ID instead of being reported as removed
+// while its replacement is reported as added.
+func (s *Service) migrateIDs(ctx context.Context, disks []storage.Disk, previous map[string]bool) {
+	known, err := s.store.ListDisks(ctx)
+	if err != nil {
+		return
+	}
+	discovered := make(map[string]bool, len(disks))
+	for _, d := range disks {
+		discovered[d.ID] = true
+	}
+	stored := make(map[string]bool, len(known))
+	for _, k := range known {
+		stored[k.ID] = true
+	}
+
+	for _, d := range disks {
+		if stored[d.ID] || d.Serial == "" {
+			continue
+		}
+		var match *storage.Disk
+		for i, k := range known {
+			if discovered[k.ID] || !stored[k.ID] || k.Serial != d.Serial || k.Model != d.Model || k.Type != d.Type {
+				continue
+			}
+			// Partitions share their disk's serial; prefer the same device.
+			if match == nil || k.Name == d.Name {
+				match = &known[i]
+			}
+		}
+		if match == nil {
+			continue
+		}
+		if err := s.store.RenameDisk(ctx, match.ID, d.ID); err != nil {
+			s.logger.Warn("failed to migrate disk ID", "from", match.ID, "to", d.ID, "error", err)
+			continue
+		}
+		s.logger.Info("disk ID migrated", "disk", d.Name, "from", match.ID, "to", d.ID)
+		stored[match.ID] = false
+		stored[d.ID] = true
+		if previous[match.ID] {
+			delete(previous, match.ID)
+			previous[d.ID] = true
+		}
+	}
+}
+
+// loadPresent reconstructs the previous pass from the store after a restart:
+// disks whose last_seen matches the most recent pass are considered present.
+func (s *Service) loadPresent(ctx context.Context) map[string]bool {
+	known, err := s.store.ListDisks(ctx)
+	if err != nil {
+		return make(map[string]bool)
+	}
+	return Present(known)
+}
+
+// Present returns the IDs of the disks seen by the latest discovery pass,
+// judged by their last_seen times.
+func Present(known []storage.Disk) map[string]bool {
+	present := make(map[string]bool)
+	var latest int64
+	for _, d := range known {
+		if d.LastSeen > latest {
+			latest = d.LastSeen
+		}
+	}
+	for _, d := range known {
+		if latest-d.LastSeen <= presenceSlackSeconds {
+			present[d.ID] = true
+		}
+	}
+	return present
+}
+
+// presenceSlackSeconds allows for a discovery pass spanning several seconds.
+const presenceSlackSeconds = 60
+
+// sysBlockDir lists the kernel's block devices; a variable so tests can point
+// discovery at a fake tree.
+var sysBlockDir = "/sys/block"
+
+// scanSysBlock lists whole disks. md arrays, eMMC partitions and any other
+// partition entries are skipped unless includePartitions is set, in which
+// case they are returned too, along with each disk's partitions. Whole disks
+// are keyed per idStrategy (storage.disk_id_strategy); partitions always by
+// their by-id path.
+func scanSysBlock(includePartitions bool, idStrategy string) ([]storage.Disk, error) {
+	entries, err := os.ReadDir(sysBlockDir)
 	if err != nil {
 		return nil, err
 	}
@@ -80,31 +356,179 @@ func scanSysBlock() ([]storage.Disk, error) {
 		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "dm-") {
 			continue
 		}
+		dir := filepath.Join(sysBlockDir, name)
+		if !includePartitions && !isWholeDisk(name, dir) {
+			continue
+		}
 
-		rotationalPath := filepath.Join("/sys/block", name, "queue/rotational")
+		rotationalPath := filepath.Join(dir, "queue/rotational")
 		rotational, _ := os.ReadFile(rotationalPath)
 		devType := classifyDevice(name, string(rotational))
 
-		model := readTrim(filepath.Join("/sys/block", name, "device/model"))
-		serial := readTrim(filepath.Join("/sys/block", name, "device/serial"))
-		firmware := readTrim(filepath.Join("/sys/block", name, "device/rev"))
-		sizeBytes := readSizeBytes(filepath.Join("/sys/block", name, "size"))
-		idPath := byIDPath(name)
+		model := readTrim(filepath.Join(dir, "device/model"))
+		serial := readTrim(filepath.Join(dir, "device/serial"))
+		firmware := readTrim(filepath.Join(dir, "device/rev"))
+		sizeBytes := readSizeBytes(filepath.Join(dir, "size"))
 		disks = append(disks, storage.Disk{
-			ID:        idPath,
+			ID:        diskID(idStrategy, name, dir, model, serial),
 			Name:      "/dev/" + name,
 			Type:      devType,
 			Model:     model,
 			Serial:    serial,
-			Firmware:   firmware,
+			Firmware:  firmware,
 			SizeBytes: sizeBytes,
 		})
+
+		if includePartitions {
+			for _, part := range partitionsOf(dir) {
+				disks = append(disks, storage.Disk{
+					ID:        byIDPath(part),
+					Name:      "/dev/" + part,
+					Type:      devType,
+					Model:     model,
+					Serial:    serial,
+					Firmware:  firmware,
+					SizeBytes: readSizeBytes(filepath.Join(dir, part, "size")),
+				})
+			}
+		}
 	}
 	return disks, nil
 }
 
+// mmcNonDisk matches eMMC partitions and hardware boot/RPMB areas, which
+// appear in /sys/block alongside the mmcblkN device itself.
+var mmcNonDisk = regexp.MustCompile(`^mmcblk\d+(p\d+|boot\d+|rpmb)$`)
+
+// isWholeDisk reports whether a /sys/block entry is a physical disk rather
+// than an md array or a partition.
+func isWholeDisk(name, dir string) bool {
+	if strings.HasPrefix(name, "md") || mmcNonDisk.MatchString(name) {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+		return false
+	}
+	return true
+}
+
+// partitionsOf returns the partition names under a /sys/block/<disk> dir,
+// identified by their "partition" attribute file.
+func partitionsOf(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var parts []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(dir, e.Name(), "partition")); err == nil {
+			parts = append(parts, e.Name())
+		}
+	}
+	return parts
+}
+
+// procMounts is read to find the root filesystem's device; a variable so
+// tests can substitute a fixture.
+var procMounts = "/proc/mounts"
+
+// RootDisk returns the whole disk holding the root filesystem (e.g.
+// "/dev/nvme0n1"), or "" when / isn't backed by a local block device (ZFS
+// root, overlay, NFS...). Partitions are mapped to their parent disk and
+// device-mapper volumes (LVM, LUKS) to the first disk underneath them.
+//
+// It is a variable so tests in the packages that exclude or label the root
+// disk can stub it.
+var RootDisk = rootDisk
+
+func rootDisk() string {
+	b, err := os.ReadFile(procMounts)
+	if err != nil {
+		return ""
+	}
+	var source string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == "/" {
+			source = fields[0] // the last entry for / wins, as with stacked mounts
+		}
+	}
+	if !strings.HasPrefix(source, "/dev/") {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(source); err == nil {
+		source = resolved
+	}
+	return parentDisk(filepath.Base(source), 0)
+}
+
+// parentDisk maps a block device name to the /sys/block disk that holds it.
+func parentDisk(name string, depth int) string {
+	if depth > 4 {
+		return ""
+	}
+	if strings.HasPrefix(name, "dm-") {
+		slaves, err := os.ReadDir(filepath.Join(sysBlockDir, name, "slaves"))
+		if err != nil || len(slaves) == 0 {
+			return ""
+		}
+		return parentDisk(slaves[0].Name(), depth+1)
+	}
+	if _, err := os.Stat(filepath.Join(sysBlockDir, name)); err == nil {
+		return "/dev/" + name
+	}
+	entries, err := os.ReadDir(sysBlockDir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(sysBlockDir, e.Name(), name, "partition")); err == nil {
+			return "/dev/" + e.Name()
+		}
+	}
+	return ""
+}
+
+// byIDDir holds the udev by-id links; a variable so tests can substitute a
+// fake directory.
+var byIDDir = "/dev/disk/by-id"
+
+// diskID computes a whole disk's ID under a storage.disk_id_strategy:
+//   - by-id (default): the /dev/disk/by-id link, whose naming varies by distro
+//   - wwn: "wwn-" plus the WWN/EUI the kernel reports in sysfs
+//   - serial-hash: "sha256-" plus the hex SHA-256 of model+serial, portable
+//     across hosts and distros
+//
+// wwn and serial-hash fall back to by-id for disks that report no WWN or
+// serial (virtual disks, some USB bridges).
+func diskID(strategy, name, dir, model, serial string) string {
+	switch strategy {
+	case "wwn":
+		if wwid := readWWID(dir); wwid != "" {
+			return "wwn-" + wwid
+		}
+	case "serial-hash":
+		if serial != "" {
+			sum := sha256.Sum256([]byte(model + serial))
+			return "sha256-" + hex.EncodeToString(sum[:])
+		}
+	}
+	return byIDPath(name)
+}
+
+// readWWID reads the world-wide identifier from sysfs: NVMe namespaces carry
+// it as "wwid", SCSI/SATA disks as "device/wwid". Padding in t10-style IDs is
+// collapsed so the result is usable in URLs.
+func readWWID(dir string) string {
+	for _, rel := range []string{"wwid", "device/wwid"} {
+		if v := readTrim(filepath.Join(dir, rel)); v != "" {
+			return strings.Join(strings.Fields(v), "_")
+		}
+	}
+	return ""
+}
+
 func byIDPath(name string) string {
-	byIDDir := "/dev/disk/by-id"
 	entries, err := os.ReadDir(byIDDir)
 	if err != nil {
 		return "/dev/" + name
@@ -247,29 +671,171 @@ func (s *Service) mapPoolDevices(ctx context.Context, poolName string) error {
 		return err
 	}
 
-	statusOutput := string(out)
-	deviceIDs := extractDevicesFromStatus(statusOutput)
-
-	// Determine vdev type (simplified - could be enhanced)
-	vdevType := "data" // Default
-	if strings.Contains(strings.ToLower(statusOutput), "cache") {
-		vdevType = "cache"
-	} else if strings.Contains(strings.ToLower(statusOutput), "log") {
-		vdevType = "log"
-	} else if strings.Contains(strings.ToLower(statusOutput), "spare") {
-		vdevType = "spare"
+	layout := parsePoolLayout(string(out))
+	if len(layout) == 0 {
+		// Unrecognised layout: fall back to any device names in the output
+		for _, path := range extractDevicesFromStatus(string(out)) {
+			layout = append(layout, poolLayoutDevice{path: path, role: "data"})
+		}
+	}
+	paths := make([]string, len(layout))
+	for i, dev := range layout {
+		paths[i] = dev.path
 	}
+	deviceIDs := s.toDiskIDs(ctx, paths)
 
-	if len(deviceIDs) > 0 {
-		if err := s.store.UpsertPoolDevices(ctx, poolName, deviceIDs, vdevType); err != nil {
+	devices := make([]storage.PoolDevice, len(layout))
+	for i, dev := range layout {
+		devices[i] = storage.PoolDevice{DiskID: deviceIDs[i], Role: dev.role, VdevType: dev.vdevType}
+	}
+	if len(devices) > 0 {
+		if err := s.store.SetPoolDevices(ctx, poolName, devices); err != nil {
 			return err
 		}
-		s.logger.Debug("mapped pool devices", "pool", poolName, "devices", len(deviceIDs))
+		s.logger.Debug("mapped pool devices", "pool", poolName, "devices", len(devices))
 	}
 
 	return nil
 }
 
+// poolLayoutDevice is a leaf device in `zpool status` config output: its
+// role in the pool and the type of the top-level vdev holding it.
+type poolLayoutDevice struct {
+	path     string
+	role     string // data, log, cache, spare, special or dedup
+	vdevType string // mirror, raidz1, draid2..., or "disk" for a single-device vdev
+}
+
+// poolSectionRoles maps the allocation class headings of `zpool status`
+// config output to device roles; everything before the first heading is
+// data.
+var poolSectionRoles = map[string]string{
+	"logs":    "log",
+	"cache":   "cache",
+	"spares":  "spare",
+	"special": "special",
+	"dedup":   "dedup",
+}
+
+// vdevGroupPattern matches vdev names such as mirror-0, raidz2-1,
+// draid1:4d:8c:1s-0, and the transient replacing-N / spare-N groups.
+var vdevGroupPattern = regexp.MustCompile(`^(mirror|raidz[123]?|draid[123]?(?::[0-9a-z]+)*|replacing|spare)-\d+$`)
+
+// parsePoolLayout walks the config section of `zpool status` and attributes
+// a role and vdev type to each device, e.g.
+//
+//	NAME          STATE     READ WRITE CKSUM
+//	tank          ONLINE       0     0     0
+//	  mirror-0    ONLINE       0     0     0
+//	    sda       ONLINE       0     0     0
+//	logs
+//	  nvme0n1     ONLINE       0     0     0
+//
+// Headings and the pool itself sit at the shallowest indent, top-level vdevs
+// one level in; a device there is a vdev of its own.
+func parsePoolLayout(statusOutput string) []poolLayoutDevice {
+	var devices []poolLayoutDevice
+	inConfig := false
+	rootIndent, vdevIndent := -1, -1
+	role, vdevType := "data", ""
+	for _, line := range strings.Split(statusOutput, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "config:"):
+			inConfig = true
+			continue
+		case !inConfig:
+			continue
+		case strings.HasPrefix(trimmed, "errors:"):
+			return devices
+		case trimmed == "" || strings.HasPrefix(trimmed, "NAME"):
+			continue
+		}
+		name := strings.Fields(trimmed)[0]
+		indent := len(strings.TrimPrefix(line, "\t")) - len(strings.TrimLeft(strings.TrimPrefix(line, "\t"), " "))
+
+		if rootIndent < 0 {
+			rootIndent = indent // the pool name
+			continue
+		}
+		if indent <= rootIndent {
+			role, vdevType = poolSectionRoles[name], ""
+			if role == "" {
+				role = "data"
+			}
+			continue
+		}
+		if vdevIndent < 0 || indent < vdevIndent {
+			vdevIndent = indent
+		}
+		group := vdevGroupPattern.FindStringSubmatch(name)
+		if indent == vdevIndent {
+			vdevType = "disk"
+			if group != nil {
+				vdevType = strings.SplitN(group[1], ":", 2)[0]
+				if vdevType == "raidz" {
+					vdevType = "raidz1"
+				}
+				continue
+			}
+		} else if group != nil {
+			continue // replacing-N / spare-N inside a top-level vdev
+		}
+		if path := poolDevicePath(name); path != "" {
+			devices = append(devices, poolLayoutDevice{path: path, role: role, vdevType: vdevType})
+		}
+	}
+	return devices
+}
+
+// poolDevicePath turns a device name from `zpool status` into a device path:
+// absolute paths are kept, by-id names resolved under /dev/disk/by-id, and
+// kernel names (sda, nvme0n1) mapped to their by-id link where one exists.
+// Names that are none of these (partitions, missing devices shown by GUID)
+// yield "".
+func poolDevicePath(name string) string {
+	if strings.HasPrefix(name, "/dev/") {
+		return resolveByID(name)
+	}
+	if poolKernelName.MatchString(name) {
+		return resolveByID("/dev/" + name)
+	}
+	if _, err := os.Lstat(filepath.Join(byIDDir, name)); err == nil {
+		return filepath.Join(byIDDir, name)
+	}
+	return ""
+}
+
+var poolKernelName = regexp.MustCompile(`^(sd[a-z]+|nvme\d+n\d+)$`)
+
+// toDiskIDs maps pool device paths (by-id links or /dev nodes) to disk IDs
+// when storage.disk_id_strategy doesn't key disks by their by-id path.
+// Devices matching no known disk are kept as they are.
+func (s *Service) toDiskIDs(ctx context.Context, paths []string) []string {
+	switch s.cfg.DiskIDStrategy {
+	case "", "by-id":
+		return paths
+	}
+	known, err := s.store.ListDisks(ctx)
+	if err != nil {
+		return paths
+	}
+	byName := make(map[string]string, len(known))
+	for _, k := range known {
+		byName[k.Name] = k.ID
+	}
+	for i, p := range paths {
+		dev := p
+		if target, err := filepath.EvalSymlinks(p); err == nil {
+			dev = target
+		}
+		if id, ok := byName[dev]; ok {
+			paths[i] = id
+		}
+	}
+	return paths
+}
+
 func extractDevicesFromStatus(statusOutput string) []string {
 	var deviceIDs []string
 	seen := make(map[string]bool)
@@ -315,7 +881,6 @@ func resolveByID(devicePath string) string {
 	deviceName := strings.TrimPrefix(devicePath, "/dev/")
 
 	// Look up in /dev/disk/by-id
-	byIDDir := "/dev/disk/by-id"
 	entries, err := os.ReadDir(byIDDir)
 	if err != nil {
 		return devicePath
@@ -0,0 +1,430 @@
+package discovery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+func openTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestPresenceAlerts(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	svc := New(store, slog.Default())
+
+	var notified []types.Alert
+	svc.SetAlertHandler(func(_ context.Context, alerts []types.Alert) {
+		notified = append(notified, alerts...)
+	})
+
+	sda := storage.Disk{ID: "/dev/disk/by-id/ata-A", Name: "/dev/sda", Type: "hdd"}
+	sdb := storage.Disk{ID: "/dev/disk/by-id/ata-B", Name: "/dev/sdb", Type: "hdd"}
+	sdc := storage.Disk{ID: "/dev/disk/by-id/ata-C", Name: "/dev/sdc", Type: "hdd"}
+
+	if alerts := svc.applyDisks(ctx, []storage.Disk{sda, sdb}); len(alerts) != 0 {
+		t.Fatalf("expected no alerts for initial inventory, got %+v", alerts)
+	}
+
+	alerts := svc.applyDisks(ctx, []storage.Disk{sda, sdc})
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %+v", alerts)
+	}
+	bySource := map[string]types.Alert{}
+	for _, a := range alerts {
+		bySource[a.SourceID] = a
+	}
+	if a := bySource[sdc.ID]; a.Severity != "info" || a.Subject != "Drive added" {
+		t.Fatalf("expected info added alert for sdc, got %+v", a)
+	}
+	if a := bySource[sdb.ID]; a.Severity != "warning" || a.Subject != "Drive removed" {
+		t.Fatalf("expected warning removed alert for sdb, got %+v", a)
+	}
+	if len(notified) != 2 {
+		t.Fatalf("expected alerts to reach the handler, got %d", len(notified))
+	}
+
+	// A stable inventory raises nothing further.
+	if alerts := svc.applyDisks(ctx, []storage.Disk{sda, sdc}); len(alerts) != 0 {
+		t.Fatalf("expected no alerts for unchanged inventory, got %+v", alerts)
+	}
+
+	stored, err := store.RecentAlerts(ctx, 10)
+	if err != nil {
+		t.Fatalf("recent alerts: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("expected 2 stored alerts, got %d", len(stored))
+	}
+
+	disk, err := store.GetDisk(ctx, sda.ID)
+	if err != nil || disk == nil || disk.LastSeen == 0 {
+		t.Fatalf("expected last_seen to be populated, got %+v (err %v)", disk, err)
+	}
+}
+
+func TestSizeChangeAlerts(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	svc := New(store, slog.Default())
+
+	sda := storage.Disk{ID: "/dev/disk/by-id/ata-A", Name: "/dev/sda", Type: "hdd", SizeBytes: 4_000_000_000_000}
+	sdb := storage.Disk{ID: "/dev/disk/by-id/ata-B", Name: "/dev/sdb", Type: "hdd", SizeBytes: 4_000_000_000_000}
+	if alerts := svc.applyDisks(ctx, []storage.Disk{sda, sdb}); len(alerts) != 0 {
+		t.Fatalf("expected no alerts for initial inventory, got %+v", alerts)
+	}
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{sdb.ID}, "mirror"); err != nil {
+		t.Fatalf("upsert pool devices: %v", err)
+	}
+
+	sda.SizeBytes = 8_000_000_000_000
+	sdb.SizeBytes = 2_000_000_000_000
+	alerts := svc.applyDisks(ctx, []storage.Disk{sda, sdb})
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %+v", alerts)
+	}
+	bySource := map[string]types.Alert{}
+	for _, a := range alerts {
+		bySource[a.SourceID] = a
+	}
+	if a := bySource[sda.ID]; a.Severity != "info" || a.Subject != "Drive size changed" ||
+		!strings.Contains(a.Message, "from 4000000000000 to 8000000000000") {
+		t.Fatalf("expected info size alert for sda, got %+v", a)
+	}
+	if a := bySource[sdb.ID]; a.Severity != "warning" || !strings.Contains(a.Message, "shrank") {
+		t.Fatalf("expected warning shrink alert for pool member sdb, got %+v", a)
+	}
+
+	disk, err := store.GetDisk(ctx, sda.ID)
+	if err != nil || disk == nil || disk.SizeBytes != sda.SizeBytes {
+		t.Fatalf("expected new size stored, got %+v (err %v)", disk, err)
+	}
+	if alerts := svc.applyDisks(ctx, []storage.Disk{sda, sdb}); len(alerts) != 0 {
+		t.Fatalf("expected no alerts once sizes are stable, got %+v", alerts)
+	}
+}
+
+func TestScanSysBlockSkipsPartitionsAndMD(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("sda/queue/rotational", "1\n")
+	write("sda/size", "7814037168\n")
+	write("sda/sda1/partition", "1\n")
+	write("sda/sda1/size", "2048\n")
+	write("md0/size", "7814037168\n")
+	write("mmcblk0/queue/rotational", "0\n")
+	write("mmcblk0p1/partition", "1\n")
+	write("mmcblk0boot0/size", "8192\n")
+	write("sdb1/partition", "1\n") // a stray partition entry
+	write("loop0/size", "0\n")
+
+	prev := sysBlockDir
+	sysBlockDir = root
+	defer func() { sysBlockDir = prev }()
+
+	names := func(disks []storage.Disk) []string {
+		var res []string
+		for _, d := range disks {
+			res = append(res, d.Name)
+		}
+		return res
+	}
+
+	disks, err := scanSysBlock(false, "")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if got, want := names(disks), []string{"/dev/mmcblk0", "/dev/sda"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("whole disks = %v, want %v", got, want)
+	}
+
+	disks, err = scanSysBlock(true, "")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	want := []string{"/dev/md0", "/dev/mmcblk0", "/dev/mmcblk0boot0", "/dev/mmcblk0p1", "/dev/sda", "/dev/sda1", "/dev/sdb1"}
+	if got := names(disks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("with partitions = %v, want %v", got, want)
+	}
+	for _, d := range disks {
+		if d.Name == "/dev/sda1" && (d.Type != "hdd" || d.SizeBytes != 2048*512) {
+			t.Fatalf("partition should inherit type and read its own size, got %+v", d)
+		}
+	}
+}
+
+func TestDiskIDStrategies(t *testing.T) {
+	root := t.TempDir()
+	sys := filepath.Join(root, "sys")
+	byID := filepath.Join(root, "by-id")
+	for rel, content := range map[string]string{
+		"sda/device/wwid":  "naa.5000c500a1b2c3d4\n",
+		"nvme0n1/wwid":     "eui.0025388b91b0e5a1\n",
+		"vda/device/model": "QEMU HARDDISK\n",
+	} {
+		path := filepath.Join(sys, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(byID, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../sda", filepath.Join(byID, "ata-ST4000VN008_ZGY00000")); err != nil {
+		t.Fatal(err)
+	}
+	prev := byIDDir
+	byIDDir = byID
+	defer func() { byIDDir = prev }()
+
+	for _, tc := range []struct {
+		strategy, name, model, serial, want string
+	}{
+		{"", "sda", "ST4000VN008", "ZGY00000", filepath.Join(byID, "ata-ST4000VN008_ZGY00000")},
+		{"by-id", "sda", "ST4000VN008", "ZGY00000", filepath.Join(byID, "ata-ST4000VN008_ZGY00000")},
+		{"by-id", "sdb", "ST4000VN008", "ZGY00001", "/dev/sdb"},
+		{"wwn", "sda", "ST4000VN008", "ZGY00000", "wwn-naa.5000c500a1b2c3d4"},
+		{"wwn", "nvme0n1", "SAMSUNG MZVL21T0HCLR", "S675NX0T000000", "wwn-eui.0025388b91b0e5a1"},
+		{"wwn", "vda", "QEMU HARDDISK", "", "/dev/vda"}, // no WWN: by-id fallback
+		{"serial-hash", "sda", "ST4000VN008", "ZGY00000", "sha256-c003cd284c628aa21b2a54b1fe46d4033f33270023f560b3bfddc26347ab845f"},
+		{"serial-hash", "vda", "QEMU HARDDISK", "", "/dev/vda"}, // no serial: by-id fallback
+	} {
+		if got := diskID(tc.strategy, tc.name, filepath.Join(sys, tc.name), tc.model, tc.serial); got != tc.want {
+			t.Errorf("diskID(%q, %s) = %q, want %q", tc.strategy, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDiskIDMigrationKeepsHistory(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	svc := New(store, slog.Default())
+
+	old := storage.Disk{ID: "/dev/disk/by-id/ata-ST4000VN008_ZGY00000", Name: "/dev/sda", Type: "hdd", Model: "ST4000VN008", Serial: "ZGY00000"}
+	svc.applyDisks(ctx, []storage.Disk{old})
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: old.ID, HealthStatus: "PASSED", Timestamp: 1}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{old.ID}, "mirror"); err != nil {
+		t.Fatalf("upsert pool devices: %v", err)
+	}
+
+	// Same drive, now keyed by serial hash.
+	moved := old
+	moved.ID = "sha256-" + sha256Hex(old.Model+old.Serial)
+	if alerts := svc.applyDisks(ctx, []storage.Disk{moved}); len(alerts) != 0 {
+		t.Fatalf("expected no added/removed alerts for a migrated ID, got %+v", alerts)
+	}
+
+	disks, _ := store.ListDisks(ctx)
+	if len(disks) != 1 || disks[0].ID != moved.ID {
+		t.Fatalf("expected only the new ID to remain, got %+v", disks)
+	}
+	if hist, _ := store.SmartHistory(ctx, moved.ID, 10); len(hist) != 1 {
+		t.Fatalf("expected the snapshot history under the new ID, got %d rows", len(hist))
+	}
+	if pools, _ := store.GetDiskPoolMembership(ctx, moved.ID); len(pools) != 1 {
+		t.Fatalf("expected pool membership under the new ID, got %+v", pools)
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRootDisk(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"nvme0n1/nvme0n1p2", "sda/sda3", "dm-0/slaves/sda3"} {
+		if err := os.MkdirAll(filepath.Join(root, "block", dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, part := range []string{"nvme0n1/nvme0n1p2", "sda/sda3"} {
+		if err := os.WriteFile(filepath.Join(root, "block", part, "partition"), []byte("2\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevBlock, prevMounts := sysBlockDir, procMounts
+	sysBlockDir, procMounts = filepath.Join(root, "block"), filepath.Join(root, "mounts")
+	defer func() { sysBlockDir, procMounts = prevBlock, prevMounts }()
+
+	for _, tc := range []struct{ mounts, want string }{
+		{"/dev/nvme0n1p2 / ext4 rw,relatime 0 0\n/dev/nvme0n1p1 /boot/efi vfat rw 0 0\n", "/dev/nvme0n1"},
+		{"/dev/dm-0 / xfs rw 0 0\n", "/dev/sda"},
+		{"rpool/ROOT/debian / zfs rw,xattr,posixacl 0 0\n", ""},
+	} {
+		if err := os.WriteFile(procMounts, []byte(tc.mounts), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := RootDisk(); got != tc.want {
+			t.Errorf("RootDisk() with %q = %q, want %q", tc.mounts, got, tc.want)
+		}
+	}
+}
+
+const zpoolStatusWithLogAndCache = `  pool: tank
+ state: ONLINE
+  scan: scrub repaired 0B in 01:02:03 with 0 errors on Sun Mar  2 01:26:04 2025
+config:
+
+	NAME                        STATE     READ WRITE CKSUM
+	tank                        ONLINE       0     0     0
+	  raidz2-0                  ONLINE       0     0     0
+	    ata-ST4000VN008_ZGY0001 ONLINE       0     0     0
+	    sdb                     ONLINE       0     0     0
+	    sdc                     ONLINE       0     0     0
+	    sdd                     ONLINE       0     0     0
+	logs
+	  mirror-1                  ONLINE       0     0     0
+	    nvme0n1                 ONLINE       0     0     0
+	    nvme1n1                 ONLINE       0     0     0
+	cache
+	  nvme2n1                   ONLINE       0     0     0
+	spares
+	  sde                       AVAIL
+
+errors: No known data errors
+`
+
+func TestMapPoolDevicesRoles(t *testing.T) {
+	byID := t.TempDir()
+	if err := os.Symlink("../../sda", filepath.Join(byID, "ata-ST4000VN008_ZGY0001")); err != nil {
+		t.Fatal(err)
+	}
+	prev := byIDDir
+	byIDDir = byID
+	defer func() { byIDDir = prev }()
+
+	store := openTestStore(t)
+	ctx := context.Background()
+	ids := []string{filepath.Join(byID, "ata-ST4000VN008_ZGY0001"), "/dev/sdb", "/dev/sdc", "/dev/sdd",
+		"/dev/nvme0n1", "/dev/nvme1n1", "/dev/nvme2n1", "/dev/sde"}
+	for _, id := range ids {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: id, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+
+	bin := filepath.Join(t.TempDir(), "zpool")
+	script := "#!/bin/sh\ncat <<'EOF'\n" + zpoolStatusWithLogAndCache + "EOF\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := NewWithConfig(store, config.StorageConfig{ZFSEnable: true}, bin, slog.Default())
+	if err := s.mapPoolDevices(ctx, "tank"); err != nil {
+		t.Fatalf("map pool devices: %v", err)
+	}
+
+	devices, err := store.PoolDevices(ctx, "tank")
+	if err != nil {
+		t.Fatalf("pool devices: %v", err)
+	}
+	got := make(map[string]storage.PoolDevice, len(devices))
+	for _, d := range devices {
+		got[d.DiskID] = d
+	}
+	want := map[string][2]string{
+		ids[0]:         {"data", "raidz2"},
+		"/dev/sdd":     {"data", "raidz2"},
+		"/dev/nvme0n1": {"log", "mirror"},
+		"/dev/nvme1n1": {"log", "mirror"},
+		"/dev/nvme2n1": {"cache", "disk"},
+		"/dev/sde":     {"spare", "disk"},
+	}
+	if len(devices) != len(ids) {
+		t.Fatalf("expected %d devices, got %+v", len(ids), devices)
+	}
+	for id, w := range want {
+		if d := got[id]; d.Role != w[0] || d.VdevType != w[1] {
+			t.Errorf("%s = %s/%s, want %s/%s", id, d.Role, d.VdevType, w[0], w[1])
+		}
+	}
+
+	pools, err := store.GetDiskPoolMembership(ctx, "/dev/nvme0n1")
+	if err != nil || len(pools) != 1 || pools[0].Role != "log" {
+		t.Fatalf("membership = %+v (%v)", pools, err)
+	}
+}
+
+func TestDuplicateSerialAlerts(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"sda", "sdb", "sdc/holders/dm-0", "sdd/holders/dm-0", "sde"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := sysBlockDir
+	sysBlockDir = root
+	defer func() { sysBlockDir = prev }()
+
+	store := openTestStore(t)
+	ctx := context.Background()
+	svc := New(store, slog.Default())
+
+	disks := []storage.Disk{
+		// Two "8TB" drives from the same dodgy listing.
+		{ID: "ata-FAKE_1", Name: "/dev/sda", Type: "hdd", Model: "WDC WD80EFAX", Serial: "WD-CA0123456789"},
+		{ID: "ata-FAKE_2", Name: "/dev/sdb", Type: "hdd", Model: "WDC WD80EFAX", Serial: "WD-CA0123456789"},
+		// A partition carries its disk's serial.
+		{ID: "ata-FAKE_1-part1", Name: "/dev/sda1", Type: "hdd", Model: "WDC WD80EFAX", Serial: "WD-CA0123456789"},
+		// Two paths to one multipathed SAS drive.
+		{ID: "scsi-PATH_A", Name: "/dev/sdc", Type: "hdd", Model: "ST12000NM", Serial: "ZHZ0AAAA"},
+		{ID: "scsi-PATH_B", Name: "/dev/sdd", Type: "hdd", Model: "ST12000NM", Serial: "ZHZ0AAAA"},
+		{ID: "ata-REAL", Name: "/dev/sde", Type: "hdd", Model: "ST4000VN008", Serial: "ZGY00000"},
+	}
+	alerts := svc.applyDisks(ctx, disks)
+	var dup []string
+	for _, a := range alerts {
+		if a.Subject == "Duplicate serial" {
+			if a.Severity != "warning" || !strings.Contains(a.Message, "/dev/sda, /dev/sdb") {
+				t.Fatalf("unexpected alert %+v", a)
+			}
+			dup = append(dup, a.SourceID)
+		}
+	}
+	if !reflect.DeepEqual(dup, []string{"ata-FAKE_1", "ata-FAKE_2"}) {
+		t.Fatalf("expected duplicate serial alerts for both fake drives only, got %v (all: %+v)", dup, alerts)
+	}
+
+	// Reported once, not on every discovery pass.
+	if alerts := svc.applyDisks(ctx, disks); len(alerts) != 0 {
+		t.Fatalf("expected no repeat alerts, got %+v", alerts)
+	}
+}
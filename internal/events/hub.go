@@ -0,0 +1,78 @@
+// Package events fans out alert and status events to live subscribers
+// (the /api/v1/events stream).
+package events
+
+import "sync"
+
+// Event types.
+const (
+	TypeAlert  = "alert"
+	TypeStatus = "status"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 64
+
+// Event is one published event. ID is the alert row id for alert events,
+// which lets a reconnecting client resume from the database; it is 0 for
+// events that can't be replayed.
+type Event struct {
+	ID   int64
+	Type string
+	Data any
+}
+
+// Hub broadcasts events to subscribers. Publish never blocks: a subscriber
+// whose buffer is full is dropped and its channel closed, so a slow client
+// can't hold up alert persistence. It is expected to reconnect and replay
+// what it missed.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a subscriber. The returned function unsubscribes and
+// must be called when the subscriber is done; it is safe to call after the
+// hub has already dropped the subscriber.
+func (h *Hub) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() { h.remove(ch) }
+}
+
+// Publish delivers e to every subscriber.
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribers returns the number of connected subscribers.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+func (h *Hub) remove(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
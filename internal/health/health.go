@@ -5,9 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/discovery"
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
 	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
@@ -38,6 +43,14 @@ type StorageBackedProvider struct {
 	logger       *slog.Logger
 	schedulingCfg config.SchedulingConfig
 	alertsCfg    config.AlertsConfig
+	startedAt    time.Time // process start, for the alerts.startup_grace window
+	systemMetrics bool     // storage.system_metrics: evaluate host samples
+
+	rootOnce sync.Once
+	root     string // device holding /, found on first use
+
+	raisedMu sync.Mutex
+	raised   map[string]bool // conditions stored by the last persisting Summary
 }
 
 func NewStorageBackedProvider(store *storage.Store, logger *slog.Logger) *StorageBackedProvider {
@@ -46,6 +59,7 @@ func NewStorageBackedProvider(store *storage.Store, logger *slog.Logger) *Storag
 		logger:       logger,
 		schedulingCfg: config.SchedulingConfig{}, // Default empty config
 		alertsCfg:    config.AlertsConfig{},    // Default empty config
+		startedAt:    time.Now(),
 	}
 }
 
@@ -55,6 +69,7 @@ func NewStorageBackedProviderWithConfig(store *storage.Store, schedulingCfg conf
 		logger:       logger,
 		schedulingCfg: schedulingCfg,
 		alertsCfg:    config.AlertsConfig{}, // Default empty config
+		startedAt:    time.Now(),
 	}
 }
 
@@ -64,9 +79,64 @@ func NewStorageBackedProviderWithFullConfig(store *storage.Store, schedulingCfg
 		logger:       logger,
 		schedulingCfg: schedulingCfg,
 		alertsCfg:    alertsCfg,
+		startedAt:    time.Now(),
 	}
 }
 
+// SetSystemMetrics enables evaluation of the host samples taken with
+// storage.system_metrics, every scheduling.zfs_status_interval.
+func (p *StorageBackedProvider) SetSystemMetrics(enabled bool) {
+	p.systemMetrics = enabled
+}
+
+// inStartupGrace reports whether the process started less than
+// alerts.startup_grace ago. Collectors may not have run yet, so alerts about
+// overdue schedules or stale data are held back; hardware failures are not.
+func (p *StorageBackedProvider) inStartupGrace() bool {
+	return time.Since(p.startedAt) < p.alertsCfg.StartupGrace
+}
+
+// maxReadingAge is how old a disk's latest SMART/NVMe reading may be before
+// it no longer counts as current: alerts.max_reading_age, or else twice the
+// collection interval (times the adaptive backoff cap, which can stretch it).
+// 0 disables the check.
+func (p *StorageBackedProvider) maxReadingAge() time.Duration {
+	if p.alertsCfg.MaxReadingAge > 0 {
+		return p.alertsCfg.MaxReadingAge
+	}
+	age := 2 * p.schedulingCfg.SmartCollectInterval
+	if a := p.schedulingCfg.Adaptive; a.Enabled && a.MaxFactor > 1 {
+		age = time.Duration(float64(age) * a.MaxFactor)
+	}
+	return age
+}
+
+// checkStale marks a disk whose latest reading (taken at ts) is older than
+// maxReadingAge as "unknown": health computed from it says nothing about
+// the drive now, most likely because collection is broken. It runs after the
+// rules, so a disk that reading already showed critical stays critical.
+// Only live evaluations (at == 0) are checked.
+func (p *StorageBackedProvider) checkStale(d storage.Disk, ts, at int64, health types.DiskHealth, alerts []types.Alert) (types.DiskHealth, []types.Alert) {
+	maxAge := p.maxReadingAge()
+	if at != 0 || maxAge <= 0 || p.inStartupGrace() {
+		return health, alerts
+	}
+	age := time.Since(time.Unix(ts, 0))
+	if age <= maxAge {
+		return health, alerts
+	}
+	if config.SeverityRank(health.Status) < config.SeverityRank("critical") {
+		health.Status = "unknown"
+	}
+	health.Issues = append(health.Issues, "readings_stale")
+	// The message names the reading's time rather than its age so it stays
+	// the same from one evaluation to the next.
+	alerts = append(alerts, newAlert("warning", "disk", d.ID, "Readings stale",
+		"Latest reading was taken at %s, more than %s ago; health cannot be trusted until collection succeeds again",
+		time.Unix(ts, 0).UTC().Format(time.RFC3339), maxAge))
+	return health, alerts
+}
+
 func (p *StorageBackedProvider) Summary(ctx context.Context) (types.HealthReport, error) {
 	disks, err := p.store.ListDisks(ctx)
 	if err != nil {
@@ -76,7 +146,7 @@ func (p *StorageBackedProvider) Summary(ctx context.Context) (types.HealthReport
 	var dh []types.DiskHealth
 	var alerts []types.Alert
 	for _, d := range disks {
-		diskHealth, diskAlerts := p.evaluateDisk(ctx, d)
+		diskHealth, diskAlerts := p.evaluateDisk(ctx, d, 0)
 		dh = append(dh, diskHealth)
 		alerts = append(alerts, diskAlerts...)
 	}
@@ -92,13 +162,59 @@ func (p *StorageBackedProvider) Summary(ctx context.Context) (types.HealthReport
 		alerts = append(alerts, poolAlerts...)
 	}
 
-	if err := p.persistAlerts(ctx, alerts); err != nil {
+	// md arrays are optional (storage.md_enable); a failed read shouldn't
+	// take the whole report down.
+	var mh []types.PoolHealth
+	arrays, err := p.store.ListMDArrays(ctx)
+	if err != nil {
+		p.logger.Warn("list md arrays", "error", err)
+	}
+	for _, a := range arrays {
+		arrayHealth, arrayAlerts := evaluateMDArray(a)
+		mh = append(mh, arrayHealth)
+		alerts = append(alerts, arrayAlerts...)
+	}
+
+	var sys *types.SystemHealth
+	var samples []storage.SystemMetrics
+	if p.systemMetrics {
+		samples, err = p.store.RecentSystemMetrics(ctx, 2)
+		if err != nil {
+			p.logger.Warn("recent system metrics", "error", err)
+		}
+	}
+	// Samples left over from before collection stopped or was turned off
+	// say nothing about the host now.
+	if len(samples) > 0 && p.systemSampleCurrent(samples[0]) {
+		var prev *storage.SystemMetrics
+		if len(samples) > 1 {
+			prev = &samples[1]
+		}
+		var sysAlerts []types.Alert
+		sys, sysAlerts = evaluateSystem(samples[0], prev)
+		alerts = append(alerts, sysAlerts...)
+	}
+
+	// A read-only database keeps serving the last collected state; its
+	// alerts can't be stored, so report the read-only condition instead.
+	if ro, ok := p.store.ReadOnlyAlert(); ok {
+		alerts = append(alerts, types.Alert{
+			Timestamp:  ro.Timestamp,
+			Severity:   ro.Severity,
+			SourceType: ro.SourceType,
+			SourceID:   ro.SourceID,
+			Subject:    ro.Subject,
+			Message:    ro.Message,
+		})
+	} else if err := p.persistAlerts(ctx, alerts); err != nil {
 		p.logger.Warn("persist alerts", "error", err)
 	}
 
 	status := "ok"
 	for _, a := range alerts {
-		if a.Severity == "critical" {
+		// Emergency alerts still report as "critical" so existing
+		// consumers of the overall status keep working.
+		if config.SeverityRank(a.Severity) >= config.SeverityRank("critical") {
 			status = "critical"
 			break
 		}
@@ -108,14 +224,310 @@ func (p *StorageBackedProvider) Summary(ctx context.Context) (types.HealthReport
 	}
 
 	return types.HealthReport{
-		Status: status,
-		Disks:  dh,
-		Pools:  ph,
-		Alerts: alerts,
+		Status:        status,
+		StatusReasons: statusReasons(alerts, maxStatusReasons),
+		Disks:         dh,
+		Pools:         ph,
+		MDArrays:      mh,
+		Alerts:        alerts,
+		System:        sys,
 	}, nil
 }
 
-func (p *StorageBackedProvider) evaluateDisk(ctx context.Context, d storage.Disk) (types.DiskHealth, []types.Alert) {
+// systemSampleCurrent reports whether m is recent enough to evaluate: no
+// older than twice the interval it is sampled on.
+func (p *StorageBackedProvider) systemSampleCurrent(m storage.SystemMetrics) bool {
+	maxAge := 2 * p.schedulingCfg.ZFSStatusInterval
+	return maxAge <= 0 || time.Since(time.Unix(m.Timestamp, 0)) <= maxAge
+}
+
+// evaluateSystem reports the latest host sample and warns when the ZFS ARC is
+// severely constrained: memory pressure has pushed its target down to
+// zfs_arc_min, or ZFS throttled writes for lack of memory since the previous
+// sample (prev may be nil).
+func evaluateSystem(m storage.SystemMetrics, prev *storage.SystemMetrics) (*types.SystemHealth, []types.Alert) {
+	health := &types.SystemHealth{
+		Timestamp:         m.Timestamp,
+		Load1:             m.Load1,
+		Load5:             m.Load5,
+		Load15:            m.Load15,
+		MemTotalBytes:     m.MemTotalBytes,
+		MemAvailableBytes: m.MemAvailableBytes,
+		ARCSizeBytes:      m.ARCSizeBytes,
+		ARCTargetBytes:    m.ARCTargetBytes,
+		ARCMinBytes:       m.ARCMinBytes,
+		ARCMaxBytes:       m.ARCMaxBytes,
+	}
+	if total := m.ARCHits + m.ARCMisses; total > 0 {
+		ratio := float64(m.ARCHits) / float64(total)
+		health.ARCHitRatio = &ratio
+	}
+	var alerts []types.Alert
+
+	// No ARC figures without the zfs module
+	if m.ARCMaxBytes == 0 {
+		return health, alerts
+	}
+	var reasons []string
+	if m.ARCMaxBytes > m.ARCMinBytes && m.ARCTargetBytes <= m.ARCMinBytes {
+		health.Issues = append(health.Issues, "arc_at_minimum")
+		reasons = append(reasons, fmt.Sprintf("ARC target %d MiB is at its minimum (max %d MiB)",
+			m.ARCTargetBytes>>20, m.ARCMaxBytes>>20))
+	}
+	if prev != nil && m.ARCThrottles > prev.ARCThrottles {
+		health.Issues = append(health.Issues, "arc_memory_throttle")
+		reasons = append(reasons, fmt.Sprintf("%d writes throttled for lack of memory", m.ARCThrottles-prev.ARCThrottles))
+	}
+	if len(reasons) > 0 {
+		alerts = append(alerts, newAlert("warning", "system", "arc", "ZFS ARC constrained",
+			"%s; %d of %d MiB memory available", strings.Join(reasons, "; "),
+			m.MemAvailableBytes>>20, m.MemTotalBytes>>20))
+	}
+	return health, alerts
+}
+
+// evaluateMDArray checks an mdadm array: failed or inactive arrays and
+// degraded arrays with no rebuild running are critical, a running rebuild is
+// a warning carrying its progress.
+func evaluateMDArray(a storage.MDArray) (types.PoolHealth, []types.Alert) {
+	health := types.PoolHealth{
+		Name:        a.Name,
+		State:       a.State,
+		Status:      "ok",
+		HealthScore: 100,
+	}
+	var alerts []types.Alert
+
+	var faulty []string
+	for _, m := range a.Members {
+		if m.State == "faulty" {
+			faulty = append(faulty, m.Device)
+		}
+	}
+	faultyNote := ""
+	if len(faulty) > 0 {
+		faultyNote = "; faulty: " + strings.Join(faulty, ", ")
+	}
+
+	state := strings.ToLower(a.State)
+	rebuilding := a.SyncAction == "recovery" || a.SyncAction == "reshape"
+	switch {
+	// Critical: array stopped or failed
+	case strings.Contains(state, "inactive") || strings.Contains(state, "failed"):
+		health.Status = "critical"
+		health.HealthScore = 0
+		health.Issues = append(health.Issues, "md_failed")
+		alerts = append(alerts, newAlert("critical", "md", a.Name, "MD array failed",
+			"%s array state: %s%s", a.Level, a.State, faultyNote))
+	// Warning: degraded but rebuilding onto a spare
+	case a.Degraded() && rebuilding:
+		health.Status = "warning"
+		health.HealthScore -= 40
+		health.Issues = append(health.Issues, "md_rebuilding")
+		alerts = append(alerts, newAlert("warning", "md", a.Name, "MD array rebuilding",
+			"%s %.1f%% complete (%d/%d devices active)%s", a.SyncAction, a.SyncProgress, a.ActiveDisks, a.RaidDisks, faultyNote))
+	// Critical: degraded with no rebuild running
+	case a.Degraded() || strings.Contains(state, "degraded"):
+		health.Status = "critical"
+		health.HealthScore -= 60
+		health.Issues = append(health.Issues, "md_degraded")
+		alerts = append(alerts, newAlert("critical", "md", a.Name, "MD array degraded",
+			"%d/%d devices active%s", a.ActiveDisks, a.RaidDisks, faultyNote))
+	// Info: resync after an unclean shutdown
+	case a.SyncAction == "resync":
+		health.Issues = append(health.Issues, "md_resync")
+		alerts = append(alerts, newAlert("info", "md", a.Name, "MD array resync",
+			"resync %.1f%% complete", a.SyncProgress))
+	}
+	return health, alerts
+}
+
+// maxListedPoolErrors bounds how many corrupted objects are named in an alert.
+const maxListedPoolErrors = 10
+
+// highStartStopCycles is the start/stop count above which mechanical wear is
+// flagged as informational.
+const highStartStopCycles = 50000
+
+// maxStatusReasons bounds how many contributing issues are summarized in a report.
+const maxStatusReasons = 3
+
+// statusReasons summarizes the most severe alerts as short human-readable
+// reasons, e.g. "pool tank: ZFS pool state: DEGRADED".
+func statusReasons(alerts []types.Alert, limit int) []string {
+	sorted := make([]types.Alert, 0, len(alerts))
+	for _, a := range alerts {
+		if config.SeverityRank(a.Severity) >= config.SeverityRank("warning") {
+			sorted = append(sorted, a)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return config.SeverityRank(sorted[i].Severity) > config.SeverityRank(sorted[j].Severity)
+	})
+
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, a := range sorted {
+		if len(reasons) >= limit {
+			break
+		}
+		reason := fmt.Sprintf("%s %s: %s", a.SourceType, a.SourceID, a.Message)
+		if seen[reason] {
+			continue
+		}
+		seen[reason] = true
+		reasons = append(reasons, reason)
+	}
+	return reasons
+}
+
+// predictiveFailureScore scores the five SMART attributes Backblaze found most
+// predictive of drive failure: 1 point for each nonzero attribute and another
+// for each that grew since prev (which may be nil).
+func predictiveFailureScore(curr storage.SmartSnapshot, prev *storage.SmartSnapshot) (int, []string) {
+	var base storage.SmartSnapshot
+	if prev != nil {
+		base = *prev
+	}
+	attrs := []struct {
+		id         int
+		curr, prev int64
+	}{
+		{5, curr.Reallocated, base.Reallocated},
+		{187, curr.ReportedUncorrect, base.ReportedUncorrect},
+		{188, curr.CommandTimeout, base.CommandTimeout},
+		{197, curr.Pending, base.Pending},
+		{198, curr.OfflineUncorrect, base.OfflineUncorrect},
+	}
+
+	score := 0
+	var details []string
+	for _, a := range attrs {
+		if a.curr <= 0 {
+			continue
+		}
+		score++
+		detail := fmt.Sprintf("%d=%d", a.id, a.curr)
+		if prev != nil && a.curr > a.prev {
+			score++
+			detail += fmt.Sprintf(" (+%d)", a.curr-a.prev)
+		}
+		details = append(details, detail)
+	}
+	return score, details
+}
+
+// DiskHealth evaluates a single disk without persisting its alerts, for
+// detail views that shouldn't have side effects.
+func (p *StorageBackedProvider) DiskHealth(ctx context.Context, d storage.Disk) types.DiskHealth {
+	return p.DiskHealthAt(ctx, d, 0)
+}
+
+// DiskHealthAt is DiskHealth as it would have been computed at the given Unix
+// time, using the snapshots taken up to then. at=0 means now.
+func (p *StorageBackedProvider) DiskHealthAt(ctx context.Context, d storage.Disk, at int64) types.DiskHealth {
+	health, _ := p.evaluateDisk(ctx, d, at)
+	return health
+}
+
+// DiskHealthFrom is DiskHealth evaluated from already loaded snapshots,
+// newest first (the current and previous reading are used), so callers
+// listing many disks can batch the history queries.
+func (p *StorageBackedProvider) DiskHealthFrom(ctx context.Context, d storage.Disk, smart []storage.SmartSnapshot, nvme []storage.NvmeSnapshot) types.DiskHealth {
+	health, _ := p.evaluateDiskHistory(ctx, d, 0, smart, nvme)
+	return health
+}
+
+// ReplayDisk re-runs the disk evaluators against each of the disk's last
+// limit snapshots, oldest first, and returns the alerts that would have fired
+// under the current configuration, timestamped with the snapshot that
+// triggered them, along with the number of snapshots evaluated. Like a live
+// condition, an alert is reported when it first appears and again only after
+// it has cleared. Nothing is persisted.
+func (p *StorageBackedProvider) ReplayDisk(ctx context.Context, d storage.Disk, limit int) ([]types.Alert, int, error) {
+	var times []int64
+	if d.Type == "nvme" {
+		history, err := p.store.NvmeHistory(ctx, d.ID, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, snap := range history {
+			times = append(times, snap.Timestamp)
+		}
+	} else {
+		history, err := p.store.SmartHistory(ctx, d.ID, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, snap := range history {
+			times = append(times, snap.Timestamp)
+		}
+	}
+
+	var fired []types.Alert
+	active := map[string]bool{}
+	for i := len(times) - 1; i >= 0; i-- {
+		_, alerts := p.evaluateDisk(ctx, d, times[i])
+		current := map[string]bool{}
+		for _, a := range alerts {
+			key := a.SourceType + "|" + a.SourceID + "|" + a.Subject
+			current[key] = true
+			if active[key] {
+				continue
+			}
+			a.Timestamp = times[i]
+			fired = append(fired, a)
+		}
+		active = current
+	}
+	return fired, len(times), nil
+}
+
+// smartHistory returns the current and previous SMART snapshots as of at
+// (0 = now), newest first.
+func (p *StorageBackedProvider) smartHistory(ctx context.Context, diskID string, at int64) []storage.SmartSnapshot {
+	if at == 0 {
+		history, _ := p.store.SmartHistory(ctx, diskID, 2)
+		return history
+	}
+	curr, _ := p.store.SmartAt(ctx, diskID, at)
+	if curr == nil {
+		return nil
+	}
+	history := []storage.SmartSnapshot{*curr}
+	if prev, _ := p.store.SmartAt(ctx, diskID, curr.Timestamp-1); prev != nil {
+		history = append(history, *prev)
+	}
+	return history
+}
+
+// nvmeHistory is the NVMe counterpart of smartHistory.
+func (p *StorageBackedProvider) nvmeHistory(ctx context.Context, diskID string, at int64) []storage.NvmeSnapshot {
+	if at == 0 {
+		history, _ := p.store.NvmeHistory(ctx, diskID, 2)
+		return history
+	}
+	curr, _ := p.store.NvmeAt(ctx, diskID, at)
+	if curr == nil {
+		return nil
+	}
+	history := []storage.NvmeSnapshot{*curr}
+	if prev, _ := p.store.NvmeAt(ctx, diskID, curr.Timestamp-1); prev != nil {
+		history = append(history, *prev)
+	}
+	return history
+}
+
+func (p *StorageBackedProvider) evaluateDisk(ctx context.Context, d storage.Disk, at int64) (types.DiskHealth, []types.Alert) {
+	if d.Type == "nvme" {
+		return p.evaluateDiskHistory(ctx, d, at, nil, p.nvmeHistory(ctx, d.ID, at))
+	}
+	return p.evaluateDiskHistory(ctx, d, at, p.smartHistory(ctx, d.ID, at), nil)
+}
+
+// evaluateDiskHistory evaluates a disk from its snapshots as of at (0 = now),
+// newest first.
+func (p *StorageBackedProvider) evaluateDiskHistory(ctx context.Context, d storage.Disk, at int64, smart []storage.SmartSnapshot, nvme []storage.NvmeSnapshot) (types.DiskHealth, []types.Alert) {
 	health := types.DiskHealth{
 		ID:          d.ID,
 		Name:        d.Name,
@@ -126,9 +538,42 @@ func (p *StorageBackedProvider) evaluateDisk(ctx context.Context, d storage.Disk
 	var alerts []types.Alert
 
 	if d.Type == "nvme" {
-		health, alerts = p.evaluateNvmeDisk(ctx, d, health, alerts)
+		health, alerts = p.evaluateNvmeDisk(d, nvme, health, alerts)
+		if len(nvme) > 0 {
+			health, alerts = p.checkStale(d, nvme[0].Timestamp, at, health, alerts)
+		}
 	} else {
-		health, alerts = p.evaluateSmartDisk(ctx, d, health, alerts)
+		health, alerts = p.evaluateSmartDisk(d, smart, health, alerts)
+		if len(smart) > 0 && !d.SmartUnsupported {
+			health, alerts = p.checkStale(d, smart[0].Timestamp, at, health, alerts)
+		}
+	}
+
+	// Acknowledged hardware: hold the known fault's alerts until it worsens
+	if ack, _ := p.store.HardwareAck(ctx, d.ID); ack != nil {
+		if cur, ok := currentCounters(d, smart, nvme); ok && !exceedsBaseline(cur, *ack) {
+			alerts = slices.DeleteFunc(alerts, func(a types.Alert) bool { return hardwareErrorAlerts[a.Subject] })
+			health.Issues = append(health.Issues, "hardware_acknowledged")
+		}
+	}
+
+	// Info: volatile write cache on a pool member without power protection
+	if d.WriteCache == "enabled" && !p.alertsCfg.WriteCacheProtected {
+		if pools, _ := p.store.GetDiskPoolMembership(ctx, d.ID); len(pools) > 0 {
+			health.Issues = append(health.Issues, "write_cache_unprotected")
+			alerts = append(alerts, newAlert("info", "disk", d.ID, "Volatile write cache enabled",
+				"Write cache is enabled on a member of pool %s with no power protection; writes in flight can be lost on power failure",
+				pools[0].PoolName))
+		}
+	}
+
+	// The boot disk: with scheduling.exclude_root_disk, drop the alerts that
+	// are noise on a boot SSD or USB stick; hardware failures still alert
+	if p.isSystemDisk(d) {
+		health.Role = "system"
+		if p.schedulingCfg.ExcludeRootDisk {
+			alerts = slices.DeleteFunc(alerts, func(a types.Alert) bool { return systemDiskNuisanceAlerts[a.Subject] })
+		}
 	}
 
 	if health.HealthScore < 0 {
@@ -140,12 +585,27 @@ func (p *StorageBackedProvider) evaluateDisk(ctx context.Context, d storage.Disk
 	return health, alerts
 }
 
-func (p *StorageBackedProvider) evaluateSmartDisk(ctx context.Context, d storage.Disk, health types.DiskHealth, alerts []types.Alert) (types.DiskHealth, []types.Alert) {
-	snap, _ := p.store.LatestSmart(ctx, d.ID)
-	if snap == nil {
+func (p *StorageBackedProvider) evaluateSmartDisk(d storage.Disk, history []storage.SmartSnapshot, health types.DiskHealth, alerts []types.Alert) (types.DiskHealth, []types.Alert) {
+	if d.SmartUnsupported {
+		switch p.alertsCfg.SmartUnsupported {
+		case "ignore":
+		case "warning":
+			health.Status = "warning"
+			health.Issues = append(health.Issues, "smart_unsupported")
+			alerts = append(alerts, newAlert("warning", "disk", d.ID, "SMART unsupported",
+				"Drive does not report SMART data; its health cannot be monitored"))
+		default:
+			health.Status = "info"
+			health.Issues = append(health.Issues, "smart_unsupported")
+		}
 		return health, alerts
 	}
 
+	if len(history) == 0 {
+		return health, alerts
+	}
+	snap := &history[0]
+
 	health.TemperatureC = snap.TemperatureC
 
 	// Critical: SMART failed
@@ -179,12 +639,37 @@ func (p *StorageBackedProvider) evaluateSmartDisk(ctx context.Context, d storage
 		health.Issues = append(health.Issues, "reallocated_sectors")
 	}
 
-	// Temperature warnings using configurable thresholds
-	hddWarning := p.alertsCfg.TemperatureThresholds.HDDWarning
+	// Warning: SCSI/SAS grown defect list entries
+	if snap.GrownDefects > 0 {
+		health.HealthScore -= 20
+		health.Issues = append(health.Issues, "grown_defects")
+		alerts = append(alerts, newAlert("warning", "disk", d.ID, "Grown defects",
+			"Drive has %d entries in the grown defect list", snap.GrownDefects))
+	}
+
+	// Critical: Backblaze failure predictors
+	if pf := p.alertsCfg.PredictiveFailure; pf.Enabled {
+		var prev *storage.SmartSnapshot
+		if len(history) >= 2 {
+			prev = &history[1]
+		}
+		score, details := predictiveFailureScore(*snap, prev)
+		if score > 0 && score >= pf.MinScore {
+			health.HealthScore -= 10 * score
+			health.Status = "critical"
+			health.Issues = append(health.Issues, "predictive_failure")
+			alerts = append(alerts, newAlert("critical", "disk", d.ID, "Predictive failure",
+				"Failure-predictive SMART attributes nonzero (score %d): %s", score, strings.Join(details, ", ")))
+		}
+	}
+
+	// Temperature warnings using configurable thresholds (per-disk overrides first)
+	thresholds := p.alertsCfg.ThresholdsFor(d.ID, d.Name, d.Model)
+	hddWarning := thresholds.HDDWarning
 	if hddWarning == 0 {
 		hddWarning = 55.0 // Default fallback
 	}
-	hddCritical := p.alertsCfg.TemperatureThresholds.HDDCritical
+	hddCritical := thresholds.HDDCritical
 	if hddCritical == 0 {
 		hddCritical = 70.0 // Default fallback
 	}
@@ -202,7 +687,6 @@ func (p *StorageBackedProvider) evaluateSmartDisk(ctx context.Context, d storage
 	}
 
 	// Historical comparison
-	history, _ := p.store.SmartHistory(ctx, d.ID, 2) // Get last 2 snapshots
 	if len(history) >= 2 {
 		prev := history[1] // Previous snapshot
 		curr := history[0] // Current snapshot
@@ -216,6 +700,38 @@ func (p *StorageBackedProvider) evaluateSmartDisk(ctx context.Context, d storage
 				"Reallocated sectors increased by %d", increase))
 		}
 
+		// Warning: Grown defect list increased
+		if curr.GrownDefects > prev.GrownDefects {
+			increase := curr.GrownDefects - prev.GrownDefects
+			health.HealthScore -= 15
+			health.Issues = append(health.Issues, "grown_defects_increasing")
+			alerts = append(alerts, newAlert("warning", "disk", d.ID, "Grown defects increasing",
+				"Grown defect list increased by %d", increase))
+		}
+
+		// Warning: SAS phy errors increased (cabling, expander or backplane).
+		// Only compare two real reads: an unread log is unknown, not zero.
+		dwords := curr.SASInvalidDwords - prev.SASInvalidDwords
+		disparity := curr.SASDisparityErrors - prev.SASDisparityErrors
+		lossOfSync := curr.SASLossOfSync - prev.SASLossOfSync
+		resets := curr.SASPhyResets - prev.SASPhyResets
+		if prev.SASPhyRead && curr.SASPhyRead && (dwords > 0 || disparity > 0 || lossOfSync > 0 || resets > 0) {
+			health.Issues = append(health.Issues, "sas_phy_errors_increasing")
+			alerts = append(alerts, newAlert("warning", "disk", d.ID, "SAS phy errors increasing",
+				"SAS phy error counters grew (invalid dword +%d, running disparity +%d, loss of sync +%d, phy reset +%d); check cabling and backplane",
+				max(dwords, 0), max(disparity, 0), max(lossOfSync, 0), max(resets, 0)))
+		}
+
+		// Warning: the drive logged a new over-temperature event (SCT),
+		// which the periodic reading may well have missed. The count is a
+		// lifetime total, so only compare two real reads.
+		if prev.SCTLimitCountsRead && curr.SCTLimitCountsRead && curr.SCTOverTempCount > prev.SCTOverTempCount {
+			health.Issues = append(health.Issues, "sct_over_temp_events")
+			alerts = append(alerts, newAlert("warning", "disk", d.ID, "Over-temperature events recorded",
+				"Drive recorded %d new over-temperature event(s) (lifetime max %d°C)",
+				curr.SCTOverTempCount-prev.SCTOverTempCount, curr.SCTLifetimeMaxC))
+		}
+
 		// Warning: CRC errors increased significantly
 		if curr.CRCErrors > prev.CRCErrors {
 			increase := curr.CRCErrors - prev.CRCErrors
@@ -232,6 +748,15 @@ func (p *StorageBackedProvider) evaluateSmartDisk(ctx context.Context, d storage
 		health.Issues = append(health.Issues, "crc_errors")
 	}
 
+	// Info: heavy spin-up/down wear (desktop drives are commonly rated for ~50k)
+	if d.Type == "hdd" && snap.StartStopCount > highStartStopCycles {
+		health.Issues = append(health.Issues, "high_start_stop_cycles")
+		alerts = append(alerts, newAlert("info", "disk", d.ID, "High start/stop cycles",
+			"Drive has %d start/stop cycles (%d power cycles); check power management settings", snap.StartStopCount, snap.PowerCycleCount))
+	}
+
+	health, alerts = p.applyRules(d, smartRuleMetrics(*snap), health, alerts)
+
 	if health.HealthScore < 60 && health.Status != "critical" {
 		health.Status = "warning"
 	}
@@ -239,20 +764,21 @@ func (p *StorageBackedProvider) evaluateSmartDisk(ctx context.Context, d storage
 	return health, alerts
 }
 
-func (p *StorageBackedProvider) evaluateNvmeDisk(ctx context.Context, d storage.Disk, health types.DiskHealth, alerts []types.Alert) (types.DiskHealth, []types.Alert) {
-	snap, _ := p.store.LatestNvme(ctx, d.ID)
-	if snap == nil {
+func (p *StorageBackedProvider) evaluateNvmeDisk(d storage.Disk, history []storage.NvmeSnapshot, health types.DiskHealth, alerts []types.Alert) (types.DiskHealth, []types.Alert) {
+	if len(history) == 0 {
 		return health, alerts
 	}
+	snap := &history[0]
 
 	health.TemperatureC = snap.TemperatureC
 
-	// Temperature warnings using configurable thresholds
-	nvmeWarning := p.alertsCfg.TemperatureThresholds.NvmeWarning
+	// Temperature warnings using configurable thresholds (per-disk overrides first)
+	thresholds := p.alertsCfg.ThresholdsFor(d.ID, d.Name, d.Model)
+	nvmeWarning := thresholds.NvmeWarning
 	if nvmeWarning == 0 {
 		nvmeWarning = 70.0 // Default fallback
 	}
-	nvmeCritical := p.alertsCfg.TemperatureThresholds.NvmeCritical
+	nvmeCritical := thresholds.NvmeCritical
 	if nvmeCritical == 0 {
 		nvmeCritical = 85.0 // Default fallback
 	}
@@ -297,12 +823,7 @@ func (p *StorageBackedProvider) evaluateNvmeDisk(ctx context.Context, d storage.
 
 	// Parse and evaluate critical warning flags
 	if snap.CriticalWarningFlags != "" {
-		var flags struct {
-			AvailableSpareLow            bool `json:"available_spare_low"`
-			TemperatureThresholdExceeded bool `json:"temperature_threshold_exceeded"`
-			ReliabilityDegraded           bool `json:"reliability_degraded"`
-			ReadOnly                      bool `json:"read_only"`
-		}
+		var flags nvmeWarnings
 		if err := json.Unmarshal([]byte(snap.CriticalWarningFlags), &flags); err == nil {
 			if flags.AvailableSpareLow {
 				health.HealthScore -= 30
@@ -329,14 +850,28 @@ func (p *StorageBackedProvider) evaluateNvmeDisk(ctx context.Context, d storage.
 				health.HealthScore = 0
 				health.Status = "critical"
 				health.Issues = append(health.Issues, "nvme_read_only")
-				alerts = append(alerts, newAlert("critical", "disk", d.ID, "NVMe read-only mode", 
+				alerts = append(alerts, newAlert("emergency", "disk", d.ID, "NVMe read-only mode", 
 					"Device has entered read-only mode"))
 			}
 		}
 	}
 
+	// Warning: thin-provisioned namespace nearly full
+	if snap.NamespaceThin && snap.NamespaceCapacityBytes > 0 {
+		limit := p.alertsCfg.NamespaceUtilization
+		if limit == 0 {
+			limit = 90.0 // Default fallback
+		}
+		used := float64(snap.NamespaceUsedBytes) / float64(snap.NamespaceCapacityBytes) * 100
+		if used >= limit {
+			health.HealthScore -= 10
+			health.Issues = append(health.Issues, "nvme_namespace_full")
+			alerts = append(alerts, newAlert("warning", "disk", d.ID, "NVMe namespace nearly full",
+				"Namespace utilization is %.1f%% of capacity (threshold %.0f%%)", used, limit))
+		}
+	}
+
 	// Historical comparison: Unsafe shutdowns
-	history, _ := p.store.NvmeHistory(ctx, d.ID, 2)
 	if len(history) >= 2 {
 		prev := history[1]
 		curr := history[0]
@@ -348,12 +883,62 @@ func (p *StorageBackedProvider) evaluateNvmeDisk(ctx context.Context, d storage.
 			alerts = append(alerts, newAlert("warning", "disk", d.ID, "Unsafe shutdowns increased", 
 				"Unsafe shutdowns increased by %d", increase))
 		}
+
+		// Time spent over the composite temperature thresholds only ever
+		// grows, so growth means the drive ran (and likely throttled) hot
+		// since the last reading, even if it has cooled down since. As
+		// lifetime totals, they are only compared between two real reads.
+		tempTimeRead := prev.TempTimeRead && curr.TempTimeRead
+		if tempTimeRead && curr.CriticalTempMinutes > prev.CriticalTempMinutes {
+			health.Issues = append(health.Issues, "critical_temp_time_increased")
+			alerts = append(alerts, newAlert("warning", "disk", d.ID, "NVMe critical temperature time increased",
+				"Time above the critical composite temperature grew by %d minutes (%d total)",
+				curr.CriticalTempMinutes-prev.CriticalTempMinutes, curr.CriticalTempMinutes))
+		} else if tempTimeRead && curr.WarningTempMinutes > prev.WarningTempMinutes {
+			health.Issues = append(health.Issues, "warning_temp_time_increased")
+			alerts = append(alerts, newAlert("info", "disk", d.ID, "NVMe warning temperature time increased",
+				"Time above the warning composite temperature grew by %d minutes (%d total)",
+				curr.WarningTempMinutes-prev.WarningTempMinutes, curr.WarningTempMinutes))
+		}
+
+		// Warning: the drive booted a different firmware slot or revision.
+		// Expected after a planned update, worth a look otherwise.
+		if prev.FirmwareActiveSlot != 0 && curr.FirmwareActiveSlot != 0 {
+			prevRev := slotRevision(prev.FirmwareSlots, prev.FirmwareActiveSlot)
+			currRev := slotRevision(curr.FirmwareSlots, curr.FirmwareActiveSlot)
+			if prev.FirmwareActiveSlot != curr.FirmwareActiveSlot || prevRev != currRev {
+				health.Issues = append(health.Issues, "firmware_changed")
+				alerts = append(alerts, newAlert("warning", "disk", d.ID, "NVMe firmware changed",
+					"Active firmware changed from slot %d (%s) to slot %d (%s)",
+					prev.FirmwareActiveSlot, prevRev, curr.FirmwareActiveSlot, currRev))
+			}
+		}
 	}
 
+	health, alerts = p.applyRules(d, nvmeRuleMetrics(*snap), health, alerts)
+
 	if health.HealthScore < 60 && health.Status != "critical" {
 		health.Status = "warning"
 	}
 
+	switch snap.SanitizeStatus {
+	case "in_progress":
+		// The drive is being wiped on purpose; until it finishes, errors
+		// and counter changes say nothing about its health
+		alerts = slices.DeleteFunc(alerts, func(a types.Alert) bool { return a.SourceID == d.ID })
+		health.Status = "info"
+		health.Issues = append(health.Issues, "sanitize_in_progress")
+		alerts = append(alerts, newAlert("info", "disk", d.ID, "NVMe sanitize in progress",
+			"Sanitize is %.0f%% complete; other alerts for this drive are held until it finishes", snap.SanitizeProgress))
+	case "failed":
+		health.Issues = append(health.Issues, "sanitize_failed")
+		alerts = append(alerts, newAlert("warning", "disk", d.ID, "NVMe sanitize failed",
+			"The last sanitize operation failed; the drive may still hold data"))
+		if health.Status == "ok" {
+			health.Status = "warning"
+		}
+	}
+
 	return health, alerts
 }
 
@@ -366,17 +951,103 @@ func (p *StorageBackedProvider) evaluatePool(ctx context.Context, pool storage.P
 	}
 	var alerts []types.Alert
 
-	// Critical: Pool not ONLINE
+	// Critical: Pool not ONLINE (emergency once I/O is suspended)
 	if pool.State != "ONLINE" && pool.State != "" {
 		health.Status = "critical"
 		health.HealthScore = 0
 		health.Issues = append(health.Issues, "pool_state_"+pool.State)
-		alerts = append(alerts, newAlert("critical", "pool", pool.Name, "Pool not healthy", 
-			"ZFS pool state: "+pool.State))
+		sev := "critical"
+		if pool.State == "SUSPENDED" {
+			sev = "emergency"
+		}
+		alerts = append(alerts, newAlert(sev, "pool", pool.Name, "Pool not healthy", 
+			"ZFS pool state: %s", pool.State))
 	}
 
-	// Warning: Last scrub time older than interval
-	if p.schedulingCfg.ZFSScrubInterval > 0 {
+	// Critical: permanent data errors (files ZFS could not repair)
+	if objects, _ := p.store.PoolErrors(ctx, pool.Name); len(objects) > 0 {
+		health.HealthScore -= 50
+		health.Status = "critical"
+		health.Issues = append(health.Issues, "permanent_errors")
+		listed := objects
+		if len(listed) > maxListedPoolErrors {
+			listed = listed[:maxListedPoolErrors]
+		}
+		msg := strings.Join(listed, ", ")
+		if more := len(objects) - len(listed); more > 0 {
+			msg += fmt.Sprintf(" and %d more", more)
+		}
+		alerts = append(alerts, newAlert("critical", "pool", pool.Name, "Permanent data errors",
+			"%d object(s) have unrecoverable errors: %s", len(objects), msg))
+	}
+
+	// Info: same-model members running different firmware revisions
+	if mismatches := p.firmwareMismatches(ctx, pool.Name); len(mismatches) > 0 {
+		health.Issues = append(health.Issues, "firmware_mismatch")
+		alerts = append(alerts, newAlert("info", "pool", pool.Name, "Firmware mismatch",
+			"Members of the same model run different firmware: %s", strings.Join(mismatches, "; ")))
+	}
+
+	// Info: dedup enabled but barely saving anything (the DDT costs RAM)
+	if props, _ := p.store.GetPoolProperties(ctx, pool.Name); props != nil && props.DedupEnabled() && props.DedupRatio > 0 {
+		minRatio := p.alertsCfg.MinDedupRatio
+		if minRatio == 0 {
+			minRatio = 1.5 // Default fallback
+		}
+		if props.DedupRatio < minRatio {
+			health.Issues = append(health.Issues, "dedup_ratio_low")
+			alerts = append(alerts, newAlert("info", "pool", pool.Name, "Dedup ratio low",
+				"Dedup is %s but the ratio is only %.2fx (below %.2fx); the dedup table is costing RAM for little saving",
+				props.Dedup, props.DedupRatio, minRatio))
+		}
+	}
+
+	// Warning/Critical: pool filling up. ZFS slows sharply past ~80% and
+	// refuses writes once free space reaches its slop reserve; fragmented
+	// free space runs out first, so each 10% of fragmentation lowers both
+	// thresholds by a point.
+	if space, _ := p.store.GetPoolSpace(ctx, pool.Name); space != nil && space.SizeBytes > 0 {
+		warnAt, critAt := p.alertsCfg.PoolCapacityWarning, p.alertsCfg.PoolCapacityCritical
+		if warnAt == 0 {
+			warnAt = 80 // Default fallback
+		}
+		if critAt == 0 {
+			critAt = 95 // Default fallback
+		}
+		penalty := float64(space.Fragmentation) / 10
+		warnAt, critAt = warnAt-penalty, critAt-penalty
+		capacity := float64(space.Capacity)
+		slop := zfsSlopBytes(space.SizeBytes)
+		switch {
+		case space.FreeBytes <= slop:
+			health.HealthScore -= 30
+			health.Status = "critical"
+			health.Issues = append(health.Issues, "pool_capacity_critical")
+			alerts = append(alerts, newAlert("critical", "pool", pool.Name, "Pool out of space",
+				"Only %.1f GiB free, within the %.1f GiB ZFS holds back; writes will fail",
+				float64(space.FreeBytes)/(1<<30), float64(slop)/(1<<30)))
+		case capacity >= critAt:
+			health.HealthScore -= 30
+			health.Status = "critical"
+			health.Issues = append(health.Issues, "pool_capacity_critical")
+			alerts = append(alerts, newAlert("critical", "pool", pool.Name, "Pool nearly full",
+				"Pool is %d%% full with %d%% fragmentation (critical at %.0f%%); ZFS is close to being unable to allocate",
+				space.Capacity, space.Fragmentation, critAt))
+		case capacity >= warnAt:
+			health.HealthScore -= 10
+			if health.Status == "ok" {
+				health.Status = "warning"
+			}
+			health.Issues = append(health.Issues, "pool_capacity_high")
+			alerts = append(alerts, newAlert("warning", "pool", pool.Name, "Pool filling up",
+				"Pool is %d%% full with %d%% fragmentation (warning at %.0f%%); write performance degrades as it fills",
+				space.Capacity, space.Fragmentation, warnAt))
+		}
+	}
+
+	// Warning: Last scrub time older than interval (held back during the
+	// startup grace window)
+	if p.schedulingCfg.ZFSScrubInterval > 0 && !p.inStartupGrace() {
 		lastScrubTime := int64(0)
 		if pool.LastScrubTime.Valid {
 			lastScrubTime = pool.LastScrubTime.Int64
@@ -403,6 +1074,21 @@ func (p *StorageBackedProvider) evaluatePool(ctx context.Context, pool storage.P
 		}
 	}
 
+	// Warning: a scrub started but never completed (alerts.max_scrub_duration)
+	if maxDur := p.alertsCfg.MaxScrubDuration; maxDur > 0 {
+		if open, err := p.store.OpenScrub(ctx, pool.Name); err == nil && open != nil {
+			if running := time.Since(time.Unix(open.StartTime, 0)); running > maxDur {
+				if health.Status == "ok" {
+					health.Status = "warning"
+				}
+				health.HealthScore -= 10
+				health.Issues = append(health.Issues, "scrub_stuck")
+				alerts = append(alerts, newAlert("warning", "pool", pool.Name, "Scrub not completing",
+					"Scrub started %s ago has not completed (limit %s)", running.Round(time.Minute), maxDur))
+			}
+		}
+	}
+
 	// Warning/Critical: Last scrub had errors
 	if pool.LastScrubError.Valid && pool.LastScrubError.Int64 > 0 {
 		errors := pool.LastScrubError.Int64
@@ -424,6 +1110,145 @@ func (p *StorageBackedProvider) evaluatePool(ctx context.Context, pool storage.P
 	return health, alerts
 }
 
+// hardwareErrorAlerts are the disk alerts an acknowledge-hardware silences:
+// they describe the known fault. Temperature and configuration alerts keep
+// firing.
+var hardwareErrorAlerts = map[string]bool{
+	"SMART FAILED":                   true,
+	"Offline uncorrectable sectors":  true,
+	"Pending sectors":                true,
+	"Grown defects":                  true,
+	"Predictive failure":             true,
+	"Reallocated sectors increasing": true,
+	"Grown defects increasing":       true,
+	"CRC errors increasing":          true,
+	"NVMe media errors":              true,
+	"NVMe spare space low":           true,
+	"NVMe reliability degraded":      true,
+	"NVMe read-only mode":            true,
+}
+
+// systemDiskNuisanceAlerts are not raised for the root disk when
+// scheduling.exclude_root_disk is set.
+var systemDiskNuisanceAlerts = map[string]bool{
+	"SMART unsupported":            true,
+	"Volatile write cache enabled": true,
+	"High start/stop cycles":       true,
+}
+
+// isSystemDisk reports whether d holds the root filesystem.
+func (p *StorageBackedProvider) isSystemDisk(d storage.Disk) bool {
+	p.rootOnce.Do(func() { p.root = discovery.RootDisk() })
+	return p.root != "" && d.Name == p.root
+}
+
+// currentCounters returns the disk's error counters from its newest snapshot.
+func currentCounters(d storage.Disk, smart []storage.SmartSnapshot, nvme []storage.NvmeSnapshot) (storage.HardwareBaseline, bool) {
+	if d.Type == "nvme" {
+		if len(nvme) > 0 {
+			return storage.NvmeBaseline(nvme[0]), true
+		}
+		return storage.HardwareBaseline{}, false
+	}
+	if len(smart) > 0 {
+		return storage.SmartBaseline(smart[0]), true
+	}
+	return storage.HardwareBaseline{}, false
+}
+
+// nvmeWarnings is the decoded critical_warning_flags of an NVMe snapshot.
+type nvmeWarnings struct {
+	AvailableSpareLow            bool `json:"available_spare_low"`
+	TemperatureThresholdExceeded bool `json:"temperature_threshold_exceeded"`
+	ReliabilityDegraded          bool `json:"reliability_degraded"`
+	ReadOnly                     bool `json:"read_only"`
+}
+
+// exceedsBaseline reports whether any error counter has grown past the
+// acknowledged baseline, SMART health has newly failed, or an NVMe drive has
+// raised a new critical warning, lost spare capacity or worn further.
+func exceedsBaseline(cur, base storage.HardwareBaseline) bool {
+	if cur.HealthStatus == "failed" && base.HealthStatus != "failed" {
+		return true
+	}
+	var curFlags, baseFlags nvmeWarnings
+	_ = json.Unmarshal([]byte(cur.CriticalWarnings), &curFlags)
+	_ = json.Unmarshal([]byte(base.CriticalWarnings), &baseFlags)
+	if curFlags.AvailableSpareLow && !baseFlags.AvailableSpareLow ||
+		curFlags.ReliabilityDegraded && !baseFlags.ReliabilityDegraded ||
+		curFlags.ReadOnly && !baseFlags.ReadOnly {
+		return true
+	}
+	if cur.AvailableSpareRead && base.AvailableSpareRead && cur.AvailableSpare < base.AvailableSpare {
+		return true
+	}
+	// Acks recorded before the NVMe fields were added have no flags and a
+	// zero wear baseline; don't treat the drive's existing wear as new.
+	if base.CriticalWarnings != "" && cur.PercentUsed > base.PercentUsed {
+		return true
+	}
+	return cur.Reallocated > base.Reallocated ||
+		cur.Pending > base.Pending ||
+		cur.OfflineUncorrect > base.OfflineUncorrect ||
+		cur.CRCErrors > base.CRCErrors ||
+		cur.GrownDefects > base.GrownDefects ||
+		cur.ReportedUncorrect > base.ReportedUncorrect ||
+		cur.MediaErrors > base.MediaErrors ||
+		cur.ErrorLogEntries > base.ErrorLogEntries
+}
+
+// slotRevision returns the revision in a firmware slot from an NVMe
+// snapshot's "1:REV,2:REV" slot list, or "unknown".
+func slotRevision(slots string, slot int64) string {
+	prefix := fmt.Sprintf("%d:", slot)
+	for _, s := range strings.Split(slots, ",") {
+		if rev, ok := strings.CutPrefix(s, prefix); ok {
+			return rev
+		}
+	}
+	return "unknown"
+}
+
+// firmwareMismatches groups a pool's member disks by model and describes
+// each model whose members report more than one firmware revision, e.g.
+// "WDC WD40EFRX: 82.00A82 (sda, sdb), 80.00A80 (sdc)". Pool device rows
+// don't record individual vdevs, so members are compared pool-wide.
+func (p *StorageBackedProvider) firmwareMismatches(ctx context.Context, poolName string) []string {
+	deviceIDs, err := p.store.GetPoolDevices(ctx, poolName)
+	if err != nil || len(deviceIDs) < 2 {
+		return nil
+	}
+	// model -> firmware -> disk names
+	byModel := map[string]map[string][]string{}
+	for _, id := range deviceIDs {
+		d, err := p.store.GetDisk(ctx, id)
+		if err != nil || d == nil || d.Model == "" || d.Firmware == "" {
+			continue
+		}
+		if byModel[d.Model] == nil {
+			byModel[d.Model] = map[string][]string{}
+		}
+		name := strings.TrimPrefix(d.Name, "/dev/")
+		byModel[d.Model][d.Firmware] = append(byModel[d.Model][d.Firmware], name)
+	}
+
+	var res []string
+	for model, revisions := range byModel {
+		if len(revisions) < 2 {
+			continue
+		}
+		var parts []string
+		for fw, names := range revisions {
+			sort.Strings(names)
+			parts = append(parts, fmt.Sprintf("%s (%s)", fw, strings.Join(names, ", ")))
+		}
+		sort.Strings(parts)
+		res = append(res, model+": "+strings.Join(parts, ", "))
+	}
+	sort.Strings(res)
+	return res
+}
+
 func newAlert(sev, sourceType, sourceID, subject, msg string, args ...interface{}) types.Alert {
 	message := msg
 	if len(args) > 0 {
@@ -439,8 +1264,20 @@ func newAlert(sev, sourceType, sourceID, subject, msg string, args ...interface{
 	}
 }
 
+// persistAlerts stores the alerts whose condition was not present, at the
+// same severity, in the previous summary. Summary runs on every health
+// dispatch and API poll; storing every active alert each time would flood
+// the alerts table and the event stream with copies.
 func (p *StorageBackedProvider) persistAlerts(ctx context.Context, alerts []types.Alert) error {
+	p.raisedMu.Lock()
+	defer p.raisedMu.Unlock()
+	current := make(map[string]bool, len(alerts))
 	for _, a := range alerts {
+		key := a.SourceType + ":" + a.SourceID + ":" + a.Subject + ":" + a.Severity
+		current[key] = true
+		if p.raised[key] {
+			continue
+		}
 		_, err := p.store.AddAlert(ctx, storage.Alert{
 			Severity:   a.Severity,
 			SourceType: a.SourceType,
@@ -453,5 +1290,14 @@ func (p *StorageBackedProvider) persistAlerts(ctx context.Context, alerts []type
 			return err
 		}
 	}
+	p.raised = current
 	return nil
 }
+
+// zfsSlopBytes is the space ZFS reserves in a pool of the given size and
+// won't allocate to ordinary writes: 1/32 of the pool, at least 128 MiB and,
+// since OpenZFS 2.1, at most 128 GiB.
+func zfsSlopBytes(size int64) int64 {
+	slop := size / 32
+	return min(max(slop, 128<<20), 128<<30)
+}
@@ -4,9 +4,16 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/discovery"
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
 
 func TestSummaryEmpty(t *testing.T) {
@@ -27,8 +34,781 @@ func TestSummaryEmpty(t *testing.T) {
 	}
 }
 
+func TestSummaryStatusReasons(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "disk-a", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "disk-a", HealthStatus: "passed", TemperatureC: 60, Timestamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	if err := store.UpsertPool(ctx, "tank", "DEGRADED", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+
+	report, err := NewStorageBackedProvider(store, slog.Default()).Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	if report.Status != "critical" {
+		t.Fatalf("expected critical status, got %s", report.Status)
+	}
+	if len(report.StatusReasons) != 2 {
+		t.Fatalf("expected 2 reasons, got %v", report.StatusReasons)
+	}
+	if !strings.HasPrefix(report.StatusReasons[0], "pool tank:") || !strings.Contains(report.StatusReasons[0], "DEGRADED") {
+		t.Fatalf("expected worst reason to be the degraded pool, got %q", report.StatusReasons[0])
+	}
+}
+
 func TestMain(m *testing.M) {
 	// quiet default logger output
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn})))
 	os.Exit(m.Run())
 }
+
+func TestPredictiveFailureRule(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "disk-a", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	now := time.Now().Unix()
+	for i, snap := range []storage.SmartSnapshot{
+		{DiskID: "disk-a", HealthStatus: "passed", CommandTimeout: 2, Timestamp: now - 3600},
+		{DiskID: "disk-a", HealthStatus: "passed", CommandTimeout: 2, ReportedUncorrect: 4, Timestamp: now},
+	} {
+		if err := store.AddSmartSnapshot(ctx, snap); err != nil {
+			t.Fatalf("add snapshot %d: %v", i, err)
+		}
+	}
+
+	alertsCfg := config.AlertsConfig{PredictiveFailure: config.PredictiveFailureConfig{Enabled: true, MinScore: 1}}
+	provider := NewStorageBackedProviderWithFullConfig(store, config.SchedulingConfig{}, alertsCfg, slog.Default())
+	report, err := provider.Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+
+	var found bool
+	for _, a := range report.Alerts {
+		if a.Subject == "Predictive failure" {
+			found = true
+			if a.Severity != "critical" {
+				t.Fatalf("expected critical severity, got %s", a.Severity)
+			}
+			// 187 nonzero and growing (2) + 188 nonzero (1)
+			if !strings.Contains(a.Message, "score 3") || !strings.Contains(a.Message, "187=4 (+4)") || !strings.Contains(a.Message, "188=2") {
+				t.Fatalf("unexpected message: %s", a.Message)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected predictive failure alert, got %+v", report.Alerts)
+	}
+	if report.Disks[0].Status != "critical" {
+		t.Fatalf("expected disk to be critical, got %s", report.Disks[0].Status)
+	}
+
+	// A higher threshold suppresses the rule.
+	alertsCfg.PredictiveFailure.MinScore = 4
+	report, _ = NewStorageBackedProviderWithFullConfig(store, config.SchedulingConfig{}, alertsCfg, slog.Default()).Summary(ctx)
+	for _, a := range report.Alerts {
+		if a.Subject == "Predictive failure" {
+			t.Fatalf("expected rule to stay quiet below min_score, got %+v", a)
+		}
+	}
+}
+
+func TestFirmwareMismatchAcrossPoolMembers(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	disks := []storage.Disk{
+		{ID: "ata-WDC_WD40EFRX_1", Name: "/dev/sda", Type: "hdd", Model: "WDC WD40EFRX", Firmware: "82.00A82"},
+		{ID: "ata-WDC_WD40EFRX_2", Name: "/dev/sdb", Type: "hdd", Model: "WDC WD40EFRX", Firmware: "80.00A80"},
+		{ID: "ata-ST4000VN008_1", Name: "/dev/sdc", Type: "hdd", Model: "ST4000VN008", Firmware: "SC60"},
+	}
+	var ids []string
+	for _, d := range disks {
+		if err := store.UpsertDisk(ctx, d); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+		ids = append(ids, d.ID)
+	}
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", time.Now().Unix(), 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", ids, "data"); err != nil {
+		t.Fatalf("upsert pool devices: %v", err)
+	}
+
+	provider := NewStorageBackedProvider(store, slog.Default())
+	report, err := provider.Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	var found bool
+	for _, a := range report.Alerts {
+		if a.Subject != "Firmware mismatch" {
+			continue
+		}
+		found = true
+		if a.Severity != "info" || a.SourceID != "tank" {
+			t.Fatalf("unexpected alert %+v", a)
+		}
+		want := "WDC WD40EFRX: 80.00A80 (sdb), 82.00A82 (sda)"
+		if !strings.Contains(a.Message, want) || strings.Contains(a.Message, "ST4000VN008") {
+			t.Fatalf("expected message to name %q only, got %q", want, a.Message)
+		}
+	}
+	if !found {
+		t.Fatalf("expected a firmware mismatch alert, got %+v", report.Alerts)
+	}
+
+	// Bring the second drive to the same firmware and the alert clears.
+	disks[1].Firmware = "82.00A82"
+	if err := store.UpsertDisk(ctx, disks[1]); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if got := provider.firmwareMismatches(ctx, "tank"); got != nil {
+		t.Fatalf("expected no mismatches after update, got %q", got)
+	}
+}
+
+func TestStaleReadingsReportUnknown(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "disk-a", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour).Unix()
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "disk-a", HealthStatus: "passed", TemperatureC: 35, Timestamp: weekAgo}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	// 6h collection: anything older than 12h is stale.
+	provider := NewStorageBackedProviderWithFullConfig(store,
+		config.SchedulingConfig{SmartCollectInterval: 6 * time.Hour}, config.AlertsConfig{}, slog.Default())
+	report, err := provider.Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	if report.Disks[0].Status != "unknown" {
+		t.Fatalf("expected unknown disk status, got %+v", report.Disks[0])
+	}
+	if report.Status != "warning" || len(report.Alerts) != 1 || report.Alerts[0].Subject != "Readings stale" {
+		t.Fatalf("expected a single staleness warning, got %s %+v", report.Status, report.Alerts)
+	}
+
+	// An explicit max_reading_age wins over the derived one.
+	provider.alertsCfg.MaxReadingAge = 30 * 24 * time.Hour
+	report, _ = provider.Summary(ctx)
+	if report.Disks[0].Status != "ok" || len(report.Alerts) != 0 {
+		t.Fatalf("expected week-old reading within a 30d limit to be ok, got %+v", report)
+	}
+
+	// A stale reading that showed a warning no longer vouches for it: the
+	// score-based warning set by the rules doesn't override unknown.
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "disk-a", HealthStatus: "passed", Pending: 1, Reallocated: 1, TemperatureC: 35, Timestamp: weekAgo + 30}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	provider.alertsCfg.MaxReadingAge = 0
+	report, _ = provider.Summary(ctx)
+	if report.Disks[0].Status != "unknown" {
+		t.Fatalf("expected a stale warning disk to be unknown, got %+v", report.Disks[0])
+	}
+
+	// A stale reading that showed the drive failing keeps it critical.
+	if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "disk-a", HealthStatus: "failed", TemperatureC: 35, Timestamp: weekAgo + 60}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	report, _ = provider.Summary(ctx)
+	if report.Disks[0].Status != "critical" || !slices.Contains(report.Disks[0].Issues, "readings_stale") {
+		t.Fatalf("expected a stale failed disk to stay critical, got %+v", report.Disks[0])
+	}
+}
+
+func TestDiskOverrideChangesTemperatureAlert(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	disk := storage.Disk{ID: "nvme-a", Name: "/dev/nvme0n1", Type: "nvme", Model: "SAMSUNG MZQL23T8HCLS-00A07"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	if err := store.AddNvmeSnapshot(ctx, storage.NvmeSnapshot{DiskID: disk.ID, TemperatureC: 75, Timestamp: time.Now().Unix()}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	alertsCfg := config.AlertsConfig{TemperatureThresholds: config.TemperatureThresholds{NvmeWarning: 70, NvmeCritical: 85}}
+	subjects := func() []string {
+		report, err := NewStorageBackedProviderWithFullConfig(store, config.SchedulingConfig{}, alertsCfg, slog.Default()).Summary(ctx)
+		if err != nil {
+			t.Fatalf("summary err: %v", err)
+		}
+		var got []string
+		for _, a := range report.Alerts {
+			got = append(got, a.Subject)
+		}
+		return got
+	}
+
+	if got := subjects(); len(got) != 1 || got[0] != "High temperature" {
+		t.Fatalf("expected the global threshold to warn at 75°C, got %v", got)
+	}
+
+	// Enterprise drive rated hotter: the model override lifts the warning.
+	alertsCfg.DiskOverrides = []config.DiskOverride{{Match: "SAMSUNG MZQL2*", Thresholds: config.TemperatureThresholds{NvmeWarning: 80}}}
+	if got := subjects(); len(got) != 0 {
+		t.Fatalf("expected no alerts under the model override, got %v", got)
+	}
+}
+
+func TestNvmeOverTempTimeGrowthAlerts(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	disk := storage.Disk{ID: "nvme-a", Name: "/dev/nvme0n1", Type: "nvme"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	now := time.Now().Unix()
+	// The first snapshot after an upgrade has a lifetime total but nothing
+	// real to compare it against.
+	if err := store.AddNvmeSnapshot(ctx, storage.NvmeSnapshot{DiskID: disk.ID, TemperatureC: 40, Timestamp: now - 120}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	if err := store.AddNvmeSnapshot(ctx, storage.NvmeSnapshot{DiskID: disk.ID, TemperatureC: 40, WarningTempMinutes: 30, CriticalTempMinutes: 5, TempTimeRead: true, Timestamp: now - 60}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	report, err := NewStorageBackedProvider(store, slog.Default()).Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	if len(report.Alerts) != 0 {
+		t.Fatalf("expected no alert against an unread previous value, got %+v", report.Alerts)
+	}
+
+	// Cool at both readings, but the drive spent 12 more minutes above its
+	// warning temperature in between.
+	if err := store.AddNvmeSnapshot(ctx, storage.NvmeSnapshot{DiskID: disk.ID, TemperatureC: 40, WarningTempMinutes: 42, CriticalTempMinutes: 5, TempTimeRead: true, Timestamp: now}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	report, err = NewStorageBackedProvider(store, slog.Default()).Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	if len(report.Alerts) != 1 || report.Alerts[0].Subject != "NVMe warning temperature time increased" || report.Alerts[0].Severity != "info" {
+		t.Fatalf("expected one info alert for warning temperature time, got %+v", report.Alerts)
+	}
+	if !strings.Contains(report.Alerts[0].Message, "12 minutes") {
+		t.Fatalf("expected the growth in the message, got %q", report.Alerts[0].Message)
+	}
+}
+
+func TestNvmeSanitizeInProgressHoldsAlerts(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	disk := storage.Disk{ID: "nvme-a", Name: "/dev/nvme0n1", Type: "nvme"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	// Media errors would normally alert, but the drive is being wiped.
+	snap := storage.NvmeSnapshot{DiskID: disk.ID, TemperatureC: 40, MediaErrors: 3, SanitizeStatus: "in_progress", SanitizeProgress: 42.5, Timestamp: time.Now().Unix()}
+	if err := store.AddNvmeSnapshot(ctx, snap); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	report, err := NewStorageBackedProvider(store, slog.Default()).Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	if len(report.Alerts) != 1 || report.Alerts[0].Subject != "NVMe sanitize in progress" || !strings.Contains(report.Alerts[0].Message, "42%") {
+		t.Fatalf("expected only the sanitize alert, got %+v", report.Alerts)
+	}
+	if report.Disks[0].Status != "info" {
+		t.Fatalf("expected info status while sanitizing, got %q", report.Disks[0].Status)
+	}
+}
+
+func TestStartupGraceSuppressesOverdueAlerts(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	// A never-scrubbed healthy pool and a faulted one.
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	if err := store.UpsertPool(ctx, "backup", "FAULTED", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+
+	provider := NewStorageBackedProviderWithFullConfig(store,
+		config.SchedulingConfig{ZFSScrubInterval: 720 * time.Hour},
+		config.AlertsConfig{StartupGrace: time.Hour}, slog.Default())
+
+	subjects := func() map[string]bool {
+		report, err := provider.Summary(ctx)
+		if err != nil {
+			t.Fatalf("summary err: %v", err)
+		}
+		got := map[string]bool{}
+		for _, a := range report.Alerts {
+			got[a.SourceID+": "+a.Subject] = true
+		}
+		return got
+	}
+
+	got := subjects()
+	if got["tank: Scrub never run"] || got["backup: Scrub never run"] {
+		t.Fatalf("expected scrub alerts to be held back during grace, got %v", got)
+	}
+	if !got["backup: Pool not healthy"] {
+		t.Fatalf("expected the faulted pool to alert during grace, got %v", got)
+	}
+
+	// Once the window has passed the overdue alert fires.
+	provider.startedAt = time.Now().Add(-2 * time.Hour)
+	if got := subjects(); !got["tank: Scrub never run"] {
+		t.Fatalf("expected scrub alert after grace, got %v", got)
+	}
+}
+
+func TestRootDiskMarkedSystem(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	prev := discovery.RootDisk
+	discovery.RootDisk = func() string { return "/dev/sda" }
+	defer func() { discovery.RootDisk = prev }()
+
+	for _, name := range []string{"sda", "sdb"} {
+		id := "usb-" + name
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/" + name, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+		if err := store.SetSmartUnsupported(ctx, id, true); err != nil {
+			t.Fatalf("mark unsupported: %v", err)
+		}
+	}
+
+	provider := NewStorageBackedProviderWithFullConfig(store, config.SchedulingConfig{ExcludeRootDisk: true},
+		config.AlertsConfig{SmartUnsupported: "warning"}, slog.Default())
+	report, err := provider.Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	for _, d := range report.Disks {
+		if want := map[string]string{"usb-sda": "system"}[d.ID]; d.Role != want {
+			t.Errorf("disk %s role = %q, want %q", d.ID, d.Role, want)
+		}
+	}
+	for _, a := range report.Alerts {
+		if a.SourceID == "usb-sda" {
+			t.Errorf("unexpected alert on the excluded boot disk: %+v", a)
+		}
+	}
+	found := false
+	for _, a := range report.Alerts {
+		found = found || (a.SourceID == "usb-sdb" && a.Subject == "SMART unsupported")
+	}
+	if !found {
+		t.Fatalf("expected the data disk to still alert, got %+v", report.Alerts)
+	}
+}
+
+func TestStuckScrubWarns(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	lastScrub := now.Add(-10 * 24 * time.Hour).Unix()
+	for _, name := range []string{"tank", "fast"} {
+		if err := store.UpsertPool(ctx, name, "ONLINE", lastScrub, 0); err != nil {
+			t.Fatalf("upsert pool: %v", err)
+		}
+	}
+	// tank's scrub started three days ago and never finished; fast's is
+	// an hour in.
+	for name, started := range map[string]time.Time{"tank": now.Add(-72 * time.Hour), "fast": now.Add(-time.Hour)} {
+		if err := store.AddScrubHistory(ctx, storage.ScrubHistoryEntry{PoolName: name, StartTime: started.Unix(), Notes: "Scheduled scrub"}); err != nil {
+			t.Fatalf("add scrub history: %v", err)
+		}
+	}
+
+	provider := NewStorageBackedProviderWithFullConfig(store, config.SchedulingConfig{},
+		config.AlertsConfig{MaxScrubDuration: 48 * time.Hour}, slog.Default())
+	stuck := func() map[string]bool {
+		report, err := provider.Summary(ctx)
+		if err != nil {
+			t.Fatalf("summary err: %v", err)
+		}
+		got := map[string]bool{}
+		for _, a := range report.Alerts {
+			if a.Subject == "Scrub not completing" {
+				got[a.SourceID] = true
+			}
+		}
+		return got
+	}
+	if got := stuck(); !got["tank"] || got["fast"] {
+		t.Fatalf("expected only tank's scrub reported stuck, got %v", got)
+	}
+
+	// The scrub finally completes: closing the history entry clears the alert.
+	if err := store.FinishScrubs(ctx, "tank", now.Unix(), 0, now.Unix()); err != nil {
+		t.Fatalf("finish scrubs: %v", err)
+	}
+	if got := stuck(); got["tank"] {
+		t.Fatalf("expected no stuck scrub after completion, got %v", got)
+	}
+	history, err := store.GetScrubHistory(ctx, "tank", 1)
+	if err != nil || len(history) != 1 || history[0].EndTime != now.Unix() {
+		t.Fatalf("expected history end time %d, got %+v (%v)", now.Unix(), history, err)
+	}
+}
+
+func TestFragmentedPoolNearlyFullIsCritical(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	const size = 10 << 40 // 10 TiB
+	pools := []storage.PoolSpace{
+		// 88% full is only a warning on its own, but with 70% of the free
+		// space fragmented the critical threshold drops to 88%.
+		{PoolName: "fragmented", SizeBytes: size, FreeBytes: size * 12 / 100, Capacity: 88, Fragmentation: 70},
+		{PoolName: "contiguous", SizeBytes: size, FreeBytes: size * 12 / 100, Capacity: 88},
+		{PoolName: "roomy", SizeBytes: size, FreeBytes: size * 60 / 100, Capacity: 40, Fragmentation: 70},
+		// 98% of 2 TiB leaves less than the 1/32 ZFS holds back.
+		{PoolName: "full", SizeBytes: 2 << 40, FreeBytes: (2 << 40) * 2 / 100, Capacity: 98},
+	}
+	for _, sp := range pools {
+		if err := store.UpsertPool(ctx, sp.PoolName, "ONLINE", 0, 0); err != nil {
+			t.Fatalf("upsert pool: %v", err)
+		}
+		if err := store.UpsertPoolSpace(ctx, sp); err != nil {
+			t.Fatalf("upsert pool space: %v", err)
+		}
+	}
+
+	provider := NewStorageBackedProviderWithFullConfig(store, config.SchedulingConfig{}, config.AlertsConfig{}, slog.Default())
+	report, err := provider.Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	got := map[string]string{}
+	for _, a := range report.Alerts {
+		if strings.HasPrefix(a.Subject, "Pool ") && a.Subject != "Pool not healthy" {
+			got[a.SourceID] = a.Severity + ": " + a.Subject
+		}
+	}
+	want := map[string]string{
+		"fragmented": "critical: Pool nearly full",
+		"contiguous": "warning: Pool filling up",
+		"full":       "critical: Pool out of space",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("capacity alerts = %v, want %v", got, want)
+	}
+}
+
+func TestCustomRuleRaisesAlert(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	for id, reallocated := range map[string]int64{"ata-worn": 64, "ata-fine": 3} {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: id, Name: "/dev/" + id, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+		if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: id, HealthStatus: "passed", Reallocated: reallocated, TemperatureC: 35, Timestamp: time.Now().Unix()}); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+
+	alertsCfg := config.AlertsConfig{Rules: []config.AlertRule{
+		{Metric: "reallocated", Op: ">", Value: 50, Severity: "critical", Subject: "Too many reallocated sectors"},
+		// NVMe-only metric: never applies to these SATA disks.
+		{Metric: "percent_used", Op: ">=", Value: 0, Severity: "warning"},
+	}}
+	report, err := NewStorageBackedProviderWithFullConfig(store, config.SchedulingConfig{}, alertsCfg, slog.Default()).Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	var fired []string
+	for _, a := range report.Alerts {
+		if a.Subject == "Too many reallocated sectors" || strings.HasPrefix(a.Subject, "percent_used") {
+			fired = append(fired, a.SourceID+" "+a.Severity+" "+a.Message)
+		}
+	}
+	if want := "ata-worn critical reallocated is 64 (rule: reallocated > 50)"; len(fired) != 1 || fired[0] != want {
+		t.Fatalf("expected only %q, got %v", want, fired)
+	}
+	for _, d := range report.Disks {
+		if d.ID == "ata-worn" && d.Status != "critical" {
+			t.Fatalf("expected the rule to make ata-worn critical, got %q", d.Status)
+		}
+	}
+}
+
+func TestAckedNvmeGoingReadOnlyAlerts(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	disk := storage.Disk{ID: "nvme-rma", Name: "/dev/nvme0n1", Type: "nvme"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	now := time.Now().Unix()
+	acked := storage.NvmeSnapshot{
+		DiskID: disk.ID, TemperatureC: 40, MediaErrors: 3, PercentUsed: 20,
+		AvailableSpare: 8, AvailableSpareRead: true,
+		CriticalWarningFlags: `{"available_spare_low":true}`, Timestamp: now - 120,
+	}
+	if err := store.AddNvmeSnapshot(ctx, acked); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	if err := store.SetHardwareAck(ctx, storage.NvmeBaseline(acked)); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	provider := NewStorageBackedProvider(store, slog.Default())
+	subjects := func() map[string]bool {
+		t.Helper()
+		report, err := provider.Summary(ctx)
+		if err != nil {
+			t.Fatalf("summary err: %v", err)
+		}
+		found := map[string]bool{}
+		for _, a := range report.Alerts {
+			found[a.Subject] = true
+		}
+		return found
+	}
+	if got := subjects(); got["NVMe spare space low"] || got["NVMe media errors"] {
+		t.Fatalf("expected the acknowledged fault to be silenced, got %v", got)
+	}
+
+	// Same counters, but the drive has since gone read-only.
+	later := acked
+	later.CriticalWarningFlags = `{"available_spare_low":true,"read_only":true}`
+	later.Timestamp = now - 60
+	if err := store.AddNvmeSnapshot(ctx, later); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	if got := subjects(); !got["NVMe read-only mode"] {
+		t.Fatalf("expected read-only alert after the ack, got %v", got)
+	}
+
+	// Spare capacity still falling re-alerts as well.
+	later.CriticalWarningFlags = acked.CriticalWarningFlags
+	later.AvailableSpare = 5
+	later.Timestamp = now
+	if err := store.AddNvmeSnapshot(ctx, later); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	if got := subjects(); !got["NVMe spare space low"] {
+		t.Fatalf("expected spare space alert once spare keeps falling, got %v", got)
+	}
+}
+
+func TestSASPhyGrowthNeedsTwoReads(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	disk := storage.Disk{ID: "sas-a", Name: "/dev/sdc", Type: "hdd"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	provider := NewStorageBackedProvider(store, slog.Default())
+	phyAlert := func() bool {
+		t.Helper()
+		report, err := provider.Summary(ctx)
+		if err != nil {
+			t.Fatalf("summary err: %v", err)
+		}
+		for _, a := range report.Alerts {
+			if a.Subject == "SAS phy errors increasing" {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(snap storage.SmartSnapshot) {
+		t.Helper()
+		snap.DiskID, snap.HealthStatus, snap.TemperatureC = disk.ID, "passed", 35
+		if err := store.AddSmartSnapshot(ctx, snap); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+
+	now := time.Now().Unix()
+	// The phy log read failed, then succeeded with the drive's lifetime
+	// counts: that is not growth.
+	add(storage.SmartSnapshot{Timestamp: now - 120})
+	add(storage.SmartSnapshot{SASInvalidDwords: 40, SASPhyResets: 2, SASPhyRead: true, Timestamp: now - 60})
+	if phyAlert() {
+		t.Fatal("expected no alert when the previous phy log wasn't read")
+	}
+
+	add(storage.SmartSnapshot{SASInvalidDwords: 45, SASPhyResets: 2, SASPhyRead: true, Timestamp: now})
+	if !phyAlert() {
+		t.Fatal("expected an alert once two real reads show growth")
+	}
+}
+
+func TestSCTOverTempNeedsTwoReads(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	disk := storage.Disk{ID: "ata-sct", Name: "/dev/sdd", Type: "hdd"}
+	if err := store.UpsertDisk(ctx, disk); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	provider := NewStorageBackedProvider(store, slog.Default())
+	overTempAlert := func() bool {
+		t.Helper()
+		report, err := provider.Summary(ctx)
+		if err != nil {
+			t.Fatalf("summary err: %v", err)
+		}
+		for _, a := range report.Alerts {
+			if a.Subject == "Over-temperature events recorded" {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(snap storage.SmartSnapshot) {
+		t.Helper()
+		snap.DiskID, snap.HealthStatus, snap.TemperatureC = disk.ID, "passed", 35
+		if err := store.AddSmartSnapshot(ctx, snap); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+
+	now := time.Now().Unix()
+	// scttempsts failed (or the snapshot predates it), then reported the
+	// drive's lifetime count: not a new event.
+	add(storage.SmartSnapshot{Timestamp: now - 120})
+	add(storage.SmartSnapshot{SCTOverTempCount: 3, SCTLimitCountsRead: true, Timestamp: now - 60})
+	if overTempAlert() {
+		t.Fatal("expected no alert when the previous count wasn't read")
+	}
+
+	add(storage.SmartSnapshot{SCTOverTempCount: 4, SCTLimitCountsRead: true, Timestamp: now})
+	if !overTempAlert() {
+		t.Fatal("expected an alert once two real reads show a new event")
+	}
+}
+
+func TestARCCheckUsesCurrentSamplesOnly(t *testing.T) {
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	// ARC target pushed down to its minimum, sampled an hour ago.
+	constrained := storage.SystemMetrics{Timestamp: time.Now().Add(-time.Hour).Unix(), MemTotalBytes: 8 << 30, MemAvailableBytes: 256 << 20,
+		ARCSizeBytes: 512 << 20, ARCTargetBytes: 512 << 20, ARCMinBytes: 512 << 20, ARCMaxBytes: 4 << 30}
+	if err := store.AddSystemMetrics(ctx, constrained); err != nil {
+		t.Fatalf("add system metrics: %v", err)
+	}
+	hasARCAlert := func(report types.HealthReport) bool {
+		return slices.ContainsFunc(report.Alerts, func(a types.Alert) bool { return a.Subject == "ZFS ARC constrained" })
+	}
+
+	// With storage.system_metrics off, whatever is stored is ignored.
+	provider := NewStorageBackedProviderWithFullConfig(store,
+		config.SchedulingConfig{ZFSStatusInterval: 15 * time.Minute}, config.AlertsConfig{}, slog.Default())
+	report, err := provider.Summary(ctx)
+	if err != nil {
+		t.Fatalf("summary err: %v", err)
+	}
+	if report.System != nil || hasARCAlert(report) {
+		t.Fatalf("expected no system evaluation while collection is off, got %+v", report.System)
+	}
+
+	// On, but the sample is older than two 15m intervals.
+	provider.SetSystemMetrics(true)
+	report, _ = provider.Summary(ctx)
+	if report.System != nil || hasARCAlert(report) {
+		t.Fatalf("expected a stale sample to be ignored, got %+v", report.System)
+	}
+
+	constrained.Timestamp = time.Now().Unix()
+	if err := store.AddSystemMetrics(ctx, constrained); err != nil {
+		t.Fatalf("add system metrics: %v", err)
+	}
+	report, _ = provider.Summary(ctx)
+	if report.System == nil || !hasARCAlert(report) {
+		t.Fatalf("expected a current constrained sample to warn, got %+v", report.Alerts)
+	}
+}
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+// smartRuleMetrics maps alerts.rules metric names to a SMART snapshot.
+func smartRuleMetrics(s storage.SmartSnapshot) map[string]float64 {
+	return map[string]float64{
+		"temperature_c":         s.TemperatureC,
+		"power_on_hours":        float64(s.PowerOnHours),
+		"reallocated":           float64(s.Reallocated),
+		"pending":               float64(s.Pending),
+		"offline_uncorrectable": float64(s.OfflineUncorrect),
+		"crc_errors":            float64(s.CRCErrors),
+		"spin_retry_count":      float64(s.SpinRetryCount),
+		"load_cycle_count":      float64(s.LoadCycleCount),
+		"grown_defects":         float64(s.GrownDefects),
+		"reported_uncorrect":    float64(s.ReportedUncorrect),
+		"command_timeout":       float64(s.CommandTimeout),
+		"power_cycle_count":     float64(s.PowerCycleCount),
+		"start_stop_count":      float64(s.StartStopCount),
+	}
+}
+
+// nvmeRuleMetrics maps alerts.rules metric names to an NVMe snapshot.
+func nvmeRuleMetrics(s storage.NvmeSnapshot) map[string]float64 {
+	return map[string]float64{
+		"temperature_c":      s.TemperatureC,
+		"power_on_hours":     float64(s.PowerOnHours),
+		"percent_used":       s.PercentUsed,
+		"media_errors":       float64(s.MediaErrors),
+		"error_log_entries":  float64(s.ErrorLogEntries),
+		"unsafe_shutdowns":   float64(s.UnsafeShutdowns),
+		"data_written_bytes": float64(s.DataWrittenBytes),
+		"data_read_bytes":    float64(s.DataReadBytes),
+	}
+}
+
+// applyRules evaluates alerts.rules against a disk's latest snapshot
+// metrics. Rules on metrics the snapshot doesn't carry are skipped.
+func (p *StorageBackedProvider) applyRules(d storage.Disk, metrics map[string]float64, health types.DiskHealth, alerts []types.Alert) (types.DiskHealth, []types.Alert) {
+	for _, r := range p.alertsCfg.Rules {
+		v, ok := metrics[r.Metric]
+		if !ok || !ruleMatches(r, v) {
+			continue
+		}
+		subject := r.Subject
+		if subject == "" {
+			subject = ruleString(r)
+		}
+		health.Issues = append(health.Issues, "rule_"+r.Metric)
+		switch r.Severity {
+		case "critical", "emergency":
+			health.Status = "critical"
+		case "warning":
+			if health.Status != "critical" {
+				health.Status = "warning"
+			}
+		}
+		alerts = append(alerts, newAlert(r.Severity, "disk", d.ID, subject,
+			"%s is %s (rule: %s)", r.Metric, strconv.FormatFloat(v, 'f', -1, 64), ruleString(r)))
+	}
+	return health, alerts
+}
+
+func ruleMatches(r config.AlertRule, v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Value
+	case ">=":
+		return v >= r.Value
+	case "<":
+		return v < r.Value
+	case "<=":
+		return v <= r.Value
+	case "==":
+		return v == r.Value
+	case "!=":
+		return v != r.Value
+	}
+	return false
+}
+
+func ruleString(r config.AlertRule) string {
+	return fmt.Sprintf("%s %s %s", r.Metric, r.Op, strconv.FormatFloat(r.Value, 'f', -1, 64))
+}
@@ -0,0 +1,32 @@
+// Package httpclient builds the HTTP clients used for outbound requests
+// (cloud uplink, webhooks and the other notification channels).
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+)
+
+// New returns a client with cfg's timeout (defaultTimeout when unset) and
+// proxy. Without a configured proxy, HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// from the environment apply.
+func New(cfg config.HTTPClientConfig, defaultTimeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", cfg.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
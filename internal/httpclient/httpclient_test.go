@@ -0,0 +1,61 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+)
+
+func TestConfiguredProxyAndTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		_, _ = io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	client, err := New(config.HTTPClientConfig{Timeout: 7 * time.Second, Proxy: proxy.URL}, 30*time.Second)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if client.Timeout != 7*time.Second {
+		t.Fatalf("timeout = %v, want 7s", client.Timeout)
+	}
+
+	resp, err := client.Get("http://hooks.example.invalid/alert")
+	if err != nil {
+		t.Fatalf("request through proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if string(body) != "via proxy" || len(proxied) != 1 || proxied[0] != "http://hooks.example.invalid/alert" {
+		t.Fatalf("expected the request to go through the proxy, got %q, proxied %v", body, proxied)
+	}
+}
+
+func TestDefaultTimeoutAndEnvironmentProxy(t *testing.T) {
+	client, err := New(config.HTTPClientConfig{}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if client.Timeout != 10*time.Second {
+		t.Fatalf("timeout = %v, want the 10s default", client.Timeout)
+	}
+	if tr, ok := client.Transport.(*http.Transport); !ok || tr.Proxy == nil {
+		t.Fatal("expected the transport to take its proxy from the environment")
+	}
+
+	if _, err := New(config.HTTPClientConfig{Proxy: "http://[::1"}, time.Second); err == nil {
+		t.Fatal("expected an invalid proxy URL to be rejected")
+	}
+}
@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+// planDeliveries turns pending queue entries into deliveries. Without a
+// batch window every entry is sent on its own. With one, entries for the same
+// channel are held until the oldest has waited out the window and are then
+// sent together as a single grouped notification, so a multi-disk event
+// doesn't flood the channel. Critical alerts can be exempted.
+func (n *Notifier) planDeliveries(ctx context.Context, entries []storage.NotificationQueueEntry, now time.Time) []delivery {
+	var out []delivery
+	groups := make(map[string]*delivery)
+	var order []string
+	oldest := make(map[string]int64)
+
+	for _, entry := range entries {
+		stored, err := n.store.GetAlert(ctx, entry.AlertID)
+		if err != nil || stored == nil {
+			n.logger.Warn("failed to get alert for notification", "queue_id", entry.ID, "error", err)
+			continue
+		}
+		alert := types.Alert{
+			ID:         stored.ID,
+			Timestamp:  stored.Timestamp,
+			Severity:   stored.Severity,
+			SourceType: stored.SourceType,
+			SourceID:   stored.SourceID,
+			Subject:    stored.Subject,
+			Message:    stored.Message,
+			Resolves:   stored.Resolves,
+		}
+
+		// Incident channels dedupe per source, so they are never grouped.
+		incident := entry.Channel == "pagerduty" || entry.Channel == "opsgenie"
+		if n.cfg.BatchWindow <= 0 || incident || (n.cfg.BatchCriticalImmediately && atLeast(alert.Severity, "critical")) {
+			out = append(out, delivery{channel: entry.Channel, entries: []storage.NotificationQueueEntry{entry}, alerts: []types.Alert{alert}})
+			continue
+		}
+
+		g, ok := groups[entry.Channel]
+		if !ok {
+			g = &delivery{channel: entry.Channel}
+			groups[entry.Channel] = g
+			order = append(order, entry.Channel)
+			oldest[entry.Channel] = entry.CreatedAt
+		}
+		g.entries = append(g.entries, entry)
+		g.alerts = append(g.alerts, alert)
+		if entry.CreatedAt < oldest[entry.Channel] {
+			oldest[entry.Channel] = entry.CreatedAt
+		}
+	}
+
+	for _, channel := range order {
+		// Still inside the window: leave the entries pending for a later pass.
+		if now.Sub(time.Unix(oldest[channel], 0)) < n.cfg.BatchWindow {
+			continue
+		}
+		out = append(out, *groups[channel])
+	}
+	return out
+}
+
+// groupAlerts summarizes several alerts as one notification carrying the
+// highest severity among them.
+func groupAlerts(alerts []types.Alert) types.Alert {
+	severity := "info"
+	var latest int64
+	var lines []string
+	for _, a := range alerts {
+		if config.SeverityRank(a.Severity) > config.SeverityRank(severity) {
+			severity = strings.ToLower(a.Severity)
+		}
+		if a.Timestamp > latest {
+			latest = a.Timestamp
+		}
+		lines = append(lines, fmt.Sprintf("- [%s] %s %s: %s — %s",
+			strings.ToUpper(a.Severity), a.SourceType, a.SourceID, a.Subject, a.Message))
+	}
+	return types.Alert{
+		Timestamp:  latest,
+		Severity:   severity,
+		SourceType: "group",
+		SourceID:   fmt.Sprintf("%d alerts", len(alerts)),
+		Subject:    fmt.Sprintf("%d storage alerts", len(alerts)),
+		Message:    strings.Join(lines, "\n"),
+	}
+}
@@ -0,0 +1,174 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+// PagerDuty and OpsGenie track incidents rather than messages: alerts on the
+// same disk or pool share one incident, keyed by incidentKey, which Reconcile
+// resolves once every condition on that source has cleared.
+
+const (
+	defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	defaultOpsGenieURL  = "https://api.opsgenie.com"
+)
+
+// incidentKey is the PagerDuty dedup key / OpsGenie alias for an alert's
+// source. The hostname keeps sources on different hosts apart.
+func incidentKey(hostname string, alert types.Alert) string {
+	return "storagesentinel:" + hostname + ":" + alert.SourceType + ":" + alert.SourceID
+}
+
+// pagerDutySeverity maps alert severities to the Events API v2 ones.
+var pagerDutySeverity = map[string]string{"emergency": "critical", "critical": "critical", "warning": "warning", "info": "info"}
+
+// opsGeniePriority maps alert severities to OpsGenie priorities.
+var opsGeniePriority = map[string]string{"emergency": "P1", "critical": "P2", "warning": "P3", "info": "P5"}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"` // trigger or resolve
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"` // trigger only
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyEventFor builds the trigger or resolve event for an alert.
+func pagerDutyEventFor(cfg config.PagerDutyConfig, alert types.Alert, hostname string) pagerDutyEvent {
+	ev := pagerDutyEvent{
+		RoutingKey:  cfg.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    incidentKey(hostname, alert),
+	}
+	if alert.Resolves {
+		ev.EventAction = "resolve"
+		return ev
+	}
+	sev, ok := pagerDutySeverity[strings.ToLower(alert.Severity)]
+	if !ok {
+		sev = "error"
+	}
+	ev.Payload = &pagerDutyPayload{
+		Summary:   truncate(fmt.Sprintf("%s on %s: %s", alert.Subject, alert.SourceID, alert.Message), 1024),
+		Source:    hostname,
+		Severity:  sev,
+		Timestamp: time.Unix(alert.Timestamp, 0).UTC().Format(time.RFC3339),
+		Component: alert.SourceID,
+		Group:     alert.SourceType,
+		Class:     alert.Subject,
+		CustomDetails: map[string]string{
+			"severity": alert.Severity,
+			"message":  alert.Message,
+		},
+	}
+	return ev
+}
+
+func (n *Notifier) sendPagerDuty(ctx context.Context, alert types.Alert) error {
+	cfg := n.cfg.PagerDuty
+	if !cfg.Enabled {
+		return fmt.Errorf("pagerduty not configured")
+	}
+	hostname, _ := os.Hostname()
+	payload, err := json.Marshal(pagerDutyEventFor(cfg, alert, hostname))
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	endpoint := cfg.URL
+	if endpoint == "" {
+		endpoint = defaultPagerDutyURL
+	}
+	return n.postWebhook(ctx, &config.WebhookConfig{URL: endpoint}, payload)
+}
+
+type opsGenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Priority    string            `json:"priority,omitempty"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+type opsGenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// opsGenieRequestFor returns the path (relative to the API base URL) and body
+// creating an alert, or closing it by alias for a recovery.
+func opsGenieRequestFor(alert types.Alert, hostname string) (string, interface{}) {
+	alias := incidentKey(hostname, alert)
+	if alert.Resolves {
+		return "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias",
+			opsGenieClose{Source: "storagesentinel", Note: alert.Message}
+	}
+	priority, ok := opsGeniePriority[strings.ToLower(alert.Severity)]
+	if !ok {
+		priority = "P3"
+	}
+	return "/v2/alerts", opsGenieAlert{
+		Message:     truncate(fmt.Sprintf("%s on %s", alert.Subject, alert.SourceID), 130),
+		Alias:       alias,
+		Description: truncate(alert.Message, 15000),
+		Priority:    priority,
+		Source:      "storagesentinel",
+		Entity:      alert.SourceID,
+		Tags:        []string{"storagesentinel", alert.SourceType, strings.ToLower(alert.Severity)},
+		Details: map[string]string{
+			"host":     hostname,
+			"severity": alert.Severity,
+		},
+	}
+}
+
+func (n *Notifier) sendOpsGenie(ctx context.Context, alert types.Alert) error {
+	cfg := n.cfg.OpsGenie
+	if !cfg.Enabled {
+		return fmt.Errorf("opsgenie not configured")
+	}
+	hostname, _ := os.Hostname()
+	path, body := opsGenieRequestFor(alert, hostname)
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+	base := cfg.URL
+	if base == "" {
+		base = defaultOpsGenieURL
+	}
+	return n.postWebhook(ctx, &config.WebhookConfig{
+		URL:     strings.TrimSuffix(base, "/") + path,
+		Headers: map[string]string{"Authorization": "GenieKey " + cfg.APIKey},
+	}, payload)
+}
+
+// truncate shortens s to at most max bytes, respecting the field limits of
+// the incident APIs.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return strings.ToValidUTF8(s[:max-3], "") + "..."
+}
@@ -4,15 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/smtp"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/metabinary-ltd/storagesentinel/internal/alertlog"
 	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/httpclient"
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
 	"github.com/metabinary-ltd/storagesentinel/internal/types"
 )
@@ -22,7 +28,12 @@ type Notifier struct {
 	cfg         config.NotificationsConfig
 	debounce    time.Duration
 	minSeverity string
+	retries     []time.Duration
+	hostID      string
+	version     string
 	lastSent    map[string]time.Time
+	active      map[string]types.Alert // warning/critical conditions from the last Reconcile
+	snoozeSeen  map[string]int64       // snooze end for which a condition's alert was stored
 	mu          sync.Mutex
 	client      *http.Client
 	logger      *slog.Logger
@@ -31,18 +42,35 @@ type Notifier struct {
 }
 
 func New(store *storage.Store, cfg config.NotificationsConfig, debounce time.Duration, minSeverity string, logger *slog.Logger) *Notifier {
+	// notifications.http is checked by config validation; should it still
+	// fail, send without the proxy rather than not at all.
+	client, err := httpclient.New(cfg.HTTP, 10*time.Second)
+	if err != nil {
+		logger.Warn("notification http client: ignoring proxy", "error", err)
+		client, _ = httpclient.New(config.HTTPClientConfig{Timeout: cfg.HTTP.Timeout}, 10*time.Second)
+	}
 	return &Notifier{
 		store:       store,
 		cfg:         cfg,
 		debounce:    debounce,
 		minSeverity: strings.ToLower(minSeverity),
+		retries:     parseRetrySchedule(cfg.RetrySchedule),
 		lastSent:    make(map[string]time.Time),
-		client:      &http.Client{Timeout: 10 * time.Second},
+		active:      make(map[string]types.Alert),
+		snoozeSeen:  make(map[string]int64),
+		client:      client,
 		logger:      logger,
 		stopChan:    make(chan struct{}),
 	}
 }
 
+// SetAgentInfo sets the cloud host ID and agent version reported in
+// enveloped webhook payloads.
+func (n *Notifier) SetAgentInfo(hostID, agentVersion string) {
+	n.hostID = hostID
+	n.version = agentVersion
+}
+
 // Start begins the background worker that processes the notification queue
 func (n *Notifier) Start(ctx context.Context) {
 	n.wg.Add(1)
@@ -56,7 +84,9 @@ func (n *Notifier) Stop() {
 }
 
 // Send queues notifications for all configured channels
-// Callers don't need to know which channels are configured
+// Callers don't need to know which channels are configured. PagerDuty and
+// OpsGenie only get alerts active in the last Reconcile, which resolves
+// their incidents, so health alerts should be reconciled before being sent.
 func (n *Notifier) Send(ctx context.Context, alerts []types.Alert) {
 	for _, alert := range alerts {
 		if !n.allowed(alert.Severity) {
@@ -64,11 +94,18 @@ func (n *Notifier) Send(ctx context.Context, alerts []types.Alert) {
 		}
 
 		// Check debounce
-		key := alert.SourceType + ":" + alert.SourceID + ":" + alert.Subject
+		key := alertKey(alert)
 		if n.isDebounced(key, alert.Timestamp) {
 			continue
 		}
 
+		// A snoozed condition is stored once per snooze; since it is never
+		// marked sent, debounce doesn't stop later evaluations re-storing it.
+		until := n.snoozedUntil(ctx, alert)
+		if until != 0 && n.seenDuringSnooze(key, until) {
+			continue
+		}
+
 		// Store alert first
 		alertID, err := n.store.AddAlert(ctx, storage.Alert{
 			Severity:   alert.Severity,
@@ -82,24 +119,337 @@ func (n *Notifier) Send(ctx context.Context, alerts []types.Alert) {
 			n.logger.Warn("failed to store alert", "error", err)
 			continue
 		}
+		if until != 0 {
+			n.markSnoozeSeen(key, until)
+			continue
+		}
 
-		// Queue for each enabled channel
-		if n.cfg.Email.Enabled {
-			if err := n.store.EnqueueNotification(ctx, alertID, "email"); err != nil {
-				n.logger.Warn("failed to queue email notification", "error", err)
-			}
+		logAlert(alertID, alert)
+		n.enqueue(ctx, alertID, alert.Severity, alert.SourceType, n.tracked(key))
+		n.markSent(key, alert.Timestamp)
+	}
+}
+
+// Submit stores a single alert and queues it for delivery unless it is below
+// the minimum severity or debounced. Unlike Send, the alert is always
+// recorded, so callers get an ID back for externally reported alerts.
+func (n *Notifier) Submit(ctx context.Context, alert types.Alert) (int64, bool, error) {
+	alertID, err := n.store.AddAlert(ctx, storage.Alert{
+		Severity:   alert.Severity,
+		SourceType: alert.SourceType,
+		SourceID:   alert.SourceID,
+		Subject:    alert.Subject,
+		Message:    alert.Message,
+		Timestamp:  alert.Timestamp,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	key := alertKey(alert)
+	if !n.allowed(alert.Severity) || n.isDebounced(key, alert.Timestamp) || n.snoozedUntil(ctx, alert) != 0 {
+		return alertID, false, nil
+	}
+	logAlert(alertID, alert)
+	// Nothing resolves an external alert, so it doesn't page.
+	n.enqueue(ctx, alertID, alert.Severity, alert.SourceType, false)
+	n.markSent(key, alert.Timestamp)
+	return alertID, true, nil
+}
+
+// snoozedUntil returns when the snooze on the alert's condition ends (POST
+// /api/v1/alerts/{id}/snooze), or 0 if it isn't snoozed. A snoozed alert
+// isn't marked sent, so the first occurrence after the snooze ends notifies.
+func (n *Notifier) snoozedUntil(ctx context.Context, alert types.Alert) int64 {
+	until, err := n.store.AlertSnoozedUntil(ctx, alert.SourceType, alert.SourceID, alert.Subject)
+	if err != nil {
+		n.logger.Warn("failed to check alert snooze", "error", err)
+		return 0
+	}
+	if until <= time.Now().Unix() {
+		return 0
+	}
+	n.logger.Debug("alert snoozed; not notifying", "source", alert.SourceID, "subject", alert.Subject, "until", time.Unix(until, 0))
+	return until
+}
+
+// seenDuringSnooze reports whether the condition under key was already
+// stored during the snooze ending at until. Re-snoozing with a new end
+// stores it once more.
+func (n *Notifier) seenDuringSnooze(key string, until int64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.snoozeSeen[key] == until
+}
+
+func (n *Notifier) markSnoozeSeen(key string, until int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.snoozeSeen[key] = until
+}
+
+// SendTest queues an info-level test message on every configured channel,
+// bypassing the severity filter and debounce.
+func (n *Notifier) SendTest(ctx context.Context) error {
+	hostname, _ := os.Hostname()
+	alertID, err := n.store.AddAlert(ctx, storage.Alert{
+		Severity:   "info",
+		SourceType: "agent",
+		SourceID:   hostname,
+		Subject:    "Test notification",
+		Message:    "StorageSentinel notifications are configured correctly.",
+		Timestamp:  time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	// An explicit test should arrive now, not after quiet hours, and on
+	// every standard channel regardless of routes. It would open an incident
+	// nothing ever resolves, so PagerDuty and OpsGenie are left out.
+	n.enqueue(ctx, alertID, "", "", false)
+	return nil
+}
+
+// channel is an enabled notification destination as named in the queue
+// (email, syslog, webhook:<name>, pagerduty, opsgenie) and its min_severity.
+type channel struct {
+	name        string
+	minSeverity string
+}
+
+// channels lists the enabled channels. Incident channels (PagerDuty,
+// OpsGenie) are returned separately: recoveries resolve their incidents
+// rather than being announced.
+func (n *Notifier) channels() (standard, incident []channel) {
+	for _, ch := range n.cfg.Channels() {
+		if ch.Incident {
+			incident = append(incident, channel{ch.Name, ch.MinSeverity})
+		} else {
+			standard = append(standard, channel{ch.Name, ch.MinSeverity})
 		}
+	}
+	return standard, incident
+}
 
-		for _, webhook := range n.cfg.Webhooks {
-			if webhook.URL != "" {
-				if err := n.store.EnqueueNotification(ctx, alertID, "webhook:"+webhook.Name); err != nil {
-					n.logger.Warn("failed to queue webhook notification", "webhook", webhook.Name, "error", err)
-				}
-			}
+// enqueue queues a stored alert for each enabled channel routed for its
+// source type whose min_severity it meets (an empty severity and source
+// type, used for test messages, reach every channel). Incident channels are
+// included only with page, for alerts whose condition Reconcile tracks and
+// so will resolve.
+func (n *Notifier) enqueue(ctx context.Context, alertID int64, severity, sourceType string, page bool) {
+	standard, incident := n.channels()
+	if page {
+		standard = append(standard, incident...)
+	}
+	n.enqueueTo(ctx, alertID, severity, n.route(sourceType, standard))
+}
+
+// tracked reports whether the condition under key is active in the last
+// Reconcile, which will resolve its incident once it clears.
+func (n *Notifier) tracked(key string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.active[key]
+	return ok
+}
+
+// route narrows channels to those listed in notifications.routes for the
+// source type. Source types without a route keep every channel.
+func (n *Notifier) route(sourceType string, channels []channel) []channel {
+	names, ok := n.cfg.Routes[sourceType]
+	if !ok {
+		return channels
+	}
+	return slices.DeleteFunc(channels, func(ch channel) bool { return !slices.Contains(names, ch.name) })
+}
+
+// enqueueTo queues a stored alert for the given channels, skipping those whose
+// min_severity it doesn't meet. During quiet hours, notifications of a muted
+// severity are queued to go out when the window ends.
+func (n *Notifier) enqueueTo(ctx context.Context, alertID int64, severity string, channels []channel) {
+	if len(channels) == 0 {
+		return
+	}
+	notBefore := quietUntil(n.cfg.QuietHours, severity, time.Now())
+	if !notBefore.IsZero() {
+		n.logger.Debug("deferring notification until quiet hours end", "alert_id", alertID, "until", notBefore)
+	}
+	for _, ch := range channels {
+		if severity != "" && !atLeast(severity, ch.minSeverity) {
+			continue
 		}
+		var err error
+		if notBefore.IsZero() {
+			err = n.store.EnqueueNotification(ctx, alertID, ch.name)
+		} else {
+			err = n.store.EnqueueNotificationAfter(ctx, alertID, ch.name, notBefore)
+		}
+		if err != nil {
+			n.logger.Warn("failed to queue notification", "channel", ch.name, "error", err)
+		}
+	}
+}
 
-		n.markSent(key, alert.Timestamp)
+// Reconcile compares the alerts of a full health evaluation with those of the
+// previous one. Warning/critical conditions that are no longer present are
+// marked resolved in the store and, when recovery notifications are enabled,
+// announced with an info-level message through the configured channels.
+func (n *Notifier) Reconcile(ctx context.Context, current []types.Alert) []types.Alert {
+	next := make(map[string]types.Alert)
+	for _, a := range current {
+		if atLeast(a.Severity, "warning") {
+			next[alertKey(a)] = a
+		}
+	}
+
+	n.mu.Lock()
+	var resolved []types.Alert
+	for key, a := range n.active {
+		if _, ok := next[key]; !ok {
+			resolved = append(resolved, a)
+			// A recurrence should notify immediately rather than be debounced
+			delete(n.lastSent, key)
+		}
+	}
+	n.active = next
+	n.mu.Unlock()
+
+	for _, a := range resolved {
+		if _, err := n.store.ResolveAlerts(ctx, a.SourceType, a.SourceID, a.Subject); err != nil {
+			n.logger.Warn("failed to resolve alerts", "source", a.SourceID, "subject", a.Subject, "error", err)
+		}
+		n.logger.Info("alert condition cleared", "source", a.SourceID, "subject", a.Subject)
+		n.sendRecovery(ctx, a, !sourceActive(next, a))
+	}
+	return resolved
+}
+
+// sourceActive reports whether any active alert shares a's source.
+func sourceActive(active map[string]types.Alert, a types.Alert) bool {
+	for _, other := range active {
+		if other.SourceType == a.SourceType && other.SourceID == a.SourceID {
+			return true
+		}
+	}
+	return false
+}
+
+// sendRecovery stores an info-level "resolved" alert and queues it on the
+// standard channels when recovery notifications are enabled, and on the
+// incident channels, to resolve the source's incident, once cleared says
+// nothing else is alerting on that source.
+func (n *Notifier) sendRecovery(ctx context.Context, resolved types.Alert, cleared bool) {
+	standard, incident := n.channels()
+	standard, incident = n.route(resolved.SourceType, standard), n.route(resolved.SourceType, incident)
+	if !n.cfg.RecoveryNotifications {
+		standard = nil
+	}
+	if !cleared {
+		incident = nil
+	}
+	if len(standard) == 0 && len(incident) == 0 {
+		return
+	}
+
+	recovery := types.Alert{
+		Severity:   "info",
+		SourceType: resolved.SourceType,
+		SourceID:   resolved.SourceID,
+		Subject:    "Resolved: " + resolved.Subject,
+		Message:    fmt.Sprintf("%s on %s has cleared (was %s)", resolved.Subject, resolved.SourceID, resolved.Severity),
+		Timestamp:  time.Now().Unix(),
+		Resolves:   true,
+	}
+	alertID, err := n.store.AddAlert(ctx, storage.Alert{
+		Severity:   recovery.Severity,
+		SourceType: recovery.SourceType,
+		SourceID:   recovery.SourceID,
+		Subject:    recovery.Subject,
+		Message:    recovery.Message,
+		Timestamp:  recovery.Timestamp,
+		Resolves:   true,
+	})
+	if err != nil {
+		n.logger.Warn("failed to store recovery alert", "error", err)
+		return
 	}
+	logAlert(alertID, recovery)
+	// Filtered on the original's severity, so a standard channel gets the
+	// recovery exactly when its min_severity and quiet hours let the alert
+	// through. Resolves skip both: they close whatever the trigger opened.
+	n.enqueueTo(ctx, alertID, resolved.Severity, standard)
+	n.enqueueTo(ctx, alertID, "", incident)
+}
+
+// logAlert appends a stored alert to the alert log. Only alerts that get
+// past the severity, debounce and snooze checks are logged, so conditions
+// re-evaluated on every health summary appear once, as they are notified.
+func logAlert(alertID int64, a types.Alert) {
+	alertlog.Write(alertlog.Entry{
+		ID:         alertID,
+		Timestamp:  a.Timestamp,
+		Severity:   a.Severity,
+		SourceType: a.SourceType,
+		SourceID:   a.SourceID,
+		Subject:    a.Subject,
+		Message:    a.Message,
+	})
+}
+
+func alertKey(a types.Alert) string {
+	return a.SourceType + ":" + a.SourceID + ":" + a.Subject
+}
+
+// QueueEntry is a pending notification as exposed for debugging. Subject and
+// LastError are redacted the same way as outbound alerts, and URLs in errors
+// are cut down to their host.
+type QueueEntry struct {
+	ID          int64  `json:"id"`
+	AlertID     int64  `json:"alert_id"`
+	Channel     string `json:"channel"`
+	Severity    string `json:"severity,omitempty"`
+	Subject     string `json:"subject,omitempty"`
+	Attempts    int    `json:"attempts"`
+	CreatedAt   int64  `json:"created_at"`
+	LastAttempt int64  `json:"last_attempt,omitempty"`
+	NextRetry   int64  `json:"next_retry,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// PendingEntries lists up to limit pending notifications, oldest first,
+// including those waiting for a retry or for quiet hours to end.
+func (n *Notifier) PendingEntries(ctx context.Context, limit int) ([]QueueEntry, error) {
+	// A far-future "now" so entries with a later next_retry are included.
+	entries, err := n.store.GetPendingNotifications(ctx, time.Now().AddDate(100, 0, 0), limit)
+	if err != nil {
+		return nil, err
+	}
+	red := n.newRedactor(ctx)
+	out := make([]QueueEntry, 0, len(entries))
+	for _, e := range entries {
+		qe := QueueEntry{
+			ID:          e.ID,
+			AlertID:     e.AlertID,
+			Channel:     e.Channel,
+			Attempts:    e.Attempts,
+			CreatedAt:   e.CreatedAt,
+			LastAttempt: e.LastAttempt.Int64,
+			NextRetry:   e.NextRetry.Int64,
+		}
+		if e.ErrorMessage.Valid {
+			qe.LastError = redactURLs(e.ErrorMessage.String)
+		}
+		if a, err := n.store.GetAlert(ctx, e.AlertID); err == nil && a != nil {
+			qe.Severity = a.Severity
+			qe.Subject = a.Subject
+		}
+		if red != nil {
+			qe.LastError = red.text(qe.LastError)
+			qe.Subject = red.text(qe.Subject)
+		}
+		out = append(out, qe)
+	}
+	return out, nil
 }
 
 // GetUnsentCount returns the number of unsent notifications
@@ -107,9 +457,13 @@ func (n *Notifier) GetUnsentCount(ctx context.Context) (int, error) {
 	return n.store.GetUnsentNotificationCount(ctx)
 }
 
+// atLeast reports whether sev is at or above min. An empty min admits all.
+func atLeast(sev, min string) bool {
+	return config.SeverityRank(sev) >= config.SeverityRank(min)
+}
+
 func (n *Notifier) allowed(sev string) bool {
-	order := map[string]int{"info": 1, "warning": 2, "critical": 3}
-	return order[strings.ToLower(sev)] >= order[n.minSeverity]
+	return atLeast(sev, n.minSeverity)
 }
 
 func (n *Notifier) isDebounced(key string, ts int64) bool {
@@ -148,70 +502,210 @@ func (n *Notifier) processQueue(ctx context.Context) {
 }
 
 func (n *Notifier) processPendingNotifications(ctx context.Context) {
-	entries, err := n.store.GetPendingNotifications(ctx, 50)
+	n.processPendingAt(ctx, time.Now())
+}
+
+func (n *Notifier) processPendingAt(ctx context.Context, now time.Time) {
+	batchSize := n.cfg.QueueBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultQueueBatchSize
+	}
+	workers := n.cfg.QueueConcurrency
+	if workers <= 0 {
+		workers = defaultQueueConcurrency
+	}
+
+	// Deliveries can't be marked sent on a read-only database, so each tick
+	// would send the same entries again.
+	if n.store.ReadOnly() {
+		return
+	}
+	entries, err := n.store.GetPendingNotifications(ctx, now, batchSize)
 	if err != nil {
 		n.logger.Warn("failed to get pending notifications", "error", err)
 		return
 	}
 
-	for _, entry := range entries {
-		alert, err := n.store.GetAlert(ctx, entry.AlertID)
-		if err != nil || alert == nil {
-			n.logger.Warn("failed to get alert for notification", "queue_id", entry.ID, "error", err)
-			continue
-		}
+	redact := n.newRedactor(ctx)
+	var jobs []func()
+	for _, b := range n.planDeliveries(ctx, entries, now) {
+		b := b
+		jobs = append(jobs, func() { n.deliver(ctx, b, redact) })
+	}
 
-		alertType := types.Alert{
-			ID:         alert.ID,
-			Timestamp:  alert.Timestamp,
-			Severity:   alert.Severity,
-			SourceType: alert.SourceType,
-			SourceID:   alert.SourceID,
-			Subject:    alert.Subject,
-			Message:    alert.Message,
-		}
+	// Deliveries are independent (each entry has its own retry state), so a
+	// slow SMTP server only ties up one worker instead of delaying the batch.
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(job func()) {
+			defer func() { <-sem; wg.Done() }()
+			job()
+		}(job)
+	}
+	wg.Wait()
+}
 
-		var sendErr error
-		if strings.HasPrefix(entry.Channel, "webhook:") {
-			webhookName := strings.TrimPrefix(entry.Channel, "webhook:")
-			sendErr = n.sendWebhook(ctx, alertType, webhookName)
-		} else if entry.Channel == "email" {
-			sendErr = n.sendEmail(ctx, alertType)
-		}
+const (
+	defaultQueueBatchSize   = 50
+	defaultQueueConcurrency = 4
+)
+
+// delivery is one outbound message: a single queued alert, or several
+// coalesced into one notification for the same channel.
+type delivery struct {
+	channel string
+	entries []storage.NotificationQueueEntry
+	alerts  []types.Alert
+}
 
+// deliver sends one delivery and records the outcome on every queue entry
+// it covers.
+func (n *Notifier) deliver(ctx context.Context, d delivery, redact *redactor) {
+	alert := d.alerts[0]
+	if len(d.alerts) > 1 {
+		alert = groupAlerts(d.alerts)
+	}
+	alert = redact.alert(alert)
+
+	sendErr := n.sendTo(ctx, d.channel, alert)
+	for _, entry := range d.entries {
 		if sendErr != nil {
-			// Calculate next retry with exponential backoff
-			nextRetry := n.calculateNextRetry(entry.Attempts)
+			// Calculate next retry with exponential backoff, honoring any
+			// server-suggested Retry-After delay
+			var retryAfter time.Duration
+			var rae *retryAfterError
+			if errors.As(sendErr, &rae) {
+				retryAfter = rae.delay
+			}
+			nextRetry := n.calculateNextRetry(entry.Attempts, retryAfter)
 			if err := n.store.MarkNotificationFailed(ctx, entry.ID, sendErr.Error(), nextRetry); err != nil {
 				n.logger.Warn("failed to mark notification as failed", "queue_id", entry.ID, "error", err)
 			}
-			n.logger.Warn("notification send failed", "channel", entry.Channel, "attempts", entry.Attempts, "error", sendErr)
 		} else {
 			if err := n.store.MarkNotificationSent(ctx, entry.ID); err != nil {
 				n.logger.Warn("failed to mark notification as sent", "queue_id", entry.ID, "error", err)
 			}
-			n.logger.Debug("notification sent", "channel", entry.Channel, "alert", alert.Subject)
 		}
 	}
+	if sendErr != nil {
+		n.logger.Warn("notification send failed", "channel", d.channel, "alerts", len(d.alerts), "error", sendErr)
+	} else {
+		n.logger.Debug("notification sent", "channel", d.channel, "alerts", len(d.alerts), "subject", alert.Subject)
+	}
 }
 
-func (n *Notifier) calculateNextRetry(attempts int) time.Time {
-	// Exponential backoff: 1min, 5min, 15min, 1hr, 6hr, 24hr
-	backoffs := []time.Duration{
-		1 * time.Minute,
-		5 * time.Minute,
-		15 * time.Minute,
-		1 * time.Hour,
-		6 * time.Hour,
-		24 * time.Hour,
+// sendTo sends an alert to a single channel by its queue name.
+func (n *Notifier) sendTo(ctx context.Context, channel string, alert types.Alert) error {
+	switch {
+	case strings.HasPrefix(channel, "webhook:"):
+		return n.sendWebhook(ctx, alert, strings.TrimPrefix(channel, "webhook:"))
+	case channel == "email":
+		return n.sendEmail(ctx, alert)
+	case channel == "syslog":
+		return n.sendSyslog(ctx, alert)
+	case channel == "pagerduty":
+		return n.sendPagerDuty(ctx, alert)
+	case channel == "opsgenie":
+		return n.sendOpsGenie(ctx, alert)
 	}
-	
+	return nil
+}
+
+// SendDirect sends an alert straight to every routed channel whose
+// min_severity it meets, bypassing the database: it is neither stored nor
+// queued, and a failed send is logged but not retried. It is meant for
+// alerts about the database itself, which the queue cannot carry. Nothing
+// resolves such an alert, so it doesn't page.
+func (n *Notifier) SendDirect(ctx context.Context, alert types.Alert) {
+	if !n.allowed(alert.Severity) {
+		return
+	}
+	alert = n.newRedactor(ctx).alert(alert)
+	standard, _ := n.channels()
+	for _, ch := range n.route(alert.SourceType, standard) {
+		if !atLeast(alert.Severity, ch.minSeverity) {
+			continue
+		}
+		if err := n.sendTo(ctx, ch.name, alert); err != nil {
+			n.logger.Warn("direct notification failed", "channel", ch.name, "error", err)
+		}
+	}
+}
+
+// defaultRetrySchedule is the exponential backoff used when
+// notifications.retry_schedule is unset: 1min, 5min, 15min, 1hr, 6hr, 24hr.
+var defaultRetrySchedule = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	1 * time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// parseRetrySchedule converts the configured retry delays, falling back to
+// defaultRetrySchedule when none are set. Entries were checked by config
+// validation; any that still fail to parse are skipped.
+func parseRetrySchedule(steps []string) []time.Duration {
+	var out []time.Duration
+	for _, step := range steps {
+		if d, err := time.ParseDuration(step); err == nil && d > 0 {
+			out = append(out, d)
+		}
+	}
+	if len(out) == 0 {
+		return defaultRetrySchedule
+	}
+	return out
+}
+
+func (n *Notifier) calculateNextRetry(attempts int, retryAfter time.Duration) time.Time {
+	backoffs := n.retries
 	idx := attempts
 	if idx >= len(backoffs) {
 		idx = len(backoffs) - 1
 	}
-	
-	return time.Now().Add(backoffs[idx])
+
+	delay := backoffs[idx]
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return time.Now().Add(delay)
+}
+
+// retryAfterError wraps a send failure for which the remote end suggested a
+// minimum delay before the next attempt.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// parseRetryAfter parses a Retry-After header given either as delay seconds
+// or as an HTTP-date. It returns 0 when the header is absent or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
 }
 
 func (n *Notifier) sendEmail(ctx context.Context, alert types.Alert) error {
@@ -263,28 +757,76 @@ Timestamp: %s
 }
 
 func (n *Notifier) sendWebhook(ctx context.Context, alert types.Alert, webhookName string) error {
-	var webhookURL string
-	for _, w := range n.cfg.Webhooks {
+	var webhook *config.WebhookConfig
+	for i, w := range n.cfg.Webhooks {
 		if w.Name == webhookName && w.URL != "" {
-			webhookURL = w.URL
+			webhook = &n.cfg.Webhooks[i]
 			break
 		}
 	}
 
-	if webhookURL == "" {
+	if webhook == nil {
 		return fmt.Errorf("webhook not found: %s", webhookName)
 	}
 
-	payload, err := json.Marshal(alert)
+	var body interface{} = alert
+	if webhook.Envelope {
+		body = n.envelope(alert, time.Now())
+	}
+	payload, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("marshal alert: %w", err)
 	}
+	return n.postWebhook(ctx, webhook, payload)
+}
+
+// webhookEnvelope wraps an alert with the context a receiver needs to route
+// it without knowing which agent sent it.
+type webhookEnvelope struct {
+	Event        string      `json:"event"` // alert.triggered, alert.resolved, alert.batch or alert.test
+	Host         string      `json:"host"`
+	HostID       string      `json:"host_id,omitempty"`
+	AgentVersion string      `json:"agent_version,omitempty"`
+	Timestamp    int64       `json:"timestamp"`
+	Alert        types.Alert `json:"alert"`
+}
+
+func (n *Notifier) envelope(alert types.Alert, now time.Time) webhookEnvelope {
+	hostname, _ := os.Hostname()
+	event := "alert.triggered"
+	switch {
+	case alert.SourceType == "group":
+		event = "alert.batch"
+	case alert.SourceType == "agent" && alert.Subject == "Test notification":
+		event = "alert.test"
+	case alert.Resolves:
+		event = "alert.resolved"
+	}
+	return webhookEnvelope{
+		Event:        event,
+		Host:         hostname,
+		HostID:       n.hostID,
+		AgentVersion: n.version,
+		Timestamp:    now.Unix(),
+		Alert:        alert,
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+// postWebhook sends a JSON payload to a webhook using its configured method
+// and headers.
+func (n *Notifier) postWebhook(ctx context.Context, webhook *config.WebhookConfig, payload []byte) error {
+	method := http.MethodPost
+	if webhook.Method != "" {
+		method = strings.ToUpper(webhook.Method)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, webhook.URL, bytes.NewReader(payload))
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	for k, v := range webhook.Headers {
+		req.Header.Set(k, v)
+	}
 
 	resp, err := n.client.Do(req)
 	if err != nil {
@@ -293,7 +835,13 @@ func (n *Notifier) sendWebhook(ctx context.Context, alert types.Alert, webhookNa
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		err := fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			if delay := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); delay > 0 {
+				return &retryAfterError{err: err, delay: delay}
+			}
+		}
+		return err
 	}
 
 	return nil
@@ -0,0 +1,900 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/alertlog"
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+func openTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	store, err := storage.Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestWebhookRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7200")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	cfg := config.NotificationsConfig{Webhooks: []config.WebhookConfig{{Name: "hook", URL: srv.URL}}}
+	n := New(nil, cfg, time.Hour, "warning", slog.Default())
+
+	err := n.sendWebhook(context.Background(), types.Alert{Severity: "critical", Subject: "test"}, "hook")
+	var rae *retryAfterError
+	if !errors.As(err, &rae) {
+		t.Fatalf("expected retry-after error, got %v", err)
+	}
+	if rae.delay != 2*time.Hour {
+		t.Fatalf("expected 2h delay, got %v", rae.delay)
+	}
+
+	// Retry-After longer than the first backoff step wins...
+	next := n.calculateNextRetry(0, rae.delay)
+	if d := time.Until(next); d < 119*time.Minute {
+		t.Fatalf("expected retry-after to be honored, next retry in %v", d)
+	}
+	// ...but never shortens the computed backoff.
+	next = n.calculateNextRetry(5, time.Minute)
+	if d := time.Until(next); d < 23*time.Hour {
+		t.Fatalf("expected computed backoff to be kept, next retry in %v", d)
+	}
+}
+
+func TestParseRetryAfterHTTPDate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	got := parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now)
+	if got != 90*time.Second {
+		t.Fatalf("expected 90s, got %v", got)
+	}
+	if got := parseRetryAfter("garbage", now); got != 0 {
+		t.Fatalf("expected 0 for invalid header, got %v", got)
+	}
+}
+
+func TestRecoveryNotification(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	cfg := config.NotificationsConfig{
+		Webhooks:              []config.WebhookConfig{{Name: "hook", URL: "http://127.0.0.1:1/"}},
+		RecoveryNotifications: true,
+	}
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+
+	alert := types.Alert{Timestamp: time.Now().Unix(), Severity: "critical", SourceType: "pool", SourceID: "tank", Subject: "Pool not healthy", Message: "ZFS pool state: DEGRADED"}
+	n.Send(ctx, []types.Alert{alert})
+	if resolved := n.Reconcile(ctx, []types.Alert{alert}); len(resolved) != 0 {
+		t.Fatalf("expected nothing resolved while alert is active, got %+v", resolved)
+	}
+
+	before, _ := store.GetUnsentNotificationCount(ctx)
+	if resolved := n.Reconcile(ctx, nil); len(resolved) != 1 {
+		t.Fatalf("expected one resolved alert, got %+v", resolved)
+	}
+	if resolved := n.Reconcile(ctx, nil); len(resolved) != 0 {
+		t.Fatalf("expected recovery to be reported once, got %+v", resolved)
+	}
+
+	after, _ := store.GetUnsentNotificationCount(ctx)
+	if after-before != 1 {
+		t.Fatalf("expected exactly one recovery notification queued, got %d", after-before)
+	}
+	alerts, err := store.RecentAlerts(ctx, 10)
+	if err != nil {
+		t.Fatalf("recent alerts: %v", err)
+	}
+	var sawRecovery, sawResolved bool
+	for _, a := range alerts {
+		if a.Subject == "Resolved: Pool not healthy" && a.Severity == "info" {
+			sawRecovery = true
+		}
+		if a.Subject == "Pool not healthy" && a.ResolvedAt > 0 {
+			sawResolved = true
+		}
+	}
+	if !sawRecovery || !sawResolved {
+		t.Fatalf("expected recovery alert and resolved original, got %+v", alerts)
+	}
+}
+
+func TestRecoveryReachesChannelsThatSawOriginal(t *testing.T) {
+	hits := map[string][]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		hits[r.URL.Path] = append(hits[r.URL.Path], fmt.Sprint(p["subject"]))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := config.NotificationsConfig{
+		Webhooks: []config.WebhookConfig{
+			{Name: "ops", URL: srv.URL + "/ops", MinSeverity: "critical"},
+			{Name: "pager", URL: srv.URL + "/pager", MinSeverity: "emergency"},
+		},
+		RecoveryNotifications: true,
+		QueueConcurrency:      1,
+	}
+	store := openTestStore(t)
+	ctx := context.Background()
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+
+	alert := types.Alert{Timestamp: time.Now().Unix(), Severity: "critical", SourceType: "disk", SourceID: "sda", Subject: "SMART FAILED", Message: "m"}
+	n.Send(ctx, []types.Alert{alert})
+	n.Reconcile(ctx, []types.Alert{alert})
+	n.Reconcile(ctx, nil)
+	n.processPendingAt(ctx, time.Now())
+
+	if got := fmt.Sprint(hits["/ops"]); got != "[SMART FAILED Resolved: SMART FAILED]" {
+		t.Fatalf("ops webhook got %s, want the alert and its recovery", got)
+	}
+	if got := hits["/pager"]; len(got) != 0 {
+		t.Fatalf("pager webhook got %v, want neither", got)
+	}
+}
+
+func TestWebhookRedactsSerials(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := openTestStore(t)
+	ctx := context.Background()
+	const serial = "WD-WCC7K1234567"
+	diskID := "/dev/disk/by-id/ata-WDC_WD40EFRX_" + serial
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: diskID, Name: "/dev/sda", Type: "hdd", Serial: serial}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	cfg := config.NotificationsConfig{
+		Webhooks:  []config.WebhookConfig{{Name: "hook", URL: srv.URL}},
+		Redaction: config.RedactionConfig{Serials: "hash", ByIDPaths: true},
+	}
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+	n.Send(ctx, []types.Alert{{
+		Timestamp:  time.Now().Unix(),
+		Severity:   "critical",
+		SourceType: "disk",
+		SourceID:   diskID,
+		Subject:    "SMART failed",
+		Message:    "Drive " + serial + " reports FAILED",
+	}})
+	n.processPendingNotifications(ctx)
+
+	if body == "" {
+		t.Fatalf("expected webhook to be called")
+	}
+	if strings.Contains(body, serial) || strings.Contains(body, "WDC_WD40EFRX") {
+		t.Fatalf("expected serial and by-id name to be redacted, got %s", body)
+	}
+	if !strings.Contains(body, "/dev/disk/by-id/sn-") {
+		t.Fatalf("expected hashed by-id path, got %s", body)
+	}
+
+	stored, err := store.RecentAlerts(ctx, 1)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("recent alerts: %v %+v", err, stored)
+	}
+	if stored[0].SourceID != diskID || !strings.Contains(stored[0].Message, serial) {
+		t.Fatalf("expected stored alert to keep identifiers, got %+v", stored[0])
+	}
+}
+
+func TestConcurrentQueueProcessing(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	run := func(concurrency int) time.Duration {
+		store := openTestStore(t)
+		ctx := context.Background()
+		cfg := config.NotificationsConfig{
+			Webhooks:         []config.WebhookConfig{{Name: "hook", URL: srv.URL}},
+			QueueConcurrency: concurrency,
+		}
+		n := New(store, cfg, time.Hour, "warning", slog.Default())
+		for i := 0; i < 8; i++ {
+			n.Send(ctx, []types.Alert{{Timestamp: time.Now().Unix(), Severity: "critical", SourceType: "disk", SourceID: fmt.Sprintf("sd%c", 'a'+i), Subject: "slow"}})
+		}
+		start := time.Now()
+		n.processPendingNotifications(ctx)
+		elapsed := time.Since(start)
+		if left, _ := store.GetUnsentNotificationCount(ctx); left != 0 {
+			t.Fatalf("concurrency %d: expected queue drained, %d left", concurrency, left)
+		}
+		return elapsed
+	}
+
+	sequential := run(1)
+	concurrent := run(4)
+	if sequential < 8*delay {
+		t.Fatalf("expected sequential run to take at least %v, took %v", 8*delay, sequential)
+	}
+	if concurrent >= sequential/2 {
+		t.Fatalf("expected concurrent sends to be faster: concurrent %v, sequential %v", concurrent, sequential)
+	}
+}
+
+func TestWebhookCustomHeadersAndMethod(t *testing.T) {
+	var gotMethod, gotKey, gotType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotKey = r.Header.Get("X-Routing-Key")
+		gotType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := config.NotificationsConfig{Webhooks: []config.WebhookConfig{{
+		Name:    "pd",
+		URL:     srv.URL,
+		Method:  "put",
+		Headers: map[string]string{"X-Routing-Key": "abc123"},
+	}}}
+	n := New(nil, cfg, time.Hour, "warning", slog.Default())
+	if err := n.sendWebhook(context.Background(), types.Alert{Severity: "critical", Subject: "test"}, "pd"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if gotMethod != http.MethodPut || gotKey != "abc123" || gotType != "application/json" {
+		t.Fatalf("unexpected request: method %s key %q content-type %q", gotMethod, gotKey, gotType)
+	}
+}
+
+func TestBatchWindowCoalescesAlerts(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := openTestStore(t)
+	ctx := context.Background()
+	cfg := config.NotificationsConfig{
+		Webhooks:         []config.WebhookConfig{{Name: "hook", URL: srv.URL}},
+		QueueConcurrency: 1,
+		BatchWindow:      time.Minute,
+	}
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+	for _, disk := range []string{"sda", "sdb", "sdc"} {
+		n.Send(ctx, []types.Alert{{Timestamp: time.Now().Unix(), Severity: "warning", SourceType: "disk", SourceID: disk, Subject: "Pending sectors", Message: "Drive has pending sectors"}})
+	}
+
+	// Inside the window nothing goes out yet.
+	n.processPendingAt(ctx, time.Now())
+	if len(bodies) != 0 {
+		t.Fatalf("expected alerts to be held during the window, got %d sends", len(bodies))
+	}
+
+	n.processPendingAt(ctx, time.Now().Add(2*time.Minute))
+	if len(bodies) != 1 {
+		t.Fatalf("expected one grouped send, got %d", len(bodies))
+	}
+	var grouped types.Alert
+	if err := json.Unmarshal([]byte(bodies[0]), &grouped); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if grouped.Subject != "3 storage alerts" || grouped.Severity != "warning" {
+		t.Fatalf("unexpected grouped alert: %+v", grouped)
+	}
+	for _, disk := range []string{"sda", "sdb", "sdc"} {
+		if !strings.Contains(grouped.Message, disk) {
+			t.Fatalf("expected %s in grouped message: %s", disk, grouped.Message)
+		}
+	}
+	if left, _ := store.GetUnsentNotificationCount(ctx); left != 0 {
+		t.Fatalf("expected all grouped entries marked sent, %d left", left)
+	}
+}
+
+func TestSyslogChannelEmitsRFC5424(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	cfg := config.NotificationsConfig{Syslog: config.SyslogConfig{
+		Enabled:  true,
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Facility: "local0",
+		Format:   "rfc5424",
+		AppName:  "sentinel",
+	}}
+	n := New(nil, cfg, time.Hour, "warning", slog.Default())
+	alert := types.Alert{Severity: "critical", SourceType: "disk", SourceID: "sda", Subject: "SMART failed", Message: "health check failed"}
+	if err := n.sendSyslog(context.Background(), alert); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	nr, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	line := string(buf[:nr])
+	// local0 (16) * 8 + critical (2)
+	if !strings.HasPrefix(line, "<130>1 ") {
+		t.Fatalf("unexpected PRI/version: %q", line)
+	}
+	if !strings.Contains(line, " sentinel ") || !strings.HasSuffix(line, "[CRITICAL] disk sda: SMART failed - health check failed") {
+		t.Fatalf("unexpected syslog line: %q", line)
+	}
+
+	cef := formatSyslog(config.SyslogConfig{Facility: "daemon", Format: "cef"}, alert, "host", time.Unix(0, 0))
+	if !strings.Contains(cef, "CEF:0|Metabinary|StorageSentinel|1.0|disk:smart_failed|SMART failed|10|") {
+		t.Fatalf("unexpected CEF body: %q", cef)
+	}
+}
+
+func TestTransitionWebhookFiresOnlyOnChange(t *testing.T) {
+	var bodies []transitionPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p transitionPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		bodies = append(bodies, p)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := openTestStore(t)
+	cfg := config.NotificationsConfig{TransitionWebhook: config.WebhookConfig{Name: "state", URL: srv.URL}}
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if fired, err := n.ObserveStatus(ctx, types.HealthReport{Status: "ok"}); err != nil || fired {
+			t.Fatalf("cycle %d: expected no transition for steady ok, fired=%v err=%v", i, fired, err)
+		}
+	}
+	if fired, err := n.ObserveStatus(ctx, types.HealthReport{Status: "warning", StatusReasons: []string{"High temperature"}}); err != nil || !fired {
+		t.Fatalf("expected ok->warning to fire, fired=%v err=%v", fired, err)
+	}
+	if fired, _ := n.ObserveStatus(ctx, types.HealthReport{Status: "warning"}); fired {
+		t.Fatal("expected repeated warning not to fire")
+	}
+
+	if len(bodies) != 1 {
+		t.Fatalf("expected exactly one webhook call, got %d", len(bodies))
+	}
+	if b := bodies[0]; b.PreviousStatus != "ok" || b.Status != "warning" || len(b.Reasons) != 1 {
+		t.Fatalf("unexpected transition payload: %+v", b)
+	}
+}
+
+func TestTransitionWebhookRedactsReasons(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := openTestStore(t)
+	ctx := context.Background()
+	const serial = "WD-WCC7K1234567"
+	diskID := "/dev/disk/by-id/ata-WDC_WD40EFRX_" + serial
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: diskID, Name: "/dev/sda", Type: "hdd", Serial: serial}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	cfg := config.NotificationsConfig{
+		TransitionWebhook: config.WebhookConfig{Name: "state", URL: srv.URL},
+		Redaction:         config.RedactionConfig{Serials: "hash", ByIDPaths: true},
+	}
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+
+	if _, err := n.ObserveStatus(ctx, types.HealthReport{Status: "ok"}); err != nil {
+		t.Fatalf("observe ok: %v", err)
+	}
+	reason := "critical disk " + diskID + ": Drive " + serial + " reports FAILED"
+	if fired, err := n.ObserveStatus(ctx, types.HealthReport{Status: "critical", StatusReasons: []string{reason}}); err != nil || !fired {
+		t.Fatalf("expected ok->critical to fire, fired=%v err=%v", fired, err)
+	}
+	if strings.Contains(body, serial) || strings.Contains(body, "WDC_WD40EFRX") {
+		t.Fatalf("expected serial and by-id name to be redacted, got %s", body)
+	}
+	if !strings.Contains(body, "/dev/disk/by-id/sn-") {
+		t.Fatalf("expected hashed by-id path, got %s", body)
+	}
+}
+
+func TestQuietHoursDeferNonCritical(t *testing.T) {
+	var subjects []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		subjects = append(subjects, fmt.Sprint(p["subject"]))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// A two-hour window centred on now, in UTC.
+	now := time.Now().UTC()
+	cfg := config.NotificationsConfig{
+		Webhooks:         []config.WebhookConfig{{Name: "hook", URL: srv.URL}},
+		QueueConcurrency: 1,
+		QuietHours: config.QuietHoursConfig{
+			Enabled:    true,
+			Start:      now.Add(-time.Hour).Format("15:04"),
+			End:        now.Add(time.Hour).Format("15:04"),
+			Timezone:   "UTC",
+			Severities: []string{"info", "warning"},
+		},
+	}
+	store := openTestStore(t)
+	ctx := context.Background()
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+	n.Send(ctx, []types.Alert{
+		{Timestamp: now.Unix(), Severity: "warning", SourceType: "disk", SourceID: "sda", Subject: "Pending sectors", Message: "m"},
+		{Timestamp: now.Unix(), Severity: "critical", SourceType: "disk", SourceID: "sdb", Subject: "SMART FAILED", Message: "m"},
+	})
+
+	// The warning is recorded straight away even though its page waits.
+	if stored, _ := store.ListAlerts(ctx, storage.AlertFilter{}); len(stored) != 2 {
+		t.Fatalf("expected both alerts stored, got %d", len(stored))
+	}
+
+	// The queue stores whole seconds; process as of after the enqueue, not
+	// the possibly earlier second captured above.
+	n.processPendingAt(ctx, time.Now())
+	if fmt.Sprint(subjects) != "[SMART FAILED]" {
+		t.Fatalf("expected only the critical during quiet hours, got %v", subjects)
+	}
+
+	n.processPendingAt(ctx, now.Add(90*time.Minute))
+	if fmt.Sprint(subjects) != "[SMART FAILED Pending sectors]" {
+		t.Fatalf("expected the warning once quiet hours end, got %v", subjects)
+	}
+}
+
+func TestQuietUntilWrapsMidnight(t *testing.T) {
+	cfg := config.QuietHoursConfig{Enabled: true, Start: "22:00", End: "07:00", Timezone: "UTC", Severities: []string{"warning"}}
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 9, h, m, 0, 0, time.UTC) }
+
+	if got := quietUntil(cfg, "warning", at(23, 30)); !got.Equal(time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("23:30: expected next-day 07:00, got %v", got)
+	}
+	if got := quietUntil(cfg, "warning", at(3, 0)); !got.Equal(at(7, 0)) {
+		t.Fatalf("03:00: expected same-day 07:00, got %v", got)
+	}
+	if got := quietUntil(cfg, "warning", at(12, 0)); !got.IsZero() {
+		t.Fatalf("12:00: expected no deferral, got %v", got)
+	}
+	if got := quietUntil(cfg, "info", at(23, 30)); !got.IsZero() {
+		t.Fatalf("info not in severities: expected no deferral, got %v", got)
+	}
+}
+
+func TestEmergencyOutranksCriticalInRouting(t *testing.T) {
+	hits := map[string][]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		hits[r.URL.Path] = append(hits[r.URL.Path], fmt.Sprint(p["subject"]))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := config.NotificationsConfig{
+		Webhooks: []config.WebhookConfig{
+			{Name: "ops", URL: srv.URL + "/ops"},
+			{Name: "pager", URL: srv.URL + "/pager", MinSeverity: "emergency"},
+		},
+		QueueConcurrency: 1,
+	}
+	store := openTestStore(t)
+	ctx := context.Background()
+	// A global floor of critical still lets emergency through.
+	n := New(store, cfg, time.Hour, "critical", slog.Default())
+	now := time.Now().Unix()
+	n.Send(ctx, []types.Alert{
+		{Timestamp: now, Severity: "critical", SourceType: "disk", SourceID: "sda", Subject: "SMART FAILED", Message: "m"},
+		{Timestamp: now, Severity: "emergency", SourceType: "pool", SourceID: "tank", Subject: "Pool not healthy", Message: "ZFS pool state: SUSPENDED"},
+	})
+	n.processPendingAt(ctx, time.Now())
+
+	if got := fmt.Sprint(hits["/ops"]); got != "[SMART FAILED Pool not healthy]" {
+		t.Fatalf("ops webhook got %s, want both alerts", got)
+	}
+	if got := fmt.Sprint(hits["/pager"]); got != "[Pool not healthy]" {
+		t.Fatalf("pager webhook got %s, want only the emergency", got)
+	}
+	if !atLeast("emergency", "critical") || atLeast("critical", "emergency") {
+		t.Fatal("expected emergency to outrank critical")
+	}
+}
+
+func TestCustomRetrySchedule(t *testing.T) {
+	cfg := config.NotificationsConfig{RetrySchedule: []string{"30s", "2m"}}
+	n := New(nil, cfg, time.Hour, "warning", slog.Default())
+
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 2 * time.Minute},
+		{7, 2 * time.Minute}, // the last step is the ceiling
+	} {
+		d := time.Until(n.calculateNextRetry(tc.attempts, 0))
+		if d < tc.want-time.Second || d > tc.want {
+			t.Fatalf("attempt %d: next retry in %v, want %v", tc.attempts, d, tc.want)
+		}
+	}
+
+	// Unset falls back to the built-in schedule.
+	n = New(nil, config.NotificationsConfig{}, time.Hour, "warning", slog.Default())
+	if d := time.Until(n.calculateNextRetry(0, 0)); d < 59*time.Second || d > time.Minute {
+		t.Fatalf("expected default first retry of 1m, got %v", d)
+	}
+}
+
+func TestWebhookEnvelope(t *testing.T) {
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		bodies = append(bodies, p)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := config.NotificationsConfig{Webhooks: []config.WebhookConfig{
+		{Name: "wrapped", URL: srv.URL, Envelope: true},
+		{Name: "flat", URL: srv.URL},
+	}}
+	n := New(nil, cfg, time.Hour, "warning", slog.Default())
+	n.SetAgentInfo("host-123", "1.4.0")
+	alert := types.Alert{Timestamp: 1700000000, Severity: "critical", SourceType: "disk", SourceID: "sda", Subject: "SMART FAILED", Message: "m"}
+	for _, name := range []string{"wrapped", "flat"} {
+		if err := n.sendWebhook(context.Background(), alert, name); err != nil {
+			t.Fatalf("send %s: %v", name, err)
+		}
+	}
+
+	wrapped := bodies[0]
+	hostname, _ := os.Hostname()
+	if wrapped["event"] != "alert.triggered" || wrapped["host"] != hostname || wrapped["host_id"] != "host-123" || wrapped["agent_version"] != "1.4.0" {
+		t.Fatalf("unexpected envelope: %v", wrapped)
+	}
+	if ts, _ := wrapped["timestamp"].(float64); ts == 0 {
+		t.Fatalf("expected envelope timestamp, got %v", wrapped["timestamp"])
+	}
+	inner, ok := wrapped["alert"].(map[string]interface{})
+	if !ok || inner["subject"] != "SMART FAILED" || inner["source_id"] != "sda" {
+		t.Fatalf("expected the alert nested under \"alert\", got %v", wrapped["alert"])
+	}
+
+	// Legacy receivers keep the flat alert.
+	if flat := bodies[1]; flat["subject"] != "SMART FAILED" || flat["event"] != nil {
+		t.Fatalf("expected a flat alert payload, got %v", flat)
+	}
+}
+
+func TestPagerDutyTriggerAndResolve(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []pagerDutyEvent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev pagerDutyEvent
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	store := openTestStore(t)
+	ctx := context.Background()
+	cfg := config.NotificationsConfig{PagerDuty: config.PagerDutyConfig{Enabled: true, RoutingKey: "R0UT1NGKEY", URL: srv.URL}}
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+
+	temp := types.Alert{Timestamp: time.Now().Unix(), Severity: "critical", SourceType: "disk", SourceID: "ata-A", Subject: "Critical temperature", Message: "Temperature 72C"}
+	crc := types.Alert{Timestamp: time.Now().Unix(), Severity: "warning", SourceType: "disk", SourceID: "ata-A", Subject: "CRC errors increasing", Message: "UDMA CRC errors grew by 4"}
+	n.Reconcile(ctx, []types.Alert{temp, crc})
+	n.Send(ctx, []types.Alert{temp, crc})
+	// The temperature clears but the disk is still alerting: no resolve yet.
+	n.Reconcile(ctx, []types.Alert{crc})
+	n.processPendingAt(ctx, time.Now())
+	if len(events) != 2 {
+		t.Fatalf("expected two trigger events, got %+v", events)
+	}
+	hostname, _ := os.Hostname()
+	wantKey := "storagesentinel:" + hostname + ":disk:ata-A"
+	for _, ev := range events {
+		if ev.EventAction != "trigger" || ev.RoutingKey != "R0UT1NGKEY" || ev.DedupKey != wantKey || ev.Payload == nil {
+			t.Fatalf("unexpected trigger event %+v", ev)
+		}
+	}
+	var p *pagerDutyPayload
+	for _, ev := range events {
+		if ev.Payload.Class == "Critical temperature" {
+			p = ev.Payload
+		}
+	}
+	if p == nil || p.Severity != "critical" || p.Component != "ata-A" || p.Group != "disk" || !strings.Contains(p.Summary, "Temperature 72C") {
+		t.Fatalf("unexpected trigger payloads %+v", events)
+	}
+
+	// Recovery notifications are off, but the incident is still resolved.
+	events = nil
+	n.Reconcile(ctx, nil)
+	n.processPendingAt(ctx, time.Now())
+	if len(events) != 1 || events[0].EventAction != "resolve" || events[0].DedupKey != wantKey || events[0].Payload != nil {
+		t.Fatalf("expected one resolve event for the disk, got %+v", events)
+	}
+}
+
+func TestOnlyTrackedAlertsPage(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	cfg := config.NotificationsConfig{
+		Syslog:    config.SyslogConfig{Enabled: true},
+		PagerDuty: config.PagerDutyConfig{Enabled: true, RoutingKey: "R0UT1NGKEY", URL: "http://127.0.0.1:1/"},
+		OpsGenie:  config.OpsGenieConfig{Enabled: true, APIKey: "k3y", URL: "http://127.0.0.1:1/"},
+	}
+	n := New(store, cfg, time.Hour, "warning", slog.Default())
+	channels := func() []string {
+		t.Helper()
+		entries, err := store.GetPendingNotifications(ctx, time.Now(), 100)
+		if err != nil {
+			t.Fatalf("pending notifications: %v", err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Channel)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	// Nothing resolves a test message or an untracked alert, so neither pages.
+	if err := n.SendTest(ctx); err != nil {
+		t.Fatalf("send test: %v", err)
+	}
+	n.Send(ctx, []types.Alert{{Timestamp: time.Now().Unix(), Severity: "warning", SourceType: "disk", SourceID: "ata-A", Subject: "Scheduled long SMART test suspended", Message: "m"}})
+	if got := fmt.Sprint(channels()); got != "[syslog syslog]" {
+		t.Fatalf("expected only syslog entries, got %s", got)
+	}
+
+	// A reconciled health alert pages.
+	alert := types.Alert{Timestamp: time.Now().Unix(), Severity: "critical", SourceType: "disk", SourceID: "ata-A", Subject: "SMART FAILED", Message: "m"}
+	n.Reconcile(ctx, []types.Alert{alert})
+	n.Send(ctx, []types.Alert{alert})
+	if got := fmt.Sprint(channels()); got != "[opsgenie pagerduty syslog syslog syslog]" {
+		t.Fatalf("expected the tracked alert on every channel, got %s", got)
+	}
+}
+
+func TestResolveNeedsRecoveryFlag(t *testing.T) {
+	cfg := config.PagerDutyConfig{Enabled: true, RoutingKey: "R0UT1NGKEY"}
+	// An external alert whose subject merely reads like a recovery still triggers.
+	external := types.Alert{Severity: "warning", SourceType: "external", SourceID: "ticket-42", Subject: "Resolved: backup ran late", Message: "m"}
+	if ev := pagerDutyEventFor(cfg, external, "host"); ev.EventAction != "trigger" {
+		t.Fatalf("expected trigger for a plain alert, got %+v", ev)
+	}
+	external.Resolves = true
+	if ev := pagerDutyEventFor(cfg, external, "host"); ev.EventAction != "resolve" {
+		t.Fatalf("expected resolve for a recovery, got %+v", ev)
+	}
+}
+
+func TestOpsGenieCreateAndClosePayloads(t *testing.T) {
+	type request struct {
+		path, auth string
+		body       map[string]interface{}
+	}
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, request{r.URL.RequestURI(), r.Header.Get("Authorization"), body})
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	n := New(nil, config.NotificationsConfig{OpsGenie: config.OpsGenieConfig{Enabled: true, APIKey: "k3y", URL: srv.URL}}, time.Hour, "warning", slog.Default())
+	ctx := context.Background()
+	alert := types.Alert{Timestamp: time.Now().Unix(), Severity: "emergency", SourceType: "pool", SourceID: "tank", Subject: "Pool not healthy", Message: "ZFS pool state: SUSPENDED"}
+	if err := n.sendOpsGenie(ctx, alert); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	resolved := types.Alert{Severity: "info", SourceType: "pool", SourceID: "tank", Subject: "Resolved: Pool not healthy", Message: "Pool not healthy on tank has cleared (was emergency)", Resolves: true}
+	if err := n.sendOpsGenie(ctx, resolved); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	alias := "storagesentinel:" + hostname + ":pool:tank"
+	if len(requests) != 2 {
+		t.Fatalf("expected two requests, got %+v", requests)
+	}
+	create := requests[0]
+	if create.path != "/v2/alerts" || create.auth != "GenieKey k3y" {
+		t.Fatalf("unexpected create request %s (auth %q)", create.path, create.auth)
+	}
+	if create.body["alias"] != alias || create.body["priority"] != "P1" || create.body["message"] != "Pool not healthy on tank" || create.body["entity"] != "tank" {
+		t.Fatalf("unexpected create body %+v", create.body)
+	}
+	closeReq := requests[1]
+	if want := "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias"; closeReq.path != want {
+		t.Fatalf("close path = %s, want %s", closeReq.path, want)
+	}
+	if closeReq.body["source"] != "storagesentinel" || closeReq.body["note"] != resolved.Message {
+		t.Fatalf("unexpected close body %+v", closeReq.body)
+	}
+}
+
+func TestRoutesBySourceType(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	cfg := config.NotificationsConfig{
+		Syslog: config.SyslogConfig{Enabled: true},
+		Webhooks: []config.WebhookConfig{
+			{Name: "storage", URL: "http://storage.invalid/hook"},
+			{Name: "hardware", URL: "http://hardware.invalid/hook"},
+		},
+		Routes: map[string][]string{
+			"pool": {"webhook:storage"},
+			"disk": {"webhook:hardware", "syslog"},
+		},
+	}
+	n := New(store, cfg, time.Hour, "info", slog.Default())
+
+	now := time.Now().Unix()
+	n.Send(ctx, []types.Alert{
+		{Timestamp: now, Severity: "critical", SourceType: "pool", SourceID: "tank", Subject: "Pool not healthy", Message: "DEGRADED"},
+		{Timestamp: now, Severity: "warning", SourceType: "disk", SourceID: "ata-A", Subject: "Pending sectors", Message: "8 pending"},
+		{Timestamp: now, Severity: "warning", SourceType: "md", SourceID: "md0", Subject: "MD array degraded", Message: "1 of 2 devices"},
+	})
+
+	entries, err := n.PendingEntries(ctx, 100)
+	if err != nil {
+		t.Fatalf("pending entries: %v", err)
+	}
+	got := map[string][]string{}
+	for _, e := range entries {
+		got[e.Subject] = append(got[e.Subject], e.Channel)
+	}
+	want := map[string][]string{
+		"Pool not healthy":  {"webhook:storage"},
+		"Pending sectors":   {"syslog", "webhook:hardware"},
+		"MD array degraded": {"syslog", "webhook:storage", "webhook:hardware"}, // no route: every channel
+	}
+	for subject, channels := range want {
+		slices.Sort(channels)
+		slices.Sort(got[subject])
+		if !slices.Equal(got[subject], channels) {
+			t.Errorf("%s queued on %v, want %v", subject, got[subject], channels)
+		}
+	}
+}
+
+func TestSnoozedAlertNotQueuedUntilExpiry(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	n := New(store, config.NotificationsConfig{Syslog: config.SyslogConfig{Enabled: true}}, time.Hour, "warning", slog.Default())
+
+	alert := types.Alert{Timestamp: time.Now().Unix(), Severity: "warning", SourceType: "disk", SourceID: "ata-A", Subject: "High temperature", Message: "58C"}
+	snooze := storage.Alert{SourceType: alert.SourceType, SourceID: alert.SourceID, Subject: alert.Subject}
+	if err := store.SnoozeAlert(ctx, snooze, time.Now().Add(4*time.Hour).Unix()); err != nil {
+		t.Fatalf("snooze: %v", err)
+	}
+
+	n.Send(ctx, []types.Alert{alert})
+	if count, _ := store.GetUnsentNotificationCount(ctx); count != 0 {
+		t.Fatalf("expected nothing queued while snoozed, got %d", count)
+	}
+	alerts, err := store.ListAlerts(ctx, storage.AlertFilter{Limit: 10})
+	if err != nil || len(alerts) != 1 {
+		t.Fatalf("expected the snoozed alert still recorded, got %d (%v)", len(alerts), err)
+	}
+
+	// Later evaluations during the same snooze don't store it again.
+	for i := 0; i < 3; i++ {
+		alert.Timestamp++
+		n.Send(ctx, []types.Alert{alert})
+	}
+	if alerts, _ := store.ListAlerts(ctx, storage.AlertFilter{Limit: 10}); len(alerts) != 1 {
+		t.Fatalf("expected one stored alert per snooze, got %d", len(alerts))
+	}
+
+	// Once the snooze has expired the next occurrence notifies.
+	if err := store.SnoozeAlert(ctx, snooze, time.Now().Add(-time.Minute).Unix()); err != nil {
+		t.Fatalf("expire snooze: %v", err)
+	}
+	alert.Timestamp++
+	n.Send(ctx, []types.Alert{alert})
+	if count, _ := store.GetUnsentNotificationCount(ctx); count != 1 {
+		t.Fatalf("expected the alert queued after the snooze, got %d", count)
+	}
+}
+
+func TestSendAppendsToAlertLog(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	alertlog.Init(path, 0)
+	t.Cleanup(func() { alertlog.Init("", 0) })
+	n := New(store, config.NotificationsConfig{}, time.Hour, "warning", slog.Default())
+
+	now := time.Now().Unix()
+	alert := types.Alert{Severity: "critical", SourceType: "pool", SourceID: "tank", Subject: "Pool not healthy", Message: "Pool state is DEGRADED", Timestamp: now}
+	n.Send(ctx, []types.Alert{alert})
+	// A debounced repeat isn't logged again.
+	alert.Timestamp++
+	n.Send(ctx, []types.Alert{alert})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open alert log: %v", err)
+	}
+	defer f.Close()
+	var entries []alertlog.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e alertlog.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	stored, err := store.ListAlerts(ctx, storage.AlertFilter{Limit: 10})
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("expected one stored alert, got %d (%v)", len(stored), err)
+	}
+	want := alertlog.Entry{ID: stored[0].ID, Timestamp: now, Severity: "critical", SourceType: "pool", SourceID: "tank", Subject: "Pool not healthy", Message: "Pool state is DEGRADED"}
+	if len(entries) != 1 || entries[0] != want {
+		t.Fatalf("expected %+v logged, got %+v", want, entries)
+	}
+
+	// Past the size limit the log is rotated before the next append.
+	alertlog.Init(path, 1)
+	n.Send(ctx, []types.Alert{{Severity: "warning", SourceType: "disk", SourceID: "ata-A", Subject: "Drive added", Timestamp: now}})
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected rotated log: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || strings.Count(string(b), "\n") != 1 || !strings.Contains(string(b), "Drive added") {
+		t.Fatalf("expected only the new alert in the fresh log, got %q (err %v)", b, err)
+	}
+}
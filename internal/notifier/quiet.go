@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+)
+
+// quietUntil returns when the quiet-hours window containing now ends if a
+// notification of the given severity must wait for it, or the zero time if it
+// can go out straight away. Critical and emergency alerts are never held back.
+func quietUntil(cfg config.QuietHoursConfig, severity string, now time.Time) time.Time {
+	sev := strings.ToLower(severity)
+	if !cfg.Enabled || atLeast(sev, "critical") || !slices.Contains(cfg.Severities, sev) {
+		return time.Time{}
+	}
+	start, err1 := time.Parse("15:04", cfg.Start)
+	end, err2 := time.Parse("15:04", cfg.End)
+	if err1 != nil || err2 != nil {
+		return time.Time{}
+	}
+	loc := time.Local
+	if cfg.Timezone != "" {
+		if l, err := time.LoadLocation(cfg.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	local := now.In(loc)
+	cur := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	var quiet bool
+	if from < to {
+		quiet = cur >= from && cur < to
+	} else { // wraps past midnight, e.g. 22:00-07:00
+		quiet = cur >= from || cur < to
+	}
+	if !quiet {
+		return time.Time{}
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
@@ -0,0 +1,93 @@
+package notifier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+// byIDPattern matches udev by-id device paths, which embed model and serial.
+var byIDPattern = regexp.MustCompile(`(/dev/disk/by-id/)([^\s,;:'")\]]+)`)
+
+// urlPattern matches URLs in send errors. Webhook and bot URLs often carry
+// their credentials in the path or query.
+var urlPattern = regexp.MustCompile(`(https?://[^/\s"']+)[^\s"']*`)
+
+// redactURLs keeps only the scheme and host of any URL in s.
+func redactURLs(s string) string {
+	return urlPattern.ReplaceAllString(s, "$1/[redacted]")
+}
+
+// redactor rewrites identifying strings in outbound alerts. The stored alert
+// is left untouched; redaction only applies to what leaves the host.
+type redactor struct {
+	mode    string // "hash" or "truncate"
+	byID    bool
+	serials []string
+}
+
+// newRedactor returns nil when redaction is disabled.
+func (n *Notifier) newRedactor(ctx context.Context) *redactor {
+	cfg := n.cfg.Redaction
+	if cfg.Serials == "" && !cfg.ByIDPaths {
+		return nil
+	}
+	r := &redactor{mode: cfg.Serials, byID: cfg.ByIDPaths}
+	if r.mode == "" {
+		r.mode = "hash"
+	}
+	if cfg.Serials != "" {
+		disks, err := n.store.ListDisks(ctx)
+		if err != nil {
+			n.logger.Warn("failed to load serials for redaction", "error", err)
+		}
+		for _, d := range disks {
+			if len(d.Serial) >= 4 {
+				r.serials = append(r.serials, d.Serial)
+			}
+		}
+	}
+	return r
+}
+
+func (r *redactor) alert(a types.Alert) types.Alert {
+	if r == nil {
+		return a
+	}
+	a.SourceID = r.text(a.SourceID)
+	a.Subject = r.text(a.Subject)
+	a.Message = r.text(a.Message)
+	return a
+}
+
+func (r *redactor) text(s string) string {
+	if r.byID {
+		s = byIDPattern.ReplaceAllStringFunc(s, func(m string) string {
+			sub := byIDPattern.FindStringSubmatch(m)
+			return sub[1] + r.token(sub[2])
+		})
+	}
+	for _, serial := range r.serials {
+		if strings.Contains(s, serial) {
+			s = strings.ReplaceAll(s, serial, r.token(serial))
+		}
+	}
+	return s
+}
+
+// token derives the replacement for a sensitive value. Hashes are stable so
+// repeated alerts for the same drive can still be correlated.
+func (r *redactor) token(v string) string {
+	if r.mode == "truncate" {
+		if len(v) <= 4 {
+			return "****"
+		}
+		return "****" + v[len(v)-4:]
+	}
+	sum := sha256.Sum256([]byte(v))
+	return "sn-" + hex.EncodeToString(sum[:])[:10]
+}
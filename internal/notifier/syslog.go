@@ -0,0 +1,91 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+// syslogSeverity maps alert severities to RFC 5424 severities.
+var syslogSeverity = map[string]int{"emergency": 1, "critical": 2, "warning": 4, "info": 6}
+
+// cefSeverity maps alert severities to CEF's 0-10 scale.
+var cefSeverity = map[string]int{"emergency": 10, "critical": 10, "warning": 6, "info": 3}
+
+func (n *Notifier) sendSyslog(ctx context.Context, alert types.Alert) error {
+	cfg := n.cfg.Syslog
+	if !cfg.Enabled {
+		return fmt.Errorf("syslog not configured")
+	}
+	hostname, _ := os.Hostname()
+	line := formatSyslog(cfg, alert, hostname, time.Now())
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, cfg.Network, cfg.Address)
+	if err != nil {
+		return fmt.Errorf("dial syslog: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+	if cfg.Network == "tcp" {
+		// RFC 6587 octet-counting framing
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	if _, err := conn.Write([]byte(line)); err != nil {
+		return fmt.Errorf("write syslog: %w", err)
+	}
+	return nil
+}
+
+// formatSyslog renders an alert as an RFC 5424 message whose body is either
+// plain text or a CEF record.
+func formatSyslog(cfg config.SyslogConfig, alert types.Alert, hostname string, now time.Time) string {
+	sev, ok := syslogSeverity[strings.ToLower(alert.Severity)]
+	if !ok {
+		sev = syslogSeverity["info"]
+	}
+	pri := config.SyslogFacilities[cfg.Facility]*8 + sev
+	if hostname == "" {
+		hostname = "-"
+	}
+	appName := cfg.AppName
+	if appName == "" {
+		appName = "storagesentinel"
+	}
+
+	var msg string
+	if cfg.Format == "cef" {
+		msg = formatCEF(alert)
+	} else {
+		msg = fmt.Sprintf("[%s] %s %s: %s - %s", strings.ToUpper(alert.Severity), alert.SourceType, alert.SourceID, alert.Subject, alert.Message)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d alert - %s",
+		pri, now.UTC().Format(time.RFC3339), hostname, appName, os.Getpid(), msg)
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtEscaper    = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func formatCEF(alert types.Alert) string {
+	sev, ok := cefSeverity[strings.ToLower(alert.Severity)]
+	if !ok {
+		sev = cefSeverity["info"]
+	}
+	signature := alert.SourceType + ":" + strings.ReplaceAll(strings.ToLower(alert.Subject), " ", "_")
+	ext := fmt.Sprintf("rt=%d cs1Label=sourceType cs1=%s cs2Label=sourceId cs2=%s msg=%s",
+		alert.Timestamp*1000,
+		cefExtEscaper.Replace(alert.SourceType),
+		cefExtEscaper.Replace(alert.SourceID),
+		cefExtEscaper.Replace(alert.Message))
+	return fmt.Sprintf("CEF:0|Metabinary|StorageSentinel|1.0|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(signature), cefHeaderEscaper.Replace(alert.Subject), sev, ext)
+}
@@ -0,0 +1,71 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+// lastStatusKey is the meta key holding the last overall health status
+// reported to the transition webhook.
+const lastStatusKey = "last_health_status"
+
+// transitionPayload is the body posted to the transition webhook.
+type transitionPayload struct {
+	Hostname       string   `json:"hostname,omitempty"`
+	PreviousStatus string   `json:"previous_status"`
+	Status         string   `json:"status"`
+	Reasons        []string `json:"reasons,omitempty"`
+	Timestamp      int64    `json:"timestamp"`
+}
+
+// ObserveStatus fires the transition webhook when the report's overall status
+// differs from the last one recorded, and reports whether it fired. The first
+// status seen is only recorded. The new status is persisted after a
+// successful send, so a failed call is retried on the next evaluation.
+func (n *Notifier) ObserveStatus(ctx context.Context, report types.HealthReport) (bool, error) {
+	webhook := n.cfg.TransitionWebhook
+	if webhook.URL == "" || report.Status == "" {
+		return false, nil
+	}
+	prev, err := n.store.GetMeta(ctx, lastStatusKey)
+	if err != nil {
+		return false, fmt.Errorf("read last status: %w", err)
+	}
+	if prev == report.Status {
+		return false, nil
+	}
+	if prev == "" {
+		return false, n.store.SetMeta(ctx, lastStatusKey, report.Status)
+	}
+
+	// Reasons name their source, often a by-id path carrying the serial.
+	reasons := report.StatusReasons
+	if red := n.newRedactor(ctx); red != nil {
+		reasons = make([]string, len(report.StatusReasons))
+		for i, r := range report.StatusReasons {
+			reasons[i] = red.text(r)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	payload, err := json.Marshal(transitionPayload{
+		Hostname:       hostname,
+		PreviousStatus: prev,
+		Status:         report.Status,
+		Reasons:        reasons,
+		Timestamp:      time.Now().Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("marshal transition: %w", err)
+	}
+	if err := n.postWebhook(ctx, &webhook, payload); err != nil {
+		return false, fmt.Errorf("transition webhook: %w", err)
+	}
+	n.logger.Info("health status changed", "from", prev, "to", report.Status)
+	return true, n.store.SetMeta(ctx, lastStatusKey, report.Status)
+}
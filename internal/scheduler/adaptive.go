@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+// adaptiveTasks are the collection loops whose intervals stretch while the
+// system stays healthy. Tests and scrubs keep their configured cadence.
+var adaptiveTasks = map[string]bool{
+	"ZFS_STATUS":    true,
+	"SMART_COLLECT": true,
+	"NVME_COLLECT":  true,
+}
+
+// idleTracker implements adaptive mode: after HealthyCycles consecutive "ok"
+// health reports the interval multiplier grows by Factor (up to MaxFactor),
+// and any warning or critical alert resets it to 1 immediately.
+type idleTracker struct {
+	cfg config.AdaptiveConfig
+
+	mu         sync.Mutex
+	okStreak   int
+	multiplier float64
+	resetCh    chan struct{}
+}
+
+func newIdleTracker(cfg config.AdaptiveConfig) *idleTracker {
+	return &idleTracker{cfg: cfg, multiplier: 1, resetCh: make(chan struct{})}
+}
+
+// observe records the outcome of a health evaluation.
+func (t *idleTracker) observe(report types.HealthReport) {
+	if !t.cfg.Enabled {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !reportHealthy(report) {
+		t.okStreak = 0
+		if t.multiplier != 1 {
+			t.multiplier = 1
+			// Wake loops waiting on a stretched ticker.
+			close(t.resetCh)
+			t.resetCh = make(chan struct{})
+		}
+		return
+	}
+
+	t.okStreak++
+	if t.okStreak < t.cfg.HealthyCycles {
+		return
+	}
+	t.okStreak = 0
+	t.multiplier *= t.cfg.Factor
+	if t.multiplier > t.cfg.MaxFactor {
+		t.multiplier = t.cfg.MaxFactor
+	}
+}
+
+// scale returns interval stretched by the current multiplier.
+func (t *idleTracker) scale(interval time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Duration(float64(interval) * t.multiplier)
+}
+
+// reset returns a channel that is closed the next time the multiplier drops
+// back to 1.
+func (t *idleTracker) reset() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resetCh
+}
+
+func reportHealthy(report types.HealthReport) bool {
+	if report.Status != "ok" {
+		return false
+	}
+	for _, a := range report.Alerts {
+		if a.Severity != "info" {
+			return false
+		}
+	}
+	return true
+}
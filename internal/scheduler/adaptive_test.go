@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+func TestIdleTrackerBackoffAndReset(t *testing.T) {
+	tr := newIdleTracker(config.AdaptiveConfig{Enabled: true, HealthyCycles: 2, Factor: 2, MaxFactor: 4})
+	base := 10 * time.Minute
+	healthy := types.HealthReport{Status: "ok"}
+
+	// One backoff step per two healthy cycles, capped at 4x.
+	steps := []time.Duration{base, 2 * base, 2 * base, 4 * base, 4 * base, 4 * base}
+	for i, want := range steps {
+		tr.observe(healthy)
+		if got := tr.scale(base); got != want {
+			t.Fatalf("after %d healthy cycles expected %v, got %v", i+1, want, got)
+		}
+	}
+
+	reset := tr.reset()
+	tr.observe(types.HealthReport{Status: "warning", Alerts: []types.Alert{{Severity: "warning"}}})
+	if got := tr.scale(base); got != base {
+		t.Fatalf("expected interval to reset to %v on alert, got %v", base, got)
+	}
+	select {
+	case <-reset:
+	default:
+		t.Fatalf("expected waiting loops to be woken on reset")
+	}
+
+	// Info-only alerts don't interrupt idle mode.
+	tr.observe(types.HealthReport{Status: "ok", Alerts: []types.Alert{{Severity: "info"}}})
+	tr.observe(healthy)
+	if got := tr.scale(base); got != 2*base {
+		t.Fatalf("expected backoff to resume, got %v", got)
+	}
+}
+
+func TestIdleTrackerDisabled(t *testing.T) {
+	tr := newIdleTracker(config.AdaptiveConfig{HealthyCycles: 1, Factor: 2, MaxFactor: 8})
+	for i := 0; i < 5; i++ {
+		tr.observe(types.HealthReport{Status: "ok"})
+	}
+	if got := tr.scale(time.Hour); got != time.Hour {
+		t.Fatalf("expected no backoff when disabled, got %v", got)
+	}
+}
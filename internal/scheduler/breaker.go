@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// breaker is a per-target circuit breaker for scheduled actions (scrubs,
+// SMART tests). After threshold consecutive failures to start, a target is
+// skipped until cooldown has passed or it is reset; the next attempt after the
+// cooldown reopens the breaker at once if it fails again. State is kept in
+// memory, so a restart also closes every breaker.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures map[string]int
+	openedAt map[string]time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		failures:  make(map[string]int),
+		openedAt:  make(map[string]time.Time),
+	}
+}
+
+// allow reports whether key may be attempted at now.
+func (b *breaker) allow(key string, now time.Time) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	opened, ok := b.openedAt[key]
+	return !ok || (b.cooldown > 0 && now.Sub(opened) >= b.cooldown)
+}
+
+// failure records a failed attempt and reports whether it (re)opened the
+// breaker for key.
+func (b *breaker) failure(key string, now time.Time) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[key]++
+	if b.failures[key] < b.threshold {
+		return false
+	}
+	b.openedAt[key] = now
+	return true
+}
+
+// success closes the breaker for key.
+func (b *breaker) success(key string) {
+	b.reset(key)
+}
+
+func (b *breaker) reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+	delete(b.openedAt, key)
+}
+
+// open lists the keys whose breaker is currently open.
+func (b *breaker) open() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := make([]string, 0, len(b.openedAt))
+	for k := range b.openedAt {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+// recordNextRun stores when a scheduled loop last ran and when its work will
+// next actually happen, for the diagnostics API. For SMART tests and scrubs
+// that is not simply the next tick: the loop only acts on disks and pools
+// that are due, so the next run is the first tick at or after the earliest
+// due time.
+func (s *Scheduler) recordNextRun(ctx context.Context, taskType string, configInterval, interval time.Duration, lastRun time.Time) {
+	if s.store == nil || interval <= 0 {
+		return
+	}
+	source, scheduleType, value := s.scheduleSource(ctx, taskType, configInterval)
+	next := lastRun.Add(interval)
+	if due, ok := s.earliestDue(ctx, taskType); ok && due.After(next) {
+		ticks := (due.Sub(next) + interval - 1) / interval
+		next = next.Add(ticks * interval)
+	}
+	err := s.store.SetTaskRun(ctx, storage.TaskRun{
+		TaskType:      taskType,
+		Source:        source,
+		ScheduleType:  scheduleType,
+		ScheduleValue: value,
+		LastRun:       lastRun.Unix(),
+		NextRun:       next.Unix(),
+	})
+	if err != nil {
+		s.logger.Debug("failed to record next run", "task", taskType, "error", err)
+	}
+}
+
+// scheduleSource reports which schedule getEffectiveInterval picks for
+// taskType: the cloud schedule when it is enabled and more frequent than the
+// config interval, otherwise the config interval.
+func (s *Scheduler) scheduleSource(ctx context.Context, taskType string, configInterval time.Duration) (source, scheduleType, value string) {
+	source, scheduleType, value = "config", "INTERVAL", configInterval.String()
+	cloudSchedule, err := s.store.GetScheduleForTask(ctx, taskType)
+	if err != nil || cloudSchedule == nil || !cloudSchedule.Enabled {
+		return
+	}
+	var cloudInterval time.Duration
+	switch cloudSchedule.ScheduleType {
+	case "INTERVAL":
+		if cloudInterval, err = ParseInterval(cloudSchedule.ScheduleValue); err != nil {
+			return
+		}
+	case "CRON":
+		cloudInterval = time.Minute
+	default:
+		return
+	}
+	if cloudInterval < configInterval {
+		return "cloud", cloudSchedule.ScheduleType, cloudSchedule.ScheduleValue
+	}
+	return
+}
+
+// earliestDue returns when the first disk or pool becomes due for a SMART
+// test or scrub. ok is false for other tasks, or when nothing is scheduled.
+func (s *Scheduler) earliestDue(ctx context.Context, taskType string) (due time.Time, ok bool) {
+	consider := func(t time.Time) {
+		if !ok || t.Before(due) {
+			due, ok = t, true
+		}
+	}
+	switch taskType {
+	case "SMART_SHORT_TEST", "SMART_LONG_TEST":
+		testType, configInterval := "short", s.cfg.SmartShortInterval
+		if taskType == "SMART_LONG_TEST" {
+			testType, configInterval = "long", s.cfg.SmartLongInterval
+		}
+		interval := s.getEffectiveInterval(ctx, taskType, configInterval)
+		disks, err := s.store.ListDisks(ctx)
+		if err != nil {
+			return
+		}
+		for _, disk := range disks {
+			if disk.Type == "nvme" || disk.SmartUnsupported {
+				continue
+			}
+			lastTest, err := s.store.GetLastSmartTestTime(ctx, disk.ID, testType)
+			if err != nil {
+				continue
+			}
+			consider(time.Unix(lastTest, 0).Add(interval))
+		}
+	case "ZFS_SCRUB":
+		pools, err := s.store.ListPools(ctx)
+		if err != nil {
+			return
+		}
+		for _, pool := range pools {
+			lastScrub, err := s.store.GetLastScrubTime(ctx, pool.Name)
+			if err != nil {
+				continue
+			}
+			if next, found := s.nextScrub(ctx, pool.Name, lastScrub); found {
+				consider(next)
+			}
+		}
+	}
+	return
+}
+
+// nextScrub returns when a pool is next due for a scrub, with the same
+// precedence as runZfsScrubScheduler: pool schedule, cloud, then config.
+func (s *Scheduler) nextScrub(ctx context.Context, poolName string, lastScrub int64) (time.Time, bool) {
+	last := time.Unix(lastScrub, 0)
+	scheduleType, value, ok := s.poolScrubSchedule(ctx, poolName)
+	if !ok {
+		if cloudSchedule, _ := s.store.GetScheduleForTask(ctx, "ZFS_SCRUB"); cloudSchedule != nil && cloudSchedule.Enabled {
+			scheduleType, value = cloudSchedule.ScheduleType, cloudSchedule.ScheduleValue
+			if scheduleType != "CRON" {
+				return last.Add(s.getEffectiveInterval(ctx, "ZFS_SCRUB", s.cfg.ZFSScrubInterval)), true
+			}
+		} else if s.cfg.ZFSScrubInterval > 0 {
+			return last.Add(s.cfg.ZFSScrubInterval), true
+		} else {
+			return time.Time{}, false
+		}
+	}
+	next, err := ParseScheduleValue(scheduleType, value, last)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return next, true
+}
@@ -3,13 +3,20 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/collectors"
 	"github.com/metabinary-ltd/storagesentinel/internal/config"
 	"github.com/metabinary-ltd/storagesentinel/internal/discovery"
+	"github.com/metabinary-ltd/storagesentinel/internal/events"
 	"github.com/metabinary-ltd/storagesentinel/internal/health"
 	"github.com/metabinary-ltd/storagesentinel/internal/notifier"
 	"github.com/metabinary-ltd/storagesentinel/internal/storage"
@@ -30,10 +37,52 @@ type Scheduler struct {
 	notifier     *notifier.Notifier
 	uplink       *uplink.Client
 	commandQueue chan uplink.Command
+	idle         *idleTracker
+	locator      *collectors.Locator
+	md           *collectors.MdCollector
+	system       *collectors.SystemCollector
+	breaker      *breaker
+	skewWarned   bool // a clock skew warning has been logged and not yet cleared
+
+	// Set once the first SMART / NVMe pass after startup has finished.
+	smartReady, nvmeReady atomic.Bool
+
+	// Last overall status seen by dispatchHealth, for status change events.
+	statusMu   sync.Mutex
+	lastStatus string
+
+	// SMART test types with disks left for a later batch, by test type.
+	staggerMu sync.Mutex
+	staggered map[string]staggeredRun
+}
+
+// staggeredRun is a SMART test run whose remaining disks wait for
+// runDeferredSmartTests to start them once due.
+type staggeredRun struct {
+	interval time.Duration
+	tried    map[string]bool
+	due      time.Time
 }
 
 func New(logger *slog.Logger, cfg config.SchedulingConfig, cloudCfg config.CloudConfig, store *storage.Store, discovery *discovery.Service, smart *collectors.SmartCollector, nvme *collectors.NvmeCollector, zfs *collectors.ZfsCollector, health health.Provider, notifier *notifier.Notifier, uplinkClient *uplink.Client) *Scheduler {
 	commandQueue := make(chan uplink.Command, 10)
+	collectors.SetMaxConcurrentCommands(cfg.MaxConcurrentCommands)
+	collectors.SetRecordMetrics(cfg.CollectionMetrics)
+	if discovery != nil && notifier != nil {
+		discovery.SetAlertHandler(notifier.Send)
+	}
+	if store != nil && notifier != nil {
+		store.OnReadOnly(func(a storage.Alert) {
+			notifier.SendDirect(context.Background(), types.Alert{
+				Timestamp:  a.Timestamp,
+				Severity:   a.Severity,
+				SourceType: a.SourceType,
+				SourceID:   a.SourceID,
+				Subject:    a.Subject,
+				Message:    a.Message,
+			})
+		})
+	}
 	return &Scheduler{
 		logger:       logger,
 		cfg:          cfg,
@@ -47,14 +96,133 @@ func New(logger *slog.Logger, cfg config.SchedulingConfig, cloudCfg config.Cloud
 		notifier:     notifier,
 		uplink:       uplinkClient,
 		commandQueue: commandQueue,
+		idle:         newIdleTracker(cfg.Adaptive),
+		breaker:      newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
 	}
 }
 
-func (s *Scheduler) Start(ctx context.Context, once bool) {
+// SetLocator enables locate LED support for the locate_disk remote command
+// and LocateDisk.
+func (s *Scheduler) SetLocator(l *collectors.Locator) {
+	s.locator = l
+}
+
+// OpenBreakers lists scheduled actions suspended after repeated failures to
+// start, e.g. "scrub:tank" or "smart_long:ata-WDC_WD80".
+func (s *Scheduler) OpenBreakers() []string {
+	return s.breaker.open()
+}
+
+// ResetBreaker re-enables a scheduled action suspended by its circuit breaker.
+func (s *Scheduler) ResetBreaker(key string) {
+	s.breaker.reset(key)
+	s.logger.Info("scheduled action re-enabled", "key", key)
+}
+
+// recordTriggerFailure counts a failed scheduled action and, when that opens
+// its breaker, raises a warning alert for the pool or disk.
+func (s *Scheduler) recordTriggerFailure(ctx context.Context, key, sourceType, sourceID, action string, err error) {
+	if !s.breaker.failure(key, time.Now()) {
+		return
+	}
+	s.logger.Warn("scheduled action suspended after repeated failures", "key", key, "error", err)
+	if s.notifier == nil {
+		return
+	}
+	retry := "until reset"
+	if s.cfg.BreakerCooldown > 0 {
+		retry = "for " + s.cfg.BreakerCooldown.String() + " or until reset"
+	}
+	s.notifier.Send(ctx, []types.Alert{{
+		Timestamp:  time.Now().Unix(),
+		Severity:   "warning",
+		SourceType: sourceType,
+		SourceID:   sourceID,
+		Subject:    "Scheduled " + action + " suspended",
+		Message: fmt.Sprintf("%s failed to start %d times in a row (last error: %v); not retrying %s",
+			action, s.cfg.BreakerThreshold, err, retry),
+	}})
+}
+
+// SetMdCollector enables mdadm array monitoring (storage.md_enable). Arrays
+// are collected on the ZFS status interval.
+func (s *Scheduler) SetMdCollector(c *collectors.MdCollector) {
+	s.md = c
+}
+
+// SetSystemCollector enables host load/memory/ARC sampling
+// (storage.system_metrics) on the ZFS status interval.
+func (s *Scheduler) SetSystemCollector(c *collectors.SystemCollector) {
+	s.system = c
+}
+
+// LocateDisk blinks the locate LED of a known disk. It backs both the API
+// trigger and the locate_disk remote command.
+func (s *Scheduler) LocateDisk(ctx context.Context, diskID string, duration time.Duration) error {
+	if s.locator == nil {
+		return fmt.Errorf("%w: no locate tool configured", collectors.ErrLocateUnsupported)
+	}
+	disk, err := s.store.GetDisk(ctx, diskID)
+	if err != nil {
+		return err
+	}
+	if disk == nil {
+		return fmt.Errorf("disk not found: %s", diskID)
+	}
+	return s.locator.Locate(ctx, *disk, duration)
+}
+
+// CollectSmart runs a SMART collection pass for the API trigger, then
+// re-evaluates health. Without wait it runs in the background and returns a
+// nil result.
+func (s *Scheduler) CollectSmart(ctx context.Context, wait bool) (*types.CollectionResult, error) {
+	if s.smart == nil {
+		return nil, errors.New("SMART collector not available")
+	}
+	return s.collectNow(ctx, wait, "SMART", s.smart.CollectWithResult)
+}
+
+// CollectNvme is CollectSmart for NVMe drives.
+func (s *Scheduler) CollectNvme(ctx context.Context, wait bool) (*types.CollectionResult, error) {
+	if s.nvme == nil {
+		return nil, errors.New("NVMe collector not available")
+	}
+	return s.collectNow(ctx, wait, "NVMe", s.nvme.CollectWithResult)
+}
+
+func (s *Scheduler) collectNow(ctx context.Context, wait bool, kind string, collect func(context.Context, []storage.Disk) (types.CollectionResult, error)) (*types.CollectionResult, error) {
+	disks, err := s.pollOrder(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !wait {
+		// The request's context ends when the handler returns
+		ctx = context.WithoutCancel(ctx)
+		go func() {
+			if _, err := collect(ctx, disks); err != nil {
+				s.logger.Warn("triggered collection failed", "kind", kind, "error", err)
+				return
+			}
+			s.dispatchHealth(ctx)
+		}()
+		return nil, nil
+	}
+	result, err := collect(ctx, disks)
+	if err != nil {
+		return nil, err
+	}
+	s.dispatchHealth(ctx)
+	return &result, nil
+}
+
+// Start runs the scheduler until ctx is done. With once it instead runs
+// discovery and every collector a single time and returns an error
+// summarising whatever failed, so a --once run can exit nonzero when
+// nothing was actually collected.
+func (s *Scheduler) Start(ctx context.Context, once bool) error {
 	if once {
 		s.logger.Info("scheduler once mode - running discovery and collectors")
-		s.runOnce(ctx)
-		return
+		return s.runOnce(ctx)
 	}
 
 	s.logger.Info("scheduler started")
@@ -72,6 +240,12 @@ func (s *Scheduler) Start(ctx context.Context, once bool) {
 	// Run discovery periodically (every 6 hours by default)
 	go s.runLoop(ctx, 6*time.Hour, s.runDiscoveryLoop)
 	go s.runLoopWithSchedule(ctx, "ZFS_STATUS", s.cfg.ZFSStatusInterval, s.runZfsLoop)
+	if s.md != nil {
+		go s.runLoop(ctx, s.cfg.ZFSStatusInterval, s.runMdLoop)
+	}
+	if s.system != nil {
+		go s.runLoop(ctx, s.cfg.ZFSStatusInterval, s.runSystemLoop)
+	}
 	go s.runLoopWithSchedule(ctx, "SMART_COLLECT", s.cfg.SmartCollectInterval, s.runSmartLoop)
 	go s.runLoopWithSchedule(ctx, "NVME_COLLECT", s.cfg.SmartCollectInterval, s.runNvmeLoop)
 	
@@ -79,22 +253,30 @@ func (s *Scheduler) Start(ctx context.Context, once bool) {
 	if s.cfg.SmartShortInterval > 0 {
 		go s.runLoopWithSchedule(ctx, "SMART_SHORT_TEST", s.cfg.SmartShortInterval, func(ctx context.Context) {
 			effectiveInterval := s.getEffectiveInterval(ctx, "SMART_SHORT_TEST", s.cfg.SmartShortInterval)
-			s.runSmartTestsScheduler(ctx, "short", effectiveInterval)
+			s.runStaggeredSmartTests(ctx, "short", effectiveInterval)
 		})
 	}
 	if s.cfg.SmartLongInterval > 0 {
 		go s.runLoopWithSchedule(ctx, "SMART_LONG_TEST", s.cfg.SmartLongInterval, func(ctx context.Context) {
 			effectiveInterval := s.getEffectiveInterval(ctx, "SMART_LONG_TEST", s.cfg.SmartLongInterval)
-			s.runSmartTestsScheduler(ctx, "long", effectiveInterval)
+			s.runStaggeredSmartTests(ctx, "long", effectiveInterval)
 		})
 	}
 	
+	if (s.cfg.SmartShortInterval > 0 || s.cfg.SmartLongInterval > 0) && s.cfg.SmartTestMaxPerRun > 0 && s.cfg.SmartTestStagger > 0 {
+		go s.runLoop(ctx, min(s.cfg.SmartTestStagger, time.Minute), s.runDeferredSmartTests)
+	}
+
 	// Run ZFS scrub scheduler if interval is configured
-	if s.cfg.ZFSScrubInterval > 0 {
-		go s.runLoopWithSchedule(ctx, "ZFS_SCRUB", s.cfg.ZFSScrubInterval, s.runZfsScrubScheduler)
+	if s.cfg.ZFSScrubInterval > 0 || len(s.cfg.PoolScrubSchedules) > 0 {
+		go s.runLoopWithSchedule(ctx, "ZFS_SCRUB", s.scrubCheckInterval(), s.runZfsScrubScheduler)
 	}
 	
 	go s.runLoop(ctx, 24*time.Hour, s.runPruneLoop)
+	if s.cfg.WALCheckpointInterval > 0 {
+		// Separate goroutine so a checkpoint waiting on readers never delays collection
+		go s.runLoop(ctx, s.cfg.WALCheckpointInterval, s.runCheckpointLoop)
+	}
 	
 	// Cloud upload and command polling if enabled
 	if s.uplink != nil && s.cloudCfg.Enabled {
@@ -117,23 +299,71 @@ func (s *Scheduler) Start(ctx context.Context, once bool) {
 	
 	<-ctx.Done()
 	s.logger.Info("scheduler stopping")
+	return nil
 }
 
-func (s *Scheduler) runOnce(ctx context.Context) {
+// Ready reports whether startup discovery and the first SMART and NVMe
+// collection passes have completed, so the API has data worth serving.
+// Discovery runs before the collection loops start, so it is implied.
+func (s *Scheduler) Ready() bool {
+	return s.smartReady.Load() && s.nvmeReady.Load()
+}
+
+func (s *Scheduler) runOnce(ctx context.Context) error {
+	var errs []error
 	if s.discovery != nil {
-		_ = s.discovery.RunOnce(ctx)
+		if err := s.discovery.RunOnce(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("discovery: %w", err))
+		}
+	}
+	disks, err := s.pollOrder(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("list disks: %w", err))
 	}
-	disks, _ := s.store.ListDisks(ctx)
 	if s.smart != nil {
-		_ = s.smart.Collect(ctx, disks)
+		result, err := s.smart.CollectWithResult(ctx, disks)
+		errs = append(errs, onceFailure("SMART", result, err))
 	}
 	if s.nvme != nil {
-		_ = s.nvme.Collect(ctx, disks)
+		result, err := s.nvme.CollectWithResult(ctx, disks)
+		errs = append(errs, onceFailure("NVMe", result, err))
 	}
 	if s.zfs != nil {
-		_ = s.zfs.Collect(ctx)
+		if err := s.zfs.Collect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("ZFS: %w", err))
+		}
 	}
+	if s.md != nil {
+		if err := s.md.Collect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("md: %w", err))
+		}
+	}
+	if s.system != nil {
+		if err := s.system.Collect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("system metrics: %w", err))
+		}
+	}
+	s.smartReady.Store(true)
+	s.nvmeReady.Store(true)
 	s.dispatchHealth(ctx)
+	return errors.Join(errs...)
+}
+
+// onceFailure summarises a once-mode collection pass: the error if it didn't
+// run, otherwise which disks failed, or nil when none did.
+func onceFailure(kind string, result types.CollectionResult, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", kind, err)
+	}
+	if len(result.Failures) == 0 {
+		return nil
+	}
+	failed := make([]string, 0, len(result.Failures))
+	for _, f := range result.Failures {
+		failed = append(failed, f.Name+": "+f.Error)
+	}
+	return fmt.Errorf("%s: %d of %d disks failed (%s)", kind, len(result.Failures),
+		len(result.Failures)+result.Collected+result.Unsupported, strings.Join(failed, "; "))
 }
 
 func (s *Scheduler) runLoop(ctx context.Context, interval time.Duration, fn func(context.Context)) {
@@ -143,7 +373,9 @@ func (s *Scheduler) runLoop(ctx context.Context, interval time.Duration, fn func
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for {
-		fn(ctx)
+		if !s.readOnly() {
+			fn(ctx)
+		}
 		select {
 		case <-ctx.Done():
 			return
@@ -152,6 +384,13 @@ func (s *Scheduler) runLoop(ctx context.Context, interval time.Duration, fn func
 	}
 }
 
+// readOnly reports whether the database has gone read-only. Loops then stop
+// running: collection and scheduled actions exist to record results, and
+// retrying writes that can't succeed only fills the log.
+func (s *Scheduler) readOnly() bool {
+	return s.store != nil && s.store.ReadOnly()
+}
+
 // runLoopWithSchedule runs a loop that checks both config and cloud schedules
 func (s *Scheduler) runLoopWithSchedule(ctx context.Context, taskType string, configInterval time.Duration, fn func(context.Context)) {
 	// Start with config interval
@@ -166,17 +405,29 @@ func (s *Scheduler) runLoopWithSchedule(ctx context.Context, taskType string, co
 	for {
 		// Check for cloud schedule and use the most frequent (shortest interval)
 		effectiveInterval := s.getEffectiveInterval(ctx, taskType, configInterval)
+		var idleReset <-chan struct{}
+		if adaptiveTasks[taskType] {
+			effectiveInterval = s.idle.scale(effectiveInterval)
+			idleReset = s.idle.reset()
+		}
 		if effectiveInterval != interval {
 			interval = effectiveInterval
 			ticker.Stop()
 			ticker = time.NewTicker(interval)
 		}
 		
-		fn(ctx)
+		if !s.readOnly() {
+			lastRun := time.Now()
+			fn(ctx)
+			s.recordNextRun(ctx, taskType, configInterval, interval, lastRun)
+		}
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+		case <-idleReset:
+			// An alert ended idle mode; collect now and drop back to the
+			// base interval rather than waiting out the stretched tick.
 		}
 	}
 }
@@ -217,13 +468,28 @@ func (s *Scheduler) pollAndStoreSchedules(ctx context.Context) {
 	if s.uplink == nil || !s.cloudCfg.Enabled {
 		return
 	}
-	
+	if _, err := s.RefreshSchedules(ctx); err != nil {
+		s.logger.Warn("failed to refresh schedules from cloud", "error", err)
+	}
+}
+
+// ErrCloudDisabled is returned by RefreshSchedules when the agent has no
+// cloud connection to poll.
+var ErrCloudDisabled = errors.New("cloud connection not enabled")
+
+// RefreshSchedules polls the cloud for schedules now rather than waiting
+// for the hourly poll, stores them and returns how many were stored. It
+// backs both the API trigger and the refresh_schedules remote command.
+func (s *Scheduler) RefreshSchedules(ctx context.Context) (int, error) {
+	if s.uplink == nil || !s.cloudCfg.Enabled {
+		return 0, ErrCloudDisabled
+	}
+
 	schedules, err := s.uplink.PollSchedules(ctx)
 	if err != nil {
-		s.logger.Warn("failed to poll schedules from cloud", "error", err)
-		return
+		return 0, fmt.Errorf("poll schedules: %w", err)
 	}
-	
+
 	// Convert to storage format
 	cloudSchedules := make([]storage.CloudSchedule, 0, len(schedules))
 	for _, sched := range schedules {
@@ -236,46 +502,105 @@ func (s *Scheduler) pollAndStoreSchedules(ctx context.Context) {
 			UpdatedAt:     sched.UpdatedAt,
 		})
 	}
-	
+
 	if err := s.store.StoreSchedules(ctx, cloudSchedules); err != nil {
-		s.logger.Warn("failed to store schedules", "error", err)
-		return
+		return 0, fmt.Errorf("store schedules: %w", err)
 	}
-	
+
 	if len(cloudSchedules) > 0 {
 		s.logger.Info("stored cloud schedules", "count", len(cloudSchedules))
 	}
+	return len(cloudSchedules), nil
+}
+
+// pollOrder lists disks in the order they should be collected, per
+// scheduling.poll_priority: higher rule priority first, then pool members if
+// pool_members_first is set, then ID order as stored.
+func (s *Scheduler) pollOrder(ctx context.Context) ([]storage.Disk, error) {
+	disks, err := s.store.ListDisks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prio := s.cfg.PollPriority
+	if len(prio.Rules) == 0 && !prio.PoolMembersFirst {
+		return disks, nil
+	}
+
+	rank := make(map[string]int, len(disks))
+	pooled := make(map[string]bool, len(disks))
+	for _, d := range disks {
+		rank[d.ID] = prio.PriorityFor(d.ID, d.Name, d.Model)
+		if prio.PoolMembersFirst {
+			pools, _ := s.store.GetDiskPoolMembership(ctx, d.ID)
+			pooled[d.ID] = len(pools) > 0
+		}
+	}
+	slices.SortStableFunc(disks, func(a, b storage.Disk) int {
+		if rank[a.ID] != rank[b.ID] {
+			return rank[b.ID] - rank[a.ID]
+		}
+		switch {
+		case pooled[a.ID] && !pooled[b.ID]:
+			return -1
+		case pooled[b.ID] && !pooled[a.ID]:
+			return 1
+		}
+		return 0
+	})
+	return disks, nil
 }
 
 func (s *Scheduler) runSmartLoop(ctx context.Context) {
-	disks, _ := s.store.ListDisks(ctx)
+	disks, _ := s.pollOrder(ctx)
 	if s.smart != nil {
-		if err := s.smart.Collect(ctx, disks); err != nil {
+		if err := s.smart.Collect(ctx, disks); errors.Is(err, collectors.ErrCollectionInProgress) {
+			s.logger.Info("previous SMART collection still running; skipping tick")
+		} else if err != nil {
 			s.logger.Warn("smart loop error", "error", err)
 		}
 	}
+	s.smartReady.Store(true)
 	s.dispatchHealth(ctx)
 }
 
 func (s *Scheduler) runNvmeLoop(ctx context.Context) {
-	disks, _ := s.store.ListDisks(ctx)
+	disks, _ := s.pollOrder(ctx)
 	if s.nvme != nil {
-		if err := s.nvme.Collect(ctx, disks); err != nil {
+		if err := s.nvme.Collect(ctx, disks); errors.Is(err, collectors.ErrCollectionInProgress) {
+			s.logger.Info("previous NVMe collection still running; skipping tick")
+		} else if err != nil {
 			s.logger.Warn("nvme loop error", "error", err)
 		}
 	}
+	s.nvmeReady.Store(true)
 	s.dispatchHealth(ctx)
 }
 
 func (s *Scheduler) runZfsLoop(ctx context.Context) {
 	if s.zfs != nil {
-		if err := s.zfs.Collect(ctx); err != nil {
+		if err := s.zfs.Collect(ctx); errors.Is(err, collectors.ErrCollectionInProgress) {
+			s.logger.Info("previous ZFS collection still running; skipping tick")
+		} else if err != nil {
 			s.logger.Warn("zfs loop error", "error", err)
 		}
 	}
 	s.dispatchHealth(ctx)
 }
 
+func (s *Scheduler) runMdLoop(ctx context.Context) {
+	if err := s.md.Collect(ctx); err != nil {
+		s.logger.Warn("md loop error", "error", err)
+	}
+	s.dispatchHealth(ctx)
+}
+
+func (s *Scheduler) runSystemLoop(ctx context.Context) {
+	if err := s.system.Collect(ctx); err != nil {
+		s.logger.Warn("system metrics loop error", "error", err)
+	}
+	s.dispatchHealth(ctx)
+}
+
 func (s *Scheduler) runDiscoveryLoop(ctx context.Context) {
 	if s.discovery != nil {
 		if err := s.discovery.RunOnce(ctx); err != nil {
@@ -284,15 +609,70 @@ func (s *Scheduler) runDiscoveryLoop(ctx context.Context) {
 	}
 }
 
-func (s *Scheduler) runSmartTestsScheduler(ctx context.Context, testType string, interval time.Duration) {
-	if s.smart == nil || s.store == nil {
+// runStaggeredSmartTests starts due SMART tests, at most SmartTestMaxPerRun
+// of them, so long tests don't start on every spindle of an array at once.
+// The rest are left to runDeferredSmartTests, which starts the next batch
+// SmartTestStagger later without holding up this loop in the meantime.
+func (s *Scheduler) runStaggeredSmartTests(ctx context.Context, testType string, interval time.Duration) {
+	s.runSmartTestBatch(ctx, testType, staggeredRun{interval: interval, tried: make(map[string]bool)})
+}
+
+// runDeferredSmartTests starts the next batch of every staggered SMART test
+// run that is due.
+func (s *Scheduler) runDeferredSmartTests(ctx context.Context) {
+	now := time.Now()
+	due := make(map[string]staggeredRun)
+	s.staggerMu.Lock()
+	for testType, run := range s.staggered {
+		if !now.Before(run.due) {
+			due[testType] = run
+		}
+	}
+	s.staggerMu.Unlock()
+	for testType, run := range due {
+		s.runSmartTestBatch(ctx, testType, run)
+	}
+}
+
+// runSmartTestBatch starts one batch of run and records whether disks remain
+// for a later one.
+func (s *Scheduler) runSmartTestBatch(ctx context.Context, testType string, run staggeredRun) {
+	deferred := s.runSmartTestsScheduler(ctx, testType, run.interval, run.tried)
+	s.staggerMu.Lock()
+	defer s.staggerMu.Unlock()
+	if deferred == 0 || s.cfg.SmartTestStagger <= 0 {
+		delete(s.staggered, testType)
+		if deferred > 0 {
+			s.logger.Info("smart tests deferred to next run", "test", testType, "disks", deferred)
+		}
 		return
 	}
+	run.due = time.Now().Add(s.cfg.SmartTestStagger)
+	if s.staggered == nil {
+		s.staggered = make(map[string]staggeredRun)
+	}
+	s.staggered[testType] = run
+	s.logger.Info("smart tests staggered", "test", testType, "remaining", deferred, "next_batch", run.due)
+}
+
+// runSmartTestsScheduler starts tests on disks that are due, at most
+// SmartTestMaxPerRun of them, skipping disks already in tried (which it
+// updates). It returns how many due disks were deferred.
+func (s *Scheduler) runSmartTestsScheduler(ctx context.Context, testType string, interval time.Duration, tried map[string]bool) int {
+	if s.smart == nil || s.store == nil {
+		return 0
+	}
 
 	disks, err := s.store.ListDisks(ctx)
 	if err != nil {
 		s.logger.Warn("failed to list disks for smart test scheduler", "error", err)
-		return
+		return 0
+	}
+
+	started, deferred := 0, 0
+	root := ""
+	if s.cfg.ExcludeRootDisk {
+		root = discovery.RootDisk()
 	}
 
 	now := time.Now().Unix()
@@ -302,6 +682,12 @@ func (s *Scheduler) runSmartTestsScheduler(ctx context.Context, testType string,
 		if disk.Type == "nvme" {
 			continue // SMART tests are for SATA/SAS drives only
 		}
+		if disk.SmartUnsupported || tried[disk.ID] {
+			continue
+		}
+		if root != "" && disk.Name == root {
+			continue // the boot disk, excluded by scheduling.exclude_root_disk
+		}
 
 		lastTest, err := s.store.GetLastSmartTestTime(ctx, disk.ID, testType)
 		if err != nil {
@@ -311,12 +697,26 @@ func (s *Scheduler) runSmartTestsScheduler(ctx context.Context, testType string,
 
 		// If never tested or interval has elapsed, trigger test
 		if lastTest == 0 || (now-lastTest) >= intervalSeconds {
+			if s.cfg.SmartTestMaxPerRun > 0 && started >= s.cfg.SmartTestMaxPerRun {
+				deferred++
+				continue
+			}
+			key := "smart_" + testType + ":" + disk.ID
+			if !s.breaker.allow(key, time.Now()) {
+				continue
+			}
+			started++
+			tried[disk.ID] = true
 			if err := s.smart.RunTest(ctx, disk, testType); err == nil {
+				s.breaker.success(key)
 				_ = s.store.RecordSmartTest(ctx, disk.ID, testType)
 				s.logger.Info("scheduled smart test", "disk", disk.Name, "test", testType)
+			} else {
+				s.recordTriggerFailure(ctx, key, "disk", disk.ID, testType+" SMART test", err)
 			}
 		}
 	}
+	return deferred
 }
 
 func (s *Scheduler) runZfsScrubScheduler(ctx context.Context) {
@@ -341,11 +741,11 @@ func (s *Scheduler) runZfsScrubScheduler(ctx context.Context) {
 			continue
 		}
 
-		// Check cloud schedule if available
-		cloudSchedule, _ := s.store.GetScheduleForTask(ctx, "ZFS_SCRUB")
 		shouldRun := false
-		
-		if cloudSchedule != nil && cloudSchedule.Enabled {
+		if due, ok := s.poolScrubDue(ctx, pool.Name, lastScrub, time.Unix(now, 0)); ok {
+			// A per-pool schedule replaces the global one for this pool
+			shouldRun = due
+		} else if cloudSchedule, _ := s.store.GetScheduleForTask(ctx, "ZFS_SCRUB"); cloudSchedule != nil && cloudSchedule.Enabled {
 			// Check if it's time based on cloud schedule
 			if cloudSchedule.ScheduleType == "CRON" {
 				nextTime, err := NextCronTime(cloudSchedule.ScheduleValue, time.Unix(lastScrub, 0))
@@ -358,15 +758,21 @@ func (s *Scheduler) runZfsScrubScheduler(ctx context.Context) {
 					shouldRun = true
 				}
 			}
-		} else {
+		} else if s.cfg.ZFSScrubInterval > 0 {
 			// Use config interval
 			if lastScrub == 0 || (now-lastScrub) >= intervalSeconds {
 				shouldRun = true
 			}
 		}
 
+		key := "scrub:" + pool.Name
+		if shouldRun && !s.breaker.allow(key, time.Now()) {
+			s.logger.Debug("scrub suspended by circuit breaker", "pool", pool.Name)
+			shouldRun = false
+		}
 		if shouldRun {
 			if err := s.zfs.TriggerScrub(ctx, pool.Name); err == nil {
+				s.breaker.success(key)
 				// Record scrub start in history
 				_ = s.store.AddScrubHistory(ctx, storage.ScrubHistoryEntry{
 					PoolName:  pool.Name,
@@ -376,32 +782,148 @@ func (s *Scheduler) runZfsScrubScheduler(ctx context.Context) {
 					Notes:     "Scheduled scrub",
 				})
 				s.logger.Info("scheduled zfs scrub", "pool", pool.Name)
+			} else {
+				s.recordTriggerFailure(ctx, key, "pool", pool.Name, "scrub", err)
 			}
 		}
 	}
 }
 
+// poolScrubDue checks a pool-specific scrub schedule: a cloud schedule for
+// task "ZFS_SCRUB:<pool>" first, then scheduling.pool_scrub_schedules. ok is
+// false when the pool has neither and the global schedule applies.
+func (s *Scheduler) poolScrubDue(ctx context.Context, poolName string, lastScrub int64, now time.Time) (due, ok bool) {
+	scheduleType, value, ok := s.poolScrubSchedule(ctx, poolName)
+	if !ok {
+		return false, false
+	}
+
+	if scheduleType == "CRON" {
+		nextTime, err := NextCronTime(value, time.Unix(lastScrub, 0))
+		if err != nil {
+			s.logger.Warn("invalid pool scrub schedule", "pool", poolName, "value", value, "error", err)
+			return false, true
+		}
+		return now.After(nextTime), true
+	}
+	interval, err := ParseInterval(value)
+	if err != nil {
+		s.logger.Warn("invalid pool scrub schedule", "pool", poolName, "value", value, "error", err)
+		return false, true
+	}
+	return lastScrub == 0 || now.Sub(time.Unix(lastScrub, 0)) >= interval, true
+}
+
+// poolScrubSchedule returns the pool-specific scrub schedule, if any, in
+// the precedence poolScrubDue applies.
+func (s *Scheduler) poolScrubSchedule(ctx context.Context, poolName string) (scheduleType, value string, ok bool) {
+	if cloudSchedule, _ := s.store.GetScheduleForTask(ctx, "ZFS_SCRUB:"+poolName); cloudSchedule != nil && cloudSchedule.Enabled {
+		return cloudSchedule.ScheduleType, cloudSchedule.ScheduleValue, true
+	}
+	if v, found := s.cfg.PoolScrubSchedules[poolName]; found {
+		if len(strings.Fields(v)) == 5 {
+			return "CRON", v, true
+		}
+		return "INTERVAL", v, true
+	}
+	return "", "", false
+}
+
+// scrubCheckInterval is how often the scrub scheduler runs: the global
+// interval, shortened to an hour when pools have their own schedules so a
+// weekly pool isn't only looked at on a monthly tick.
+func (s *Scheduler) scrubCheckInterval() time.Duration {
+	interval := s.cfg.ZFSScrubInterval
+	if len(s.cfg.PoolScrubSchedules) > 0 && (interval <= 0 || interval > time.Hour) {
+		interval = time.Hour
+	}
+	return interval
+}
+
 func (s *Scheduler) runPruneLoop(ctx context.Context) {
 	if s.store != nil {
 		if err := s.store.PruneOldSnapshots(ctx, 90); err != nil {
 			s.logger.Warn("prune snapshots failed", "error", err)
 		}
+		if err := s.store.PruneSnapshotsByCount(ctx, s.cfg.SnapshotMaxRows); err != nil {
+			s.logger.Warn("prune snapshots by count failed", "error", err)
+		}
+		if err := s.store.PruneCollectionMetrics(ctx); err != nil {
+			s.logger.Warn("prune collection metrics failed", "error", err)
+		}
+		if err := s.store.PruneSystemMetrics(ctx); err != nil {
+			s.logger.Warn("prune system metrics failed", "error", err)
+		}
+		if err := s.store.PruneCommandHistory(ctx); err != nil {
+			s.logger.Warn("prune command history failed", "error", err)
+		}
 	}
 }
 
+func (s *Scheduler) runCheckpointLoop(ctx context.Context) {
+	if s.store == nil {
+		return
+	}
+	_, before := s.store.FileSizes()
+	if err := s.store.Checkpoint(ctx); err != nil {
+		s.logger.Warn("wal checkpoint failed", "error", err)
+		return
+	}
+	_, after := s.store.FileSizes()
+	s.logger.Debug("wal checkpoint complete", "wal_bytes_before", before, "wal_bytes_after", after)
+}
+
 func (s *Scheduler) dispatchHealth(ctx context.Context) {
 	if s.health == nil {
 		return
 	}
 	report, err := s.health.Summary(ctx)
+	if err == nil {
+		s.idle.observe(report)
+		s.publishStatus(report)
+	}
 	if err == nil && s.notifier != nil {
+		// Reconcile first: it decides which alerts may page.
+		s.notifier.Reconcile(ctx, report.Alerts)
 		s.notifier.Send(ctx, report.Alerts)
+		if _, err := s.notifier.ObserveStatus(ctx, report); err != nil {
+			s.logger.Warn("status transition notification failed", "error", err)
+		}
 	}
 	if err == nil && s.uplink != nil {
 		_ = s.uplink.SendSummary(ctx, report)
 	}
 }
 
+// statusEvent is the payload of a status change on the event stream.
+type statusEvent struct {
+	PreviousStatus string   `json:"previous_status"`
+	Status         string   `json:"status"`
+	Reasons        []string `json:"reasons,omitempty"`
+	Timestamp      int64    `json:"timestamp"`
+}
+
+// publishStatus emits a status event when the overall status differs from
+// the previous evaluation. The first status after startup is only recorded.
+func (s *Scheduler) publishStatus(report types.HealthReport) {
+	if s.store == nil || report.Status == "" {
+		return
+	}
+	s.statusMu.Lock()
+	prev := s.lastStatus
+	s.lastStatus = report.Status
+	s.statusMu.Unlock()
+	if prev == "" || prev == report.Status {
+		return
+	}
+	s.store.Events().Publish(events.Event{Type: events.TypeStatus, Data: statusEvent{
+		PreviousStatus: prev,
+		Status:         report.Status,
+		Reasons:        report.StatusReasons,
+		Timestamp:      time.Now().Unix(),
+	}})
+}
+
 func (s *Scheduler) runCloudUploadLoop(ctx context.Context) {
 	if s.uplink == nil || !s.cloudCfg.Enabled {
 		return
@@ -420,42 +942,20 @@ func (s *Scheduler) runCloudUploadLoop(ctx context.Context) {
 		return
 	}
 
-	// Get latest snapshots for each disk
 	var smartSnaps []types.SmartSnapshot
 	var nvmeSnaps []types.NvmeSnapshot
-	for _, disk := range disks {
-		if disk.Type == "nvme" {
-			hist, _ := s.store.NvmeHistory(ctx, disk.ID, 1)
-			if len(hist) > 0 {
-				snap := hist[0]
-				nvmeSnaps = append(nvmeSnaps, types.NvmeSnapshot{
-					DiskID:             snap.DiskID,
-					PercentUsed:        snap.PercentUsed,
-					MediaErrors:        snap.MediaErrors,
-					ErrorLogEntries:    snap.ErrorLogEntries,
-					PowerOnHours:       snap.PowerOnHours,
-					UnsafeShutdowns:    snap.UnsafeShutdowns,
-					TemperatureC:       snap.TemperatureC,
-					DataWrittenBytes:   snap.DataWrittenBytes,
-					DataReadBytes:      snap.DataReadBytes,
-					TimestampUnixMilli: snap.Timestamp * 1000,
-				})
-			}
-		} else {
-			hist, _ := s.store.SmartHistory(ctx, disk.ID, 1)
-			if len(hist) > 0 {
-				snap := hist[0]
-				smartSnaps = append(smartSnaps, types.SmartSnapshot{
-					DiskID:             snap.DiskID,
-					HealthStatus:       snap.HealthStatus,
-					Reallocated:        snap.Reallocated,
-					Pending:            snap.Pending,
-					OfflineUncorrect:   snap.OfflineUncorrect,
-					CRCErrors:          snap.CRCErrors,
-					TemperatureC:       snap.TemperatureC,
-					PowerOnHours:        snap.PowerOnHours,
-					TimestampUnixMilli: snap.Timestamp * 1000,
-				})
+	var marks map[string]int64
+	if s.cloudCfg.UploadHistory {
+		smartSnaps, nvmeSnaps, marks = s.unsentSnapshots(ctx, disks)
+	} else {
+		// Latest snapshot for each disk
+		for _, disk := range disks {
+			if disk.Type == "nvme" {
+				if hist, _ := s.store.NvmeHistory(ctx, disk.ID, 1); len(hist) > 0 {
+					nvmeSnaps = append(nvmeSnaps, nvmeSnapshotType(hist[0]))
+				}
+			} else if hist, _ := s.store.SmartHistory(ctx, disk.ID, 1); len(hist) > 0 {
+				smartSnaps = append(smartSnaps, smartSnapshotType(hist[0]))
 			}
 		}
 	}
@@ -497,6 +997,16 @@ func (s *Scheduler) runCloudUploadLoop(ctx context.Context) {
 			Serial:    d.Serial,
 			Firmware:  d.Firmware,
 			SizeBytes: d.SizeBytes,
+			LastSeen:  d.LastSeen,
+
+			SmartUnsupported: d.SmartUnsupported,
+			WriteCache:       d.WriteCache,
+
+			RotationRate: d.RotationRate,
+			FormFactor:   d.FormFactor,
+			ATAVersion:   d.ATAVersion,
+			SATAVersion:  d.SATAVersion,
+			TRIM:         d.TRIM,
 		})
 	}
 
@@ -511,11 +1021,156 @@ func (s *Scheduler) runCloudUploadLoop(ctx context.Context) {
 
 	if err := s.uplink.SendFullSnapshot(ctx, payload); err != nil {
 		s.logger.Warn("failed to upload snapshot to cloud", "error", err)
-	} else {
-		s.logger.Debug("uploaded snapshot to cloud")
+		return
+	}
+	s.logger.Debug("uploaded snapshot to cloud", "smart", len(smartSnaps), "nvme", len(nvmeSnaps))
+	for key, id := range marks {
+		if err := s.store.SetMeta(ctx, key, strconv.FormatInt(id, 10)); err != nil {
+			s.logger.Warn("failed to record upload high-water mark", "key", key, "error", err)
+		}
+	}
+}
+
+// defaultUploadBatchSize bounds a history upload when cloud.upload_batch_size
+// is unset.
+const defaultUploadBatchSize = 200
+
+// uploadMarkKey is the meta key holding the ID of the last snapshot of a
+// disk uploaded in cloud.upload_history mode.
+func uploadMarkKey(table, diskID string) string {
+	return "cloud_upload_hwm:" + table + ":" + diskID
+}
+
+// unsentSnapshots collects, oldest first, the snapshots not yet uploaded,
+// along with the high-water marks to record once the upload succeeds. The
+// batch is split across disks so one disk's backlog after a long outage
+// can't starve the others; whatever doesn't fit goes with the next upload.
+func (s *Scheduler) unsentSnapshots(ctx context.Context, disks []storage.Disk) ([]types.SmartSnapshot, []types.NvmeSnapshot, map[string]int64) {
+	batch := s.cloudCfg.UploadBatchSize
+	if batch <= 0 {
+		batch = defaultUploadBatchSize
+	}
+	perDisk := max(1, batch/max(1, len(disks)))
+
+	var smartSnaps []types.SmartSnapshot
+	var nvmeSnaps []types.NvmeSnapshot
+	marks := make(map[string]int64)
+	for _, disk := range disks {
+		table := "smart"
+		if disk.Type == "nvme" {
+			table = "nvme"
+		}
+		key := uploadMarkKey(table, disk.ID)
+		mark, _ := s.store.GetMeta(ctx, key)
+		after, _ := strconv.ParseInt(mark, 10, 64)
+
+		if table == "nvme" {
+			hist, err := s.store.NvmeSnapshotsSince(ctx, disk.ID, after, perDisk)
+			if err != nil {
+				s.logger.Warn("failed to read nvme history for cloud upload", "disk", disk.ID, "error", err)
+				continue
+			}
+			for _, snap := range hist {
+				nvmeSnaps = append(nvmeSnaps, nvmeSnapshotType(snap))
+				marks[key] = snap.ID
+			}
+			continue
+		}
+		hist, err := s.store.SmartSnapshotsSince(ctx, disk.ID, after, perDisk)
+		if err != nil {
+			s.logger.Warn("failed to read smart history for cloud upload", "disk", disk.ID, "error", err)
+			continue
+		}
+		for _, snap := range hist {
+			smartSnaps = append(smartSnaps, smartSnapshotType(snap))
+			marks[key] = snap.ID
+		}
+	}
+	return smartSnaps, nvmeSnaps, marks
+}
+
+func smartSnapshotType(snap storage.SmartSnapshot) types.SmartSnapshot {
+	return types.SmartSnapshot{
+		DiskID:             snap.DiskID,
+		HealthStatus:       snap.HealthStatus,
+		Reallocated:        snap.Reallocated,
+		Pending:            snap.Pending,
+		OfflineUncorrect:   snap.OfflineUncorrect,
+		CRCErrors:          snap.CRCErrors,
+		TemperatureC:       snap.TemperatureC,
+		PowerOnHours:        snap.PowerOnHours,
+		PowerCycleCount:    snap.PowerCycleCount,
+		StartStopCount:     snap.StartStopCount,
+		SASInvalidDwords:   snap.SASInvalidDwords,
+		SASDisparityErrors: snap.SASDisparityErrors,
+		SASLossOfSync:      snap.SASLossOfSync,
+		SASPhyResets:       snap.SASPhyResets,
+		SCTLifetimeMinC:    snap.SCTLifetimeMinC,
+		SCTLifetimeMaxC:    snap.SCTLifetimeMaxC,
+		SCTOverTempCount:   snap.SCTOverTempCount,
+		SCTUnderTempCount:  snap.SCTUnderTempCount,
+		TimestampUnixMilli: snap.Timestamp * 1000,
 	}
 }
 
+func nvmeSnapshotType(snap storage.NvmeSnapshot) types.NvmeSnapshot {
+	return types.NvmeSnapshot{
+		DiskID:             snap.DiskID,
+		PercentUsed:        snap.PercentUsed,
+		MediaErrors:        snap.MediaErrors,
+		ErrorLogEntries:    snap.ErrorLogEntries,
+		PowerOnHours:       snap.PowerOnHours,
+		UnsafeShutdowns:    snap.UnsafeShutdowns,
+		TemperatureC:       snap.TemperatureC,
+		DataWrittenBytes:   snap.DataWrittenBytes,
+		DataReadBytes:      snap.DataReadBytes,
+		TimestampUnixMilli: snap.Timestamp * 1000,
+
+		NamespaceCapacityBytes: snap.NamespaceCapacityBytes,
+		NamespaceUsedBytes:     snap.NamespaceUsedBytes,
+
+		FirmwareActiveSlot: snap.FirmwareActiveSlot,
+		FirmwareSlots:      snap.FirmwareSlots,
+
+		WarningTempMinutes:  snap.WarningTempMinutes,
+		CriticalTempMinutes: snap.CriticalTempMinutes,
+
+		SanitizeStatus:   snap.SanitizeStatus,
+		SanitizeProgress: snap.SanitizeProgress,
+	}
+}
+
+// maxInventoryPools bounds the pool names sent with a registration.
+const maxInventoryPools = 64
+
+// RegistrationInventory summarises the stored disks and pools for
+// uplink.Client.RegisterHost. It returns nil if the store can't be read, so
+// registration can go ahead without it.
+func (s *Scheduler) RegistrationInventory(ctx context.Context) *uplink.Inventory {
+	disks, err := s.store.ListDisks(ctx)
+	if err != nil {
+		s.logger.Warn("failed to list disks for registration inventory", "error", err)
+		return nil
+	}
+	pools, err := s.store.ListPools(ctx)
+	if err != nil {
+		s.logger.Warn("failed to list pools for registration inventory", "error", err)
+		return nil
+	}
+
+	inv := &uplink.Inventory{DiskCount: len(disks), PoolCount: len(pools)}
+	for _, d := range disks {
+		inv.TotalCapacityBytes += d.SizeBytes
+	}
+	for i, p := range pools {
+		if i == maxInventoryPools {
+			break
+		}
+		inv.Pools = append(inv.Pools, p.Name)
+	}
+	return inv
+}
+
 func (s *Scheduler) runCommandPollLoop(ctx context.Context) {
 	if s.uplink == nil || !s.cloudCfg.Enabled {
 		return
@@ -526,6 +1181,7 @@ func (s *Scheduler) runCommandPollLoop(ctx context.Context) {
 		s.logger.Warn("failed to poll commands from cloud", "error", err)
 		return
 	}
+	s.checkClockSkew(ctx)
 
 	for _, cmd := range commands {
 		select {
@@ -536,6 +1192,37 @@ func (s *Scheduler) runCommandPollLoop(ctx context.Context) {
 	}
 }
 
+// Meta keys holding the last clock skew measured against the cloud, shown in
+// /api/v1/diagnostics.
+const (
+	metaClockSkew   = "cloud_clock_skew_seconds"
+	metaClockSkewAt = "cloud_clock_skew_checked_at"
+)
+
+// checkClockSkew records the skew seen on the last cloud response and warns
+// once when it exceeds cloud.max_clock_skew, since snapshot timestamps are
+// agent-local and a wrong clock misaligns the cloud charts.
+func (s *Scheduler) checkClockSkew(ctx context.Context) {
+	skew, at, ok := s.uplink.ClockSkew()
+	if !ok {
+		return
+	}
+	_ = s.store.SetMeta(ctx, metaClockSkew, strconv.FormatInt(int64(skew/time.Second), 10))
+	_ = s.store.SetMeta(ctx, metaClockSkewAt, strconv.FormatInt(at.Unix(), 10))
+
+	limit := s.cloudCfg.MaxClockSkew
+	switch {
+	case limit > 0 && skew.Abs() > limit:
+		if !s.skewWarned {
+			s.logger.Warn("host clock differs from the cloud; check NTP", "skew", skew, "max", limit)
+			s.skewWarned = true
+		}
+	case s.skewWarned:
+		s.logger.Info("host clock back in line with the cloud", "skew", skew)
+		s.skewWarned = false
+	}
+}
+
 func (s *Scheduler) runCommandProcessor(ctx context.Context) {
 	for {
 		select {
@@ -547,7 +1234,20 @@ func (s *Scheduler) runCommandProcessor(ctx context.Context) {
 	}
 }
 
+// commandAllowed reports whether cloud.allowed_commands permits a remote
+// command type. An unset list allows everything, as before the option
+// existed; an empty list allows nothing.
+func (s *Scheduler) commandAllowed(cmdType string) bool {
+	return s.cloudCfg.AllowedCommands == nil || slices.Contains(s.cloudCfg.AllowedCommands, cmdType)
+}
+
 func (s *Scheduler) processCommand(ctx context.Context, cmd uplink.Command) {
+	if !s.commandAllowed(cmd.Type) {
+		s.logger.Warn("refusing remote command not in cloud.allowed_commands", "type", cmd.Type, "cmd_id", cmd.ID)
+		s.finishCommand(ctx, cmd, false, fmt.Sprintf("refused: %s is not in the agent's allowed_commands", cmd.Type))
+		return
+	}
+
 	var success bool
 	var errorMsg string
 
@@ -572,7 +1272,7 @@ func (s *Scheduler) processCommand(ctx context.Context, cmd uplink.Command) {
 		}
 
 	case "collect_smart":
-		disks, err := s.store.ListDisks(ctx)
+		disks, err := s.pollOrder(ctx)
 		if err != nil {
 			errorMsg = err.Error()
 			break
@@ -589,7 +1289,7 @@ func (s *Scheduler) processCommand(ctx context.Context, cmd uplink.Command) {
 		}
 
 	case "collect_nvme":
-		disks, err := s.store.ListDisks(ctx)
+		disks, err := s.pollOrder(ctx)
 		if err != nil {
 			errorMsg = err.Error()
 			break
@@ -617,14 +1317,60 @@ func (s *Scheduler) processCommand(ctx context.Context, cmd uplink.Command) {
 			errorMsg = "ZFS collector not available"
 		}
 
+	case "locate_disk":
+		var params struct {
+			DiskID          string `json:"disk_id"`
+			DurationSeconds int    `json:"duration_seconds"`
+		}
+		if err := json.Unmarshal(cmd.Params, &params); err != nil {
+			errorMsg = fmt.Sprintf("invalid params: %v", err)
+			break
+		}
+		if err := s.LocateDisk(ctx, params.DiskID, time.Duration(params.DurationSeconds)*time.Second); err != nil {
+			errorMsg = err.Error()
+		} else {
+			success = true
+			s.logger.Info("executed remote locate command", "disk", params.DiskID, "cmd_id", cmd.ID)
+		}
+
+	case "refresh_schedules":
+		if n, err := s.RefreshSchedules(ctx); err != nil {
+			errorMsg = err.Error()
+		} else {
+			success = true
+			s.logger.Info("executed remote schedule refresh command", "stored", n, "cmd_id", cmd.ID)
+		}
+
 	default:
 		errorMsg = fmt.Sprintf("unknown command type: %s", cmd.Type)
 	}
 
-	// Acknowledge command
+	s.finishCommand(ctx, cmd, success, errorMsg)
+}
+
+// finishCommand records a command's outcome in the local command history,
+// so operators can audit what the cloud had the agent do, and acknowledges it.
+func (s *Scheduler) finishCommand(ctx context.Context, cmd uplink.Command, success bool, errorMsg string) {
+	if s.store != nil {
+		err := s.store.AddCommandHistory(ctx, storage.CommandRecord{
+			CommandID: cmd.ID,
+			Type:      cmd.Type,
+			Params:    cmd.Params,
+			Success:   success,
+			Error:     errorMsg,
+		})
+		if err != nil {
+			s.logger.Warn("failed to record command history", "cmd_id", cmd.ID, "error", err)
+		}
+	}
+	s.ackCommand(ctx, cmd.ID, success, errorMsg)
+}
+
+// ackCommand reports a command's outcome back to the cloud.
+func (s *Scheduler) ackCommand(ctx context.Context, cmdID string, success bool, errorMsg string) {
 	if s.uplink != nil {
-		if err := s.uplink.AcknowledgeCommand(ctx, cmd.ID, success, errorMsg); err != nil {
-			s.logger.Warn("failed to acknowledge command", "cmd_id", cmd.ID, "error", err)
+		if err := s.uplink.AcknowledgeCommand(ctx, cmdID, success, errorMsg); err != nil {
+			s.logger.Warn("failed to acknowledge command", "cmd_id", cmdID, "error", err)
 		}
 	}
 }
@@ -0,0 +1,606 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/alertlog"
+	"github.com/metabinary-ltd/storagesentinel/internal/collectors"
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/discovery"
+	"github.com/metabinary-ltd/storagesentinel/internal/health"
+	"github.com/metabinary-ltd/storagesentinel/internal/notifier"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+	"github.com/metabinary-ltd/storagesentinel/internal/uplink"
+)
+
+func openTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	store, err := storage.Open(filepath.Join(t.TempDir(), "state.db"), slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestSmartTestsThrottledPerRun(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	bin := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store := openTestStore(t)
+
+	ctx := context.Background()
+	for _, name := range []string{"sda", "sdb", "sdc", "sdd", "sde"} {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-" + name, Name: "/dev/" + name, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+
+	cfg := config.SchedulingConfig{SmartTestMaxPerRun: 2}
+	s := New(slog.Default(), cfg, config.CloudConfig{}, store, nil, collectors.NewSmartCollector(store, bin, slog.Default()), nil, nil, nil, nil, nil)
+
+	calls := func() []string {
+		b, _ := os.ReadFile(logPath)
+		return strings.Fields(strings.ReplaceAll(string(b), "-t long ", ""))
+	}
+
+	tried := make(map[string]bool)
+	if deferred := s.runSmartTestsScheduler(ctx, "long", time.Hour, tried); deferred != 3 {
+		t.Fatalf("expected 3 deferred disks, got %d", deferred)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Fatalf("expected 2 tests started in one pass, got %v", got)
+	}
+
+	// The next passes pick up the deferred disks without repeating any.
+	s.runSmartTestsScheduler(ctx, "long", time.Hour, make(map[string]bool))
+	if deferred := s.runSmartTestsScheduler(ctx, "long", time.Hour, make(map[string]bool)); deferred != 0 {
+		t.Fatalf("expected nothing deferred after three passes, got %d", deferred)
+	}
+	if got := calls(); len(got) != 5 {
+		t.Fatalf("expected each disk tested once, got %v", got)
+	}
+}
+
+func TestSmartTestsStaggeredAcrossTicks(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	bin := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store := openTestStore(t)
+
+	ctx := context.Background()
+	for _, name := range []string{"sda", "sdb", "sdc"} {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-" + name, Name: "/dev/" + name, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+
+	cfg := config.SchedulingConfig{SmartTestMaxPerRun: 2, SmartTestStagger: time.Hour}
+	s := New(slog.Default(), cfg, config.CloudConfig{}, store, nil, collectors.NewSmartCollector(store, bin, slog.Default()), nil, nil, nil, nil, nil)
+	calls := func() int {
+		b, _ := os.ReadFile(logPath)
+		return strings.Count(string(b), "\n")
+	}
+
+	// The first batch returns at once rather than sleeping out the stagger.
+	start := time.Now()
+	s.runStaggeredSmartTests(ctx, "long", time.Hour)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected the run to return without waiting, took %v", elapsed)
+	}
+	if n := calls(); n != 2 {
+		t.Fatalf("expected 2 tests in the first batch, got %d", n)
+	}
+
+	// The rest wait until the stagger has passed.
+	s.runDeferredSmartTests(ctx)
+	if n := calls(); n != 2 {
+		t.Fatalf("expected no tests before the stagger passed, got %d", n)
+	}
+	s.staggerMu.Lock()
+	run := s.staggered["long"]
+	run.due = time.Now().Add(-time.Second)
+	s.staggered["long"] = run
+	s.staggerMu.Unlock()
+	s.runDeferredSmartTests(ctx)
+	if n := calls(); n != 3 {
+		t.Fatalf("expected the last disk tested once due, got %d", n)
+	}
+	if len(s.staggered) != 0 {
+		t.Fatalf("expected nothing left staggered, got %+v", s.staggered)
+	}
+}
+
+func TestRootDiskExcludedFromSmartTests(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	bin := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store := openTestStore(t)
+
+	prev := discovery.RootDisk
+	discovery.RootDisk = func() string { return "/dev/sda" }
+	defer func() { discovery.RootDisk = prev }()
+
+	ctx := context.Background()
+	for _, name := range []string{"sda", "sdb"} {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-" + name, Name: "/dev/" + name, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+
+	s := New(slog.Default(), config.SchedulingConfig{ExcludeRootDisk: true}, config.CloudConfig{}, store, nil, collectors.NewSmartCollector(store, bin, slog.Default()), nil, nil, nil, nil, nil)
+	s.runSmartTestsScheduler(ctx, "long", time.Hour, make(map[string]bool))
+	b, _ := os.ReadFile(logPath)
+	if got := strings.TrimSpace(string(b)); got != "-t long /dev/sdb" {
+		t.Fatalf("expected only the data disk tested, got %q", got)
+	}
+
+	// Without the toggle the boot disk is tested like any other.
+	s.cfg.ExcludeRootDisk = false
+	s.runSmartTestsScheduler(ctx, "long", time.Hour, make(map[string]bool))
+	if b, _ := os.ReadFile(logPath); !strings.Contains(string(b), "/dev/sda") {
+		t.Fatalf("expected the boot disk tested with exclusion off, got %q", b)
+	}
+}
+
+func TestDisallowedRemoteCommandRefused(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	zpool := filepath.Join(dir, "zpool")
+	if err := os.WriteFile(zpool, []byte("#!/bin/sh\necho \"$@\" >> "+logPath+"\n"), 0o755); err != nil {
+		t.Fatalf("write fake zpool: %v", err)
+	}
+	store := openTestStore(t)
+
+	var ack struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	var ackPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ackPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&ack)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cloudCfg := config.CloudConfig{Enabled: true, AllowedCommands: []string{"collect_smart"}}
+	zfs := collectors.NewZfsCollector(store, zpool, "zfs", slog.Default())
+	s := New(slog.Default(), config.SchedulingConfig{}, cloudCfg, store, nil, nil, nil, zfs, nil, nil,
+		uplink.New(srv.URL, "token", "host-1", "host"))
+
+	s.processCommand(context.Background(), uplink.Command{ID: "cmd-1", Type: "trigger_scrub", Params: json.RawMessage(`{"pool_name":"tank"}`)})
+
+	if _, err := os.Stat(logPath); err == nil {
+		b, _ := os.ReadFile(logPath)
+		t.Fatalf("expected zpool not to run, got calls: %s", b)
+	}
+	if ackPath != "/api/v1/agent/commands/cmd-1/ack" {
+		t.Fatalf("expected the command to be acknowledged, got path %q", ackPath)
+	}
+	if ack.Success || !strings.Contains(ack.Error, "refused") {
+		t.Fatalf("expected a refused ack, got %+v", ack)
+	}
+}
+
+func TestRegistrationIncludesInventory(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	for i, name := range []string{"sda", "sdb", "nvme0n1"} {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: "id-" + name, Name: "/dev/" + name, Type: "hdd", SizeBytes: int64(i+1) << 40}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	for _, pool := range []string{"tank", "backup"} {
+		if err := store.UpsertPool(ctx, pool, "ONLINE", 0, 0); err != nil {
+			t.Fatalf("upsert pool: %v", err)
+		}
+	}
+
+	var body struct {
+		Hostname  string            `json:"hostname"`
+		Inventory *uplink.Inventory `json:"inventory"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_ = json.NewEncoder(w).Encode(uplink.RegisterResponse{HostID: "host-1"})
+	}))
+	defer srv.Close()
+
+	s := New(slog.Default(), config.SchedulingConfig{}, config.CloudConfig{}, store, nil, nil, nil, nil, nil, nil, nil)
+	client := uplink.New(srv.URL, "token", "", "nas")
+	if _, err := client.RegisterHost(ctx, "linux", "1.0", s.RegistrationInventory(ctx)); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	inv := body.Inventory
+	if inv == nil {
+		t.Fatal("expected inventory in registration body")
+	}
+	if inv.DiskCount != 3 || inv.TotalCapacityBytes != 6<<40 || inv.PoolCount != 2 {
+		t.Fatalf("unexpected inventory %+v", inv)
+	}
+	if !slices.Contains(inv.Pools, "tank") || !slices.Contains(inv.Pools, "backup") {
+		t.Fatalf("expected pool names in inventory, got %v", inv.Pools)
+	}
+}
+
+func TestScrubBreakerOpensAfterRepeatedFailures(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	zpool := filepath.Join(dir, "zpool")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\necho \"cannot scrub 'tank': pool is currently unavailable\" >&2\nexit 1\n"
+	if err := os.WriteFile(zpool, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake zpool: %v", err)
+	}
+	store := openTestStore(t)
+
+	ctx := context.Background()
+	if err := store.UpsertPool(ctx, "tank", "FAULTED", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	cfg := config.SchedulingConfig{ZFSScrubInterval: time.Hour, BreakerThreshold: 3, BreakerCooldown: time.Hour}
+	n := notifier.New(store, config.NotificationsConfig{}, time.Hour, "warning", slog.Default())
+	s := New(slog.Default(), cfg, config.CloudConfig{}, store, nil, nil, nil, collectors.NewZfsCollector(store, zpool, "zfs", slog.Default()), nil, n, nil)
+
+	calls := func() int {
+		b, _ := os.ReadFile(logPath)
+		return strings.Count(string(b), "scrub tank")
+	}
+	for i := 0; i < 5; i++ {
+		s.runZfsScrubScheduler(ctx)
+	}
+	if got := calls(); got != 3 {
+		t.Fatalf("expected 3 scrub attempts before the breaker opened, got %d", got)
+	}
+	if open := s.OpenBreakers(); !slices.Equal(open, []string{"scrub:tank"}) {
+		t.Fatalf("expected scrub:tank breaker open, got %v", open)
+	}
+	alerts, _ := store.ListAlerts(ctx, storage.AlertFilter{})
+	if len(alerts) != 1 || alerts[0].Subject != "Scheduled scrub suspended" || alerts[0].SourceID != "tank" {
+		t.Fatalf("expected one suspension alert, got %+v", alerts)
+	}
+
+	// A manual reset lets the scheduler try again.
+	s.ResetBreaker("scrub:tank")
+	s.runZfsScrubScheduler(ctx)
+	if got := calls(); got != 4 {
+		t.Fatalf("expected a new attempt after reset, got %d attempts", got)
+	}
+
+	// Failures count from zero again after a reset.
+	s.runZfsScrubScheduler(ctx)
+	s.runZfsScrubScheduler(ctx)
+	if got := calls(); got != 6 {
+		t.Fatalf("expected breaker to reopen after 3 more failures, got %d attempts", got)
+	}
+	if !s.breaker.allow("scrub:tank", time.Now().Add(2*time.Hour)) {
+		t.Fatal("expected the breaker to allow a retry once the cooldown passes")
+	}
+}
+
+func TestPoolScrubScheduleOverridesGlobalInterval(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	zpool := filepath.Join(dir, "zpool")
+	if err := os.WriteFile(zpool, []byte("#!/bin/sh\necho \"$@\" >> "+logPath+"\n"), 0o755); err != nil {
+		t.Fatalf("write fake zpool: %v", err)
+	}
+	store := openTestStore(t)
+
+	ctx := context.Background()
+	eightDaysAgo := time.Now().Add(-8 * 24 * time.Hour).Unix()
+	for _, name := range []string{"hddpool", "ssdpool"} {
+		if err := store.UpsertPool(ctx, name, "ONLINE", eightDaysAgo, 0); err != nil {
+			t.Fatalf("upsert pool: %v", err)
+		}
+	}
+	cfg := config.SchedulingConfig{
+		ZFSScrubInterval:   720 * time.Hour,
+		PoolScrubSchedules: map[string]string{"ssdpool": "7d"},
+	}
+	s := New(slog.Default(), cfg, config.CloudConfig{}, store, nil, nil, nil, collectors.NewZfsCollector(store, zpool, "zfs", slog.Default()), nil, nil, nil)
+
+	s.runZfsScrubScheduler(ctx)
+	b, _ := os.ReadFile(logPath)
+	if got := strings.TrimSpace(string(b)); got != "scrub ssdpool" {
+		t.Fatalf("expected only ssdpool scrubbed on its weekly schedule, got %q", got)
+	}
+	if got := s.scrubCheckInterval(); got != time.Hour {
+		t.Fatalf("expected hourly checks with per-pool schedules, got %v", got)
+	}
+}
+
+func TestOverlappingCollectionTickSkipped(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	release := filepath.Join(dir, "release")
+	bin := filepath.Join(dir, "smartctl")
+	// Each call is logged, then blocks until the test releases it.
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n" +
+		"while [ ! -e " + release + " ]; do sleep 0.01; done\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store := openTestStore(t)
+
+	ctx := context.Background()
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-SLOW", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	s := New(slog.Default(), config.SchedulingConfig{}, config.CloudConfig{}, store, nil, collectors.NewSmartCollector(store, bin, slog.Default()), nil, nil, nil, nil, nil)
+
+	// Count collection passes (smartctl -H ...), not follow-up log reads.
+	calls := func() int {
+		b, _ := os.ReadFile(logPath)
+		return strings.Count(string(b), "-H ")
+	}
+
+	first := make(chan struct{})
+	go func() {
+		s.runSmartLoop(ctx)
+		close(first)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for calls() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("first collection never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The next tick fires while the first pass is still collecting.
+	s.runSmartLoop(ctx)
+	if got := calls(); got != 1 {
+		t.Fatalf("expected the overlapping tick to be skipped, got %d smartctl calls", got)
+	}
+
+	if err := os.WriteFile(release, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	<-first
+	s.runSmartLoop(ctx)
+	if got := calls(); got != 2 {
+		t.Fatalf("expected a tick after the first pass finished to collect, got %d calls", got)
+	}
+}
+
+func TestUploadHistoryFillsGap(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-A", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+	addSnaps := func(from, to int64) {
+		for ts := from; ts <= to; ts++ {
+			if err := store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "ata-A", Timestamp: ts, HealthStatus: "PASSED"}); err != nil {
+				t.Fatalf("add snapshot: %v", err)
+			}
+		}
+	}
+
+	var uploads [][]int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload uplink.SnapshotPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		var sent []int64
+		for _, snap := range payload.SmartSnaps {
+			sent = append(sent, snap.TimestampUnixMilli/1000)
+		}
+		uploads = append(uploads, sent)
+	}))
+	defer srv.Close()
+
+	cloudCfg := config.CloudConfig{Enabled: true, UploadHistory: true, UploadBatchSize: 3}
+	s := New(slog.Default(), config.SchedulingConfig{}, cloudCfg, store, nil, nil, nil, nil,
+		health.NewStorageBackedProvider(store, slog.Default()), nil, uplink.New(srv.URL, "token", "", "nas"))
+
+	addSnaps(1, 2)
+	s.runCloudUploadLoop(ctx)
+	// The cloud was unreachable while these were collected.
+	addSnaps(3, 7)
+	s.runCloudUploadLoop(ctx)
+	s.runCloudUploadLoop(ctx)
+	s.runCloudUploadLoop(ctx)
+
+	want := [][]int64{{1, 2}, {3, 4, 5}, {6, 7}, nil}
+	if len(uploads) != len(want) {
+		t.Fatalf("expected %d uploads, got %v", len(want), uploads)
+	}
+	for i := range want {
+		if !slices.Equal(uploads[i], want[i]) {
+			t.Fatalf("upload %d: expected snapshots %v, got %v", i, want[i], uploads[i])
+		}
+	}
+}
+
+func TestPoolMembersCollectedFirst(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	bin := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\nfor a; do last=$a; done\n[ \"$1\" = -H ] && echo \"$last\" >> " + logPath + "\nexit 0\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake smartctl: %v", err)
+	}
+	store := openTestStore(t)
+
+	ctx := context.Background()
+	for _, name := range []string{"sda", "sdb", "sdc", "sdd"} {
+		if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-" + name, Name: "/dev/" + name, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{"ata-sdb", "ata-sdd"}, "mirror"); err != nil {
+		t.Fatalf("upsert pool devices: %v", err)
+	}
+
+	cfg := config.SchedulingConfig{PollPriority: config.PollPriority{
+		PoolMembersFirst: true,
+		Rules:            []config.PriorityRule{{Match: "sdc", Priority: 10}},
+	}}
+	s := New(slog.Default(), cfg, config.CloudConfig{}, store, nil, collectors.NewSmartCollector(store, bin, slog.Default()), nil, nil, nil, nil, nil)
+	s.runSmartLoop(ctx)
+
+	b, _ := os.ReadFile(logPath)
+	want := []string{"/dev/sdc", "/dev/sdb", "/dev/sdd", "/dev/sda"}
+	if got := strings.Fields(string(b)); !slices.Equal(got, want) {
+		t.Fatalf("expected collection order %v, got %v", want, got)
+	}
+}
+
+func TestNextRunRecordedForIntervalTasks(t *testing.T) {
+	store := openTestStore(t)
+
+	ctx := context.Background()
+	scrubbed := time.Now().Add(-2 * 24 * time.Hour).Truncate(time.Second)
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", scrubbed.Unix(), 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	cfg := config.SchedulingConfig{ZFSStatusInterval: time.Hour, ZFSScrubInterval: 7 * 24 * time.Hour}
+	s := New(slog.Default(), cfg, config.CloudConfig{}, store, nil, nil, nil, nil, nil, nil, nil)
+
+	runs := func() map[string]storage.TaskRun {
+		t.Helper()
+		list, err := store.ListTaskRuns(ctx)
+		if err != nil {
+			t.Fatalf("list task runs: %v", err)
+		}
+		byTask := make(map[string]storage.TaskRun)
+		for _, r := range list {
+			byTask[r.TaskType] = r
+		}
+		return byTask
+	}
+
+	last := scrubbed.Add(48 * time.Hour)
+	s.recordNextRun(ctx, "ZFS_STATUS", cfg.ZFSStatusInterval, time.Hour, last)
+	// The scrub loop ticks hourly but the pool isn't due for another five days.
+	s.recordNextRun(ctx, "ZFS_SCRUB", cfg.ZFSScrubInterval, time.Hour, last)
+	got := runs()
+	if r := got["ZFS_STATUS"]; r.Source != "config" || r.LastRun != last.Unix() || r.NextRun != last.Add(time.Hour).Unix() {
+		t.Fatalf("unexpected ZFS_STATUS run %+v", r)
+	}
+	if r := got["ZFS_SCRUB"]; r.NextRun != scrubbed.Add(cfg.ZFSScrubInterval).Unix() {
+		t.Fatalf("expected next scrub when tank is due, got %+v", r)
+	}
+
+	// A more frequent cloud schedule takes precedence over config.
+	if err := store.StoreSchedules(ctx, []storage.CloudSchedule{{ID: "s1", TaskType: "ZFS_STATUS", ScheduleType: "INTERVAL", ScheduleValue: "30m", Enabled: true}}); err != nil {
+		t.Fatalf("store schedules: %v", err)
+	}
+	s.recordNextRun(ctx, "ZFS_STATUS", cfg.ZFSStatusInterval, 30*time.Minute, last)
+	if r := runs()["ZFS_STATUS"]; r.Source != "cloud" || r.ScheduleValue != "30m" || r.NextRun != last.Add(30*time.Minute).Unix() {
+		t.Fatalf("unexpected ZFS_STATUS run with cloud schedule %+v", r)
+	}
+}
+
+func TestOnceModeReportsMissingTool(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestStore(t)
+	ctx := context.Background()
+	if err := store.UpsertDisk(ctx, storage.Disk{ID: "ata-sda", Name: "/dev/sda", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	s := New(slog.Default(), config.SchedulingConfig{}, config.CloudConfig{}, store, nil,
+		collectors.NewSmartCollector(store, filepath.Join(missing, "smartctl"), slog.Default()), nil,
+		collectors.NewZfsCollector(store, filepath.Join(missing, "zpool"), "zfs", slog.Default()), nil, nil, nil)
+
+	err := s.Start(ctx, true)
+	if err == nil {
+		t.Fatal("expected once mode to fail with smartctl and zpool missing")
+	}
+	for _, want := range []string{"SMART: 1 of 1 disks failed (/dev/sda:", "ZFS: zpool list:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in once-mode error, got: %v", want, err)
+		}
+	}
+}
+
+func TestExecutedCommandRecorded(t *testing.T) {
+	dir := t.TempDir()
+	zpool := filepath.Join(dir, "zpool")
+	if err := os.WriteFile(zpool, []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatalf("write fake zpool: %v", err)
+	}
+	store := openTestStore(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cloudCfg := config.CloudConfig{Enabled: true, AllowedCommands: []string{"trigger_scrub"}}
+	zfs := collectors.NewZfsCollector(store, zpool, "zfs", slog.Default())
+	s := New(slog.Default(), config.SchedulingConfig{}, cloudCfg, store, nil, nil, nil, zfs, nil, nil,
+		uplink.New(srv.URL, "token", "host-1", "host"))
+
+	ctx := context.Background()
+	s.processCommand(ctx, uplink.Command{ID: "cmd-1", Type: "trigger_scrub", Params: json.RawMessage(`{"pool_name":"tank"}`)})
+	s.processCommand(ctx, uplink.Command{ID: "cmd-2", Type: "collect_zfs"})
+
+	history, err := store.ListCommandHistory(ctx, 10)
+	if err != nil {
+		t.Fatalf("list command history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected both commands recorded, got %+v", history)
+	}
+	refused, executed := history[0], history[1]
+	if executed.CommandID != "cmd-1" || executed.Type != "trigger_scrub" || !executed.Success || string(executed.Params) != `{"pool_name":"tank"}` || executed.Timestamp == 0 {
+		t.Fatalf("unexpected record for the executed command: %+v", executed)
+	}
+	if refused.CommandID != "cmd-2" || refused.Success || !strings.Contains(refused.Error, "refused") {
+		t.Fatalf("unexpected record for the refused command: %+v", refused)
+	}
+}
+
+func TestHealthDispatchLogsAlertOnce(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	alertlog.Init(path, 0)
+	t.Cleanup(func() { alertlog.Init("", 0) })
+	if err := store.UpsertPool(ctx, "tank", "DEGRADED", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+
+	n := notifier.New(store, config.NotificationsConfig{}, time.Hour, "warning", slog.Default())
+	s := New(slog.Default(), config.SchedulingConfig{}, config.CloudConfig{}, store, nil, nil, nil, nil,
+		health.NewStorageBackedProvider(store, slog.Default()), n, nil)
+	// Every summary re-evaluates the degraded pool; only the notified alert
+	// reaches the log.
+	s.dispatchHealth(ctx)
+	s.dispatchHealth(ctx)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read alert log: %v", err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines != 1 || !strings.Contains(string(b), "tank") {
+		t.Fatalf("expected the pool alert logged once, got %q", b)
+	}
+}
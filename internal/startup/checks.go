@@ -4,35 +4,89 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
 )
 
 type Requirements struct {
 	Smartctl string
 	Nvme     string
 	Zpool    string
+	Zfs      string
+}
+
+// FromTools builds requirements from the configured tool names.
+func FromTools(t config.ToolsConfig) Requirements {
+	return Requirements{Smartctl: t.Smartctl, Nvme: t.Nvme, Zpool: t.Zpool, Zfs: t.Zfs}
+}
+
+// Tools returns the (resolved) requirements as a ToolsConfig so callers can
+// record the absolute paths before constructing collectors and discovery.
+func (r Requirements) Tools() config.ToolsConfig {
+	return config.ToolsConfig{Smartctl: r.Smartctl, Nvme: r.Nvme, Zpool: r.Zpool, Zfs: r.Zfs}
 }
 
-func RunChecks(req Requirements) error {
-	if err := ensureBinary(req.Smartctl); err != nil {
-		return err
+// searchDirs are checked when a binary isn't on PATH. Appliance distros
+// (TrueNAS, Proxmox) keep storage tools in sbin dirs that a service's
+// minimal PATH often omits.
+var searchDirs = []string{
+	"/usr/local/sbin",
+	"/usr/local/bin",
+	"/usr/sbin",
+	"/usr/bin",
+	"/sbin",
+	"/bin",
+}
+
+// RunChecks verifies the required binaries exist and returns the
+// requirements with every tool resolved to an absolute path, suitable for
+// passing to the collectors and discovery.
+func RunChecks(req Requirements) (Requirements, error) {
+	var err error
+	if req.Smartctl, err = resolveBinary(req.Smartctl); err != nil {
+		return req, err
 	}
-	if err := ensureBinary(req.Nvme); err != nil {
-		return err
+	if req.Nvme, err = resolveBinary(req.Nvme); err != nil {
+		return req, err
 	}
-	if err := ensureBinary(req.Zpool); err != nil {
-		return err
+	if req.Zpool, err = resolveBinary(req.Zpool); err != nil {
+		return req, err
 	}
-	return nil
+	if req.Zfs != "" {
+		if req.Zfs, err = resolveBinary(req.Zfs); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
 }
 
-func ensureBinary(name string) error {
+func resolveBinary(name string) (string, error) {
 	if name == "" {
-		return fmt.Errorf("binary not specified")
+		return "", fmt.Errorf("binary not specified")
+	}
+	if strings.Contains(name, "/") {
+		if !isExecutable(name) {
+			return "", fmt.Errorf("required binary not found: %s", name)
+		}
+		return filepath.Abs(name)
 	}
-	if _, err := exec.LookPath(name); err != nil {
-		return fmt.Errorf("required binary not found: %s", name)
+	if p, err := exec.LookPath(name); err == nil {
+		return filepath.Abs(p)
 	}
-	return nil
+	for _, dir := range searchDirs {
+		candidate := filepath.Join(dir, name)
+		if isExecutable(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("required binary not found: %s", name)
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode().Perm()&0o111 != 0
 }
 
 func EnsurePaths(paths ...string) error {
@@ -0,0 +1,52 @@
+package startup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveBinaryNonstandardDir(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "zpool")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("write binary: %v", err)
+	}
+
+	prev := searchDirs
+	searchDirs = []string{t.TempDir(), dir}
+	defer func() { searchDirs = prev }()
+	t.Setenv("PATH", "")
+
+	got, err := resolveBinary("zpool")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if got != bin {
+		t.Fatalf("expected %s, got %s", bin, got)
+	}
+
+	if _, err := resolveBinary("definitely-not-a-tool"); err == nil {
+		t.Fatalf("expected error for missing binary")
+	}
+}
+
+func TestRunChecksResolvesAbsolutePaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"smartctl", "nvme", "zpool", "zfs"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	req, err := RunChecks(Requirements{Smartctl: "smartctl", Nvme: "nvme", Zpool: "zpool", Zfs: "zfs"})
+	if err != nil {
+		t.Fatalf("run checks: %v", err)
+	}
+	for _, p := range []string{req.Smartctl, req.Nvme, req.Zpool, req.Zfs} {
+		if !filepath.IsAbs(p) {
+			t.Fatalf("expected absolute path, got %q (%+v)", p, req)
+		}
+	}
+}
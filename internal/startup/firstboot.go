@@ -0,0 +1,145 @@
+package startup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+// firstBootKey is the meta key set once the first-boot self-check has run.
+const firstBootKey = "first_boot_completed"
+
+// FirstBoot is a one-time guided self-check for new installs. It runs
+// discovery and a collection pass, then logs a readiness summary covering
+// tools, discovered hardware and notification channels.
+type FirstBoot struct {
+	Store         *storage.Store
+	Tools         config.ToolsConfig
+	Notifications config.NotificationsConfig
+
+	Discover func(context.Context) error // e.g. discovery.Service.RunOnce
+	Collect  func(context.Context) error // one SMART/NVMe/ZFS collection pass
+	SendTest func(context.Context) error // e.g. notifier.Notifier.SendTest; used when Notifications.TestOnFirstBoot is set
+
+	Logger *slog.Logger
+}
+
+// Run performs the self-check unless it has already completed on this
+// database. It returns the report lines and whether the check ran. The flag
+// is set even when problems are found: the report is informational and
+// shouldn't repeat on every restart.
+func (f FirstBoot) Run(ctx context.Context) ([]string, bool, error) {
+	done, err := f.Store.GetMeta(ctx, firstBootKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("read first boot flag: %w", err)
+	}
+	if done != "" {
+		return nil, false, nil
+	}
+
+	var lines []string
+	problems := 0
+	report := func(ok bool, format string, args ...interface{}) {
+		mark := "ok"
+		if !ok {
+			mark = "!!"
+			problems++
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s", mark, fmt.Sprintf(format, args...)))
+	}
+
+	for _, tool := range []struct{ name, bin string }{
+		{"smartctl", f.Tools.Smartctl},
+		{"nvme", f.Tools.Nvme},
+		{"zpool", f.Tools.Zpool},
+		{"zfs", f.Tools.Zfs},
+	} {
+		if tool.bin == "" {
+			continue
+		}
+		if path, err := resolveBinary(tool.bin); err != nil {
+			report(false, "%s not found (%s)", tool.name, tool.bin)
+		} else {
+			report(true, "%s found at %s", tool.name, path)
+		}
+	}
+
+	if f.Discover != nil {
+		if err := f.Discover(ctx); err != nil {
+			report(false, "discovery failed: %v", err)
+		}
+	}
+	disks, err := f.Store.ListDisks(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("list disks: %w", err)
+	}
+	pools, err := f.Store.ListPools(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("list pools: %w", err)
+	}
+	report(len(disks) > 0, "discovered %d disk(s) and %d ZFS pool(s)", len(disks), len(pools))
+
+	if f.Collect != nil {
+		if err := f.Collect(ctx); err != nil {
+			report(false, "collection failed: %v", err)
+		}
+	}
+	withData := 0
+	for _, d := range disks {
+		if d.Type == "nvme" {
+			if snap, _ := f.Store.LatestNvme(ctx, d.ID); snap != nil {
+				withData++
+			}
+		} else if snap, _ := f.Store.LatestSmart(ctx, d.ID); snap != nil {
+			withData++
+		}
+	}
+	if len(disks) > 0 {
+		report(withData == len(disks), "health data collected for %d of %d disk(s)", withData, len(disks))
+	}
+
+	channels := notificationChannels(f.Notifications)
+	if len(channels) == 0 {
+		report(false, "no notification channels configured; alerts are only visible via the API")
+	} else {
+		report(true, "notification channels: %s", strings.Join(channels, ", "))
+		if f.Notifications.TestOnFirstBoot && f.SendTest != nil {
+			if err := f.SendTest(ctx); err != nil {
+				report(false, "test notification could not be queued: %v", err)
+			} else {
+				report(true, "test notification queued")
+			}
+		}
+	}
+
+	if problems == 0 {
+		lines = append(lines, "ready: storagesentinel is fully configured")
+	} else {
+		lines = append(lines, fmt.Sprintf("ready with %d issue(s): see above", problems))
+	}
+	if f.Logger != nil {
+		f.Logger.Info("first boot self-check")
+		for _, l := range lines {
+			f.Logger.Info("  " + l)
+		}
+	}
+
+	if err := f.Store.SetMeta(ctx, firstBootKey, strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return lines, true, fmt.Errorf("set first boot flag: %w", err)
+	}
+	return lines, true, nil
+}
+
+func notificationChannels(cfg config.NotificationsConfig) []string {
+	var names []string
+	for _, ch := range cfg.Channels() {
+		names = append(names, ch.Name)
+	}
+	return names
+}
@@ -0,0 +1,69 @@
+package startup
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/config"
+	"github.com/metabinary-ltd/storagesentinel/internal/storage"
+)
+
+func TestFirstBootRunsOnce(t *testing.T) {
+	store, err := storage.Open(filepath.Join(t.TempDir(), "state.db"), slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	var discovered, collected, tests int
+	fb := FirstBoot{
+		Store: store,
+		Tools: config.ToolsConfig{Smartctl: "sh", Zpool: "definitely-not-a-real-binary"},
+		Notifications: config.NotificationsConfig{
+			Webhooks:        []config.WebhookConfig{{Name: "ops", URL: "http://127.0.0.1:1/"}},
+			PagerDuty:       config.PagerDutyConfig{Enabled: true},
+			TestOnFirstBoot: true,
+		},
+		Discover: func(ctx context.Context) error {
+			discovered++
+			return store.UpsertDisk(ctx, storage.Disk{ID: "ata-TEST", Name: "/dev/sda", Type: "hdd"})
+		},
+		Collect: func(ctx context.Context) error {
+			collected++
+			return store.AddSmartSnapshot(ctx, storage.SmartSnapshot{DiskID: "ata-TEST", HealthStatus: "passed"})
+		},
+		SendTest: func(context.Context) error {
+			tests++
+			return nil
+		},
+		Logger: slog.Default(),
+	}
+
+	lines, ran, err := fb.Run(ctx)
+	if err != nil || !ran {
+		t.Fatalf("expected first run to execute, ran=%v err=%v", ran, err)
+	}
+	if discovered != 1 || collected != 1 || tests != 1 {
+		t.Fatalf("expected one discovery, collection and test, got %d/%d/%d", discovered, collected, tests)
+	}
+	report := strings.Join(lines, "\n")
+	for _, want := range []string{"zpool not found", "discovered 1 disk(s)", "health data collected for 1 of 1", "channels: webhook:ops, pagerduty", "ready with 1 issue(s)"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+	if v, _ := store.GetMeta(ctx, firstBootKey); v == "" {
+		t.Fatal("expected first boot flag to be set")
+	}
+
+	if _, ran, err := fb.Run(ctx); err != nil || ran {
+		t.Fatalf("expected second run to be skipped, ran=%v err=%v", ran, err)
+	}
+	if discovered != 1 || collected != 1 || tests != 1 {
+		t.Fatalf("second run should not repeat work, got %d/%d/%d", discovered, collected, tests)
+	}
+}
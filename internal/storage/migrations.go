@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schema version 1 is the set of tables created by initSchema. Each later
+// change is a numbered migration, applied in order in its own transaction
+// and recorded in meta.schema_version, so a database is upgraded step by
+// step from whatever version it was last opened with.
+//
+// The CREATE TABLE statements always describe the latest schema, so on a
+// fresh database the migrations find nothing to do; they must therefore be
+// idempotent. New tables need no migration, as initSchema creates any that
+// are missing. Append new migrations to the end of the list and never
+// renumber or edit released ones.
+
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{2, "smart spin retry and load cycle counts", addColumns("smart_snapshots", "spin_retry_count INTEGER", "load_cycle_count INTEGER")},
+	{3, "disk firmware", addColumns("disks", "firmware TEXT")},
+	{4, "nvme raw output", addColumns("nvme_snapshots", "raw_output TEXT")},
+	{5, "smart grown defects", addColumns("smart_snapshots", "grown_defects INTEGER")},
+	{6, "alert resolution time", addColumns("alerts", "resolved_at TIMESTAMP")},
+	{7, "smart error and power counters", addColumns("smart_snapshots",
+		"reported_uncorrect INTEGER", "command_timeout INTEGER", "power_cycle_count INTEGER", "start_stop_count INTEGER")},
+	{8, "disks without smart", addColumns("disks", "smart_unsupported INTEGER DEFAULT 0")},
+	{9, "nvme namespace utilization", addColumns("nvme_snapshots", "ns_capacity_bytes INTEGER", "ns_used_bytes INTEGER", "ns_thin INTEGER")},
+	{10, "nvme firmware slots", addColumns("nvme_snapshots", "fw_active_slot INTEGER", "fw_slots TEXT")},
+	{11, "nvme temperature time", addColumns("nvme_snapshots", "warning_temp_time INTEGER", "critical_comp_time INTEGER")},
+	{12, "disk write cache", addColumns("disks", "write_cache TEXT")},
+	{13, "solid-state correction", addColumns("disks", "solid_state INTEGER DEFAULT 0")},
+	{14, "sas phy counters", addColumns("smart_snapshots",
+		"sas_invalid_dwords INTEGER", "sas_disparity_errors INTEGER", "sas_loss_of_sync INTEGER", "sas_phy_resets INTEGER")},
+	{15, "sct temperature history", addColumns("smart_snapshots",
+		"sct_lifetime_min_c INTEGER", "sct_lifetime_max_c INTEGER", "sct_over_temp_count INTEGER", "sct_under_temp_count INTEGER")},
+	{16, "nvme sanitize status", addColumns("nvme_snapshots", "sanitize_status TEXT", "sanitize_progress REAL")},
+	{17, "compress smart raw json", compressRawColumn("smart_snapshots", "raw_json")},
+	{18, "compress nvme raw output", compressRawColumn("nvme_snapshots", "raw_output")},
+	{19, "per-device pool roles", poolDeviceRoles},
+	{20, "smartctl identity fields", addColumns("disks",
+		"rotation_rate INTEGER", "form_factor TEXT", "ata_version TEXT", "sata_version TEXT", "trim_support TEXT")},
+	{21, "nvme available spare", addColumns("nvme_snapshots", "available_spare REAL")},
+	{22, "nvme hardware ack baseline", addColumns("disk_hardware_acks",
+		"critical_warnings TEXT", "available_spare REAL", "percent_used REAL")},
+	{23, "recovery alert flag", addColumns("alerts", "resolves INTEGER NOT NULL DEFAULT 0")},
+}
+
+// SchemaVersion is the schema version this build migrates databases to.
+var SchemaVersion = migrations[len(migrations)-1].version
+
+// migrate applies every migration newer than the database's recorded
+// version. A database written by a newer build is refused rather than used
+// with a schema this build doesn't understand.
+func (s *Store) migrate(ctx context.Context) error {
+	current, err := s.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, SchemaVersion)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if s.logger != nil {
+			s.logger.Info("applied schema migration", "version", m.version, "name", m.name)
+		}
+	}
+	return nil
+}
+
+func (s *Store) applyMigration(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO meta (key, value) VALUES ('schema_version', ?)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value
+	`, strconv.Itoa(m.version)); err != nil {
+		return fmt.Errorf("record version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// schemaVersion returns meta.schema_version, or 0 for a database that has
+// never recorded one.
+func (s *Store) schemaVersion(ctx context.Context) (int, error) {
+	value, err := s.GetMeta(ctx, "schema_version")
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	if value == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", value)
+	}
+	return version, nil
+}
+
+// poolDeviceRoles adds zfs_pool_devices.role. vdev_type used to hold a
+// pool-wide role guess; such values move to role, to be corrected by the
+// next discovery pass.
+func poolDeviceRoles(ctx context.Context, tx *sql.Tx) error {
+	if err := addColumns("zfs_pool_devices", "role TEXT")(ctx, tx); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE zfs_pool_devices SET role = vdev_type, vdev_type = ''
+		WHERE role IS NULL AND vdev_type IN ('data', 'cache', 'log', 'spare')
+	`)
+	return err
+}
+
+// addColumns returns a migration adding "name TYPE" columns to table,
+// skipping any that already exist (SQLite has no ADD COLUMN IF NOT EXISTS).
+func addColumns(table string, columns ...string) func(context.Context, *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		existing, err := tableColumns(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		for _, col := range columns {
+			name, _, _ := strings.Cut(col, " ")
+			if existing[name] {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, col)); err != nil {
+				return fmt.Errorf("add %s.%s: %w", table, name, err)
+			}
+		}
+		return nil
+	}
+}
+
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, typeName string
+		var dfltValue sql.NullString
+		if err := rows.Scan(&cid, &name, &typeName, &notnull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+)
+
+// Raw smartctl JSON and nvme-cli output (smart_snapshots.raw_json,
+// nvme_snapshots.raw_output) is kept with every snapshot and dominates the
+// database size, but compresses very well. It is stored gzipped as a BLOB;
+// the gzip magic bytes mark a compressed value, as neither JSON nor
+// nvme-cli text can start with them. Rows written before compression stay
+// plain text and read back unchanged.
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// packRaw compresses raw output for storage. Values that don't shrink
+// (including empty ones) are stored as-is.
+func packRaw(raw string) any {
+	if raw == "" {
+		return raw
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, raw); err != nil {
+		return raw
+	}
+	if err := zw.Close(); err != nil {
+		return raw
+	}
+	if buf.Len() >= len(raw) {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+// unpackRaw reverses packRaw, passing plain text through.
+func unpackRaw(stored string) (string, error) {
+	if !isPackedRaw([]byte(stored)) {
+		return stored, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader([]byte(stored)))
+	if err != nil {
+		return "", fmt.Errorf("decompress raw output: %w", err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("decompress raw output: %w", err)
+	}
+	return string(raw), nil
+}
+
+func isPackedRaw(b []byte) bool {
+	return bytes.HasPrefix(b, gzipMagic)
+}
+
+// compressRawColumn is the migration compressing the plain-text raw output
+// already stored in table.column, in batches by id so a large history never
+// has to be held in memory.
+func compressRawColumn(table, column string) func(context.Context, *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		const batch = 500
+		var after int64
+		for {
+			rows, err := tx.QueryContext(ctx, fmt.Sprintf(
+				"SELECT id, %s FROM %s WHERE id > ? AND %s IS NOT NULL AND %s != '' ORDER BY id LIMIT ?",
+				column, table, column, column), after, batch)
+			if err != nil {
+				return err
+			}
+			type rawRow struct {
+				id  int64
+				raw []byte
+			}
+			var pending []rawRow
+			n := 0
+			for rows.Next() {
+				var r rawRow
+				if err := rows.Scan(&r.id, &r.raw); err != nil {
+					rows.Close()
+					return err
+				}
+				n++
+				after = r.id
+				if !isPackedRaw(r.raw) {
+					pending = append(pending, r)
+				}
+			}
+			if err := rows.Close(); err != nil {
+				return err
+			}
+			for _, r := range pending {
+				packed, ok := packRaw(string(r.raw)).([]byte)
+				if !ok {
+					continue
+				}
+				if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column), packed, r.id); err != nil {
+					return fmt.Errorf("compress %s.%s row %d: %w", table, column, r.id, err)
+				}
+			}
+			if n < batch {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/alertlog"
+	"github.com/metabinary-ltd/storagesentinel/internal/events"
+	"modernc.org/sqlite"
+)
+
+// ErrReadOnly is returned by writes once the store has switched to read-only
+// mode.
+var ErrReadOnly = errors.New("database is read-only")
+
+// SQLite primary result codes that mean the database file can no longer be
+// written, e.g. after the filesystem was remounted read-only.
+const (
+	sqliteReadOnly = 8
+	sqliteIOErr    = 10
+	sqliteCantOpen = 14
+	sqliteCodeMask = 0xff
+)
+
+// ReadOnly reports whether a write has failed because the database can no
+// longer be written. Reads keep working; writes return ErrReadOnly without
+// touching the database until the agent is restarted.
+func (s *Store) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// OnReadOnly registers fn to be called, once, with the critical alert
+// raised when the store switches to read-only mode. The alert can't be
+// stored, so fn should deliver it by other means and must not write to the
+// store.
+func (s *Store) OnReadOnly(fn func(a Alert)) {
+	s.mu.Lock()
+	s.onReadOnly = fn
+	s.mu.Unlock()
+}
+
+// ReadOnlyAlert returns the alert raised when the store switched to
+// read-only mode; ok is false while the store is writable.
+func (s *Store) ReadOnlyAlert() (a Alert, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnlyAlert == nil {
+		return Alert{}, false
+	}
+	return *s.readOnlyAlert, true
+}
+
+// exec runs a write statement, refusing it in read-only mode.
+func (s *Store) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if s.readOnly.Load() {
+		return nil, ErrReadOnly
+	}
+	result, err := s.db.ExecContext(ctx, query, args...)
+	return result, s.checkWrite(err)
+}
+
+// beginTx starts a write transaction, refusing it in read-only mode.
+// Callers pass the Commit error through checkWrite.
+func (s *Store) beginTx(ctx context.Context) (*sql.Tx, error) {
+	if s.readOnly.Load() {
+		return nil, ErrReadOnly
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	return tx, s.checkWrite(err)
+}
+
+// checkWrite switches the store to read-only mode when err shows the
+// database file can't be written, and returns err unchanged.
+func (s *Store) checkWrite(err error) error {
+	if err == nil || !isReadOnlyErr(err) {
+		return err
+	}
+	if !s.readOnly.CompareAndSwap(false, true) {
+		return err
+	}
+	s.logger.Error("database is no longer writable; switching to read-only mode", "path", s.path, "error", err)
+	a := Alert{
+		Severity:   "critical",
+		SourceType: "system",
+		SourceID:   "database",
+		Subject:    "Database is read-only",
+		Message: fmt.Sprintf("Writes to %s are failing (%v). Monitoring data is no longer recorded; "+
+			"the API keeps serving the last stored state. Fix the filesystem and restart the agent.", s.path, err),
+		Timestamp: time.Now().Unix(),
+	}
+	s.mu.Lock()
+	s.readOnlyAlert = &a
+	fn := s.onReadOnly
+	s.mu.Unlock()
+
+	// Neither the alerts table nor the notification queue can carry this
+	// alert, so it goes out on the alert log, the event stream and fn.
+	alertlog.Write(alertlog.Entry{
+		Timestamp:  a.Timestamp,
+		Severity:   a.Severity,
+		SourceType: a.SourceType,
+		SourceID:   a.SourceID,
+		Subject:    a.Subject,
+		Message:    a.Message,
+	})
+	s.events.Publish(events.Event{Type: events.TypeAlert, Data: a})
+	if fn != nil {
+		fn(a)
+	}
+	return err
+}
+
+func isReadOnlyErr(err error) bool {
+	var serr *sqlite.Error
+	if !errors.As(err, &serr) {
+		return false
+	}
+	switch serr.Code() & sqliteCodeMask {
+	case sqliteReadOnly, sqliteIOErr, sqliteCantOpen:
+		return true
+	}
+	return false
+}
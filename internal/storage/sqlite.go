@@ -3,19 +3,32 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/debug"
+	"github.com/metabinary-ltd/storagesentinel/internal/events"
 	_ "modernc.org/sqlite"
 )
 
 type Store struct {
 	db     *sql.DB
+	path   string
 	logger *slog.Logger
+	events *events.Hub
+
+	readOnly      atomic.Bool
+	mu            sync.Mutex
+	readOnlyAlert *Alert
+	onReadOnly    func(a Alert)
 }
 
 type Alert struct {
@@ -27,6 +40,8 @@ type Alert struct {
 	Message      string
 	Timestamp    int64
 	Acknowledged bool
+	ResolvedAt   int64 // unix seconds; 0 while the condition is still active
+	Resolves     bool  // a recovery announcing that the condition it names cleared
 }
 
 type PoolStatus struct {
@@ -37,21 +52,47 @@ type PoolStatus struct {
 }
 
 type SmartSnapshot struct {
-	DiskID           string
-	HealthStatus     string
-	Reallocated      int64
-	Pending          int64
-	OfflineUncorrect int64
-	CRCErrors        int64
-	TemperatureC     float64
-	PowerOnHours     int64
-	SpinRetryCount   int64
-	LoadCycleCount   int64
-	RawJSON          string
-	Timestamp        int64
+	ID                int64
+	DiskID            string
+	HealthStatus      string
+	Reallocated       int64
+	Pending           int64
+	OfflineUncorrect  int64
+	CRCErrors         int64
+	TemperatureC      float64
+	PowerOnHours      int64
+	SpinRetryCount    int64
+	LoadCycleCount    int64
+	GrownDefects      int64
+	ReportedUncorrect int64
+	CommandTimeout    int64
+	PowerCycleCount   int64
+	StartStopCount    int64
+	// SAS phy error counters (smartctl -l sasphy), summed over all phys;
+	// growth points at cabling or backplane trouble rather than the disk.
+	// SASPhyRead is false when the log wasn't read (non-SAS disk, failed
+	// read, or a snapshot from before the counters were collected): the
+	// counters are then unknown, not zero.
+	SASInvalidDwords   int64
+	SASDisparityErrors int64
+	SASLossOfSync      int64
+	SASPhyResets       int64
+	SASPhyRead         bool
+	// SCT temperature status (smartctl -l scttempsts) on ATA drives that
+	// support it: the drive's own lifetime extremes and limit-crossing counts.
+	// SCTLimitCountsRead is false when the limit counts weren't read, which
+	// stores them as unknown rather than zero.
+	SCTLifetimeMinC    int64
+	SCTLifetimeMaxC    int64
+	SCTOverTempCount   int64
+	SCTUnderTempCount  int64
+	SCTLimitCountsRead bool
+	RawJSON           string
+	Timestamp         int64
 }
 
 type NvmeSnapshot struct {
+	ID                   int64
 	DiskID               string
 	PercentUsed          float64
 	MediaErrors          int64
@@ -64,6 +105,37 @@ type NvmeSnapshot struct {
 	CriticalWarningFlags string
 	RawOutput            string
 	Timestamp            int64
+
+	// Namespace capacity and utilization from `nvme id-ns`; NamespaceThin is
+	// set when the namespace supports thin provisioning (NSFEAT bit 0).
+	NamespaceCapacityBytes int64
+	NamespaceUsedBytes     int64
+	NamespaceThin          bool
+
+	// Firmware slots from `nvme fw-log`: the active slot and the revision in
+	// each populated slot, as "1:REV,2:REV". Zero/empty when not read.
+	FirmwareActiveSlot int64
+	FirmwareSlots      string
+
+	// Minutes the composite temperature has spent above the warning and
+	// critical thresholds over the drive's life (thermal throttling history).
+	// TempTimeRead is false when the smart-log didn't report them or the
+	// snapshot predates them; they are then unknown, not zero.
+	WarningTempMinutes  int64
+	CriticalTempMinutes int64
+	TempTimeRead        bool
+
+	// Most recent sanitize from `nvme sanitize-log`: never, completed,
+	// in_progress or failed ("" when not read), and percent done while in
+	// progress.
+	SanitizeStatus   string
+	SanitizeProgress float64
+
+	// Remaining spare capacity in percent. AvailableSpareRead is false when
+	// the smart-log didn't report it or the snapshot predates the field; a
+	// depleted spare reads as 0, so 0 alone can't mean "unknown".
+	AvailableSpare     float64
+	AvailableSpareRead bool
 }
 
 func Open(dbPath string, logger *slog.Logger) (*Store, error) {
@@ -71,7 +143,10 @@ func Open(dbPath string, logger *slog.Logger) (*Store, error) {
 		return nil, fmt.Errorf("create db dir: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// busy_timeout is per connection, so set it in the DSN to cover the whole
+	// pool; concurrent writers (collectors, notification workers) then wait
+	// for the lock instead of failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
@@ -79,13 +154,43 @@ func Open(dbPath string, logger *slog.Logger) (*Store, error) {
 		return nil, fmt.Errorf("set WAL: %w", err)
 	}
 
-	s := &Store{db: db, logger: logger}
+	s := &Store{db: db, path: dbPath, logger: logger, events: events.NewHub()}
 	if err := s.initSchema(); err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
+// Checkpoint copies the WAL back into the main database and truncates it.
+// Without it the -wal file can grow unbounded under sustained writes.
+func (s *Store) Checkpoint(ctx context.Context) error {
+	var busy, logFrames, checkpointed int
+	if err := s.db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE);`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return errors.New("wal checkpoint blocked by active readers or writers")
+	}
+	return nil
+}
+
+// FileSizes reports the on-disk size of the database and its WAL file.
+// A missing WAL (e.g. right after a checkpoint) reports 0.
+func (s *Store) FileSizes() (dbBytes, walBytes int64) {
+	if info, err := os.Stat(s.path); err == nil {
+		dbBytes = info.Size()
+	}
+	if info, err := os.Stat(s.path + "-wal"); err == nil {
+		walBytes = info.Size()
+	}
+	return dbBytes, walBytes
+}
+
+// Ping checks that the database is still reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 func (s *Store) Close() error {
 	if s.db == nil {
 		return nil
@@ -93,6 +198,26 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// GetMeta returns the value stored under key in the meta table, or "" if it
+// is unset.
+func (s *Store) GetMeta(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key=?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetMeta stores value under key in the meta table.
+func (s *Store) SetMeta(ctx context.Context, key, value string) error {
+	_, err := s.exec(ctx, `
+		INSERT INTO meta (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value
+	`, key, value)
+	return err
+}
+
 func (s *Store) initSchema() error {
 	schema := []string{
 		`CREATE TABLE IF NOT EXISTS meta (
@@ -115,7 +240,15 @@ func (s *Store) initSchema() error {
 			firmware TEXT,
 			size_bytes INTEGER,
 			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			smart_unsupported INTEGER DEFAULT 0,
+			write_cache TEXT,
+			solid_state INTEGER DEFAULT 0,
+			rotation_rate INTEGER,
+			form_factor TEXT,
+			ata_version TEXT,
+			sata_version TEXT,
+			trim_support TEXT
 		);`,
 		`CREATE TABLE IF NOT EXISTS smart_snapshots (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -130,6 +263,19 @@ func (s *Store) initSchema() error {
 			power_on_hours INTEGER,
 			spin_retry_count INTEGER,
 			load_cycle_count INTEGER,
+			grown_defects INTEGER,
+			reported_uncorrect INTEGER,
+			command_timeout INTEGER,
+			power_cycle_count INTEGER,
+			start_stop_count INTEGER,
+			sas_invalid_dwords INTEGER,
+			sas_disparity_errors INTEGER,
+			sas_loss_of_sync INTEGER,
+			sas_phy_resets INTEGER,
+			sct_lifetime_min_c INTEGER,
+			sct_lifetime_max_c INTEGER,
+			sct_over_temp_count INTEGER,
+			sct_under_temp_count INTEGER,
 			raw_json TEXT,
 			FOREIGN KEY (disk_id) REFERENCES disks(id)
 		);`,
@@ -147,6 +293,16 @@ func (s *Store) initSchema() error {
 			data_read_bytes INTEGER,
 			critical_warning_flags TEXT,
 			raw_output TEXT,
+			ns_capacity_bytes INTEGER,
+			ns_used_bytes INTEGER,
+			ns_thin INTEGER,
+			fw_active_slot INTEGER,
+			fw_slots TEXT,
+			warning_temp_time INTEGER,
+			critical_comp_time INTEGER,
+			sanitize_status TEXT,
+			sanitize_progress REAL,
+			available_spare REAL,
 			FOREIGN KEY (disk_id) REFERENCES disks(id)
 		);`,
 		`CREATE TABLE IF NOT EXISTS zfs_pools (
@@ -169,10 +325,93 @@ func (s *Store) initSchema() error {
 			pool_name TEXT,
 			disk_id TEXT,
 			vdev_type TEXT,
+			role TEXT,
 			PRIMARY KEY (pool_name, disk_id),
 			FOREIGN KEY (pool_name) REFERENCES zfs_pools(name) ON DELETE CASCADE,
 			FOREIGN KEY (disk_id) REFERENCES disks(id) ON DELETE CASCADE
 		);`,
+		`CREATE TABLE IF NOT EXISTS zfs_pool_errors (
+			pool_name TEXT,
+			object TEXT,
+			PRIMARY KEY (pool_name, object),
+			FOREIGN KEY (pool_name) REFERENCES zfs_pools(name) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS zfs_pool_properties (
+			pool_name TEXT PRIMARY KEY,
+			used_bytes INTEGER,
+			logical_used_bytes INTEGER,
+			compress_ratio REAL,
+			dedup TEXT,
+			dedup_ratio REAL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (pool_name) REFERENCES zfs_pools(name) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS zfs_pool_space (
+			pool_name TEXT PRIMARY KEY,
+			size_bytes INTEGER,
+			free_bytes INTEGER,
+			capacity_pct INTEGER,
+			fragmentation_pct INTEGER,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (pool_name) REFERENCES zfs_pools(name) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS md_arrays (
+			name TEXT PRIMARY KEY,
+			level TEXT,
+			state TEXT,
+			raid_disks INTEGER,
+			active_disks INTEGER,
+			sync_action TEXT,
+			sync_progress REAL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS md_array_devices (
+			array_name TEXT,
+			device TEXT,
+			state TEXT,
+			PRIMARY KEY (array_name, device),
+			FOREIGN KEY (array_name) REFERENCES md_arrays(name) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS disk_hardware_acks (
+			disk_id TEXT PRIMARY KEY,
+			health_status TEXT,
+			reallocated INTEGER,
+			pending INTEGER,
+			offline_uncorrectable INTEGER,
+			crc_errors INTEGER,
+			grown_defects INTEGER,
+			reported_uncorrect INTEGER,
+			media_errors INTEGER,
+			error_log_entries INTEGER,
+			critical_warnings TEXT,
+			available_spare REAL,
+			percent_used REAL,
+			acked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (disk_id) REFERENCES disks(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS collection_metrics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			collector TEXT NOT NULL,
+			disk_id TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS system_metrics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			load1 REAL,
+			load5 REAL,
+			load15 REAL,
+			mem_total_bytes INTEGER,
+			mem_available_bytes INTEGER,
+			arc_size_bytes INTEGER,
+			arc_target_bytes INTEGER,
+			arc_min_bytes INTEGER,
+			arc_max_bytes INTEGER,
+			arc_hits INTEGER,
+			arc_misses INTEGER,
+			arc_throttles INTEGER
+		);`,
 		`CREATE TABLE IF NOT EXISTS alerts (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -181,7 +420,16 @@ func (s *Store) initSchema() error {
 			source_id TEXT,
 			subject TEXT,
 			message TEXT,
-			acknowledged INTEGER DEFAULT 0
+			acknowledged INTEGER DEFAULT 0,
+			resolved_at TIMESTAMP,
+			resolves INTEGER NOT NULL DEFAULT 0
+		);`,
+		`CREATE TABLE IF NOT EXISTS alert_snoozes (
+			source_type TEXT NOT NULL,
+			source_id TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			snoozed_until INTEGER NOT NULL,
+			PRIMARY KEY (source_type, source_id, subject)
 		);`,
 		`CREATE TABLE IF NOT EXISTS notification_queue (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -204,6 +452,24 @@ func (s *Store) initSchema() error {
 			enabled INTEGER DEFAULT 1,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);`,
+		`CREATE TABLE IF NOT EXISTS command_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			command_id TEXT,
+			type TEXT,
+			params TEXT,
+			success INTEGER,
+			error TEXT,
+			timestamp INTEGER
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_command_history_timestamp ON command_history(timestamp);`,
+		`CREATE TABLE IF NOT EXISTS task_runs (
+			task_type TEXT PRIMARY KEY,
+			source TEXT,
+			schedule_type TEXT,
+			schedule_value TEXT,
+			last_run INTEGER,
+			next_run INTEGER
+		);`,
 	}
 
 	for _, stmt := range schema {
@@ -212,50 +478,7 @@ func (s *Store) initSchema() error {
 		}
 	}
 
-	// Migrate existing databases to add new columns
-	s.migrateSchema()
-
-	_, _ = s.db.Exec(`INSERT OR IGNORE INTO meta(key,value) VALUES ('schema_version','1')`)
-	return nil
-}
-
-func (s *Store) migrateSchema() {
-	// Add new columns to smart_snapshots if they don't exist
-	// SQLite doesn't support IF NOT EXISTS for ALTER TABLE, so we ignore errors
-	_ = s.addColumnIfNotExists("smart_snapshots", "spin_retry_count", "INTEGER")
-	_ = s.addColumnIfNotExists("smart_snapshots", "load_cycle_count", "INTEGER")
-	_ = s.addColumnIfNotExists("disks", "firmware", "TEXT")
-	_ = s.addColumnIfNotExists("nvme_snapshots", "raw_output", "TEXT")
-}
-
-func (s *Store) addColumnIfNotExists(table, column, colType string) error {
-	// Check if column exists by querying table info
-	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var cid int
-		var name string
-		var typeName string
-		var notnull int
-		var dfltValue sql.NullString
-		var pk int
-
-		if err := rows.Scan(&cid, &name, &typeName, &notnull, &dfltValue, &pk); err != nil {
-			continue
-		}
-		if name == column {
-			// Column already exists
-			return nil
-		}
-	}
-
-	// Column doesn't exist, add it
-	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, colType))
-	return err
+	return s.migrate(context.Background())
 }
 
 func dirOf(path string) string {
@@ -276,20 +499,35 @@ type Disk struct {
 	Serial    string
 	Firmware  string
 	SizeBytes int64
-	FirstSeen string
-	LastSeen  string
+	FirstSeen int64 // unix seconds
+	LastSeen  int64 // unix seconds; stale when older than the latest discovery pass
+
+	SmartUnsupported bool   // smartctl reported the device has no usable SMART
+	WriteCache       string // "enabled", "disabled" or "" when unknown
+
+	DiskInfo
+}
+
+// DiskInfo is the drive identity reported by `smartctl -i`. Fields are
+// empty (or 0) when the drive or transport doesn't report them.
+type DiskInfo struct {
+	RotationRate int64  // rpm; 0 for solid-state drives
+	FormFactor   string // e.g. "3.5 inches", "2.5 inches", "M.2"
+	ATAVersion   string // e.g. "ACS-3 T13/2161-D revision 3b"
+	SATAVersion  string // e.g. "SATA 3.2, 6.0 Gb/s (current: 6.0 Gb/s)"
+	TRIM         string // e.g. "Available, deterministic, zeroed"
 }
 
 func (s *Store) UpsertDisk(ctx context.Context, d Disk) error {
 	if d.ID == "" {
 		return errors.New("disk id required")
 	}
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		INSERT INTO disks (id, name, type, model, serial, firmware, size_bytes)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			name=excluded.name,
-			type=excluded.type,
+			type=CASE WHEN disks.solid_state=1 AND excluded.type='hdd' THEN 'sata_ssd' ELSE excluded.type END,
 			model=excluded.model,
 			serial=excluded.serial,
 			firmware=excluded.firmware,
@@ -299,8 +537,293 @@ func (s *Store) UpsertDisk(ctx context.Context, d Disk) error {
 	return err
 }
 
+// SetSmartUnsupported records whether smartctl can read SMART data from a
+// disk. UpsertDisk leaves the flag alone so discovery doesn't reset it.
+func (s *Store) SetSmartUnsupported(ctx context.Context, diskID string, unsupported bool) error {
+	_, err := s.exec(ctx, `UPDATE disks SET smart_unsupported=? WHERE id=?`, unsupported, diskID)
+	return err
+}
+
+// SetDiskInfo stores the smartctl identity fields of a disk.
+func (s *Store) SetDiskInfo(ctx context.Context, diskID string, info DiskInfo) error {
+	_, err := s.exec(ctx, `
+		UPDATE disks SET rotation_rate=?, form_factor=?, ata_version=?, sata_version=?, trim_support=? WHERE id=?
+	`, info.RotationRate, info.FormFactor, info.ATAVersion, info.SATAVersion, info.TRIM, diskID)
+	return err
+}
+
+// MarkSolidState records that SMART identifies a disk as solid-state and
+// reclassifies it from hdd to sata_ssd. Some SSDs and virtual disks claim to
+// be rotational in sysfs, so UpsertDisk keeps the correction on rediscovery.
+func (s *Store) MarkSolidState(ctx context.Context, diskID string) error {
+	_, err := s.exec(ctx, `
+		UPDATE disks SET solid_state=1, type=CASE WHEN type='hdd' THEN 'sata_ssd' ELSE type END WHERE id=?
+	`, diskID)
+	return err
+}
+
+// HardwareBaseline is the set of error counters recorded when an operator
+// acknowledges a known-bad disk (e.g. one awaiting RMA). Counters that don't
+// apply to the disk's type stay zero. For NVMe drives the critical warning
+// flags, available spare and wear are recorded too, so a drive that goes
+// read-only or keeps losing spare capacity after the ack alerts again.
+type HardwareBaseline struct {
+	DiskID            string `json:"disk_id"`
+	HealthStatus      string `json:"health_status,omitempty"`
+	Reallocated       int64  `json:"reallocated"`
+	Pending           int64  `json:"pending"`
+	OfflineUncorrect  int64  `json:"offline_uncorrectable"`
+	CRCErrors         int64  `json:"crc_errors"`
+	GrownDefects      int64  `json:"grown_defects"`
+	ReportedUncorrect int64  `json:"reported_uncorrect"`
+	MediaErrors       int64  `json:"media_errors"`
+	ErrorLogEntries   int64  `json:"error_log_entries"`
+	CriticalWarnings  string `json:"critical_warnings,omitempty"`
+	// AvailableSpare is only meaningful when AvailableSpareRead is set.
+	AvailableSpare     float64 `json:"available_spare"`
+	AvailableSpareRead bool    `json:"-"`
+	PercentUsed        float64 `json:"percent_used"`
+	AckedAt            int64   `json:"acked_at"`
+}
+
+// SmartBaseline extracts the acknowledged counters from a SMART snapshot.
+func SmartBaseline(snap SmartSnapshot) HardwareBaseline {
+	return HardwareBaseline{
+		DiskID:            snap.DiskID,
+		HealthStatus:      snap.HealthStatus,
+		Reallocated:       snap.Reallocated,
+		Pending:           snap.Pending,
+		OfflineUncorrect:  snap.OfflineUncorrect,
+		CRCErrors:         snap.CRCErrors,
+		GrownDefects:      snap.GrownDefects,
+		ReportedUncorrect: snap.ReportedUncorrect,
+	}
+}
+
+// NvmeBaseline extracts the acknowledged counters from an NVMe snapshot.
+func NvmeBaseline(snap NvmeSnapshot) HardwareBaseline {
+	return HardwareBaseline{
+		DiskID:             snap.DiskID,
+		MediaErrors:        snap.MediaErrors,
+		ErrorLogEntries:    snap.ErrorLogEntries,
+		CriticalWarnings:   snap.CriticalWarningFlags,
+		AvailableSpare:     snap.AvailableSpare,
+		AvailableSpareRead: snap.AvailableSpareRead,
+		PercentUsed:        snap.PercentUsed,
+	}
+}
+
+// SetHardwareAck stores (or replaces) the acknowledged baseline for a disk.
+func (s *Store) SetHardwareAck(ctx context.Context, b HardwareBaseline) error {
+	_, err := s.exec(ctx, `
+		INSERT INTO disk_hardware_acks (disk_id, health_status, reallocated, pending, offline_uncorrectable,
+			crc_errors, grown_defects, reported_uncorrect, media_errors, error_log_entries,
+			critical_warnings, available_spare, percent_used, acked_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(disk_id) DO UPDATE SET
+			health_status=excluded.health_status,
+			reallocated=excluded.reallocated,
+			pending=excluded.pending,
+			offline_uncorrectable=excluded.offline_uncorrectable,
+			crc_errors=excluded.crc_errors,
+			grown_defects=excluded.grown_defects,
+			reported_uncorrect=excluded.reported_uncorrect,
+			media_errors=excluded.media_errors,
+			error_log_entries=excluded.error_log_entries,
+			critical_warnings=excluded.critical_warnings,
+			available_spare=excluded.available_spare,
+			percent_used=excluded.percent_used,
+			acked_at=CURRENT_TIMESTAMP
+	`, b.DiskID, b.HealthStatus, b.Reallocated, b.Pending, b.OfflineUncorrect,
+		b.CRCErrors, b.GrownDefects, b.ReportedUncorrect, b.MediaErrors, b.ErrorLogEntries,
+		b.CriticalWarnings, optFloat(b.AvailableSpare, b.AvailableSpareRead), b.PercentUsed)
+	return err
+}
+
+// HardwareAck returns the acknowledged baseline for a disk, or nil if the
+// disk hasn't been acknowledged.
+func (s *Store) HardwareAck(ctx context.Context, diskID string) (*HardwareBaseline, error) {
+	var b HardwareBaseline
+	err := s.db.QueryRowContext(ctx, `
+		SELECT disk_id, COALESCE(health_status, ''), COALESCE(reallocated, 0), COALESCE(pending, 0),
+			COALESCE(offline_uncorrectable, 0), COALESCE(crc_errors, 0), COALESCE(grown_defects, 0),
+			COALESCE(reported_uncorrect, 0), COALESCE(media_errors, 0), COALESCE(error_log_entries, 0),
+			COALESCE(critical_warnings, ''), COALESCE(available_spare, 0), available_spare IS NOT NULL,
+			COALESCE(percent_used, 0), COALESCE(strftime('%s', acked_at), 0)
+		FROM disk_hardware_acks WHERE disk_id=?
+	`, diskID).Scan(&b.DiskID, &b.HealthStatus, &b.Reallocated, &b.Pending, &b.OfflineUncorrect,
+		&b.CRCErrors, &b.GrownDefects, &b.ReportedUncorrect, &b.MediaErrors, &b.ErrorLogEntries,
+		&b.CriticalWarnings, &b.AvailableSpare, &b.AvailableSpareRead, &b.PercentUsed, &b.AckedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ClearHardwareAck removes a disk's acknowledgement.
+func (s *Store) ClearHardwareAck(ctx context.Context, diskID string) error {
+	_, err := s.exec(ctx, `DELETE FROM disk_hardware_acks WHERE disk_id=?`, diskID)
+	return err
+}
+
+// CollectionMetric is one timed collection: a whole collector pass (DiskID
+// empty) or a single disk within it.
+type CollectionMetric struct {
+	Collector string
+	DiskID    string
+	Duration  time.Duration
+	Timestamp int64
+}
+
+// CollectionMetricStats summarises recorded durations for one collector/disk.
+type CollectionMetricStats struct {
+	Collector string  `json:"collector"`
+	DiskID    string  `json:"disk_id,omitempty"`
+	Count     int64   `json:"count"`
+	AvgMs     float64 `json:"avg_ms"`
+	MaxMs     int64   `json:"max_ms"`
+	LastMs    int64   `json:"last_ms"`
+	LastAt    int64   `json:"last_at"`
+}
+
+// maxCollectionMetrics is how many samples are kept per collector/disk.
+const maxCollectionMetrics = 200
+
+func (s *Store) RecordCollectionMetric(ctx context.Context, m CollectionMetric) error {
+	if m.Timestamp == 0 {
+		m.Timestamp = time.Now().Unix()
+	}
+	_, err := s.exec(ctx, `
+		INSERT INTO collection_metrics (timestamp, collector, disk_id, duration_ms)
+		VALUES (datetime(?,'unixepoch'), ?, ?, ?)
+	`, m.Timestamp, m.Collector, m.DiskID, m.Duration.Milliseconds())
+	return err
+}
+
+// CollectionMetricStats returns avg/max/last durations per collector and
+// disk, whole-collector passes first.
+func (s *Store) CollectionMetricStats(ctx context.Context) ([]CollectionMetricStats, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.collector, m.disk_id, COUNT(*), AVG(m.duration_ms), MAX(m.duration_ms),
+			(SELECT l.duration_ms FROM collection_metrics l
+				WHERE l.collector=m.collector AND l.disk_id=m.disk_id
+				ORDER BY l.timestamp DESC, l.id DESC LIMIT 1),
+			COALESCE(strftime('%s', MAX(m.timestamp)), 0)
+		FROM collection_metrics m
+		GROUP BY m.collector, m.disk_id
+		ORDER BY m.collector, m.disk_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CollectionMetricStats
+	for rows.Next() {
+		var st CollectionMetricStats
+		if err := rows.Scan(&st.Collector, &st.DiskID, &st.Count, &st.AvgMs, &st.MaxMs, &st.LastMs, &st.LastAt); err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// PruneCollectionMetrics keeps the newest samples per collector/disk.
+func (s *Store) PruneCollectionMetrics(ctx context.Context) error {
+	_, err := s.exec(ctx, `
+		DELETE FROM collection_metrics WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (
+					PARTITION BY collector, disk_id ORDER BY timestamp DESC, id DESC
+				) AS rn
+				FROM collection_metrics
+			) WHERE rn > ?
+		)
+	`, maxCollectionMetrics)
+	return err
+}
+
+// SystemMetrics is one sample of host load, memory and ZFS ARC state
+// (storage.system_metrics). ARC fields are zero on hosts without ZFS.
+type SystemMetrics struct {
+	Timestamp         int64   `json:"timestamp"`
+	Load1             float64 `json:"load1"`
+	Load5             float64 `json:"load5"`
+	Load15            float64 `json:"load15"`
+	MemTotalBytes     int64   `json:"mem_total_bytes"`
+	MemAvailableBytes int64   `json:"mem_available_bytes"`
+	ARCSizeBytes      int64   `json:"arc_size_bytes,omitempty"`
+	ARCTargetBytes    int64   `json:"arc_target_bytes,omitempty"` // "c": the size the ARC is aiming for
+	ARCMinBytes       int64   `json:"arc_min_bytes,omitempty"`
+	ARCMaxBytes       int64   `json:"arc_max_bytes,omitempty"`
+	ARCHits           int64   `json:"arc_hits,omitempty"`
+	ARCMisses         int64   `json:"arc_misses,omitempty"`
+	ARCThrottles      int64   `json:"arc_throttles,omitempty"` // memory_throttle_count: writes throttled for lack of memory
+}
+
+// maxSystemMetrics is how many system samples are kept.
+const maxSystemMetrics = 2000
+
+func (s *Store) AddSystemMetrics(ctx context.Context, m SystemMetrics) error {
+	if m.Timestamp == 0 {
+		m.Timestamp = time.Now().Unix()
+	}
+	_, err := s.exec(ctx, `
+		INSERT INTO system_metrics (timestamp, load1, load5, load15, mem_total_bytes, mem_available_bytes,
+			arc_size_bytes, arc_target_bytes, arc_min_bytes, arc_max_bytes, arc_hits, arc_misses, arc_throttles)
+		VALUES (datetime(?,'unixepoch'), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, m.Timestamp, m.Load1, m.Load5, m.Load15, m.MemTotalBytes, m.MemAvailableBytes,
+		m.ARCSizeBytes, m.ARCTargetBytes, m.ARCMinBytes, m.ARCMaxBytes, m.ARCHits, m.ARCMisses, m.ARCThrottles)
+	return err
+}
+
+// RecentSystemMetrics returns up to limit samples, newest first.
+func (s *Store) RecentSystemMetrics(ctx context.Context, limit int) ([]SystemMetrics, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT strftime('%s', timestamp), load1, load5, load15, mem_total_bytes, mem_available_bytes,
+			arc_size_bytes, arc_target_bytes, arc_min_bytes, arc_max_bytes, arc_hits, arc_misses, arc_throttles
+		FROM system_metrics ORDER BY timestamp DESC, id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SystemMetrics
+	for rows.Next() {
+		var m SystemMetrics
+		if err := rows.Scan(&m.Timestamp, &m.Load1, &m.Load5, &m.Load15, &m.MemTotalBytes, &m.MemAvailableBytes,
+			&m.ARCSizeBytes, &m.ARCTargetBytes, &m.ARCMinBytes, &m.ARCMaxBytes, &m.ARCHits, &m.ARCMisses, &m.ARCThrottles); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// PruneSystemMetrics keeps the newest maxSystemMetrics samples.
+func (s *Store) PruneSystemMetrics(ctx context.Context) error {
+	_, err := s.exec(ctx, `
+		DELETE FROM system_metrics WHERE id NOT IN (
+			SELECT id FROM system_metrics ORDER BY timestamp DESC, id DESC LIMIT ?
+		)
+	`, maxSystemMetrics)
+	return err
+}
+
+// SetWriteCache records a disk's volatile write cache state ("enabled",
+// "disabled" or "" when it could not be determined).
+func (s *Store) SetWriteCache(ctx context.Context, diskID, state string) error {
+	_, err := s.exec(ctx, `UPDATE disks SET write_cache=? WHERE id=?`, state, diskID)
+	return err
+}
+
 func (s *Store) ListDisks(ctx context.Context) ([]Disk, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, name, type, model, serial, firmware, size_bytes FROM disks ORDER BY id`)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+diskColumns+` FROM disks ORDER BY id`)
 	if err != nil {
 		return nil, err
 	}
@@ -308,51 +831,138 @@ func (s *Store) ListDisks(ctx context.Context) ([]Disk, error) {
 
 	var res []Disk
 	for rows.Next() {
-		var d Disk
-		var firmware sql.NullString
-		if err := rows.Scan(&d.ID, &d.Name, &d.Type, &d.Model, &d.Serial, &firmware, &d.SizeBytes); err != nil {
+		d, err := scanDisk(rows)
+		if err != nil {
 			return nil, err
 		}
-		d.Firmware = firmware.String
 		res = append(res, d)
 	}
 	return res, rows.Err()
 }
 
 func (s *Store) GetDisk(ctx context.Context, id string) (*Disk, error) {
-	row := s.db.QueryRowContext(ctx, `SELECT id, name, type, model, serial, firmware, size_bytes FROM disks WHERE id=?`, id)
-	var d Disk
-	var firmware sql.NullString
-	if err := row.Scan(&d.ID, &d.Name, &d.Type, &d.Model, &d.Serial, &firmware, &d.SizeBytes); err != nil {
+	row := s.db.QueryRowContext(ctx, `SELECT `+diskColumns+` FROM disks WHERE id=?`, id)
+	d, err := scanDisk(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	d.Firmware = firmware.String
 	return &d, nil
 }
 
+// diskTables are the tables holding per-disk rows, removed by DeleteDisk
+// and moved by RenameDisk.
+var diskTables = []string{"smart_snapshots", "nvme_snapshots", "smart_test_schedule",
+	"zfs_pool_devices", "disk_hardware_acks", "collection_metrics"}
+
+// DeleteDisk forgets a disk: its row, snapshots, test schedule, pool-device
+// mappings and hardware acknowledgement are removed and its open alerts are
+// resolved. Alerts themselves are kept as history. Reports whether the disk
+// existed.
+func (s *Store) DeleteDisk(ctx context.Context, id string) (bool, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range diskTables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE disk_id=?`, id); err != nil {
+			return false, fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE alerts SET resolved_at = datetime('now')
+		WHERE source_type = 'disk' AND source_id = ? AND resolved_at IS NULL
+	`, id); err != nil {
+		return false, fmt.Errorf("resolve alerts: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM disks WHERE id=?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, s.checkWrite(tx.Commit())
+}
+
+// RenameDisk moves a disk, with its snapshots, schedules, pool mappings and
+// alerts, from oldID to newID, e.g. when storage.disk_id_strategy changes.
+// newID must not be in use.
+func (s *Store) RenameDisk(ctx context.Context, oldID, newID string) error {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range diskTables {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET disk_id=? WHERE disk_id=?`, newID, oldID); err != nil {
+			return fmt.Errorf("rename in %s: %w", table, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE alerts SET source_id = ? WHERE source_type = 'disk' AND source_id = ?
+	`, newID, oldID); err != nil {
+		return fmt.Errorf("rename alerts: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE disks SET id=? WHERE id=?`, newID, oldID); err != nil {
+		return err
+	}
+	return s.checkWrite(tx.Commit())
+}
+
+// diskColumns is the column list shared by all disks reads; it must stay in
+// sync with scanDisk.
+const diskColumns = `id, name, type, model, serial, firmware, size_bytes,
+	COALESCE(strftime('%s', first_seen), 0), COALESCE(strftime('%s', last_seen), 0),
+	COALESCE(smart_unsupported, 0), COALESCE(write_cache, ''),
+	COALESCE(rotation_rate, 0), COALESCE(form_factor, ''), COALESCE(ata_version, ''),
+	COALESCE(sata_version, ''), COALESCE(trim_support, '')`
+
+func scanDisk(row rowScanner) (Disk, error) {
+	var d Disk
+	var firmware sql.NullString
+	if err := row.Scan(&d.ID, &d.Name, &d.Type, &d.Model, &d.Serial, &firmware, &d.SizeBytes,
+		&d.FirstSeen, &d.LastSeen, &d.SmartUnsupported, &d.WriteCache,
+		&d.RotationRate, &d.FormFactor, &d.ATAVersion, &d.SATAVersion, &d.TRIM); err != nil {
+		return d, err
+	}
+	d.Firmware = firmware.String
+	return d, nil
+}
+
+// PoolMembership describes a disk's place in a ZFS pool.
+type PoolMembership struct {
+	PoolName string `json:"pool_name"`
+	VdevType string `json:"vdev_type"`
+	Role     string `json:"role"`
+}
+
+// PoolDevice is a pool member with its role (data, log, cache, spare,
+// special or dedup) and the type of the top-level vdev holding it (mirror,
+// raidz2..., or "disk" when the device is a vdev of its own).
+type PoolDevice struct {
+	DiskID   string `json:"disk_id"`
+	Role     string `json:"role"`
+	VdevType string `json:"vdev_type"`
+}
+
 // GetDiskPoolMembership returns pool membership information for a disk
-func (s *Store) GetDiskPoolMembership(ctx context.Context, diskID string) ([]struct {
-	PoolName string
-	VdevType string
-}, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT pool_name, vdev_type FROM zfs_pool_devices WHERE disk_id=?`, diskID)
+func (s *Store) GetDiskPoolMembership(ctx context.Context, diskID string) ([]PoolMembership, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT pool_name, COALESCE(vdev_type, ''), COALESCE(role, '') FROM zfs_pool_devices WHERE disk_id=?`, diskID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var memberships []struct {
-		PoolName string
-		VdevType string
-	}
+	var memberships []PoolMembership
 	for rows.Next() {
-		var m struct {
-			PoolName string
-			VdevType string
-		}
-		if err := rows.Scan(&m.PoolName, &m.VdevType); err != nil {
+		var m PoolMembership
+		if err := rows.Scan(&m.PoolName, &m.VdevType, &m.Role); err != nil {
 			return nil, err
 		}
 		memberships = append(memberships, m)
@@ -364,7 +974,7 @@ func (s *Store) UpsertPool(ctx context.Context, name, state string, lastScrubTim
 	if name == "" {
 		return errors.New("pool name required")
 	}
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		INSERT INTO zfs_pools (name, state, last_scrub_time, last_scrub_errors)
 		VALUES (?, ?, ?, ?)
 		ON CONFLICT(name) DO UPDATE SET
@@ -405,29 +1015,338 @@ func (s *Store) ListPools(ctx context.Context) ([]PoolStatus, error) {
 	return res, rows.Err()
 }
 
-// UpsertPoolDevices updates the device mapping for a pool
+// UpsertPoolDevices makes deviceIDs the device mapping for a pool, all as
+// data devices in vdevs of the given type. See SetPoolDevices.
 func (s *Store) UpsertPoolDevices(ctx context.Context, poolName string, deviceIDs []string, vdevType string) error {
-	// Delete existing mappings for this pool
-	_, err := s.db.ExecContext(ctx, `DELETE FROM zfs_pool_devices WHERE pool_name=?`, poolName)
+	devices := make([]PoolDevice, len(deviceIDs))
+	for i, id := range deviceIDs {
+		devices[i] = PoolDevice{DiskID: id, Role: "data", VdevType: vdevType}
+	}
+	return s.SetPoolDevices(ctx, poolName, devices)
+}
+
+// SetPoolDevices makes devices the device mapping for a pool. It applies
+// only the difference from the stored mapping (inserting new devices,
+// deleting removed ones and updating changed roles or vdev types) in one
+// transaction, so concurrent readers never observe a partial or empty
+// mapping.
+func (s *Store) SetPoolDevices(ctx context.Context, poolName string, devices []PoolDevice) error {
+	tx, err := s.beginTx(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// Insert new mappings
-	for _, diskID := range deviceIDs {
-		if diskID == "" {
+	existing := make(map[string]PoolDevice)
+	rows, err := tx.QueryContext(ctx, `SELECT disk_id, COALESCE(vdev_type, ''), COALESCE(role, '') FROM zfs_pool_devices WHERE pool_name=?`, poolName)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var d PoolDevice
+		if err := rows.Scan(&d.DiskID, &d.VdevType, &d.Role); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[d.DiskID] = d
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		if d.DiskID == "" || wanted[d.DiskID] {
 			continue
 		}
-		_, err := s.db.ExecContext(ctx, `
-			INSERT INTO zfs_pool_devices (pool_name, disk_id, vdev_type)
-			VALUES (?, ?, ?)
-		`, poolName, diskID, vdevType)
-		if err != nil {
-			// Log but continue - some devices might not be in disks table yet
+		wanted[d.DiskID] = true
+		prev, ok := existing[d.DiskID]
+		switch {
+		case !ok:
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO zfs_pool_devices (pool_name, disk_id, vdev_type, role)
+				VALUES (?, ?, ?, ?)
+			`, poolName, d.DiskID, d.VdevType, d.Role); err != nil {
+				// Log but continue - some devices might not be in disks table yet
+				continue
+			}
+		case prev != d:
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE zfs_pool_devices SET vdev_type=?, role=? WHERE pool_name=? AND disk_id=?
+			`, d.VdevType, d.Role, poolName, d.DiskID); err != nil {
+				return err
+			}
+		}
+	}
+	for diskID := range existing {
+		if wanted[diskID] {
 			continue
 		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM zfs_pool_devices WHERE pool_name=? AND disk_id=?`, poolName, diskID); err != nil {
+			return err
+		}
 	}
-	return nil
+	return s.checkWrite(tx.Commit())
+}
+
+// SetPoolErrors replaces the files/objects `zpool status -v` reports as
+// having permanent errors for a pool.
+func (s *Store) SetPoolErrors(ctx context.Context, poolName string, objects []string) error {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM zfs_pool_errors WHERE pool_name=?`, poolName); err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO zfs_pool_errors (pool_name, object) VALUES (?, ?)
+		`, poolName, obj); err != nil {
+			return err
+		}
+	}
+	return s.checkWrite(tx.Commit())
+}
+
+// PoolErrors returns the objects with permanent errors recorded for a pool.
+func (s *Store) PoolErrors(ctx context.Context, poolName string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT object FROM zfs_pool_errors WHERE pool_name=? ORDER BY object`, poolName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var objects []string
+	for rows.Next() {
+		var obj string
+		if err := rows.Scan(&obj); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, rows.Err()
+}
+
+// PoolProperties holds space accounting and dedup/compression properties of
+// a pool's root dataset, as reported by `zfs get -Hp` and `zpool get -Hp`.
+type PoolProperties struct {
+	PoolName         string  `json:"pool_name"`
+	UsedBytes        int64   `json:"used_bytes"`
+	LogicalUsedBytes int64   `json:"logical_used_bytes"`
+	CompressRatio    float64 `json:"compress_ratio"`
+	Dedup            string  `json:"dedup"` // off, on, verify, sha256, ...
+	DedupRatio       float64 `json:"dedup_ratio"`
+}
+
+// DedupEnabled reports whether the dedup property is set to anything but off.
+func (p PoolProperties) DedupEnabled() bool {
+	return p.Dedup != "" && p.Dedup != "off"
+}
+
+// UpsertPoolProperties stores the latest properties for a pool.
+func (s *Store) UpsertPoolProperties(ctx context.Context, props PoolProperties) error {
+	_, err := s.exec(ctx, `
+		INSERT INTO zfs_pool_properties (pool_name, used_bytes, logical_used_bytes, compress_ratio, dedup, dedup_ratio, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(pool_name) DO UPDATE SET
+			used_bytes=excluded.used_bytes,
+			logical_used_bytes=excluded.logical_used_bytes,
+			compress_ratio=excluded.compress_ratio,
+			dedup=excluded.dedup,
+			dedup_ratio=excluded.dedup_ratio,
+			updated_at=CURRENT_TIMESTAMP
+	`, props.PoolName, props.UsedBytes, props.LogicalUsedBytes, props.CompressRatio, props.Dedup, props.DedupRatio)
+	return err
+}
+
+// GetPoolProperties returns the stored properties for a pool, or nil if
+// none have been collected.
+func (s *Store) GetPoolProperties(ctx context.Context, poolName string) (*PoolProperties, error) {
+	var props PoolProperties
+	err := s.db.QueryRowContext(ctx, `
+		SELECT pool_name, COALESCE(used_bytes,0), COALESCE(logical_used_bytes,0),
+			COALESCE(compress_ratio,0), COALESCE(dedup,''), COALESCE(dedup_ratio,0)
+		FROM zfs_pool_properties WHERE pool_name=?
+	`, poolName).Scan(&props.PoolName, &props.UsedBytes, &props.LogicalUsedBytes,
+		&props.CompressRatio, &props.Dedup, &props.DedupRatio)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &props, nil
+}
+
+// PoolSpace is a pool's allocation as reported by `zpool list`.
+// Fragmentation is the percentage of free space in small segments; it is 0
+// when zpool doesn't report it.
+type PoolSpace struct {
+	PoolName      string `json:"pool_name"`
+	SizeBytes     int64  `json:"size_bytes"`
+	FreeBytes     int64  `json:"free_bytes"`
+	Capacity      int64  `json:"capacity_percent"`
+	Fragmentation int64  `json:"fragmentation_percent"`
+}
+
+// UpsertPoolSpace stores the latest allocation figures for a pool.
+func (s *Store) UpsertPoolSpace(ctx context.Context, space PoolSpace) error {
+	_, err := s.exec(ctx, `
+		INSERT INTO zfs_pool_space (pool_name, size_bytes, free_bytes, capacity_pct, fragmentation_pct, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(pool_name) DO UPDATE SET
+			size_bytes=excluded.size_bytes,
+			free_bytes=excluded.free_bytes,
+			capacity_pct=excluded.capacity_pct,
+			fragmentation_pct=excluded.fragmentation_pct,
+			updated_at=CURRENT_TIMESTAMP
+	`, space.PoolName, space.SizeBytes, space.FreeBytes, space.Capacity, space.Fragmentation)
+	return err
+}
+
+// GetPoolSpace returns the stored allocation figures for a pool, or nil if
+// none have been collected.
+func (s *Store) GetPoolSpace(ctx context.Context, poolName string) (*PoolSpace, error) {
+	var space PoolSpace
+	err := s.db.QueryRowContext(ctx, `
+		SELECT pool_name, COALESCE(size_bytes,0), COALESCE(free_bytes,0),
+			COALESCE(capacity_pct,0), COALESCE(fragmentation_pct,0)
+		FROM zfs_pool_space WHERE pool_name=?
+	`, poolName).Scan(&space.PoolName, &space.SizeBytes, &space.FreeBytes, &space.Capacity, &space.Fragmentation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &space, nil
+}
+
+// MDArray is a Linux software RAID (mdadm) array as read from /proc/mdstat
+// and `mdadm --detail`.
+type MDArray struct {
+	Name         string     `json:"name"`  // e.g. md0
+	Level        string     `json:"level"` // raid1, raid5, ...
+	State        string     `json:"state"` // mdadm state, e.g. "clean, degraded, recovering"
+	RaidDisks    int        `json:"raid_disks"`
+	ActiveDisks  int        `json:"active_disks"`
+	SyncAction   string     `json:"sync_action,omitempty"`   // recovery, resync, reshape or check while running
+	SyncProgress float64    `json:"sync_progress,omitempty"` // Percent complete of SyncAction
+	Members      []MDMember `json:"members"`
+}
+
+// MDMember is one component device of an md array.
+type MDMember struct {
+	Device string `json:"device"` // e.g. sda1
+	State  string `json:"state"`  // active, faulty, spare or replacement
+}
+
+// Degraded reports whether fewer devices are active than the array needs.
+func (a MDArray) Degraded() bool {
+	return a.ActiveDisks < a.RaidDisks
+}
+
+// SetMDArrays makes arrays the full set of known md arrays, dropping arrays
+// that no longer exist, in one transaction.
+func (s *Store) SetMDArrays(ctx context.Context, arrays []MDArray) error {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM md_array_devices`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM md_arrays`); err != nil {
+		return err
+	}
+	for _, a := range arrays {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO md_arrays (name, level, state, raid_disks, active_disks, sync_action, sync_progress, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`, a.Name, a.Level, a.State, a.RaidDisks, a.ActiveDisks, a.SyncAction, a.SyncProgress); err != nil {
+			return err
+		}
+		for _, m := range a.Members {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT OR REPLACE INTO md_array_devices (array_name, device, state) VALUES (?, ?, ?)
+			`, a.Name, m.Device, m.State); err != nil {
+				return err
+			}
+		}
+	}
+	return s.checkWrite(tx.Commit())
+}
+
+func (s *Store) ListMDArrays(ctx context.Context) ([]MDArray, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, COALESCE(level, ''), COALESCE(state, ''), COALESCE(raid_disks, 0),
+			COALESCE(active_disks, 0), COALESCE(sync_action, ''), COALESCE(sync_progress, 0)
+		FROM md_arrays ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var arrays []MDArray
+	for rows.Next() {
+		var a MDArray
+		if err := rows.Scan(&a.Name, &a.Level, &a.State, &a.RaidDisks, &a.ActiveDisks, &a.SyncAction, &a.SyncProgress); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		arrays = append(arrays, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range arrays {
+		mrows, err := s.db.QueryContext(ctx, `
+			SELECT device, COALESCE(state, '') FROM md_array_devices WHERE array_name=? ORDER BY device
+		`, arrays[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		for mrows.Next() {
+			var m MDMember
+			if err := mrows.Scan(&m.Device, &m.State); err != nil {
+				mrows.Close()
+				return nil, err
+			}
+			arrays[i].Members = append(arrays[i].Members, m)
+		}
+		mrows.Close()
+		if err := mrows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return arrays, nil
+}
+
+// PoolDevices returns a pool's members with their roles, data devices first.
+func (s *Store) PoolDevices(ctx context.Context, poolName string) ([]PoolDevice, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT disk_id, COALESCE(role, ''), COALESCE(vdev_type, '') FROM zfs_pool_devices
+		WHERE pool_name=? ORDER BY role != 'data', role, disk_id
+	`, poolName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var devices []PoolDevice
+	for rows.Next() {
+		var d PoolDevice
+		if err := rows.Scan(&d.DiskID, &d.Role, &d.VdevType); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
 }
 
 // GetPoolDevices returns the list of device IDs for a pool
@@ -449,43 +1368,134 @@ func (s *Store) GetPoolDevices(ctx context.Context, poolName string) ([]string,
 }
 
 func (s *Store) AddSmartSnapshot(ctx context.Context, snap SmartSnapshot) error {
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		INSERT INTO smart_snapshots (
 			disk_id, timestamp, health_status, reallocated, pending,
 			offline_uncorrectable, crc_errors, temperature_c, power_on_hours,
-			spin_retry_count, load_cycle_count, raw_json)
-		VALUES (?, datetime(?,'unixepoch'), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			spin_retry_count, load_cycle_count, grown_defects, reported_uncorrect,
+			command_timeout, power_cycle_count, start_stop_count,
+			sas_invalid_dwords, sas_disparity_errors, sas_loss_of_sync, sas_phy_resets,
+			sct_lifetime_min_c, sct_lifetime_max_c, sct_over_temp_count, sct_under_temp_count, raw_json)
+		VALUES (?, datetime(?,'unixepoch'), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, snap.DiskID, snap.Timestamp, snap.HealthStatus, snap.Reallocated, snap.Pending,
 		snap.OfflineUncorrect, snap.CRCErrors, snap.TemperatureC, snap.PowerOnHours,
-		snap.SpinRetryCount, snap.LoadCycleCount, snap.RawJSON)
+		snap.SpinRetryCount, snap.LoadCycleCount, snap.GrownDefects, snap.ReportedUncorrect,
+		snap.CommandTimeout, snap.PowerCycleCount, snap.StartStopCount,
+		optInt(snap.SASInvalidDwords, snap.SASPhyRead), optInt(snap.SASDisparityErrors, snap.SASPhyRead),
+		optInt(snap.SASLossOfSync, snap.SASPhyRead), optInt(snap.SASPhyResets, snap.SASPhyRead),
+		snap.SCTLifetimeMinC, snap.SCTLifetimeMaxC, optInt(snap.SCTOverTempCount, snap.SCTLimitCountsRead),
+		optInt(snap.SCTUnderTempCount, snap.SCTLimitCountsRead), packRaw(snap.RawJSON))
 	return err
 }
 
 func (s *Store) AddNvmeSnapshot(ctx context.Context, snap NvmeSnapshot) error {
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		INSERT INTO nvme_snapshots (
 			disk_id, timestamp, percent_used, media_errors, error_log_entries,
-			power_on_hours, unsafe_shutdowns, temperature_c, data_written_bytes, data_read_bytes, critical_warning_flags, raw_output)
-		VALUES (?, datetime(?,'unixepoch'), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			power_on_hours, unsafe_shutdowns, temperature_c, data_written_bytes, data_read_bytes, critical_warning_flags, raw_output,
+			ns_capacity_bytes, ns_used_bytes, ns_thin, fw_active_slot, fw_slots, warning_temp_time, critical_comp_time,
+			sanitize_status, sanitize_progress, available_spare)
+		VALUES (?, datetime(?,'unixepoch'), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, snap.DiskID, snap.Timestamp, snap.PercentUsed, snap.MediaErrors, snap.ErrorLogEntries,
 		snap.PowerOnHours, snap.UnsafeShutdowns, snap.TemperatureC, snap.DataWrittenBytes, snap.DataReadBytes,
-		snap.CriticalWarningFlags, snap.RawOutput)
+		snap.CriticalWarningFlags, packRaw(snap.RawOutput), snap.NamespaceCapacityBytes, snap.NamespaceUsedBytes, snap.NamespaceThin,
+		snap.FirmwareActiveSlot, snap.FirmwareSlots, optInt(snap.WarningTempMinutes, snap.TempTimeRead),
+		optInt(snap.CriticalTempMinutes, snap.TempTimeRead), snap.SanitizeStatus, snap.SanitizeProgress, optFloat(snap.AvailableSpare, snap.AvailableSpareRead))
 	return err
 }
 
-func (s *Store) LatestSmart(ctx context.Context, diskID string) (*SmartSnapshot, error) {
+func (s *Store) LatestSmart(ctx context.Context, diskID string) (*SmartSnapshot, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+smartSnapshotColumns+`
+		FROM smart_snapshots
+		WHERE disk_id=?
+		ORDER BY timestamp DESC LIMIT 1
+	`, diskID)
+	snap, err := scanSmartSnapshot(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// SmartAt returns the newest SMART snapshot taken at or before the given
+// Unix time, or nil if the disk has none that old.
+func (s *Store) SmartAt(ctx context.Context, diskID string, at int64) (*SmartSnapshot, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+smartSnapshotColumns+`
+		FROM smart_snapshots
+		WHERE disk_id=? AND timestamp <= datetime(?, 'unixepoch')
+		ORDER BY timestamp DESC LIMIT 1
+	`, diskID, at)
+	snap, err := scanSmartSnapshot(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// LatestSmartByDisk returns up to limit of the newest SMART snapshots of
+// every disk (newest first), keyed by disk ID, in a single query.
+func (s *Store) LatestSmartByDisk(ctx context.Context, limit int) (map[string][]SmartSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+smartSnapshotColumns+` FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY disk_id ORDER BY timestamp DESC, id DESC) AS rn
+			FROM smart_snapshots
+		) WHERE rn <= ? ORDER BY disk_id, rn
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	latest := make(map[string][]SmartSnapshot)
+	for rows.Next() {
+		snap, err := scanSmartSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		latest[snap.DiskID] = append(latest[snap.DiskID], snap)
+	}
+	return latest, rows.Err()
+}
+
+// LatestNvmeByDisk is LatestSmartByDisk for NVMe snapshots.
+func (s *Store) LatestNvmeByDisk(ctx context.Context, limit int) (map[string][]NvmeSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+nvmeSnapshotColumns+` FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY disk_id ORDER BY timestamp DESC, id DESC) AS rn
+			FROM nvme_snapshots
+		) WHERE rn <= ? ORDER BY disk_id, rn
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	latest := make(map[string][]NvmeSnapshot)
+	for rows.Next() {
+		snap, err := scanNvmeSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		latest[snap.DiskID] = append(latest[snap.DiskID], snap)
+	}
+	return latest, rows.Err()
+}
+
+func (s *Store) LatestNvme(ctx context.Context, diskID string) (*NvmeSnapshot, error) {
 	row := s.db.QueryRowContext(ctx, `
-		SELECT disk_id, strftime('%s', timestamp), health_status, reallocated, pending,
-			offline_uncorrectable, crc_errors, temperature_c, power_on_hours,
-			spin_retry_count, load_cycle_count, raw_json
-		FROM smart_snapshots
+		SELECT `+nvmeSnapshotColumns+`
+		FROM nvme_snapshots
 		WHERE disk_id=?
 		ORDER BY timestamp DESC LIMIT 1
 	`, diskID)
-	var snap SmartSnapshot
-	if err := row.Scan(&snap.DiskID, &snap.Timestamp, &snap.HealthStatus, &snap.Reallocated, &snap.Pending,
-		&snap.OfflineUncorrect, &snap.CRCErrors, &snap.TemperatureC, &snap.PowerOnHours,
-		&snap.SpinRetryCount, &snap.LoadCycleCount, &snap.RawJSON); err != nil {
+	snap, err := scanNvmeSnapshot(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -494,51 +1504,206 @@ func (s *Store) LatestSmart(ctx context.Context, diskID string) (*SmartSnapshot,
 	return &snap, nil
 }
 
-func (s *Store) LatestNvme(ctx context.Context, diskID string) (*NvmeSnapshot, error) {
+// NvmeAt is the NVMe counterpart of SmartAt.
+func (s *Store) NvmeAt(ctx context.Context, diskID string, at int64) (*NvmeSnapshot, error) {
 	row := s.db.QueryRowContext(ctx, `
-		SELECT disk_id, strftime('%s', timestamp), percent_used, media_errors, error_log_entries,
-			power_on_hours, unsafe_shutdowns, temperature_c, data_written_bytes, data_read_bytes, critical_warning_flags, COALESCE(raw_output, '')
+		SELECT `+nvmeSnapshotColumns+`
 		FROM nvme_snapshots
-		WHERE disk_id=?
+		WHERE disk_id=? AND timestamp <= datetime(?, 'unixepoch')
 		ORDER BY timestamp DESC LIMIT 1
-	`, diskID)
-	var snap NvmeSnapshot
-	var rawOutput sql.NullString
-	if err := row.Scan(&snap.DiskID, &snap.Timestamp, &snap.PercentUsed, &snap.MediaErrors, &snap.ErrorLogEntries,
-		&snap.PowerOnHours, &snap.UnsafeShutdowns, &snap.TemperatureC, &snap.DataWrittenBytes, &snap.DataReadBytes,
-		&snap.CriticalWarningFlags, &rawOutput); err != nil {
+	`, diskID, at)
+	snap, err := scanNvmeSnapshot(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	snap.RawOutput = rawOutput.String
 	return &snap, nil
 }
 
 func (s *Store) SmartHistory(ctx context.Context, diskID string, limit int) ([]SmartSnapshot, error) {
+	return s.SmartHistoryAfter(ctx, diskID, Cursor{}, limit)
+}
+
+// SmartHistoryAfter returns up to limit snapshots older than the cursor
+// (newest first); a zero cursor starts from the newest snapshot.
+func (s *Store) SmartHistoryAfter(ctx context.Context, diskID string, after Cursor, limit int) ([]SmartSnapshot, error) {
 	if limit <= 0 {
 		limit = 20
 	}
+	query := `SELECT ` + smartSnapshotColumns + ` FROM smart_snapshots WHERE disk_id=?`
+	args := []interface{}{diskID}
+	if !after.IsZero() {
+		cond, condArgs := after.condition()
+		query += ` AND ` + cond
+		args = append(args, condArgs...)
+	}
+	query += ` ORDER BY timestamp DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []SmartSnapshot
+	for rows.Next() {
+		snap, err := scanSmartSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, snap)
+	}
+	return res, rows.Err()
+}
+
+// SmartSeriesMetrics and NvmeSeriesMetrics map the metric names accepted by
+// DiskTimeSeries to their snapshot columns.
+var (
+	SmartSeriesMetrics = map[string]string{
+		"temperature":           "temperature_c",
+		"reallocated":           "reallocated",
+		"pending":               "pending",
+		"offline_uncorrectable": "offline_uncorrectable",
+		"crc_errors":            "crc_errors",
+		"power_on_hours":        "power_on_hours",
+		"load_cycle_count":      "load_cycle_count",
+		"grown_defects":         "grown_defects",
+		"reported_uncorrect":    "reported_uncorrect",
+		"command_timeout":       "command_timeout",
+	}
+	NvmeSeriesMetrics = map[string]string{
+		"temperature":        "temperature_c",
+		"percent_used":       "percent_used",
+		"media_errors":       "media_errors",
+		"error_log_entries":  "error_log_entries",
+		"unsafe_shutdowns":   "unsafe_shutdowns",
+		"power_on_hours":     "power_on_hours",
+		"data_written_bytes": "data_written_bytes",
+		"data_read_bytes":    "data_read_bytes",
+	}
+)
+
+// TimeSeries is a set of metric series sharing one time axis. Timestamps
+// are bucket starts, multiples of the step since the Unix epoch; each series
+// holds the bucket average, or nil where a bucket has no snapshots.
+type TimeSeries struct {
+	Timestamps []int64               `json:"timestamps"`
+	Series     map[string][]*float64 `json:"series"`
+}
+
+// DiskTimeSeries averages a disk's snapshot metrics into step-sized buckets
+// covering [start, end), from the nvme_snapshots table when nvme is set and
+// smart_snapshots otherwise. Metrics must be keys of the matching
+// SmartSeriesMetrics or NvmeSeriesMetrics map.
+func (s *Store) DiskTimeSeries(ctx context.Context, diskID string, nvme bool, metrics []string, start, end, step int64) (TimeSeries, error) {
+	table, columns := "smart_snapshots", SmartSeriesMetrics
+	if nvme {
+		table, columns = "nvme_snapshots", NvmeSeriesMetrics
+	}
+	first := start / step * step
+	ts := TimeSeries{Series: make(map[string][]*float64, len(metrics))}
+	for b := first; b < end; b += step {
+		ts.Timestamps = append(ts.Timestamps, b)
+	}
+	selects := make([]string, len(metrics))
+	for i, m := range metrics {
+		col, ok := columns[m]
+		if !ok {
+			return TimeSeries{}, fmt.Errorf("unknown metric %q", m)
+		}
+		selects[i] = "AVG(" + col + ")"
+		ts.Series[m] = make([]*float64, len(ts.Timestamps))
+	}
+	if len(metrics) == 0 {
+		return ts, nil
+	}
+
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT disk_id, strftime('%s', timestamp), health_status, reallocated, pending,
+		SELECT CAST(strftime('%s', timestamp) AS INTEGER) / ? * ? AS bucket, `+strings.Join(selects, ", ")+`
+		FROM `+table+`
+		WHERE disk_id=? AND timestamp >= datetime(?, 'unixepoch') AND timestamp < datetime(?, 'unixepoch')
+		GROUP BY bucket
+		ORDER BY bucket
+	`, step, step, diskID, first, end)
+	if err != nil {
+		return TimeSeries{}, err
+	}
+	defer rows.Close()
+	values := make([]sql.NullFloat64, len(metrics))
+	dest := make([]any, len(metrics)+1)
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	for rows.Next() {
+		var bucket int64
+		dest[0] = &bucket
+		if err := rows.Scan(dest...); err != nil {
+			return TimeSeries{}, err
+		}
+		idx := (bucket - first) / step
+		if idx < 0 || idx >= int64(len(ts.Timestamps)) {
+			continue
+		}
+		for i, m := range metrics {
+			if values[i].Valid {
+				v := values[i].Float64
+				ts.Series[m][idx] = &v
+			}
+		}
+	}
+	return ts, rows.Err()
+}
+
+// smartSnapshotColumns is the column list shared by all smart_snapshots reads;
+// it must stay in sync with scanSmartSnapshot.
+const smartSnapshotColumns = `disk_id, strftime('%s', timestamp), health_status, reallocated, pending,
 			offline_uncorrectable, crc_errors, temperature_c, power_on_hours,
-			spin_retry_count, load_cycle_count, raw_json
-		FROM smart_snapshots
-		WHERE disk_id=?
-		ORDER BY timestamp DESC
-		LIMIT ?
-	`, diskID, limit)
+			spin_retry_count, load_cycle_count, COALESCE(grown_defects, 0), COALESCE(reported_uncorrect, 0),
+			COALESCE(command_timeout, 0), COALESCE(power_cycle_count, 0), COALESCE(start_stop_count, 0),
+			COALESCE(sas_invalid_dwords, 0), COALESCE(sas_disparity_errors, 0), COALESCE(sas_loss_of_sync, 0),
+			COALESCE(sas_phy_resets, 0), sas_invalid_dwords IS NOT NULL, COALESCE(sct_lifetime_min_c, 0), COALESCE(sct_lifetime_max_c, 0),
+			COALESCE(sct_over_temp_count, 0), COALESCE(sct_under_temp_count, 0), sct_over_temp_count IS NOT NULL,
+			raw_json, id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSmartSnapshot(row rowScanner) (SmartSnapshot, error) {
+	var snap SmartSnapshot
+	err := row.Scan(&snap.DiskID, &snap.Timestamp, &snap.HealthStatus, &snap.Reallocated, &snap.Pending,
+		&snap.OfflineUncorrect, &snap.CRCErrors, &snap.TemperatureC, &snap.PowerOnHours,
+		&snap.SpinRetryCount, &snap.LoadCycleCount, &snap.GrownDefects, &snap.ReportedUncorrect,
+		&snap.CommandTimeout, &snap.PowerCycleCount, &snap.StartStopCount,
+		&snap.SASInvalidDwords, &snap.SASDisparityErrors, &snap.SASLossOfSync, &snap.SASPhyResets, &snap.SASPhyRead,
+		&snap.SCTLifetimeMinC, &snap.SCTLifetimeMaxC, &snap.SCTOverTempCount, &snap.SCTUnderTempCount, &snap.SCTLimitCountsRead,
+		&snap.RawJSON, &snap.ID)
+	if err != nil {
+		return snap, err
+	}
+	snap.RawJSON, err = unpackRaw(snap.RawJSON)
+	return snap, err
+}
+
+func (s *Store) NvmeHistory(ctx context.Context, diskID string, limit int) ([]NvmeSnapshot, error) {
+	return s.NvmeHistoryAfter(ctx, diskID, Cursor{}, limit)
+}
+
+// SmartSnapshotsSince returns up to limit snapshots with an ID above afterID,
+// oldest first, for callers that walk the history forward from a
+// high-water mark.
+func (s *Store) SmartSnapshotsSince(ctx context.Context, diskID string, afterID int64, limit int) ([]SmartSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+smartSnapshotColumns+` FROM smart_snapshots
+		WHERE disk_id=? AND id > ? ORDER BY id LIMIT ?`, diskID, afterID, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var res []SmartSnapshot
 	for rows.Next() {
-		var snap SmartSnapshot
-		if err := rows.Scan(&snap.DiskID, &snap.Timestamp, &snap.HealthStatus, &snap.Reallocated, &snap.Pending,
-			&snap.OfflineUncorrect, &snap.CRCErrors, &snap.TemperatureC, &snap.PowerOnHours,
-			&snap.SpinRetryCount, &snap.LoadCycleCount, &snap.RawJSON); err != nil {
+		snap, err := scanSmartSnapshot(rows)
+		if err != nil {
 			return nil, err
 		}
 		res = append(res, snap)
@@ -546,93 +1711,303 @@ func (s *Store) SmartHistory(ctx context.Context, diskID string, limit int) ([]S
 	return res, rows.Err()
 }
 
-func (s *Store) NvmeHistory(ctx context.Context, diskID string, limit int) ([]NvmeSnapshot, error) {
+// NvmeSnapshotsSince is the NVMe counterpart of SmartSnapshotsSince.
+func (s *Store) NvmeSnapshotsSince(ctx context.Context, diskID string, afterID int64, limit int) ([]NvmeSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+nvmeSnapshotColumns+` FROM nvme_snapshots
+		WHERE disk_id=? AND id > ? ORDER BY id LIMIT ?`, diskID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []NvmeSnapshot
+	for rows.Next() {
+		snap, err := scanNvmeSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, snap)
+	}
+	return res, rows.Err()
+}
+
+// NvmeHistoryAfter is the NVMe counterpart of SmartHistoryAfter.
+func (s *Store) NvmeHistoryAfter(ctx context.Context, diskID string, after Cursor, limit int) ([]NvmeSnapshot, error) {
 	if limit <= 0 {
 		limit = 20
 	}
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT disk_id, strftime('%s', timestamp), percent_used, media_errors, error_log_entries,
-			power_on_hours, unsafe_shutdowns, temperature_c, data_written_bytes, data_read_bytes, critical_warning_flags, COALESCE(raw_output, '')
-		FROM nvme_snapshots
-		WHERE disk_id=?
-		ORDER BY timestamp DESC
-		LIMIT ?
-	`, diskID, limit)
+	query := `SELECT ` + nvmeSnapshotColumns + ` FROM nvme_snapshots WHERE disk_id=?`
+	args := []interface{}{diskID}
+	if !after.IsZero() {
+		cond, condArgs := after.condition()
+		query += ` AND ` + cond
+		args = append(args, condArgs...)
+	}
+	query += ` ORDER BY timestamp DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var res []NvmeSnapshot
 	for rows.Next() {
-		var snap NvmeSnapshot
-		var rawOutput sql.NullString
-		if err := rows.Scan(&snap.DiskID, &snap.Timestamp, &snap.PercentUsed, &snap.MediaErrors, &snap.ErrorLogEntries,
-			&snap.PowerOnHours, &snap.UnsafeShutdowns, &snap.TemperatureC, &snap.DataWrittenBytes, &snap.DataReadBytes,
-			&snap.CriticalWarningFlags, &rawOutput); err != nil {
+		snap, err := scanNvmeSnapshot(rows)
+		if err != nil {
 			return nil, err
 		}
-		snap.RawOutput = rawOutput.String
 		res = append(res, snap)
 	}
 	return res, rows.Err()
 }
 
+// nvmeSnapshotColumns is the column list shared by all nvme_snapshots reads;
+// it must stay in sync with scanNvmeSnapshot.
+const nvmeSnapshotColumns = `disk_id, strftime('%s', timestamp), percent_used, media_errors, error_log_entries,
+			power_on_hours, unsafe_shutdowns, temperature_c, data_written_bytes, data_read_bytes, critical_warning_flags, COALESCE(raw_output, ''),
+			COALESCE(ns_capacity_bytes, 0), COALESCE(ns_used_bytes, 0), COALESCE(ns_thin, 0),
+			COALESCE(fw_active_slot, 0), COALESCE(fw_slots, ''), COALESCE(warning_temp_time, 0), COALESCE(critical_comp_time, 0),
+			warning_temp_time IS NOT NULL,
+			COALESCE(sanitize_status, ''), COALESCE(sanitize_progress, 0),
+			COALESCE(available_spare, 0), available_spare IS NOT NULL, id`
+
+// optFloat stores v, or NULL when it wasn't actually read.
+func optFloat(v float64, read bool) any {
+	if !read {
+		return nil
+	}
+	return v
+}
+
+// optInt is optFloat for counters.
+func optInt(v int64, read bool) any {
+	if !read {
+		return nil
+	}
+	return v
+}
+
+func scanNvmeSnapshot(row rowScanner) (NvmeSnapshot, error) {
+	var snap NvmeSnapshot
+	err := row.Scan(&snap.DiskID, &snap.Timestamp, &snap.PercentUsed, &snap.MediaErrors, &snap.ErrorLogEntries,
+		&snap.PowerOnHours, &snap.UnsafeShutdowns, &snap.TemperatureC, &snap.DataWrittenBytes, &snap.DataReadBytes,
+		&snap.CriticalWarningFlags, &snap.RawOutput, &snap.NamespaceCapacityBytes, &snap.NamespaceUsedBytes, &snap.NamespaceThin,
+		&snap.FirmwareActiveSlot, &snap.FirmwareSlots, &snap.WarningTempMinutes, &snap.CriticalTempMinutes, &snap.TempTimeRead,
+		&snap.SanitizeStatus, &snap.SanitizeProgress, &snap.AvailableSpare, &snap.AvailableSpareRead, &snap.ID)
+	if err != nil {
+		return snap, err
+	}
+	snap.RawOutput, err = unpackRaw(snap.RawOutput)
+	return snap, err
+}
+
 func (s *Store) AddAlert(ctx context.Context, a Alert) (int64, error) {
-	result, err := s.db.ExecContext(ctx, `
-		INSERT INTO alerts (timestamp, severity, source_type, source_id, subject, message)
-		VALUES (datetime(?,'unixepoch'), ?, ?, ?, ?, ?)
-	`, a.Timestamp, a.Severity, a.SourceType, a.SourceID, a.Subject, a.Message)
+	result, err := s.exec(ctx, `
+		INSERT INTO alerts (timestamp, severity, source_type, source_id, subject, message, resolves)
+		VALUES (datetime(?,'unixepoch'), ?, ?, ?, ?, ?, ?)
+	`, a.Timestamp, a.Severity, a.SourceType, a.SourceID, a.Subject, a.Message, a.Resolves)
 	if err != nil {
 		return 0, err
 	}
 	id, err := result.LastInsertId()
-	return id, err
+	if err != nil {
+		return 0, err
+	}
+	a.ID = id
+	s.events.Publish(events.Event{ID: id, Type: events.TypeAlert, Data: a})
+	return id, nil
+}
+
+// Events returns the hub that alerts are published to as they are stored.
+func (s *Store) Events() *events.Hub {
+	return s.events
+}
+
+// AlertsAfterID returns up to limit alerts with an id greater than afterID,
+// oldest first. It backs event stream replay.
+func (s *Store) AlertsAfterID(ctx context.Context, afterID int64, limit int) ([]Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Alert
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
 }
 
 func (s *Store) RecentAlerts(ctx context.Context, limit int) ([]Alert, error) {
+	return s.ListAlerts(ctx, AlertFilter{Limit: limit})
+}
+
+// AlertFilter narrows an alerts listing. Zero values mean "no constraint".
+type AlertFilter struct {
+	// Query is a case-insensitive substring matched against subject and message.
+	Query string
+	Limit int
+	// After continues a listing from the last alert of a previous page.
+	After Cursor
+}
+
+// Cursor is a keyset pagination position: the timestamp and row id of the
+// last row on a page. Listings are ordered by (timestamp, id) descending, so
+// the next page holds rows strictly "below" the cursor. Unlike OFFSET this
+// stays cheap on large tables and doesn't skip or repeat rows when new ones
+// are inserted between requests.
+type Cursor struct {
+	Timestamp int64
+	ID        int64
+}
+
+// IsZero reports whether c is the start of a listing.
+func (c Cursor) IsZero() bool {
+	return c.Timestamp == 0 && c.ID == 0
+}
+
+// Token encodes the cursor as an opaque string for API clients.
+func (c Cursor) Token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.Timestamp, c.ID)))
+}
+
+// ParseCursor decodes a token produced by Cursor.Token.
+func ParseCursor(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	var c Cursor
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &c.Timestamp, &c.ID); err != nil || c.IsZero() {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// condition returns the keyset WHERE clause selecting rows after c.
+func (c Cursor) condition() (string, []interface{}) {
+	return `(timestamp < datetime(?, 'unixepoch') OR (timestamp = datetime(?, 'unixepoch') AND id < ?))`,
+		[]interface{}{c.Timestamp, c.Timestamp, c.ID}
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+func (s *Store) ListAlerts(ctx context.Context, f AlertFilter) ([]Alert, error) {
+	limit := f.Limit
 	if limit <= 0 {
 		limit = 50
 	}
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, strftime('%s', timestamp), severity, source_type, source_id, subject, message, acknowledged
-		FROM alerts
-		ORDER BY timestamp DESC
-		LIMIT ?
-	`, limit)
+	var where []string
+	var args []interface{}
+	if f.Query != "" {
+		pattern := "%" + escapeLike(f.Query) + "%"
+		where = append(where, `(subject LIKE ? ESCAPE '\' OR message LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if !f.After.IsZero() {
+		cond, condArgs := f.After.condition()
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	query := `SELECT ` + alertColumns + ` FROM alerts`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY timestamp DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var res []Alert
 	for rows.Next() {
-		var a Alert
-		var ack int
-		if err := rows.Scan(&a.ID, &a.Timestamp, &a.Severity, &a.SourceType, &a.SourceID, &a.Subject, &a.Message, &ack); err != nil {
+		a, err := scanAlert(rows)
+		if err != nil {
 			return nil, err
 		}
-		a.Acknowledged = ack != 0
 		res = append(res, a)
 	}
 	return res, rows.Err()
 }
 
+// alertColumns is the column list shared by all alerts reads; it must stay in
+// sync with scanAlert.
+const alertColumns = `id, strftime('%s', timestamp), severity, source_type, source_id, subject, message, acknowledged,
+	COALESCE(strftime('%s', resolved_at), 0), resolves`
+
+func scanAlert(row rowScanner) (Alert, error) {
+	var a Alert
+	var ack int
+	if err := row.Scan(&a.ID, &a.Timestamp, &a.Severity, &a.SourceType, &a.SourceID, &a.Subject, &a.Message, &ack,
+		&a.ResolvedAt, &a.Resolves); err != nil {
+		return a, err
+	}
+	a.Acknowledged = ack != 0
+	return a, nil
+}
+
+// ResolveAlerts marks all active alerts for a condition (source + subject) as
+// resolved and returns how many rows were updated.
+func (s *Store) ResolveAlerts(ctx context.Context, sourceType, sourceID, subject string) (int64, error) {
+	result, err := s.exec(ctx, `
+		UPDATE alerts SET resolved_at = datetime('now')
+		WHERE source_type = ? AND source_id = ? AND subject = ? AND resolved_at IS NULL
+	`, sourceType, sourceID, subject)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // PruneOldSnapshots removes snapshots older than the given age in days.
 func (s *Store) PruneOldSnapshots(ctx context.Context, days int) error {
 	if days <= 0 {
 		days = 90
 	}
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		DELETE FROM smart_snapshots WHERE timestamp < datetime('now', ?);
 	`, fmt.Sprintf("-%d days", days))
 	if err != nil {
 		return err
 	}
-	_, err = s.db.ExecContext(ctx, `
+	_, err = s.exec(ctx, `
 		DELETE FROM nvme_snapshots WHERE timestamp < datetime('now', ?);
 	`, fmt.Sprintf("-%d days", days))
 	return err
 }
 
+// PruneSnapshotsByCount keeps only the newest maxRows snapshots per disk.
+func (s *Store) PruneSnapshotsByCount(ctx context.Context, maxRows int) error {
+	if maxRows <= 0 {
+		return nil
+	}
+	for _, table := range []string{"smart_snapshots", "nvme_snapshots"} {
+		_, err := s.exec(ctx, fmt.Sprintf(`
+			DELETE FROM %[1]s WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (
+						PARTITION BY disk_id ORDER BY timestamp DESC, id DESC
+					) AS rn
+					FROM %[1]s
+				) WHERE rn > ?
+			)
+		`, table), maxRows)
+		if err != nil {
+			return fmt.Errorf("prune %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
 // ScrubHistoryEntry represents a scrub history record
 type ScrubHistoryEntry struct {
 	PoolName       string
@@ -644,7 +2019,7 @@ type ScrubHistoryEntry struct {
 }
 
 func (s *Store) AddScrubHistory(ctx context.Context, entry ScrubHistoryEntry) error {
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		INSERT INTO zfs_scrub_history (
 			pool_name, start_time, end_time, errors, bytes_processed, notes)
 		VALUES (?, datetime(?,'unixepoch'), datetime(?,'unixepoch'), ?, ?, ?)
@@ -652,6 +2027,46 @@ func (s *Store) AddScrubHistory(ctx context.Context, entry ScrubHistoryEntry) er
 	return err
 }
 
+// openScrub matches scrub history rows with no completion recorded; starts
+// are stored with EndTime 0, i.e. the epoch.
+const openScrub = `(end_time IS NULL OR strftime('%s', end_time) = '0')`
+
+// OpenScrub returns the most recent scrub of a pool that has a start but no
+// end in the history, or nil.
+func (s *Store) OpenScrub(ctx context.Context, poolName string) (*ScrubHistoryEntry, error) {
+	var e ScrubHistoryEntry
+	var notes sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT pool_name, strftime('%s', start_time), COALESCE(errors, 0), COALESCE(bytes_processed, 0), notes
+		FROM zfs_scrub_history
+		WHERE pool_name = ? AND `+openScrub+`
+		ORDER BY start_time DESC
+		LIMIT 1
+	`, poolName).Scan(&e.PoolName, &e.StartTime, &e.Errors, &e.BytesProcessed, &notes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.Notes = notes.String
+	return &e, nil
+}
+
+// FinishScrubs closes a pool's open scrub history rows once no scrub is
+// running. Rows started before completedAt (the pool's last completed
+// scrub) end then with its error count; any others were cancelled or lost
+// and end at now.
+func (s *Store) FinishScrubs(ctx context.Context, poolName string, completedAt, scrubErrors, now int64) error {
+	_, err := s.exec(ctx, `
+		UPDATE zfs_scrub_history SET
+			end_time = CASE WHEN start_time <= datetime(?1,'unixepoch') THEN datetime(?1,'unixepoch') ELSE datetime(?3,'unixepoch') END,
+			errors = CASE WHEN start_time <= datetime(?1,'unixepoch') THEN ?2 ELSE errors END
+		WHERE pool_name = ?4 AND `+openScrub+`
+	`, completedAt, scrubErrors, now, poolName)
+	return err
+}
+
 // GetScrubHistory returns scrub history for a pool
 func (s *Store) GetScrubHistory(ctx context.Context, poolName string, limit int) ([]ScrubHistoryEntry, error) {
 	if limit <= 0 {
@@ -721,7 +2136,7 @@ func (s *Store) GetLastSmartTestTime(ctx context.Context, diskID, testType strin
 
 // RecordSmartTest records that a SMART test was started
 func (s *Store) RecordSmartTest(ctx context.Context, diskID, testType string) error {
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		INSERT INTO smart_test_schedule (disk_id, test_type, last_run_time)
 		VALUES (?, ?, datetime('now'))
 		ON CONFLICT(disk_id, test_type) DO UPDATE SET
@@ -732,8 +2147,13 @@ func (s *Store) RecordSmartTest(ctx context.Context, diskID, testType string) er
 
 // GetLastScrubTime returns the last scrub time for a pool (from zfs_pools table)
 func (s *Store) GetLastScrubTime(ctx context.Context, poolName string) (int64, error) {
+	// UpsertPool stores unix seconds; older rows may hold datetime text.
 	row := s.db.QueryRowContext(ctx, `
-		SELECT strftime('%s', last_scrub_time) FROM zfs_pools WHERE name=?
+		SELECT CASE typeof(last_scrub_time)
+			WHEN 'integer' THEN last_scrub_time
+			ELSE strftime('%s', last_scrub_time)
+		END
+		FROM zfs_pools WHERE name=?
 	`, poolName)
 
 	var lastScrub sql.NullInt64
@@ -765,15 +2185,25 @@ type NotificationQueueEntry struct {
 
 // EnqueueNotification adds a notification to the queue
 func (s *Store) EnqueueNotification(ctx context.Context, alertID int64, channel string) error {
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		INSERT INTO notification_queue (alert_id, channel, status, next_retry)
 		VALUES (?, ?, 'pending', datetime('now'))
 	`, alertID, channel)
 	return err
 }
 
-// GetPendingNotifications returns notifications that need to be sent
-func (s *Store) GetPendingNotifications(ctx context.Context, limit int) ([]NotificationQueueEntry, error) {
+// EnqueueNotificationAfter queues a notification that must not be sent
+// before notBefore (e.g. the end of quiet hours).
+func (s *Store) EnqueueNotificationAfter(ctx context.Context, alertID int64, channel string, notBefore time.Time) error {
+	_, err := s.exec(ctx, `
+		INSERT INTO notification_queue (alert_id, channel, status, next_retry)
+		VALUES (?, ?, 'pending', datetime(?, 'unixepoch'))
+	`, alertID, channel, notBefore.Unix())
+	return err
+}
+
+// GetPendingNotifications returns notifications that are due as of now
+func (s *Store) GetPendingNotifications(ctx context.Context, now time.Time, limit int) ([]NotificationQueueEntry, error) {
 	if limit <= 0 {
 		limit = 50
 	}
@@ -782,10 +2212,10 @@ func (s *Store) GetPendingNotifications(ctx context.Context, limit int) ([]Notif
 			strftime('%s', last_attempt), strftime('%s', next_retry),
 			error_message, strftime('%s', created_at), strftime('%s', sent_at)
 		FROM notification_queue
-		WHERE status = 'pending' AND (next_retry IS NULL OR next_retry <= datetime('now'))
+		WHERE status = 'pending' AND (next_retry IS NULL OR next_retry <= datetime(?, 'unixepoch'))
 		ORDER BY created_at ASC
 		LIMIT ?
-	`, limit)
+	`, now.Unix(), limit)
 	if err != nil {
 		return nil, err
 	}
@@ -805,7 +2235,7 @@ func (s *Store) GetPendingNotifications(ctx context.Context, limit int) ([]Notif
 
 // MarkNotificationSent marks a notification as successfully sent
 func (s *Store) MarkNotificationSent(ctx context.Context, queueID int64) error {
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		UPDATE notification_queue
 		SET status = 'sent', sent_at = datetime('now'), next_retry = NULL
 		WHERE id = ?
@@ -815,7 +2245,7 @@ func (s *Store) MarkNotificationSent(ctx context.Context, queueID int64) error {
 
 // MarkNotificationFailed marks a notification as failed and schedules retry
 func (s *Store) MarkNotificationFailed(ctx context.Context, queueID int64, errorMsg string, nextRetry time.Time) error {
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.exec(ctx, `
 		UPDATE notification_queue
 		SET status = 'pending', attempts = attempts + 1,
 			last_attempt = datetime('now'), next_retry = datetime(?,'unixepoch'),
@@ -839,28 +2269,20 @@ func (s *Store) GetUnsentNotificationCount(ctx context.Context) (int, error) {
 
 // GetAlert retrieves an alert by ID
 func (s *Store) GetAlert(ctx context.Context, alertID int64) (*Alert, error) {
-	row := s.db.QueryRowContext(ctx, `
-		SELECT id, strftime('%s', timestamp), severity, source_type, source_id, subject, message, acknowledged
-		FROM alerts WHERE id = ?
-	`, alertID)
-
-	var a Alert
-	var ts int64
-	var ack int
-	if err := row.Scan(&a.ID, &ts, &a.Severity, &a.SourceType, &a.SourceID, &a.Subject, &a.Message, &ack); err != nil {
+	row := s.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id = ?`, alertID)
+	a, err := scanAlert(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	a.Timestamp = ts
-	a.Acknowledged = ack != 0
 	return &a, nil
 }
 
 // AcknowledgeAlert marks an alert as acknowledged
 func (s *Store) AcknowledgeAlert(ctx context.Context, alertID int64) error {
-	result, err := s.db.ExecContext(ctx, `
+	result, err := s.exec(ctx, `
 		UPDATE alerts
 		SET acknowledged = 1
 		WHERE id = ?
@@ -878,6 +2300,42 @@ func (s *Store) AcknowledgeAlert(ctx context.Context, alertID int64) error {
 	return nil
 }
 
+// SnoozeAlert holds notifications for an alert's condition (its source and
+// subject, the notifier's dedupe key) until the given Unix time. Matching
+// alerts are still recorded.
+func (s *Store) SnoozeAlert(ctx context.Context, a Alert, until int64) error {
+	_, err := s.exec(ctx, `
+		INSERT INTO alert_snoozes (source_type, source_id, subject, snoozed_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT(source_type, source_id, subject) DO UPDATE SET snoozed_until=excluded.snoozed_until
+	`, a.SourceType, a.SourceID, a.Subject, until)
+	return err
+}
+
+// UnsnoozeAlert lifts a snooze early. It reports whether one was active.
+func (s *Store) UnsnoozeAlert(ctx context.Context, a Alert) (bool, error) {
+	result, err := s.exec(ctx, `
+		DELETE FROM alert_snoozes WHERE source_type=? AND source_id=? AND subject=? AND snoozed_until > ?
+	`, a.SourceType, a.SourceID, a.Subject, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// AlertSnoozedUntil returns when the snooze on an alert's condition ends, or
+// 0 if it was never snoozed.
+func (s *Store) AlertSnoozedUntil(ctx context.Context, sourceType, sourceID, subject string) (int64, error) {
+	var until int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT snoozed_until FROM alert_snoozes WHERE source_type=? AND source_id=? AND subject=?
+	`, sourceType, sourceID, subject).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return until, err
+}
+
 // CloudSchedule represents a schedule from the cloud
 type CloudSchedule struct {
 	ID           string
@@ -895,7 +2353,7 @@ func (s *Store) StoreSchedules(ctx context.Context, schedules []CloudSchedule) e
 		if schedule.Enabled {
 			enabled = 1
 		}
-		_, err := s.db.ExecContext(ctx, `
+		_, err := s.exec(ctx, `
 			INSERT INTO cloud_schedules (id, task_type, schedule_type, schedule_value, enabled, updated_at)
 			VALUES (?, ?, ?, ?, ?, datetime('now'))
 			ON CONFLICT(id) DO UPDATE SET
@@ -959,3 +2417,116 @@ func (s *Store) GetScheduleForTask(ctx context.Context, taskType string) (*Cloud
 	sched.Enabled = enabled != 0
 	return &sched, nil
 }
+
+// TaskRun is the last and next run of a scheduled task, as recorded by the
+// scheduler. Source is "config" or "cloud", whichever schedule is in effect.
+// Times are unix seconds; LastRun is 0 before the first run.
+type TaskRun struct {
+	TaskType      string
+	Source        string
+	ScheduleType  string
+	ScheduleValue string
+	LastRun       int64
+	NextRun       int64
+}
+
+// SetTaskRun records the last and next run of a scheduled task.
+func (s *Store) SetTaskRun(ctx context.Context, r TaskRun) error {
+	_, err := s.exec(ctx, `
+		INSERT INTO task_runs (task_type, source, schedule_type, schedule_value, last_run, next_run)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(task_type) DO UPDATE SET
+			source = excluded.source,
+			schedule_type = excluded.schedule_type,
+			schedule_value = excluded.schedule_value,
+			last_run = excluded.last_run,
+			next_run = excluded.next_run
+	`, r.TaskType, r.Source, r.ScheduleType, r.ScheduleValue, r.LastRun, r.NextRun)
+	return err
+}
+
+// ListTaskRuns returns the recorded runs of all scheduled tasks.
+func (s *Store) ListTaskRuns(ctx context.Context) ([]TaskRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT task_type, source, schedule_type, schedule_value, last_run, next_run
+		FROM task_runs
+		ORDER BY task_type
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []TaskRun
+	for rows.Next() {
+		var r TaskRun
+		if err := rows.Scan(&r.TaskType, &r.Source, &r.ScheduleType, &r.ScheduleValue, &r.LastRun, &r.NextRun); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// CommandRecord is a remote command the agent received from the cloud and
+// what came of it, kept for auditing.
+type CommandRecord struct {
+	ID        int64           `json:"id"`
+	CommandID string          `json:"command_id"`
+	Type      string          `json:"type"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Success   bool            `json:"success"`
+	Error     string          `json:"error,omitempty"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+// maxCommandHistory is how many command records PruneCommandHistory keeps.
+const maxCommandHistory = 1000
+
+// AddCommandHistory records an executed (or refused) remote command.
+func (s *Store) AddCommandHistory(ctx context.Context, r CommandRecord) error {
+	if r.Timestamp == 0 {
+		r.Timestamp = time.Now().Unix()
+	}
+	_, err := s.exec(ctx, `
+		INSERT INTO command_history (command_id, type, params, success, error, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, r.CommandID, r.Type, string(r.Params), r.Success, r.Error, r.Timestamp)
+	return err
+}
+
+// ListCommandHistory returns up to limit command records, newest first.
+func (s *Store) ListCommandHistory(ctx context.Context, limit int) ([]CommandRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, command_id, type, COALESCE(params, ''), success, COALESCE(error, ''), timestamp
+		FROM command_history ORDER BY timestamp DESC, id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CommandRecord
+	for rows.Next() {
+		var r CommandRecord
+		var params string
+		if err := rows.Scan(&r.ID, &r.CommandID, &r.Type, &params, &r.Success, &r.Error, &r.Timestamp); err != nil {
+			return nil, err
+		}
+		if params != "" {
+			r.Params = json.RawMessage(params)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// PruneCommandHistory keeps the newest maxCommandHistory command records.
+func (s *Store) PruneCommandHistory(ctx context.Context) error {
+	_, err := s.exec(ctx, `
+		DELETE FROM command_history WHERE id NOT IN (
+			SELECT id FROM command_history ORDER BY timestamp DESC, id DESC LIMIT ?
+		)
+	`, maxCommandHistory)
+	return err
+}
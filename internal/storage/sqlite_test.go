@@ -0,0 +1,460 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(t.TempDir()+"/state.db", slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestPruneSnapshotsByCount(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour).Unix()
+	for i := 0; i < 10; i++ {
+		for _, id := range []string{"disk-a", "disk-b"} {
+			if err := store.AddSmartSnapshot(ctx, SmartSnapshot{DiskID: id, HealthStatus: "passed", Reallocated: int64(i), Timestamp: base + int64(i)}); err != nil {
+				t.Fatalf("add snapshot: %v", err)
+			}
+		}
+	}
+
+	if err := store.PruneSnapshotsByCount(ctx, 3); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+
+	for _, id := range []string{"disk-a", "disk-b"} {
+		hist, err := store.SmartHistory(ctx, id, 100)
+		if err != nil {
+			t.Fatalf("history: %v", err)
+		}
+		if len(hist) != 3 {
+			t.Fatalf("%s: expected 3 snapshots, got %d", id, len(hist))
+		}
+		if hist[0].Reallocated != 9 || hist[2].Reallocated != 7 {
+			t.Fatalf("%s: expected newest snapshots kept, got %+v", id, hist)
+		}
+	}
+}
+
+func TestCheckpointTruncatesWAL(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+
+	for i := 0; i < 200; i++ {
+		if err := store.AddSmartSnapshot(ctx, SmartSnapshot{DiskID: "disk-a", HealthStatus: "passed", RawJSON: strings.Repeat("x", 512), Timestamp: int64(i)}); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+	}
+	_, before := store.FileSizes()
+	if before == 0 {
+		t.Fatalf("expected WAL to grow after writes")
+	}
+
+	if err := store.Checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+	_, after := store.FileSizes()
+	if after >= before {
+		t.Fatalf("expected WAL to shrink, before %d after %d", before, after)
+	}
+}
+
+func TestUpsertPoolDevicesAppliesDiff(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	for _, id := range []string{"ata-A", "ata-B", "ata-C"} {
+		if err := store.UpsertDisk(ctx, Disk{ID: id, Name: "/dev/" + id, Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+	}
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{"ata-A", "ata-B"}, "mirror"); err != nil {
+		t.Fatalf("initial mapping: %v", err)
+	}
+
+	// Count row churn from here on.
+	for _, stmt := range []string{
+		`CREATE TABLE churn (op TEXT)`,
+		`CREATE TRIGGER pd_del AFTER DELETE ON zfs_pool_devices BEGIN INSERT INTO churn VALUES ('delete'); END`,
+		`CREATE TRIGGER pd_ins AFTER INSERT ON zfs_pool_devices BEGIN INSERT INTO churn VALUES ('insert'); END`,
+	} {
+		if _, err := store.db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	churn := func() map[string]int {
+		counts := map[string]int{}
+		rows, err := store.db.Query(`SELECT op, COUNT(*) FROM churn GROUP BY op`)
+		if err != nil {
+			t.Fatalf("count churn: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var op string
+			var n int
+			if err := rows.Scan(&op, &n); err != nil {
+				t.Fatal(err)
+			}
+			counts[op] = n
+		}
+		return counts
+	}
+
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{"ata-B", "ata-A"}, "mirror"); err != nil {
+		t.Fatalf("no-op rediscovery: %v", err)
+	}
+	if c := churn(); len(c) != 0 {
+		t.Fatalf("expected no row churn for unchanged mapping, got %v", c)
+	}
+
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{"ata-A", "ata-C"}, "mirror"); err != nil {
+		t.Fatalf("replace device: %v", err)
+	}
+	if c := churn(); c["insert"] != 1 || c["delete"] != 1 {
+		t.Fatalf("expected one insert and one delete, got %v", c)
+	}
+	devices, err := store.GetPoolDevices(ctx, "tank")
+	if err != nil {
+		t.Fatalf("get devices: %v", err)
+	}
+	if strings.Join(devices, ",") != "ata-A,ata-C" && strings.Join(devices, ",") != "ata-C,ata-A" {
+		t.Fatalf("unexpected mapping %v", devices)
+	}
+}
+
+func TestDeleteDiskRemovesRelatedRows(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for _, id := range []string{"ata-GONE", "ata-KEEP"} {
+		if err := store.UpsertDisk(ctx, Disk{ID: id, Name: "/dev/sdx", Type: "hdd"}); err != nil {
+			t.Fatalf("upsert disk: %v", err)
+		}
+		if err := store.AddSmartSnapshot(ctx, SmartSnapshot{DiskID: id, HealthStatus: "passed", Pending: 2, Timestamp: now}); err != nil {
+			t.Fatalf("add snapshot: %v", err)
+		}
+		if err := store.AddNvmeSnapshot(ctx, NvmeSnapshot{DiskID: id, Timestamp: now}); err != nil {
+			t.Fatalf("add nvme snapshot: %v", err)
+		}
+		if err := store.RecordSmartTest(ctx, id, "short"); err != nil {
+			t.Fatalf("record test: %v", err)
+		}
+		if err := store.SetHardwareAck(ctx, HardwareBaseline{DiskID: id, Pending: 2}); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+		if err := store.RecordCollectionMetric(ctx, CollectionMetric{Collector: "smart", DiskID: id, Duration: time.Second}); err != nil {
+			t.Fatalf("metric: %v", err)
+		}
+		if _, err := store.AddAlert(ctx, Alert{Severity: "warning", SourceType: "disk", SourceID: id, Subject: "Pending sectors", Timestamp: now}); err != nil {
+			t.Fatalf("add alert: %v", err)
+		}
+	}
+	if err := store.UpsertPool(ctx, "tank", "ONLINE", 0, 0); err != nil {
+		t.Fatalf("upsert pool: %v", err)
+	}
+	if err := store.UpsertPoolDevices(ctx, "tank", []string{"ata-GONE", "ata-KEEP"}, "mirror"); err != nil {
+		t.Fatalf("upsert pool devices: %v", err)
+	}
+
+	deleted, err := store.DeleteDisk(ctx, "ata-GONE")
+	if err != nil || !deleted {
+		t.Fatalf("delete disk: %v (deleted %v)", err, deleted)
+	}
+
+	for _, table := range append(diskTables, "disks") {
+		column := "disk_id"
+		if table == "disks" {
+			column = "id"
+		}
+		for id, want := range map[string]int{"ata-GONE": 0, "ata-KEEP": 1} {
+			var n int
+			if err := store.db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+column+`=?`, id).Scan(&n); err != nil {
+				t.Fatalf("count %s: %v", table, err)
+			}
+			if n != want {
+				t.Fatalf("%s: expected %d rows for %s, got %d", table, want, id, n)
+			}
+		}
+	}
+
+	alerts, err := store.RecentAlerts(ctx, 10)
+	if err != nil {
+		t.Fatalf("recent alerts: %v", err)
+	}
+	for _, a := range alerts {
+		if resolved := a.ResolvedAt != 0; resolved != (a.SourceID == "ata-GONE") {
+			t.Fatalf("expected only the deleted disk's alert resolved, got %+v", a)
+		}
+	}
+
+	if deleted, err := store.DeleteDisk(ctx, "ata-GONE"); err != nil || deleted {
+		t.Fatalf("expected second delete to report nothing deleted, got %v, %v", deleted, err)
+	}
+}
+
+func TestOpenMigratesOldSchema(t *testing.T) {
+	path := t.TempDir() + "/state.db"
+	// A database as written by an early release: no firmware, SAS or NVMe
+	// namespace columns, and schema_version stuck at 1.
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE meta (key TEXT PRIMARY KEY, value TEXT)`,
+		`INSERT INTO meta(key,value) VALUES ('schema_version','1')`,
+		`CREATE TABLE disks (id TEXT PRIMARY KEY, name TEXT, type TEXT, model TEXT, serial TEXT, size_bytes INTEGER,
+			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP, last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`,
+		`INSERT INTO disks (id, name, type, model, serial, size_bytes) VALUES ('ata-OLD', 'sda', 'hdd', 'M', 'S', 1)`,
+		`CREATE TABLE nvme_snapshots (id INTEGER PRIMARY KEY AUTOINCREMENT, disk_id TEXT, timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			percent_used REAL, media_errors INTEGER, error_log_entries INTEGER, power_on_hours INTEGER, unsafe_shutdowns INTEGER,
+			temperature_c REAL, data_written_bytes INTEGER, data_read_bytes INTEGER, critical_warning_flags TEXT)`,
+	} {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("old schema: %v", err)
+		}
+	}
+	_ = old.Close()
+
+	store, err := Open(path, slog.Default())
+	if err != nil {
+		t.Fatalf("open old database: %v", err)
+	}
+	ctx := context.Background()
+	version, err := store.GetMeta(ctx, "schema_version")
+	if err != nil || version != strconv.Itoa(SchemaVersion) {
+		t.Fatalf("schema_version = %q (%v), want %d", version, err, SchemaVersion)
+	}
+	if err := store.UpsertDisk(ctx, Disk{ID: "ata-OLD", Name: "sda", Type: "hdd", Firmware: "FW2"}); err != nil {
+		t.Fatalf("upsert after migration: %v", err)
+	}
+	if err := store.AddNvmeSnapshot(ctx, NvmeSnapshot{DiskID: "nvme-X", Timestamp: 1, FirmwareSlots: "1:A", NamespaceThin: true}); err != nil {
+		t.Fatalf("add nvme snapshot after migration: %v", err)
+	}
+	_ = store.Close()
+
+	// Reopening is a no-op: every migration is already recorded.
+	store, err = Open(path, slog.Default())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	disk, err := store.GetDisk(ctx, "ata-OLD")
+	if err != nil || disk == nil || disk.Firmware != "FW2" {
+		t.Fatalf("disk after reopen = %+v (%v)", disk, err)
+	}
+
+	if err := store.SetMeta(ctx, "schema_version", strconv.Itoa(SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+	if _, err := Open(path, slog.Default()); err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Fatalf("expected a newer schema to be refused, got %v", err)
+	}
+}
+
+func TestRawOutputStoredCompressed(t *testing.T) {
+	path := t.TempDir() + "/state.db"
+	store, err := Open(path, slog.Default())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	ctx := context.Background()
+	raw := `{"smartctl":{"version":[7,3]},"ata_smart_attributes":{"table":[` + strings.Repeat(`{"id":5,"value":100,"raw":{"value":0}},`, 50) + `{}]}}`
+	if err := store.AddSmartSnapshot(ctx, SmartSnapshot{DiskID: "disk-a", HealthStatus: "passed", RawJSON: raw, Timestamp: 1}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+	var stored []byte
+	if err := store.db.QueryRow(`SELECT raw_json FROM smart_snapshots WHERE disk_id = 'disk-a'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !isPackedRaw(stored) || len(stored) >= len(raw) {
+		t.Fatalf("raw_json stored uncompressed (%d bytes for %d)", len(stored), len(raw))
+	}
+	snap, err := store.LatestSmart(ctx, "disk-a")
+	if err != nil || snap == nil || snap.RawJSON != raw {
+		t.Fatalf("round trip = %+v (%v)", snap, err)
+	}
+
+	// A row written before compression reads back as-is, and the migration
+	// compresses it in place.
+	plain := strings.Repeat("Media and Data Integrity Errors: 0\n", 20)
+	if _, err := store.db.Exec(`INSERT INTO nvme_snapshots (disk_id, timestamp, percent_used, media_errors, error_log_entries,
+		power_on_hours, unsafe_shutdowns, temperature_c, data_written_bytes, data_read_bytes, critical_warning_flags, raw_output)
+		VALUES ('nvme-a', datetime(2,'unixepoch'), 0, 0, 0, 0, 0, 0, 0, 0, '', ?)`, plain); err != nil {
+		t.Fatal(err)
+	}
+	if nvme, err := store.LatestNvme(ctx, "nvme-a"); err != nil || nvme == nil || nvme.RawOutput != plain {
+		t.Fatalf("legacy row = %+v (%v)", nvme, err)
+	}
+	if err := store.SetMeta(ctx, "schema_version", "16"); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+
+	store, err = Open(path, slog.Default())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	if err := store.db.QueryRow(`SELECT raw_output FROM nvme_snapshots WHERE disk_id = 'nvme-a'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !isPackedRaw(stored) {
+		t.Fatalf("migration left raw_output uncompressed")
+	}
+	if nvme, err := store.LatestNvme(ctx, "nvme-a"); err != nil || nvme == nil || nvme.RawOutput != plain {
+		t.Fatalf("migrated row = %+v (%v)", nvme, err)
+	}
+	if snap, err := store.LatestSmart(ctx, "disk-a"); err != nil || snap == nil || snap.RawJSON != raw {
+		t.Fatalf("already compressed row = %+v (%v)", snap, err)
+	}
+}
+
+// countingConnector opens SQLite connections that count the queries run on
+// them.
+type countingConnector struct {
+	dsn     string
+	queries *int
+}
+
+func (c countingConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn, c.queries}, nil
+}
+
+func (c countingConnector) Driver() driver.Driver { return &sqlite.Driver{} }
+
+type countingConn struct {
+	driver.Conn
+	queries *int
+}
+
+func (c countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	*c.queries++
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func TestLatestByDiskSingleQuery(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		for _, id := range []string{"disk-a", "disk-b"} {
+			if err := store.AddSmartSnapshot(ctx, SmartSnapshot{DiskID: id, HealthStatus: "passed", Reallocated: i, Timestamp: i}); err != nil {
+				t.Fatalf("add snapshot: %v", err)
+			}
+		}
+	}
+	if err := store.AddNvmeSnapshot(ctx, NvmeSnapshot{DiskID: "nvme-a", MediaErrors: 4, Timestamp: 1}); err != nil {
+		t.Fatalf("add nvme snapshot: %v", err)
+	}
+
+	var queries int
+	counted := sql.OpenDB(countingConnector{dsn: store.path, queries: &queries})
+	defer counted.Close()
+	batched := &Store{db: counted, path: store.path}
+
+	smart, err := batched.LatestSmartByDisk(ctx, 2)
+	if err != nil {
+		t.Fatalf("latest smart: %v", err)
+	}
+	if queries != 1 {
+		t.Fatalf("expected one query for every disk's SMART snapshots, got %d", queries)
+	}
+	if len(smart) != 2 || len(smart["disk-a"]) != 2 || smart["disk-a"][0].Reallocated != 3 || smart["disk-a"][1].Reallocated != 2 || smart["disk-b"][0].Reallocated != 3 {
+		t.Fatalf("unexpected latest smart %+v", smart)
+	}
+	for id, hist := range smart {
+		one, err := store.LatestSmart(ctx, id)
+		if err != nil || one == nil || one.ID != hist[0].ID {
+			t.Errorf("%s: batched latest %d differs from LatestSmart %+v", id, hist[0].ID, one)
+		}
+	}
+	nvme, err := batched.LatestNvmeByDisk(ctx, 2)
+	if err != nil || len(nvme) != 1 || len(nvme["nvme-a"]) != 1 || nvme["nvme-a"][0].MediaErrors != 4 {
+		t.Fatalf("unexpected latest nvme %+v (%v)", nvme, err)
+	}
+	if queries != 2 {
+		t.Fatalf("expected one query for every disk's NVMe snapshots, got %d in all", queries)
+	}
+}
+
+func TestWriteFailureSwitchesToReadOnly(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	if err := store.UpsertDisk(ctx, Disk{ID: "disk-a", Type: "hdd"}); err != nil {
+		t.Fatalf("upsert disk: %v", err)
+	}
+
+	var raised []Alert
+	store.OnReadOnly(func(a Alert) { raised = append(raised, a) })
+	events, unsubscribe := store.Events().Subscribe()
+	defer unsubscribe()
+
+	// Simulate the filesystem going read-only: with a single connection,
+	// query_only makes every write fail with SQLITE_READONLY.
+	store.db.SetMaxOpenConns(1)
+	if _, err := store.db.Exec(`PRAGMA query_only=ON`); err != nil {
+		t.Fatalf("set query_only: %v", err)
+	}
+
+	if _, err := store.AddAlert(ctx, Alert{Severity: "warning", SourceType: "disk", SourceID: "disk-a", Subject: "x", Timestamp: time.Now().Unix()}); err == nil {
+		t.Fatal("expected write to fail")
+	}
+	if !store.ReadOnly() {
+		t.Fatal("expected store to switch to read-only mode")
+	}
+	if len(raised) != 1 || raised[0].Severity != "critical" || raised[0].SourceType != "system" {
+		t.Fatalf("expected one critical system alert, got %+v", raised)
+	}
+	select {
+	case e := <-events:
+		if a, ok := e.Data.(Alert); !ok || a.Subject != raised[0].Subject {
+			t.Fatalf("expected read-only alert on event stream, got %+v", e)
+		}
+	default:
+		t.Fatal("expected read-only alert on event stream")
+	}
+
+	// Later writes are refused without touching the database.
+	if err := store.SetMeta(ctx, "k", "v"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if len(raised) != 1 {
+		t.Fatalf("expected the alert to be raised once, got %d", len(raised))
+	}
+	if _, ok := store.ReadOnlyAlert(); !ok {
+		t.Fatal("expected ReadOnlyAlert to report the alert")
+	}
+
+	// Reads keep working.
+	disks, err := store.ListDisks(ctx)
+	if err != nil || len(disks) != 1 {
+		t.Fatalf("expected reads to keep working, got %v, %v", disks, err)
+	}
+}
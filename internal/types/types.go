@@ -8,6 +8,16 @@ type Disk struct {
 	Serial    string `json:"serial,omitempty"`
 	Firmware  string `json:"firmware,omitempty"`
 	SizeBytes int64  `json:"size_bytes,omitempty"`
+	LastSeen  int64  `json:"last_seen,omitempty"`
+
+	SmartUnsupported bool   `json:"smart_unsupported,omitempty"`
+	WriteCache       string `json:"write_cache,omitempty"` // enabled | disabled
+
+	RotationRate int64  `json:"rotation_rate,omitempty"` // rpm; 0 for SSDs
+	FormFactor   string `json:"form_factor,omitempty"`
+	ATAVersion   string `json:"ata_version,omitempty"`
+	SATAVersion  string `json:"sata_version,omitempty"`
+	TRIM         string `json:"trim,omitempty"`
 }
 
 type Pool struct {
@@ -24,6 +34,16 @@ type SmartSnapshot struct {
 	CRCErrors          int64   `json:"crc_errors"`
 	TemperatureC       float64 `json:"temperature_c"`
 	PowerOnHours       int64   `json:"power_on_hours"`
+	PowerCycleCount    int64   `json:"power_cycle_count,omitempty"`
+	StartStopCount     int64   `json:"start_stop_count,omitempty"`
+	SASInvalidDwords   int64   `json:"sas_invalid_dwords,omitempty"`
+	SASDisparityErrors int64   `json:"sas_disparity_errors,omitempty"`
+	SASLossOfSync      int64   `json:"sas_loss_of_sync,omitempty"`
+	SASPhyResets       int64   `json:"sas_phy_resets,omitempty"`
+	SCTLifetimeMinC    int64   `json:"sct_lifetime_min_c,omitempty"`
+	SCTLifetimeMaxC    int64   `json:"sct_lifetime_max_c,omitempty"`
+	SCTOverTempCount   int64   `json:"sct_over_temp_count,omitempty"`
+	SCTUnderTempCount  int64   `json:"sct_under_temp_count,omitempty"`
 	TimestampUnixMilli int64   `json:"timestamp"`
 }
 
@@ -38,6 +58,18 @@ type NvmeSnapshot struct {
 	DataWrittenBytes   int64   `json:"data_written_bytes"`
 	DataReadBytes      int64   `json:"data_read_bytes"`
 	TimestampUnixMilli int64   `json:"timestamp"`
+
+	NamespaceCapacityBytes int64 `json:"namespace_capacity_bytes,omitempty"`
+	NamespaceUsedBytes     int64 `json:"namespace_used_bytes,omitempty"`
+
+	FirmwareActiveSlot int64  `json:"firmware_active_slot,omitempty"`
+	FirmwareSlots      string `json:"firmware_slots,omitempty"`
+
+	WarningTempMinutes  int64 `json:"warning_temp_minutes,omitempty"`
+	CriticalTempMinutes int64 `json:"critical_temp_minutes,omitempty"`
+
+	SanitizeStatus   string  `json:"sanitize_status,omitempty"`
+	SanitizeProgress float64 `json:"sanitize_progress,omitempty"`
 }
 
 type PoolStatus struct {
@@ -51,9 +83,11 @@ type DiskHealth struct {
 	ID           string   `json:"id"`
 	Name         string   `json:"name,omitempty"`
 	Type         string   `json:"type,omitempty"`
+	Role         string   `json:"role,omitempty"` // "system" for the disk holding the root filesystem
 	Status       string   `json:"status,omitempty"`
 	HealthScore  int      `json:"health_score,omitempty"`
 	TemperatureC float64  `json:"temperature_c,omitempty"`
+	TemperatureF float64  `json:"temperature_f,omitempty"` // Set by the API when display_units is fahrenheit
 	Issues       []string `json:"issues,omitempty"`
 }
 
@@ -74,11 +108,46 @@ type Alert struct {
 	Subject      string `json:"subject"`
 	Message      string `json:"message"`
 	Acknowledged bool   `json:"acknowledged,omitempty"`
+	Resolves     bool   `json:"resolves,omitempty"` // Recovery for a cleared condition
 }
 
 type HealthReport struct {
-	Status string       `json:"status"`
-	Disks  []DiskHealth `json:"disks"`
-	Pools  []PoolHealth `json:"pools"`
-	Alerts []Alert      `json:"alerts,omitempty"`
+	Status        string       `json:"status"`
+	StatusReasons []string     `json:"status_reasons,omitempty"`
+	Disks         []DiskHealth `json:"disks"`
+	Pools         []PoolHealth `json:"pools"`
+	MDArrays      []PoolHealth `json:"md_arrays,omitempty"` // mdadm software RAID arrays
+	Alerts        []Alert      `json:"alerts,omitempty"`
+
+	System *SystemHealth `json:"system,omitempty"` // latest host sample (storage.system_metrics)
+}
+
+// SystemHealth is the host's load, memory and ZFS ARC state.
+type SystemHealth struct {
+	Timestamp         int64    `json:"timestamp"`
+	Load1             float64  `json:"load1"`
+	Load5             float64  `json:"load5"`
+	Load15            float64  `json:"load15"`
+	MemTotalBytes     int64    `json:"mem_total_bytes"`
+	MemAvailableBytes int64    `json:"mem_available_bytes"`
+	ARCSizeBytes      int64    `json:"arc_size_bytes,omitempty"`
+	ARCTargetBytes    int64    `json:"arc_target_bytes,omitempty"`
+	ARCMinBytes       int64    `json:"arc_min_bytes,omitempty"`
+	ARCMaxBytes       int64    `json:"arc_max_bytes,omitempty"`
+	ARCHitRatio       *float64 `json:"arc_hit_ratio,omitempty"` // lifetime hits/(hits+misses)
+	Issues            []string `json:"issues,omitempty"`
+}
+
+// CollectionResult summarises one on-demand SMART or NVMe collection pass.
+type CollectionResult struct {
+	Collected   int                 `json:"collected"`             // disks with a new snapshot
+	Unsupported int                 `json:"unsupported,omitempty"` // disks without usable SMART
+	Failures    []CollectionFailure `json:"failures,omitempty"`
+	DurationMs  int64               `json:"duration_ms"`
+}
+
+type CollectionFailure struct {
+	DiskID string `json:"disk_id"`
+	Name   string `json:"name,omitempty"`
+	Error  string `json:"error"`
 }
@@ -3,11 +3,16 @@ package uplink
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/metabinary-ltd/storagesentinel/internal/types"
@@ -18,13 +23,29 @@ type Client struct {
 	token    string
 	hostID   string
 	hostname string
+	secret   []byte // HMAC signing key; nil leaves requests unsigned
 	client   *http.Client
+
+	skewMu sync.Mutex
+	skew   time.Duration // server clock minus local clock, from the last Date header
+	skewAt time.Time
 }
 
 type RegisterRequest struct {
-	Hostname    string `json:"hostname"`
-	OSInfo      string `json:"os_info,omitempty"`
-	AgentVersion string `json:"agent_version,omitempty"`
+	Hostname     string     `json:"hostname"`
+	OSInfo       string     `json:"os_info,omitempty"`
+	AgentVersion string     `json:"agent_version,omitempty"`
+	Inventory    *Inventory `json:"inventory,omitempty"`
+}
+
+// Inventory is a compact summary of the host's storage sent at registration
+// so the dashboard can show the host before its first snapshot upload.
+// Pools is capped; PoolCount is always the full count.
+type Inventory struct {
+	DiskCount          int      `json:"disk_count"`
+	TotalCapacityBytes int64    `json:"total_capacity_bytes"`
+	PoolCount          int      `json:"pool_count"`
+	Pools              []string `json:"pools,omitempty"`
 }
 
 type RegisterResponse struct {
@@ -75,17 +96,90 @@ func New(endpoint, token, hostID, hostname string) *Client {
 	}
 }
 
+// SetHTTPClient replaces the default client (30s timeout, proxy from the
+// environment), e.g. with one built from cloud.http.
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
 // SetHostID updates the host ID after registration
 func (c *Client) SetHostID(hostID string) {
 	c.hostID = hostID
 }
 
-// RegisterHost registers this agent with the cloud dashboard
-func (c *Client) RegisterHost(ctx context.Context, osInfo, agentVersion string) (string, error) {
+// SetSigningSecret enables HMAC request signing with the given shared secret.
+// An empty secret disables signing.
+func (c *Client) SetSigningSecret(secret string) {
+	if secret == "" {
+		c.secret = nil
+		return
+	}
+	c.secret = []byte(secret)
+}
+
+// sign adds X-Timestamp and X-Signature headers when a signing secret is
+// configured. The signature is the hex HMAC-SHA256 of
+// method + "\n" + path + "\n" + timestamp + "\n" + body, so the server can
+// reject replays outside its accepted clock window.
+func (c *Client) sign(req *http.Request, body []byte) {
+	if c.secret == nil {
+		return
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Timestamp", ts)
+	req.Header.Set("X-Signature", signature(c.secret, req.Method, req.URL.EscapedPath(), ts, body))
+}
+
+// do sends req and records the clock skew from the response's Date header.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	sent := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.observeDate(resp.Header.Get("Date"), sent, time.Now())
+	return resp, nil
+}
+
+// observeDate compares a server Date header with the local clock at the
+// midpoint of the request. Date only has one-second resolution, which is
+// plenty for spotting a host whose clock is minutes off.
+func (c *Client) observeDate(date string, sent, received time.Time) {
+	server, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	c.skewMu.Lock()
+	c.skew = server.Sub(local).Round(time.Second)
+	c.skewAt = received
+	c.skewMu.Unlock()
+}
+
+// ClockSkew returns how far the cloud's clock was ahead of the local clock
+// (negative when the host is ahead) on the last response carrying a Date
+// header, and when that was. ok is false until such a response is seen.
+func (c *Client) ClockSkew() (skew time.Duration, at time.Time, ok bool) {
+	c.skewMu.Lock()
+	defer c.skewMu.Unlock()
+	return c.skew, c.skewAt, !c.skewAt.IsZero()
+}
+
+func signature(secret []byte, method, path, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RegisterHost registers this agent with the cloud dashboard. inv may be nil
+// when no inventory is available yet.
+func (c *Client) RegisterHost(ctx context.Context, osInfo, agentVersion string, inv *Inventory) (string, error) {
 	payload := RegisterRequest{
 		Hostname:     c.hostname,
 		OSInfo:       osInfo,
 		AgentVersion: agentVersion,
+		Inventory:    inv,
 	}
 	
 	body, err := json.Marshal(payload)
@@ -101,8 +195,9 @@ func (c *Client) RegisterHost(ctx context.Context, osInfo, agentVersion string)
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
+	c.sign(req, body)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", fmt.Errorf("send request: %w", err)
 	}
@@ -146,8 +241,9 @@ func (c *Client) PollCommands(ctx context.Context) ([]Command, error) {
 	if c.hostID != "" {
 		req.Header.Set("X-Host-ID", c.hostID)
 	}
+	c.sign(req, nil)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("send request: %w", err)
 	}
@@ -197,8 +293,9 @@ func (c *Client) AcknowledgeCommand(ctx context.Context, commandID string, succe
 	if c.hostID != "" {
 		req.Header.Set("X-Host-ID", c.hostID)
 	}
+	c.sign(req, body)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("send request: %w", err)
 	}
@@ -225,8 +322,9 @@ func (c *Client) PollSchedules(ctx context.Context) ([]Schedule, error) {
 	if c.hostID != "" {
 		req.Header.Set("X-Host-ID", c.hostID)
 	}
+	c.sign(req, nil)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("send request: %w", err)
 	}
@@ -282,8 +380,9 @@ func (c *Client) sendWithRetry(ctx context.Context, path string, payload interfa
 		if c.hostID != "" {
 			req.Header.Set("X-Host-ID", c.hostID)
 		}
+		c.sign(req, body)
 
-		resp, err := c.client.Do(req)
+		resp, err := c.do(req)
 		if err != nil {
 			lastErr = fmt.Errorf("send request: %w", err)
 			continue
@@ -0,0 +1,78 @@
+package uplink
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/metabinary-ltd/storagesentinel/internal/types"
+)
+
+func TestSignatureKnownVector(t *testing.T) {
+	got := signature([]byte("topsecret"), http.MethodPost, "/api/v1/agent/ingest", "1700000000", []byte(`{"status":"ok"}`))
+	want := "8c1f668a58de1cf6050077cb5bd3866075d5fc1f4922a3e7d09f68e47a34f6fd"
+	if got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	var gotTS, gotSig, gotPath string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTS = r.Header.Get("X-Timestamp")
+		gotSig = r.Header.Get("X-Signature")
+		gotPath = r.URL.Path
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "token", "host-1", "nas")
+	if err := c.SendSummary(context.Background(), types.HealthReport{Status: "ok"}); err != nil {
+		t.Fatalf("send unsigned: %v", err)
+	}
+	if gotTS != "" || gotSig != "" {
+		t.Fatalf("expected no signature headers without a secret, got %q %q", gotTS, gotSig)
+	}
+
+	c.SetSigningSecret("topsecret")
+	if err := c.SendSummary(context.Background(), types.HealthReport{Status: "ok"}); err != nil {
+		t.Fatalf("send signed: %v", err)
+	}
+	ts, err := strconv.ParseInt(gotTS, 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)).Abs() > time.Minute {
+		t.Fatalf("unexpected X-Timestamp %q", gotTS)
+	}
+	if want := signature([]byte("topsecret"), http.MethodPost, gotPath, gotTS, gotBody); gotSig != want {
+		t.Fatalf("X-Signature = %s, want %s", gotSig, want)
+	}
+}
+
+func TestClockSkewFromDateHeader(t *testing.T) {
+	ahead := 10 * time.Minute
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(ahead).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "token", "host-1", "nas")
+	if _, _, ok := c.ClockSkew(); ok {
+		t.Fatal("expected no skew before any response")
+	}
+	if err := c.SendSummary(context.Background(), types.HealthReport{Status: "ok"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	skew, at, ok := c.ClockSkew()
+	if !ok || time.Since(at) > time.Minute {
+		t.Fatalf("expected a fresh skew reading, got ok=%v at=%v", ok, at)
+	}
+	if (skew - ahead).Abs() > 2*time.Second {
+		t.Fatalf("expected skew of about %v, got %v", ahead, skew)
+	}
+}